@@ -0,0 +1,53 @@
+package chat
+
+// Roles used in chat completion messages
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message is a single role-tagged entry of a chat conversation
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Options holds per-request generation settings, zero values fall back to the client defaults
+type Options struct {
+	MaxTokens   int
+	Temperature *float64 // nil for the client default, so that 0 can be requested
+}
+
+// Temperature returns a pointer to the temperature, for Options.Temperature
+func Temperature(value float64) *float64 {
+	return &value
+}
+
+// TemperatureOr returns the requested temperature, or the default when none is set
+func (o Options) TemperatureOr(defaultTemperature float64) float64 {
+	if o.Temperature == nil {
+		return defaultTemperature
+	}
+	return *o.Temperature
+}
+
+// CompletionResponse is the body of an OpenAI compatible chat completion response
+type CompletionResponse struct {
+	Choices []struct {
+		Message Message `json:"message"`
+	} `json:"choices"`
+}
+
+// Text returns the message content of the first choice, false when the response has no choices
+func (r CompletionResponse) Text() (string, bool) {
+	if len(r.Choices) == 0 {
+		return "", false
+	}
+	return r.Choices[0].Message.Content, true
+}
+
+// UserMessage wraps a plain prompt into a single user message
+func UserMessage(prompt string) []Message {
+	return []Message{{Role: RoleUser, Content: prompt}}
+}
@@ -0,0 +1,57 @@
+package chat
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// TokenHandler is called with every incremental piece of text received from a streaming completion
+type TokenHandler func(token string) error
+
+// ReadStream parses an OpenAI compatible server-sent event stream ("data: {...}" lines ending with "data: [DONE]"),
+// passes each content delta to onToken and returns the full text.
+func ReadStream(body io.Reader, onToken TokenHandler) (string, error) {
+	var fullText strings.Builder
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue // Skip blank lines, comments and other SSE fields
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var event struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fullText.String(), fmt.Errorf("error parsing stream event: %v", err)
+		}
+		if len(event.Choices) == 0 || event.Choices[0].Delta.Content == "" {
+			continue
+		}
+
+		token := event.Choices[0].Delta.Content
+		fullText.WriteString(token)
+		if err := onToken(token); err != nil {
+			return fullText.String(), err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fullText.String(), fmt.Errorf("error reading stream: %v", err)
+	}
+	return fullText.String(), nil
+}
@@ -1,6 +1,7 @@
 package huggingface
 
 import (
+	"crossplatform_chatbot/ai_clients/chat"
 	config "crossplatform_chatbot/configs"
 	"encoding/json"
 	"errors"
@@ -29,10 +30,24 @@ func NewClient() *Client {
 	}
 }
 
-// GetResponse sends a request to the Hugging Face Inference API and retrieves the response
-func (c *Client) GetResponse(prompt string) (string, error) {
+// Describe returns the provider and model name
+func (c *Client) Describe() string {
+	return "Hugging Face " + c.Model
+}
+
+// ChatCompletion sends the chat messages to the Hugging Face Inference API (chat completion route) and retrieves the response
+func (c *Client) ChatCompletion(messages []chat.Message, opts chat.Options) (string, error) {
+	maxTokens := 512
+	if opts.MaxTokens > 0 {
+		maxTokens = opts.MaxTokens
+	}
+	temperature := opts.TemperatureOr(0.7)
+
 	request := map[string]interface{}{
-		"inputs": prompt,
+		"model":       c.Model,
+		"messages":    messages,
+		"max_tokens":  maxTokens,
+		"temperature": temperature,
 	}
 
 	// Send the request to Hugging Face API
@@ -40,7 +55,7 @@ func (c *Client) GetResponse(prompt string) (string, error) {
 		SetHeader("Authorization", "Bearer "+c.ApiKey).
 		SetHeader("Content-Type", "application/json").
 		SetBody(request).
-		Post(fmt.Sprintf("https://api-inference.huggingface.co/models/%s", c.Model))
+		Post(fmt.Sprintf("https://api-inference.huggingface.co/models/%s/v1/chat/completions", c.Model))
 
 	if err != nil {
 		return "", fmt.Errorf("error sending request to Hugging Face: %v", err)
@@ -50,18 +65,14 @@ func (c *Client) GetResponse(prompt string) (string, error) {
 		return "", fmt.Errorf("error: HuggingFace API returned status code %d: %s", response.StatusCode(), response.String())
 	}
 
-	var result []map[string]interface{}
+	var result chat.CompletionResponse
 	if err := json.Unmarshal(response.Body(), &result); err != nil {
 		return "", fmt.Errorf("error parsing response from Hugging Face: %v", err)
 	}
 
-	if len(result) == 0 {
-		return "", errors.New("no response from Hugging Face")
-	}
-
-	text, ok := result[0]["generated_text"].(string)
+	text, ok := result.Text()
 	if !ok {
-		return "", errors.New("invalid response format from Hugging Face")
+		return "", errors.New("no response from Hugging Face")
 	}
 
 	return cleanResponseText(text), nil
@@ -1,10 +1,12 @@
 package mistral
 
 import (
+	"crossplatform_chatbot/ai_clients/chat"
 	config "crossplatform_chatbot/configs"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/go-resty/resty/v2"
@@ -30,14 +32,14 @@ func NewClient() *Client {
 	}
 }
 
-// GetResponse sends a request to Mistral AI API and retrieves the response
-func (c *Client) GetResponse(prompt string) (string, error) {
-	request := map[string]interface{}{
-		"model":       c.Model, // Mistral model name
-		"messages":    []map[string]string{{"role": "user", "content": prompt}},
-		"max_tokens":  512,
-		"temperature": 0.7,
-	}
+// Describe returns the provider and model name
+func (c *Client) Describe() string {
+	return "Mistral AI " + c.Model
+}
+
+// ChatCompletion sends the chat messages to Mistral AI API and retrieves the response
+func (c *Client) ChatCompletion(messages []chat.Message, opts chat.Options) (string, error) {
+	request := c.buildChatRequest(messages, opts)
 
 	// Send request to Mistral API
 	response, err := c.Client.R().
@@ -54,19 +56,14 @@ func (c *Client) GetResponse(prompt string) (string, error) {
 		return "", fmt.Errorf("error: Mistral API returned status code %d: %s", response.StatusCode(), response.String())
 	}
 
-	var result map[string]interface{}
+	var result chat.CompletionResponse
 	if err := json.Unmarshal(response.Body(), &result); err != nil {
 		return "", fmt.Errorf("error parsing response from Mistral: %v", err)
 	}
 
-	choices, ok := result["choices"].([]interface{})
-	if !ok || len(choices) == 0 {
-		return "", errors.New("no response from Mistral")
-	}
-
-	text, ok := choices[0].(map[string]interface{})["message"].(map[string]interface{})["content"].(string)
+	text, ok := result.Text()
 	if !ok {
-		return "", errors.New("invalid response format from Mistral")
+		return "", errors.New("no response from Mistral")
 	}
 
 	// Clean up the response to remove unnecessary prefixes
@@ -75,6 +72,56 @@ func (c *Client) GetResponse(prompt string) (string, error) {
 	return cleanedText, nil
 }
 
+// buildChatRequest builds the chat completion request body, applying the client defaults for unset options
+func (c *Client) buildChatRequest(messages []chat.Message, opts chat.Options) map[string]interface{} {
+	maxTokens := 512
+	if opts.MaxTokens > 0 {
+		maxTokens = opts.MaxTokens
+	}
+	temperature := opts.TemperatureOr(0.7)
+
+	return map[string]interface{}{
+		"model":       c.Model, // Mistral model name
+		"messages":    messages,
+		"max_tokens":  maxTokens,
+		"temperature": temperature,
+	}
+}
+
+// ChatCompletionStream sends the chat messages with streaming enabled, passing each token to onToken as it arrives.
+// Returns the full response text once the stream ends.
+func (c *Client) ChatCompletionStream(messages []chat.Message, opts chat.Options, onToken chat.TokenHandler) (string, error) {
+	request := c.buildChatRequest(messages, opts)
+	request["stream"] = true
+
+	// Keep the response body open to read the event stream
+	response, err := c.Client.R().
+		SetHeader("Authorization", "Bearer "+c.ApiKey).
+		SetHeader("Content-Type", "application/json").
+		SetHeader("Accept", "text/event-stream").
+		SetBody(request).
+		SetDoNotParseResponse(true).
+		Post("https://api.mistral.ai/v1/chat/completions")
+
+	if err != nil {
+		return "", fmt.Errorf("error sending request to Mistral: %v", err)
+	}
+	body := response.RawBody()
+	defer body.Close()
+
+	if response.StatusCode() != 200 {
+		errBody, _ := io.ReadAll(body)
+		return "", fmt.Errorf("error: Mistral API returned status code %d: %s", response.StatusCode(), string(errBody))
+	}
+
+	text, err := chat.ReadStream(body, onToken)
+	if err != nil {
+		return "", fmt.Errorf("error streaming response from Mistral: %v", err)
+	}
+
+	return cleanResponseText(text), nil
+}
+
 // cleanResponseText trims unwanted prefixes from the text
 func cleanResponseText(text string) string {
 	lowerText := strings.ToLower(text)
@@ -3,29 +3,40 @@ package openai
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/pkoukk/tiktoken-go"
 )
 
-// Prompt based tag generation using OpenAI API
-func (c *Client) AutoTagWithOpenAI(docText string) ([]string, error) {
+// Prompt based tag generation using OpenAI API, choosing among the tags of the taxonomy (descriptions by tag name)
+func (c *Client) AutoTagWithOpenAI(docText string, tagDescriptions map[string]string) ([]string, error) {
 	// Define the prompt for tag generation
 	//prompt := fmt.Sprintf("Suggest relevant tags for the following content: %s", docText)
 
-	// Define predefined tags
-	predefinedTags := []string{"Account & Billing", "Order Status & Tracking", "Shipping & Returns", "Technical Troubleshooting", "Installation & Setup",
-		"Product Information", "User Guide & How-To", "Software Updates & Maintenance", "Security & Privacy", "Feedback & Contact Support"}
-
-	// Prepare the full predefined tags as part of the prompt
-	tagList := strings.Join(predefinedTags, ", ")
+	// List the tags of the taxonomy, with their descriptions to guide the choice
+	names := make([]string, 0, len(tagDescriptions))
+	for name := range tagDescriptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := make([]string, len(names))
+	for i, name := range names {
+		lines[i] = "- " + name
+		if description := tagDescriptions[name]; description != "" {
+			lines[i] += ": " + description
+		}
+	}
+	tagList := strings.Join(lines, "\n")
 	reminder := "Reminder: DO NOT include any additional undefined tags. Provide ONLY tags from the list."
 
 	// Construct the base prompt
 	/*prompt := fmt.Sprintf("From specifically the following tags: [ %s ], provide a comma-separated list of most relevant tags (only tags, no explanations, DO NOT use undefined tags) for the following content: %s. Reminder: Provide only tags, no explanations, DO NOT use undefined tags",
 	tagList, docText)*/
-	basePrompt := fmt.Sprintf(`From specifically the following tags: [ %s ], 
-	provide a comma-separated list of most relevant tags (only tags, no explanations, DO NOT use undefined tags) for the following content: %s.
+	basePrompt := fmt.Sprintf(`From specifically the following tags:
+%s
+
+provide a comma-separated list of most relevant tag names (only tag names, no descriptions or explanations, DO NOT use undefined tags) for the following content: %s.
 	
 	%s`, tagList, docText, reminder)
 
@@ -95,7 +106,11 @@ func (c *Client) AutoTagWithOpenAI(docText string) ([]string, error) {
 		return nil, fmt.Errorf("error: missing 'choices' in API response")
 	}
 
-	text, ok := choices[0].(map[string]interface{})["text"].(string)
+	choice, ok := choices[0].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("error: invalid 'choices' in API response")
+	}
+	text, ok := choice["text"].(string)
 	if !ok {
 		return nil, fmt.Errorf("error: 'text' not found in choices response")
 	}
@@ -108,14 +123,3 @@ func (c *Client) AutoTagWithOpenAI(docText string) ([]string, error) {
 
 	return tags, nil
 }
-
-// Generate tags using embeddings
-// func (c *Client) AutoTagWithEmbeddings(docEmbedding []float64, tagEmbeddings map[string][]float64) []string {
-// 	var tags []string
-// 	for tag, embedding := range tagEmbeddings {
-// 		if utils.CosineSimilarity(docEmbedding, embedding) > 0.7 {
-// 			tags = append(tags, tag)
-// 		}
-// 	}
-// 	return tags
-// }
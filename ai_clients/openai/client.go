@@ -1,10 +1,12 @@
 package openai
 
 import (
+	"crossplatform_chatbot/ai_clients/chat"
 	config "crossplatform_chatbot/configs"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/go-resty/resty/v2"
@@ -19,6 +21,11 @@ type Client struct {
 	MsgTokenSize int
 	TagTokenSize int
 	Client       *resty.Client
+
+	EmbBatchSize   int // Maximum number of texts per embeddings request
+	EmbBatchTokens int // Maximum estimated tokens per embeddings request
+	EmbConcurrency int // Maximum number of embeddings requests in flight
+	EmbMaxRetries  int // Retries of rate-limited or failed embeddings requests
 }
 
 // Function to create a new OpenAI client
@@ -34,17 +41,22 @@ func NewClient() *Client {
 		MsgTokenSize: conf.MaxTokens,
 		TagTokenSize: conf.MaxTagTokens,
 		Client:       client,
+
+		EmbBatchSize:   conf.EmbeddingBatchSize,
+		EmbBatchTokens: conf.EmbeddingBatchTokens,
+		EmbConcurrency: conf.EmbeddingConcurrency,
+		EmbMaxRetries:  conf.EmbeddingMaxRetries,
 	}
 }
 
-// Function to get a response from the OpenAI API
-func (c *Client) GetResponse(prompt string) (string, error) {
-	request := map[string]interface{}{
-		"model":       c.MsgModel,                                               // Specify model type (gpt-3.5-turbo, gpt-4o-mini, chatgpt-4o, gpt-4)
-		"messages":    []map[string]string{{"role": "user", "content": prompt}}, // Adjusted for chat models
-		"max_tokens":  c.MsgTokenSize,
-		"temperature": 0.7,
-	}
+// Describe returns the provider and model name
+func (c *Client) Describe() string {
+	return "OpenAI " + c.MsgModel
+}
+
+// ChatCompletion sends the chat messages to the OpenAI API and returns the response
+func (c *Client) ChatCompletion(messages []chat.Message, opts chat.Options) (string, error) {
+	request := c.buildChatRequest(messages, opts)
 
 	// Send the request to OpenAI API (chat completion endpoint)
 	response, err := c.Client.R().
@@ -61,19 +73,14 @@ func (c *Client) GetResponse(prompt string) (string, error) {
 		return "", fmt.Errorf("OpenAI API returned status code %d: %s", response.StatusCode(), response.String())
 	}
 
-	var result map[string]interface{}
+	var result chat.CompletionResponse
 	if err := json.Unmarshal(response.Body(), &result); err != nil {
 		return "", fmt.Errorf("error parsing response from OpenAI: %v", err)
 	}
 
-	choices, ok := result["choices"].([]interface{})
-	if !ok || len(choices) == 0 {
-		return "", errors.New("no response from OpenAI")
-	}
-
-	text, ok := choices[0].(map[string]interface{})["message"].(map[string]interface{})["content"].(string)
+	text, ok := result.Text()
 	if !ok {
-		return "", errors.New("invalid response format from OpenAI")
+		return "", errors.New("no response from OpenAI")
 	}
 
 	// Clean up the response to trim prefixes like "Assistant:" or "assistant:"
@@ -82,6 +89,56 @@ func (c *Client) GetResponse(prompt string) (string, error) {
 	return cleanedText, nil
 }
 
+// buildChatRequest builds the chat completion request body, applying the client defaults for unset options
+func (c *Client) buildChatRequest(messages []chat.Message, opts chat.Options) map[string]interface{} {
+	maxTokens := c.MsgTokenSize
+	if opts.MaxTokens > 0 {
+		maxTokens = opts.MaxTokens
+	}
+	temperature := opts.TemperatureOr(0.7)
+
+	return map[string]interface{}{
+		"model":       c.MsgModel, // Specify model type (gpt-3.5-turbo, gpt-4o-mini, chatgpt-4o, gpt-4)
+		"messages":    messages,
+		"max_tokens":  maxTokens,
+		"temperature": temperature,
+	}
+}
+
+// ChatCompletionStream sends the chat messages with streaming enabled, passing each token to onToken as it arrives.
+// Returns the full response text once the stream ends.
+func (c *Client) ChatCompletionStream(messages []chat.Message, opts chat.Options, onToken chat.TokenHandler) (string, error) {
+	request := c.buildChatRequest(messages, opts)
+	request["stream"] = true
+
+	// Keep the response body open to read the event stream
+	response, err := c.Client.R().
+		SetHeader("Authorization", "Bearer "+c.ApiKey).
+		SetHeader("Content-Type", "application/json").
+		SetHeader("Accept", "text/event-stream").
+		SetBody(request).
+		SetDoNotParseResponse(true).
+		Post("https://api.openai.com/v1/chat/completions")
+
+	if err != nil {
+		return "", fmt.Errorf("error sending request to OpenAI: %v", err)
+	}
+	body := response.RawBody()
+	defer body.Close()
+
+	if response.StatusCode() != 200 {
+		errBody, _ := io.ReadAll(body)
+		return "", fmt.Errorf("OpenAI API returned status code %d: %s", response.StatusCode(), string(errBody))
+	}
+
+	text, err := chat.ReadStream(body, onToken)
+	if err != nil {
+		return "", fmt.Errorf("error streaming response from OpenAI: %v", err)
+	}
+
+	return cleanResponseText(text), nil
+}
+
 // cleanResponseText trims unwanted prefixes like "Assistant:" or "assistant:" from the text
 func cleanResponseText(text string) string {
 	// Normalize the text to lowercase for comparison
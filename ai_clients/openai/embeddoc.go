@@ -3,94 +3,201 @@ package openai
 import (
 	"encoding/json"
 	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Limits of the embeddings endpoint (at most 2048 inputs and 300k tokens per request)
+const (
+	maxBatchInputs = 2048
+	maxBatchTokens = 300000
+	maxBackoff     = 60 * time.Second
 )
 
 // EmbedText converts text to an embedding vector using OpenAI's embedding model
 func (c *Client) EmbedText(text string) ([]float64, error) {
-	//fmt.Println("Starting document embedding process...")
-
-	//client := NewClient() // Create a new OpenAI client
-	request := map[string]interface{}{
-		"model": c.EmbModel,
-		"input": text,
+	embeddings, err := c.embedBatch([]string{text})
+	if err != nil {
+		return nil, err
 	}
+	return embeddings[0], nil
+}
 
-	response, err := c.Client.R().
-		SetHeader("Authorization", "Bearer "+c.ApiKey).
-		SetHeader("Content-Type", "application/json").
-		SetBody(request).
-		Post("https://api.openai.com/v1/embeddings") // move to env?
+// EmbedTexts converts many texts to embedding vectors, returned in input order.
+// The texts are split into batches limited by EmbBatchSize inputs and EmbBatchTokens estimated tokens,
+// and up to EmbConcurrency batches are sent in parallel. onProgress (optional) is called with the
+// number of embedded texts after each batch.
+func (c *Client) EmbedTexts(texts []string, onProgress func(done, total int)) ([][]float64, error) {
+	embeddings := make([][]float64, len(texts))
+	batches := c.splitBatches(texts)
+
+	concurrency := c.EmbConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	semaphore := make(chan struct{}, concurrency)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		done     int
+	)
+	for _, batch := range batches {
+		semaphore <- struct{}{}
+
+		// Stop starting new batches after a failure
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			<-semaphore
+			break
+		}
+
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			result, err := c.embedBatch(texts[start:end])
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("error embedding texts %d-%d: %w", start, end-1, err)
+				}
+				return
+			}
+			copy(embeddings[start:end], result)
+			done += end - start
+			if onProgress != nil {
+				onProgress(done, len(texts))
+			}
+		}(batch[0], batch[1])
+	}
+	wg.Wait()
 
-	if err != nil {
-		return nil, fmt.Errorf("error embedding document: %v", err)
+	if firstErr != nil {
+		return nil, firstErr
 	}
+	return embeddings, nil
+}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(response.Body(), &result); err != nil {
-		return nil, fmt.Errorf("error parsing response: %v", err)
+// splitBatches returns the [start, end) ranges of the batches sent to the API
+func (c *Client) splitBatches(texts []string) [][2]int {
+	batchSize := c.EmbBatchSize
+	if batchSize < 1 || batchSize > maxBatchInputs {
+		batchSize = maxBatchInputs
+	}
+	tokenBudget := c.EmbBatchTokens
+	if tokenBudget < 1 || tokenBudget > maxBatchTokens {
+		tokenBudget = maxBatchTokens
 	}
 
-	//data := result["data"].([]interface{})
-	// Check if "data" exists in the response and is not nil
-	data, ok := result["data"].([]interface{})
-	if !ok || data == nil || len(data) == 0 {
-		fmt.Printf("Full API response: %+v\n", result) // Log the entire response
-		return nil, fmt.Errorf("error: missing or invalid 'data' in API response")
+	var batches [][2]int
+	start, tokens := 0, 0
+	for i, text := range texts {
+		textTokens := estimateTokens(text)
+		if i > start && (i-start >= batchSize || tokens+textTokens > tokenBudget) {
+			batches = append(batches, [2]int{start, i})
+			start, tokens = i, 0
+		}
+		tokens += textTokens
+	}
+	if start < len(texts) {
+		batches = append(batches, [2]int{start, len(texts)})
 	}
-	embedding := data[0].(map[string]interface{})["embedding"].([]interface{})
+	return batches
+}
+
+// estimateTokens approximates the token count of the text (about 4 characters per token for English)
+func estimateTokens(text string) int {
+	return utf8.RuneCountInString(text)/4 + 1
+}
 
-	//fmt.Println("Converting embedding to []float64...")
-	embeddingFloat := make([]float64, len(embedding))
-	for i, v := range embedding {
-		embeddingFloat[i] = v.(float64)
+// embeddingResponse is the response body of the embeddings endpoint
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+}
+
+// embedBatch sends one embeddings request, retrying rate-limited (429) and server errors with backoff
+func (c *Client) embedBatch(texts []string) ([][]float64, error) {
+	request := map[string]interface{}{
+		"model": c.EmbModel,
+		"input": texts,
 	}
 
-	//fmt.Println("Document embedding complete.")
-	return embeddingFloat, nil
+	for attempt := 0; ; attempt++ {
+		response, err := c.Client.R().
+			SetHeader("Authorization", "Bearer "+c.ApiKey).
+			SetHeader("Content-Type", "application/json").
+			SetBody(request).
+			Post("https://api.openai.com/v1/embeddings") // move to env?
+
+		if err != nil {
+			return nil, fmt.Errorf("error embedding document: %v", err)
+		}
+
+		status := response.StatusCode()
+		if status == http.StatusTooManyRequests || status >= 500 {
+			if attempt >= c.EmbMaxRetries {
+				return nil, fmt.Errorf("OpenAI API returned status code %d after %d retries: %s", status, attempt, response.String())
+			}
+			wait := retryDelay(response.Header().Get("Retry-After"), attempt)
+			fmt.Printf("Embedding request returned status %d, retrying in %s\n", status, wait)
+			time.Sleep(wait)
+			continue
+		}
+		if status != http.StatusOK {
+			return nil, fmt.Errorf("OpenAI API returned status code %d: %s", status, response.String())
+		}
+
+		var result embeddingResponse
+		if err := json.Unmarshal(response.Body(), &result); err != nil {
+			return nil, fmt.Errorf("error parsing response: %v", err)
+		}
+		if len(result.Data) != len(texts) {
+			return nil, fmt.Errorf("error: expected %d embeddings in API response, got %d", len(texts), len(result.Data))
+		}
+
+		// The API returns the embeddings with the index of their input
+		sort.Slice(result.Data, func(i, j int) bool {
+			return result.Data[i].Index < result.Data[j].Index
+		})
+		embeddings := make([][]float64, len(result.Data))
+		for i, item := range result.Data {
+			embeddings[i] = item.Embedding
+		}
+		return embeddings, nil
+	}
 }
 
-// EmbedSentencesBatch sends multiple sentences in a single request and gets embeddings for all of them (discarded)
-// func EmbedSentencesBatch(sentences []string) ([][]float64, error) {
-// 	client := NewClient()
-// 	request := map[string]interface{}{
-// 		"model": "text-embedding-ada-002",
-// 		"input": sentences, // Send all sentences in one request
-// 	}
-
-// 	response, err := client.Client.R().
-// 		SetHeader("Authorization", "Bearer "+client.ApiKey).
-// 		SetHeader("Content-Type", "application/json").
-// 		SetBody(request).
-// 		Post("https://api.openai.com/v1/embeddings")
-
-// 	if err != nil {
-// 		return nil, fmt.Errorf("error embedding sentences: %v", err)
-// 	}
-
-// 	var result map[string]interface{}
-// 	if err := json.Unmarshal(response.Body(), &result); err != nil {
-// 		return nil, fmt.Errorf("error parsing response: %v", err)
-// 	}
-
-// 	// Check for the "data" field in the response
-// 	data, ok := result["data"].([]interface{})
-// 	if !ok || data == nil {
-// 		return nil, fmt.Errorf("error: missing or invalid 'data' in API response")
-// 	}
-
-// 	// Process embeddings for each sentence
-// 	embeddings := make([][]float64, len(data))
-// 	for i, item := range data {
-// 		embedding, ok := item.(map[string]interface{})["embedding"].([]interface{})
-// 		if !ok {
-// 			return nil, fmt.Errorf("error: missing 'embedding' field for sentence %d", i)
-// 		}
-// 		embeddingFloat := make([]float64, len(embedding))
-// 		for j, v := range embedding {
-// 			embeddingFloat[j] = v.(float64)
-// 		}
-// 		embeddings[i] = embeddingFloat
-// 	}
-
-// 	return embeddings, nil
-// }
+// retryDelay returns the wait before the next attempt: the Retry-After header (seconds or HTTP date)
+// if present, otherwise exponential backoff from one second with jitter.
+func retryDelay(retryAfter string, attempt int) time.Duration {
+	if seconds, err := strconv.ParseFloat(retryAfter, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(retryAfter); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+		return 0
+	}
+
+	backoff := time.Second << attempt
+	if backoff > maxBackoff || backoff <= 0 {
+		backoff = maxBackoff
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
@@ -0,0 +1,63 @@
+package ai_clients
+
+import (
+	"crossplatform_chatbot/ai_clients/chat"
+	"sort"
+	"sync"
+)
+
+// ChatProvider defines the common interface for all chat completion models
+type ChatProvider interface {
+	// ChatCompletion sends the role-tagged messages to the model and returns the reply text
+	ChatCompletion(messages []chat.Message, opts chat.Options) (string, error)
+	// Describe returns a human readable name of the provider and model (e.g. "OpenAI gpt-4")
+	Describe() string
+}
+
+// StreamingChatProvider is implemented by providers that can stream the completion token by token
+type StreamingChatProvider interface {
+	ChatProvider
+	// ChatCompletionStream passes each token to onToken as it arrives and returns the full reply text
+	ChatCompletionStream(messages []chat.Message, opts chat.Options, onToken chat.TokenHandler) (string, error)
+}
+
+// Registry holds the chat providers keyed by name (the name is also used as the bot command, e.g. /openai)
+type Registry struct {
+	mu        sync.RWMutex
+	providers map[string]ChatProvider
+}
+
+// NewRegistry creates an empty provider registry
+func NewRegistry() *Registry {
+	return &Registry{
+		providers: make(map[string]ChatProvider),
+	}
+}
+
+// Register adds a provider under the given name, replacing any existing one
+func (r *Registry) Register(name string, provider ChatProvider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[name] = provider
+}
+
+// Get returns the provider registered under the given name
+func (r *Registry) Get(name string) (ChatProvider, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	provider, ok := r.providers[name]
+	return provider, ok
+}
+
+// Names returns the registered provider names in alphabetical order
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
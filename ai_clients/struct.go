@@ -7,10 +7,30 @@ import (
 	"crossplatform_chatbot/ai_clients/togetherai"
 )
 
-// AIClient defines a common interface for all AI services
+// AIClients holds the initialized AI clients and the registry of chat providers
 type AIClients struct {
-	OpenAI      *openai.Client
+	OpenAI      *openai.Client // Also used for embeddings and auto-tagging
 	HuggingFace *huggingface.Client
 	Mistral     *mistral.Client
 	TogetherAI  *togetherai.Client
+	Providers   *Registry
+}
+
+// NewAIClients initializes all AI clients and registers them as chat providers.
+// Adding a new model only requires a client implementing ChatProvider and a Register call here.
+func NewAIClients() AIClients {
+	clients := AIClients{
+		OpenAI:      openai.NewClient(),
+		HuggingFace: huggingface.NewClient(),
+		Mistral:     mistral.NewClient(),
+		TogetherAI:  togetherai.NewClient(),
+		Providers:   NewRegistry(),
+	}
+
+	clients.Providers.Register("openai", clients.OpenAI)
+	clients.Providers.Register("mistral", clients.Mistral)
+	clients.Providers.Register("meta", clients.TogetherAI) // META Llama models served by Together AI
+	clients.Providers.Register("huggingface", clients.HuggingFace)
+
+	return clients
 }
@@ -1,10 +1,12 @@
 package togetherai
 
 import (
+	"crossplatform_chatbot/ai_clients/chat"
 	config "crossplatform_chatbot/configs"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/go-resty/resty/v2"
@@ -30,14 +32,14 @@ func NewClient() *Client {
 	}
 }
 
-// GetResponse sends a request to Together AI API and retrieves the response
-func (c *Client) GetResponse(prompt string) (string, error) {
-	request := map[string]interface{}{
-		"model":       c.Model,
-		"messages":    []map[string]string{{"role": "user", "content": prompt}},
-		"max_tokens":  512,
-		"temperature": 0.7,
-	}
+// Describe returns the provider and model name
+func (c *Client) Describe() string {
+	return "Together AI " + c.Model
+}
+
+// ChatCompletion sends the chat messages to Together AI API and retrieves the response
+func (c *Client) ChatCompletion(messages []chat.Message, opts chat.Options) (string, error) {
+	request := c.buildChatRequest(messages, opts)
 
 	response, err := c.Client.R().
 		SetHeader("Authorization", "Bearer "+c.ApiKey).
@@ -53,19 +55,64 @@ func (c *Client) GetResponse(prompt string) (string, error) {
 		return "", fmt.Errorf("Together AI API returned status code %d: %s", response.StatusCode(), response.String())
 	}
 
-	var result map[string]interface{}
+	var result chat.CompletionResponse
 	if err := json.Unmarshal(response.Body(), &result); err != nil {
 		return "", fmt.Errorf("error parsing response from Together AI: %v", err)
 	}
 
-	choices, ok := result["choices"].([]interface{})
-	if !ok || len(choices) == 0 {
+	text, ok := result.Text()
+	if !ok {
 		return "", errors.New("no response from Together AI")
 	}
 
-	text, ok := choices[0].(map[string]interface{})["message"].(map[string]interface{})["content"].(string)
-	if !ok {
-		return "", errors.New("invalid response format from Together AI")
+	return cleanResponseText(text), nil
+}
+
+// buildChatRequest builds the chat completion request body, applying the client defaults for unset options
+func (c *Client) buildChatRequest(messages []chat.Message, opts chat.Options) map[string]interface{} {
+	maxTokens := 512
+	if opts.MaxTokens > 0 {
+		maxTokens = opts.MaxTokens
+	}
+	temperature := opts.TemperatureOr(0.7)
+
+	return map[string]interface{}{
+		"model":       c.Model,
+		"messages":    messages,
+		"max_tokens":  maxTokens,
+		"temperature": temperature,
+	}
+}
+
+// ChatCompletionStream sends the chat messages with streaming enabled, passing each token to onToken as it arrives.
+// Returns the full response text once the stream ends.
+func (c *Client) ChatCompletionStream(messages []chat.Message, opts chat.Options, onToken chat.TokenHandler) (string, error) {
+	request := c.buildChatRequest(messages, opts)
+	request["stream"] = true
+
+	// Keep the response body open to read the event stream
+	response, err := c.Client.R().
+		SetHeader("Authorization", "Bearer "+c.ApiKey).
+		SetHeader("Content-Type", "application/json").
+		SetHeader("Accept", "text/event-stream").
+		SetBody(request).
+		SetDoNotParseResponse(true).
+		Post("https://api.together.xyz/v1/chat/completions")
+
+	if err != nil {
+		return "", fmt.Errorf("error sending request to Together AI: %v", err)
+	}
+	body := response.RawBody()
+	defer body.Close()
+
+	if response.StatusCode() != 200 {
+		errBody, _ := io.ReadAll(body)
+		return "", fmt.Errorf("Together AI API returned status code %d: %s", response.StatusCode(), string(errBody))
+	}
+
+	text, err := chat.ReadStream(body, onToken)
+	if err != nil {
+		return "", fmt.Errorf("error streaming response from Together AI: %v", err)
 	}
 
 	return cleanResponseText(text), nil
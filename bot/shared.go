@@ -1,6 +1,8 @@
 package bot
 
 import (
+	"crossplatform_chatbot/ai_clients"
+	"crossplatform_chatbot/ai_clients/chat"
 	"fmt"
 	"strings"
 )
@@ -17,21 +19,6 @@ func (b *BaseBot) HandleCommand(command string) string {
 	case "/whisper":
 		b.conf.Screaming = false // Disable screaming mode
 		message = "Scream mode disabled!"
-	case "/openai":
-		b.conf.UseOpenAI = true
-		b.conf.UseMistral = false
-		b.conf.UseMETA = false
-		message = "Using OpenAI GPT-4 for responses."
-	case "/mistral":
-		b.conf.UseOpenAI = false
-		b.conf.UseMistral = true
-		b.conf.UseMETA = false
-		message = "Using Mistral AI Mistral-large model for responses."
-	case "/meta":
-		b.conf.UseOpenAI = false
-		b.conf.UseMistral = false
-		b.conf.UseMETA = true
-		message = "Using META Llama model from Together AI for responses."
 	case "/dialogflow":
 		b.conf.UseDialogflow = true
 		message = "Enabling Dialogflow for intent matching."
@@ -40,92 +27,77 @@ func (b *BaseBot) HandleCommand(command string) string {
 		message = "Dialogflow disabled."
 	case "/help":
 		message = "You can type the following commands:\n"
-		message += "**/openai** - Use OpenAI GPT-4 for responses.\n"
-		message += "**/mistral** - Use Mistral AI Mistral-large model.\n"
-		message += "**/meta** - Use META Llama model from Together AI.\n"
+		for _, name := range b.aiClients.Providers.Names() {
+			provider, _ := b.aiClients.Providers.Get(name)
+			message += fmt.Sprintf("**/%s** - Use %s for responses.\n", name, provider.Describe())
+		}
 		message += "**/dialogflow** - Enable Dialogflow for intent matching.\n"
 		message += "**/disable_dialogflow** - Disable Dialogflow intent matching. Use similarity score based retrieval only.\n"
 		message += "Note that only one AI model can be active at a time, while you can enable Dialogflow independently. "
 		message += "OpenAI and Dialogflow enabled by default."
 	default:
-		message = "I don't know that command"
+		// Switch the active AI provider if the command matches a registered provider name
+		name := strings.TrimPrefix(command, "/")
+		if provider, ok := b.aiClients.Providers.Get(name); ok {
+			b.conf.AIProvider = name
+			message = fmt.Sprintf("Using %s for responses.", provider.Describe())
+		} else {
+			message = "I don't know that command"
+		}
 	}
 
 	return message
 }
 
-// GetOpenAIResponse processes the user message and fetches a response from OpenAI API
-func (b *BaseBot) GetOpenAIResponse(prompt string) (string, error) {
-	client := b.aiClients.OpenAI
-	response, err := client.GetResponse(prompt)
+// GetAIResponse sends the messages to the named chat provider and returns the filtered response
+func (b *BaseBot) GetAIResponse(providerName string, messages []chat.Message) (string, error) {
+	provider, ok := b.aiClients.Providers.Get(providerName)
+	if !ok {
+		return "", fmt.Errorf("error: AI provider %q is not registered", providerName)
+	}
+
+	response, err := provider.ChatCompletion(messages, chat.Options{})
 	if err != nil {
-		return "", fmt.Errorf("error fetching response from OpenAI: %v", err)
+		return "", fmt.Errorf("error fetching response from %s: %v", provider.Describe(), err)
 	}
 
 	// Check if response is empty or missing expected fields
 	if response == "" {
-		return "", fmt.Errorf("no valid response from OpenAI. Please try again later")
+		return "", fmt.Errorf("no valid response from %s. Please try again later", provider.Describe())
 	}
 
-	fmt.Printf("OpenAI response: %s \n", response)
+	fmt.Printf("%s response: %s \n", provider.Describe(), response)
 
 	// Filter out "Response:" if it exists
-	response = filterResponse(response)
-
-	return response, nil
+	return filterResponse(response), nil
 }
 
-// GetHuggingFaceResponse processes the user message and fetches a response from Hugging Face Inference API
-/*func (b *BaseBot) GetHuggingFaceResponse(prompt string) (string, error) {
-	client := b.huggingfaceClient
-	response, err := client.GetResponse(prompt)
-	if err != nil {
-		return "", fmt.Errorf("error fetching response from HuggingFace: %v", err)
+// GetAIResponseStream streams the response of the named chat provider, passing each token to onToken.
+// Providers without streaming support send their full response as a single token.
+func (b *BaseBot) GetAIResponseStream(providerName string, messages []chat.Message, onToken chat.TokenHandler) (string, error) {
+	provider, ok := b.aiClients.Providers.Get(providerName)
+	if !ok {
+		return "", fmt.Errorf("error: AI provider %q is not registered", providerName)
 	}
 
-	// Check if response is empty or missing expected fields
-	if response == "" {
-		return "", fmt.Errorf("no valid response from HuggingFace. Please try again later")
+	streamer, ok := provider.(ai_clients.StreamingChatProvider)
+	if !ok {
+		response, err := b.GetAIResponse(providerName, messages)
+		if err != nil {
+			return "", err
+		}
+		return response, onToken(response)
 	}
 
-	fmt.Printf("Hugging Face response: %s \n", response)
-
-	// Filter out "Response:" if it exists
-	response = filterResponse(response)
-
-	return response, nil
-}*/
-
-// GetMistralResponse processes the user message and fetches a response from Mistral AI API
-func (b *BaseBot) GetMistralResponse(prompt string) (string, error) {
-	client := b.aiClients.Mistral
-	response, err := client.GetResponse(prompt)
+	response, err := streamer.ChatCompletionStream(messages, chat.Options{}, onToken)
 	if err != nil {
-		return "", fmt.Errorf("error fetching response from Mistral AI: %v", err)
+		return "", fmt.Errorf("error streaming response from %s: %v", provider.Describe(), err)
 	}
 
-	// Check if response is empty or missing expected fields
 	if response == "" {
-		return "", fmt.Errorf("no valid response from Mistral AI. Please try again later")
+		return "", fmt.Errorf("no valid response from %s. Please try again later", provider.Describe())
 	}
 
-	fmt.Printf("Mistral response: %s \n", response)
-
-	// Filter out "Response:" if it exists
-	response = filterResponse(response)
-
-	return response, nil
-}
-
-// GetTogetherAIResponse processes the user message and fetches a response from Together AI API
-func (b *BaseBot) GetTogetherAIResponse(prompt string) (string, error) {
-	if b.aiClients.TogetherAI == nil {
-		return "", fmt.Errorf("error: Together AI client is not initialized")
-	}
-	response, err := b.aiClients.TogetherAI.GetResponse(prompt)
-	if err != nil {
-		return "", fmt.Errorf("error fetching response from Together AI: %v", err)
-	}
 	return filterResponse(response), nil
 }
 
@@ -20,7 +20,8 @@ import (
 
 type TgBot interface {
 	Run() error
-	GetDocFile(update tgbotapi.Update) (string, string, string, error)
+	GetDocFile(update tgbotapi.Update) (string, string, error)
+	GetFileURL(fileID string) (string, error)
 	ValidateUser(user *tgbotapi.User, message *tgbotapi.Message) (bool, error)
 }
 
@@ -318,15 +319,15 @@ func (b *tgBot) sendTelegramMessage(chatID int64, messageText string) error {
 	return nil
 }
 
-// GetDocFile retrieves relevant file information of the document
-func (b *tgBot) GetDocFile(update tgbotapi.Update) (string, string, string, error) {
-
-	fileID := update.Message.Document.FileID
-	filename := update.Message.Document.FileName
-	fileURL, err := b.botApi.GetFileDirectURL(fileID)
-	if err != nil {
-		//b.sendTelegramMessage(update.Message.Chat.ID, "Error getting file: "+err.Error())
-		return "", "", "", err
+// GetDocFile retrieves the file ID and filename of the document
+func (b *tgBot) GetDocFile(update tgbotapi.Update) (string, string, error) {
+	if update.Message == nil || update.Message.Document == nil {
+		return "", "", errors.New("message has no document")
 	}
-	return fileID, fileURL, filename, nil
+	return update.Message.Document.FileID, update.Message.Document.FileName, nil
+}
+
+// GetFileURL returns the download URL of a file. The URL contains the bot token and must not be stored or logged.
+func (b *tgBot) GetFileURL(fileID string) (string, error) {
+	return b.botApi.GetFileDirectURL(fileID)
 }
@@ -43,6 +43,12 @@ type ServerConfig struct {
 	MaxConn  int
 	DBString string
 	AppPort  string
+
+	AdminAPIKey string // Required by the admin endpoints, which are disabled when empty
+
+	DialogflowWebhookSecret   string // Shared secret of the fulfillment webhook, sent as a bearer token or X-Webhook-Secret
+	DialogflowWebhookUser     string // Basic auth credentials of the fulfillment webhook, as set in the Dialogflow console
+	DialogflowWebhookPassword string
 }
 
 type BotConfig struct {
@@ -59,10 +65,25 @@ type BotConfig struct {
 	InstagramVerifyToken      string
 	InstagramPageToken        string
 	Screaming                 bool
-	UseOpenAI                 bool
-	UseMistral                bool
-	UseMETA                   bool
+	AIProvider                string // Name of the active chat provider in the registry (openai, mistral, meta...)
 	UseDialogflow             bool
+	NoContextPolicy           string // What to do when retrieval finds no chunks (free, disclaimer, canned, handoff)
+	NoContextMessage          string // Reply of the canned policy
+	NoContextDisclaimer       string // Appended to free answers by the disclaimer policy
+	HandoffMessage            string // Reply of the handoff policy
+	HandoffWebhookURL         string // Notified with the conversation when a question is handed off to a human
+	GroundingCheck            string // Post-generation check of the answer against the context (off, flag, rewrite)
+	GroundingProvider         string // Chat provider used as judge by the grounding check (defaults to AI_PROVIDER)
+
+	IntentClassifier   string  // Intent detection of the Dialogflow mode (dialogflow, local)
+	IntentMatch        string  // Matching method of the local classifier (centroid, knn)
+	IntentThreshold    float64 // Minimum confidence of a local intent match, below it the fallback intent is used
+	IntentNeighbors    int     // Nearest examples voting with knn matching
+	IntentExamplesFile string  // JSON file of example utterances by intent, imported at startup
+
+	DialogflowLanguage  string  // Language code of the DetectIntent requests
+	IntentMinConfidence float64 // Below this intent confidence, the intent's tags are ignored and all documents searched
+	ParameterFilters    string  // Intent parameters used as chunk metadata filters, e.g. "product,os:platform"
 }
 
 type OpenAIConfig struct {
@@ -80,13 +101,60 @@ type RedisConfig struct {
 }
 
 type EmbeddingConfig struct {
-	//EmbeddingBatchSize int
-	ChunkSize      int
-	MinChunkSize   int
-	OverlapSize    int
-	ScoreThreshold float64
-	NumTopChunks   int
-	TagEmbeddings  map[string][]float64
+	EmbeddingBatchSize   int // Maximum number of texts per embeddings request
+	EmbeddingBatchTokens int // Maximum estimated tokens per embeddings request
+	EmbeddingConcurrency int // Maximum number of embeddings requests in flight
+	EmbeddingMaxRetries  int // Retries of rate-limited (429) or failed embeddings requests
+
+	ChunkStrategy      string // Chunking strategy (words, tokens, sentences, headings)
+	ChunkTokens        int    // Tokens per chunk for the tokens, sentences and headings strategies
+	ChunkOverlapTokens int
+	MinChunkTokens     int // Smaller sections are merged with their first subsection (headings strategy)
+	MaxChunkTokens     int // Input limit of the embedding model, longer chunks are always split
+
+	ChunkSize           int
+	MinChunkSize        int
+	OverlapSize         int
+	ScoreThreshold      float64
+	NumTopChunks        int
+	NumCandidateChunks  int // Number of nearest chunks fetched from the vector store before scoring
+	TagEmbeddings       map[string][]float64
+	VectorStore         string // Vector store implementation (hnsw, pgvector)
+	EmbeddingDimensions int    // Dimensions of the embedding model, used for the pgvector column
+	HNSWM               int
+	HNSWEfConstruction  int
+	HNSWEfSearch        int
+	FusionMode          string  // How semantic and lexical results are combined (weighted, rrf)
+	SemanticWeight      float64 // Weight of the cosine similarity in the fused score
+	LexicalWeight       float64 // Weight of the BM25 score in the fused score
+	RRFK                int     // Rank constant for reciprocal rank fusion
+	LexicalStemming     bool    // Apply suffix stemming in the BM25 index
+	Reranker            string  // Reranking stage after retrieval (none, llm, http)
+	RerankCandidates    int     // Number of retrieved chunks passed to the reranker
+	RerankProvider      string  // Chat provider used as relevance judge by the llm reranker (defaults to AI_PROVIDER)
+	RerankURL           string  // Endpoint of the http reranker (Cohere/Jina compatible /rerank API)
+	RerankAPIKey        string
+	RerankModel         string
+	SelectionMode       string  // How the final chunks are picked from the ranked candidates (topn, mmr)
+	MMRLambda           float64 // MMR trade-off between relevance (1) and diversity (0)
+	MergeAdjacentChunks bool    // Merge neighbouring chunks of the same document into one passage
+	IngestWorkers       int     // Number of workers processing uploaded documents
+	IngestQueueSize     int     // Buffer size of the ingestion job queue
+	DuplicatePolicy     string  // Handling of uploads identical to a stored document (reject, link)
+
+	PDFOCRFallback bool   // Run the Python OCR script for PDF pages without a text layer
+	PDFOCRPython   string // Python interpreter running the OCR script
+	PDFOCRScript   string
+
+	WebCrawlUserAgent string // User agent of the crawler, matched against robots.txt groups
+	WebCrawlDelayMs   int    // Delay between two requests to the same site
+	WebCrawlMaxPages  int    // Pages ingested from one sitemap
+
+	WebCrawlAllowPrivate bool // Let the crawler fetch loopback, private and link-local addresses, e.g. an intranet
+
+	TagStrategy    string  // Tagging of uploaded documents (none, llm, embedding, hybrid)
+	TagThreshold   float64 // Minimum similarity between a chunk and a tag description for embedding based tagging
+	TagMaxPerChunk int     // Most similar tags kept per chunk by embedding based tagging
 }
 
 type HuggingFaceConfig struct {
@@ -157,6 +225,12 @@ func loadConfig() error {
 			Timeout:  getEnvDuration("SERVER_TIMEOUT", 30*time.Second),
 			MaxConn:  getEnvInt("SERVER_MAX_CONN", 100),
 			DBString: os.Getenv("DATABASE_URL"),
+
+			AdminAPIKey: os.Getenv("ADMIN_API_KEY"),
+
+			DialogflowWebhookSecret:   os.Getenv("DIALOGFLOW_WEBHOOK_SECRET"),
+			DialogflowWebhookUser:     os.Getenv("DIALOGFLOW_WEBHOOK_USER"),
+			DialogflowWebhookPassword: os.Getenv("DIALOGFLOW_WEBHOOK_PASSWORD"),
 		},
 		BotConfig: BotConfig{
 			TelegramBotToken:          os.Getenv("TELEGRAM_BOT_TOKEN"),
@@ -172,10 +246,25 @@ func loadConfig() error {
 			InstagramVerifyToken:      os.Getenv("IG_VERIFY_TOKEN"),
 			InstagramPageToken:        os.Getenv("IG_PAGE_TOKEN"),
 			Screaming:                 false,
-			UseOpenAI:                 true,
-			UseMistral:                false,
-			UseMETA:                   false,
+			AIProvider:                getEnvString("AI_PROVIDER", "openai"),
 			UseDialogflow:             true,
+			NoContextPolicy:           getEnvString("NO_CONTEXT_POLICY", "free"),
+			NoContextMessage:          getEnvString("NO_CONTEXT_MESSAGE", "I couldn't find that in our docs. Could you rephrase your question or add more details?"),
+			NoContextDisclaimer:       getEnvString("NO_CONTEXT_DISCLAIMER", "Note: I couldn't find this in our documentation, so this answer may be inaccurate."),
+			HandoffMessage:            getEnvString("HANDOFF_MESSAGE", "I couldn't find that in our docs, so I've passed your question on to our support team. Someone will get back to you shortly."),
+			HandoffWebhookURL:         os.Getenv("HANDOFF_WEBHOOK_URL"),
+			GroundingCheck:            getEnvString("GROUNDING_CHECK", "off"),
+			GroundingProvider:         os.Getenv("GROUNDING_PROVIDER"),
+
+			IntentClassifier:   getEnvString("INTENT_CLASSIFIER", "dialogflow"),
+			IntentMatch:        getEnvString("INTENT_MATCH", "centroid"),
+			IntentThreshold:    getEnvFloat("INTENT_THRESHOLD", 0.8),
+			IntentNeighbors:    getEnvInt("INTENT_KNN_K", 5),
+			IntentExamplesFile: os.Getenv("INTENT_EXAMPLES_FILE"),
+
+			DialogflowLanguage:  getEnvString("DIALOGFLOW_LANGUAGE", "en"),
+			IntentMinConfidence: getEnvFloat("INTENT_MIN_CONFIDENCE", 0.5),
+			ParameterFilters:    getEnvString("DIALOGFLOW_PARAMETER_FILTERS", "product,version,os"),
 		},
 		OpenAIConfig: OpenAIConfig{
 			OpenaiAPIKey:   os.Getenv("OPENAI_API_KEY"),
@@ -186,13 +275,58 @@ func loadConfig() error {
 			MaxTagTokens:   getEnvInt("OPENAI_MAX_TAG_TOKEN_SIZE", 4097),
 		},
 		EmbeddingConfig: EmbeddingConfig{
-			//EmbeddingBatchSize: getEnvInt("DOC_EMBEDDING_BATCH_SIZE", 10),
-			ChunkSize:      getEnvInt("DOC_CHUNK_SIZE", 500),
-			OverlapSize:    getEnvInt("DOC_OVERLAP_CHUNK_SIZE", 100),
-			MinChunkSize:   getEnvInt("DOC_MIN_CHUNK_SIZE", 50),
-			ScoreThreshold: getEnvFloat("DOC_SCORE_THRESHOLD", 0.65),
-			NumTopChunks:   getEnvInt("DOC_NUM_TOP_CHUNKS", 10),
-			TagEmbeddings:  make(map[string][]float64),
+			EmbeddingBatchSize:   getEnvInt("DOC_EMBEDDING_BATCH_SIZE", 100),
+			EmbeddingBatchTokens: getEnvInt("DOC_EMBEDDING_BATCH_TOKENS", 100000),
+			EmbeddingConcurrency: getEnvInt("DOC_EMBEDDING_CONCURRENCY", 4),
+			EmbeddingMaxRetries:  getEnvInt("DOC_EMBEDDING_MAX_RETRIES", 5),
+
+			ChunkStrategy:      getEnvString("DOC_CHUNK_STRATEGY", "words"),
+			ChunkTokens:        getEnvInt("DOC_CHUNK_TOKENS", 400),
+			ChunkOverlapTokens: getEnvInt("DOC_CHUNK_OVERLAP_TOKENS", 50),
+			MinChunkTokens:     getEnvInt("DOC_MIN_CHUNK_TOKENS", 50),
+			MaxChunkTokens:     getEnvInt("DOC_MAX_CHUNK_TOKENS", 8000),
+
+			ChunkSize:           getEnvInt("DOC_CHUNK_SIZE", 500),
+			OverlapSize:         getEnvInt("DOC_OVERLAP_CHUNK_SIZE", 100),
+			MinChunkSize:        getEnvInt("DOC_MIN_CHUNK_SIZE", 50),
+			ScoreThreshold:      getEnvFloat("DOC_SCORE_THRESHOLD", 0.65),
+			NumTopChunks:        getEnvInt("DOC_NUM_TOP_CHUNKS", 10),
+			NumCandidateChunks:  getEnvInt("DOC_NUM_CANDIDATE_CHUNKS", 50),
+			TagEmbeddings:       make(map[string][]float64),
+			VectorStore:         getEnvString("VECTOR_STORE", "hnsw"),
+			EmbeddingDimensions: getEnvInt("EMBEDDING_DIMENSIONS", 1536),
+			HNSWM:               getEnvInt("HNSW_M", 16),
+			HNSWEfConstruction:  getEnvInt("HNSW_EF_CONSTRUCTION", 100),
+			HNSWEfSearch:        getEnvInt("HNSW_EF_SEARCH", 64),
+			FusionMode:          getEnvString("DOC_FUSION_MODE", "weighted"),
+			SemanticWeight:      getEnvFloat("DOC_SEMANTIC_WEIGHT", 0.7),
+			LexicalWeight:       getEnvFloat("DOC_LEXICAL_WEIGHT", 0.3),
+			RRFK:                getEnvInt("DOC_RRF_K", 60),
+			LexicalStemming:     getEnvBool("DOC_LEXICAL_STEMMING", true),
+			Reranker:            getEnvString("RERANKER", "none"),
+			RerankCandidates:    getEnvInt("RERANK_CANDIDATES", 50),
+			RerankProvider:      os.Getenv("RERANK_PROVIDER"),
+			RerankURL:           os.Getenv("RERANK_URL"),
+			RerankAPIKey:        os.Getenv("RERANK_API_KEY"),
+			RerankModel:         os.Getenv("RERANK_MODEL"),
+			SelectionMode:       getEnvString("DOC_SELECTION_MODE", "topn"),
+			MMRLambda:           getEnvFloat("DOC_MMR_LAMBDA", 0.7),
+			MergeAdjacentChunks: getEnvBool("DOC_MERGE_ADJACENT_CHUNKS", false),
+			IngestWorkers:       getEnvInt("DOC_INGEST_WORKERS", 2),
+			IngestQueueSize:     getEnvInt("DOC_INGEST_QUEUE_SIZE", 100),
+			DuplicatePolicy:     getEnvString("DOC_DUPLICATE_POLICY", "reject"),
+			PDFOCRFallback:      getEnvBool("PDF_OCR_FALLBACK", false),
+			PDFOCRPython:        getEnvString("PDF_OCR_PYTHON", "python"),
+			PDFOCRScript:        getEnvString("PDF_OCR_SCRIPT", "./python_scripts/extractPDF.py"),
+			WebCrawlUserAgent:   getEnvString("WEB_CRAWL_USER_AGENT", "CrossPlatformChatbot/1.0"),
+			WebCrawlDelayMs:     getEnvInt("WEB_CRAWL_DELAY_MS", 1000),
+			WebCrawlMaxPages:    getEnvInt("WEB_CRAWL_MAX_PAGES", 500),
+
+			WebCrawlAllowPrivate: getEnvBool("WEB_CRAWL_ALLOW_PRIVATE", false),
+
+			TagStrategy:    getEnvString("DOC_TAG_STRATEGY", "llm"),
+			TagThreshold:   getEnvFloat("DOC_TAG_THRESHOLD", 0.8),
+			TagMaxPerChunk: getEnvInt("DOC_TAG_MAX_PER_CHUNK", 3),
 		},
 		RedisConfig: RedisConfig{
 			RedisEndpoint: os.Getenv("REDIS_ENDPOINT"),
@@ -243,6 +377,14 @@ func ResetConfig() {
 	once = sync.Once{} // Reset the sync.Once to allow re-initialization
 }
 
+// Utility function to get environment variable as a string with a default value
+func getEnvString(name string, defaultVal string) string {
+	if value, exists := os.LookupEnv(name); exists && value != "" {
+		return value
+	}
+	return defaultVal
+}
+
 func isEnvSet(key string) bool {
 	_, exists := os.LookupEnv(key)
 	return exists
@@ -286,6 +428,16 @@ func getEnvFloat(name string, defaultVal float64) float64 {
 	return defaultVal
 }
 
+// Utility function to get environment variable as a boolean
+func getEnvBool(name string, defaultVal bool) bool {
+	if value, exists := os.LookupEnv(name); exists {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultVal
+}
+
 // Utility function to get environment variable as a duration
 func getEnvDuration(name string, defaultVal time.Duration) time.Duration {
 	if value, exists := os.LookupEnv(name); exists {
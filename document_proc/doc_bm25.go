@@ -0,0 +1,271 @@
+package document_proc
+
+import (
+	"crossplatform_chatbot/vectorstore"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Words, numbers and codes joined by '-', '_', '.' or '/' (e.g. "x-200", "err_404", "v2.1")
+var tokenPattern = regexp.MustCompile(`[\p{L}\p{N}]+(?:[-_./][\p{L}\p{N}]+)*`)
+
+// Common English words ignored by the lexical index
+var stopWords = map[string]struct{}{
+	"a": {}, "about": {}, "after": {}, "all": {}, "also": {}, "am": {}, "an": {}, "and": {}, "any": {}, "are": {},
+	"as": {}, "at": {}, "be": {}, "been": {}, "but": {}, "by": {}, "can": {}, "could": {}, "did": {}, "do": {},
+	"does": {}, "for": {}, "from": {}, "had": {}, "has": {}, "have": {}, "he": {}, "her": {}, "his": {}, "how": {},
+	"i": {}, "if": {}, "in": {}, "into": {}, "is": {}, "it": {}, "its": {}, "me": {}, "my": {}, "no": {},
+	"not": {}, "of": {}, "on": {}, "or": {}, "our": {}, "she": {}, "so": {}, "than": {}, "that": {}, "the": {},
+	"their": {}, "them": {}, "then": {}, "there": {}, "these": {}, "they": {}, "this": {}, "to": {}, "was": {}, "we": {},
+	"were": {}, "what": {}, "when": {}, "where": {}, "which": {}, "who": {}, "why": {}, "will": {}, "with": {}, "would": {},
+	"you": {}, "your": {},
+}
+
+// Tokenize lowercases the text and splits it into index terms, dropping stop words.
+// Compound codes are kept whole and also added without separators and as their parts ("x-200" -> "x-200", "x200", "x", "200").
+// Plain words are reduced with a light suffix stemmer when stem is set.
+func Tokenize(text string, stem bool) []string {
+	var terms []string
+	for _, token := range tokenPattern.FindAllString(strings.ToLower(text), -1) {
+		if strings.ContainsAny(token, "-_./") {
+			terms = append(terms, token, strings.NewReplacer("-", "", "_", "", ".", "", "/", "").Replace(token))
+			for _, part := range strings.FieldsFunc(token, func(r rune) bool { return strings.ContainsRune("-_./", r) }) {
+				if _, stop := stopWords[part]; !stop {
+					terms = append(terms, part)
+				}
+			}
+			continue
+		}
+
+		if _, stop := stopWords[token]; stop {
+			continue
+		}
+		if stem && isAlphabetic(token) {
+			token = stemWord(token)
+		}
+		terms = append(terms, token)
+	}
+	return terms
+}
+
+// stemWord strips common English inflection suffixes (plurals, -ing, -ed, -ly)
+func stemWord(word string) string {
+	if len(word) <= 3 {
+		return word
+	}
+
+	switch {
+	case strings.HasSuffix(word, "sses"):
+		return word[:len(word)-2]
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		return word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "ing") && len(word) > 5:
+		return undouble(word[:len(word)-3])
+	case strings.HasSuffix(word, "ed") && len(word) > 4:
+		return undouble(word[:len(word)-2])
+	case strings.HasSuffix(word, "ly") && len(word) > 4:
+		return word[:len(word)-2]
+	case strings.HasSuffix(word, "es") && (strings.HasSuffix(word, "ches") || strings.HasSuffix(word, "shes") || strings.HasSuffix(word, "xes") || strings.HasSuffix(word, "zes")):
+		return word[:len(word)-2]
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") && !strings.HasSuffix(word, "us") && !strings.HasSuffix(word, "is"):
+		return word[:len(word)-1]
+	}
+	return word
+}
+
+// undouble removes a doubled final consonant left after stripping a suffix ("running" -> "runn" -> "run")
+func undouble(stem string) string {
+	n := len(stem)
+	if n >= 2 && stem[n-1] == stem[n-2] && !strings.ContainsRune("aeiouls", rune(stem[n-1])) {
+		return stem[:n-1]
+	}
+	return stem
+}
+
+func isAlphabetic(word string) bool {
+	for _, r := range word {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// BM25Index is an in-memory inverted index scoring document chunks with Okapi BM25
+type BM25Index struct {
+	mu       sync.RWMutex
+	k1       float64
+	b        float64
+	stem     bool
+	postings map[string]map[string]int // Term -> ChunkID -> term frequency
+	docs     map[string]bm25Doc        // ChunkID -> indexed chunk
+	totalLen int
+}
+
+// bm25Doc is an indexed chunk with its length in terms
+type bm25Doc struct {
+	record vectorstore.Record
+	terms  []string // Distinct terms, used for removal
+	length int
+}
+
+// NewBM25Index creates an empty index with the usual k1 = 1.2 and b = 0.75 parameters
+func NewBM25Index(stem bool) *BM25Index {
+	return &BM25Index{
+		k1:       1.2,
+		b:        0.75,
+		stem:     stem,
+		postings: make(map[string]map[string]int),
+		docs:     make(map[string]bm25Doc),
+	}
+}
+
+// Add indexes the chunks, replacing chunks already in the index
+func (idx *BM25Index) Add(records ...vectorstore.Record) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, record := range records {
+		idx.remove(record.ChunkID)
+
+		terms := Tokenize(record.Text, idx.stem)
+		frequencies := make(map[string]int)
+		for _, term := range terms {
+			frequencies[term]++
+		}
+
+		distinct := make([]string, 0, len(frequencies))
+		for term, tf := range frequencies {
+			if idx.postings[term] == nil {
+				idx.postings[term] = make(map[string]int)
+			}
+			idx.postings[term][record.ChunkID] = tf
+			distinct = append(distinct, term)
+		}
+
+		record.Embedding = nil // The lexical index only needs the text
+		idx.docs[record.ChunkID] = bm25Doc{record: record, terms: distinct, length: len(terms)}
+		idx.totalLen += len(terms)
+	}
+}
+
+// Remove drops the chunks from the index
+func (idx *BM25Index) Remove(chunkIDs ...string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, chunkID := range chunkIDs {
+		idx.remove(chunkID)
+	}
+}
+
+func (idx *BM25Index) remove(chunkID string) {
+	doc, exists := idx.docs[chunkID]
+	if !exists {
+		return
+	}
+	for _, term := range doc.terms {
+		delete(idx.postings[term], chunkID)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	idx.totalLen -= doc.length
+	delete(idx.docs, chunkID)
+}
+
+// ChunkIDs returns the IDs of the indexed chunks of the document
+func (idx *BM25Index) ChunkIDs(docID string) []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var chunkIDs []string
+	for chunkID, doc := range idx.docs {
+		if doc.record.DocID == docID {
+			chunkIDs = append(chunkIDs, chunkID)
+		}
+	}
+	return chunkIDs
+}
+
+// DocIDs returns the IDs of the documents with indexed chunks
+func (idx *BM25Index) DocIDs() []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var docIDs []string
+	for _, doc := range idx.docs {
+		if !seen[doc.record.DocID] {
+			seen[doc.record.DocID] = true
+			docIDs = append(docIDs, doc.record.DocID)
+		}
+	}
+	return docIDs
+}
+
+// Len returns the number of indexed chunks
+func (idx *BM25Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docs)
+}
+
+// Search returns up to topK chunks matching the filter with a positive BM25 score for the query, best match first
+func (idx *BM25Index) Search(query string, topK int, filter vectorstore.Filter) []vectorstore.Result {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if len(idx.docs) == 0 || topK <= 0 {
+		return nil
+	}
+
+	n := float64(len(idx.docs))
+	avgLen := float64(idx.totalLen) / n
+	scores := make(map[string]float64)
+
+	seen := make(map[string]struct{})
+	for _, term := range Tokenize(query, idx.stem) {
+		if _, dup := seen[term]; dup {
+			continue
+		}
+		seen[term] = struct{}{}
+
+		postings := idx.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+
+		// Rare terms (e.g. product codes) weigh more than common ones
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+		for chunkID, tf := range postings {
+			doc := idx.docs[chunkID]
+			if !filter.Match(doc.record) {
+				continue
+			}
+			freq := float64(tf)
+			scores[chunkID] += idf * freq * (idx.k1 + 1) / (freq + idx.k1*(1-idx.b+idx.b*float64(doc.length)/avgLen))
+		}
+	}
+
+	results := make([]vectorstore.Result, 0, len(scores))
+	for chunkID, score := range scores {
+		results = append(results, vectorstore.Result{Record: idx.docs[chunkID].record, Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score == results[j].Score {
+			return results[i].ChunkID < results[j].ChunkID
+		}
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > topK {
+		results = results[:topK]
+	}
+	return results
+}
@@ -0,0 +1,142 @@
+package document_proc
+
+import (
+	"crossplatform_chatbot/vectorstore"
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		stem bool
+		want []string
+	}{
+		{"The router's X-200 error E1234 occurred", false,
+			[]string{"router", "s", "x-200", "x200", "x", "200", "error", "e1234", "occurred"}},
+		{"The router's X-200 error E1234 occurred", true,
+			[]string{"router", "s", "x-200", "x200", "x", "200", "error", "e1234", "occur"}},
+		{"Use the in-app menu", false, []string{"use", "in-app", "inapp", "app", "menu"}}, // Stop words are dropped from the parts only
+		{"firmware v2.1 / err_404", false, []string{"firmware", "v2.1", "v21", "v2", "1", "err_404", "err404", "err", "404"}},
+		{"Where is it? What to do", false, nil},
+		{"Ünïcode Wörter", false, []string{"ünïcode", "wörter"}},
+	}
+	for _, tt := range tests {
+		if got := Tokenize(tt.text, tt.stem); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q, %v) = %q, want %q", tt.text, tt.stem, got, tt.want)
+		}
+	}
+}
+
+func TestStemWord(t *testing.T) {
+	tests := map[string]string{
+		"classes":   "class",
+		"batteries": "battery",
+		"running":   "run",
+		"setting":   "set",
+		"stopped":   "stop",
+		"installed": "install",
+		"quickly":   "quick",
+		"boxes":     "box",
+		"switches":  "switch",
+		"cables":    "cable",
+		"status":    "status",
+		"analysis":  "analysis",
+		"access":    "access",
+		"bus":       "bus", // Short words are kept
+		"ring":      "ring",
+	}
+	for word, want := range tests {
+		if got := stemWord(word); got != want {
+			t.Errorf("stemWord(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+// errorCodeRecords are the chunks of a troubleshooting guide, many of them about errors
+func errorCodeRecords() []vectorstore.Record {
+	return []vectorstore.Record{
+		{ChunkID: "fan", DocID: "guide", Text: "Troubleshooting the fan: clean the fan and check the fan cable."},
+		{ChunkID: "e1234", DocID: "guide", Text: "Error E1234: the fan failed. Replace the fan."},
+		{ChunkID: "e1235", DocID: "guide", Text: "Error E1235: the power supply failed. An error is shown on the display."},
+		{ChunkID: "e2001", DocID: "guide", Text: "Error E2001: the network cable is unplugged."},
+		{ChunkID: "x200", DocID: "models", Text: "The X-200 router supports mesh networking."},
+	}
+}
+
+func TestBM25IndexSearch(t *testing.T) {
+	idx := NewBM25Index(true)
+	idx.Add(errorCodeRecords()...)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// The rare code outweighs the common words shared with the other error chunks
+		{"What does error E1234 mean?", []string{"e1234", "e1235", "e2001"}},
+		{"e1234", []string{"e1234"}},
+		{"fan", []string{"fan", "e1234"}}, // More occurrences in a chunk of similar length rank higher
+		{"x200 routers", []string{"x200"}},
+		{"200", []string{"x200"}},
+		{"cables unplugged", []string{"e2001", "fan"}},
+		{"what is the", nil}, // Only stop words
+		{"E9999", nil},
+	}
+	for _, tt := range tests {
+		results := idx.Search(tt.query, 10, vectorstore.Filter{})
+		var got []string
+		for _, result := range results {
+			got = append(got, result.ChunkID)
+			if result.Score <= 0 {
+				t.Errorf("Search(%q) returned %s with score %f", tt.query, result.ChunkID, result.Score)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	if results := idx.Search("error", 1, vectorstore.Filter{}); len(results) != 1 {
+		t.Errorf("Search with topK 1 returned %d results", len(results))
+	}
+	results := idx.Search("router fan", 10, vectorstore.Filter{DocIDs: []string{"models"}})
+	if len(results) != 1 || results[0].ChunkID != "x200" {
+		t.Errorf("filtered Search = %+v, want x200 only", results)
+	}
+}
+
+func TestBM25IndexRemove(t *testing.T) {
+	idx := NewBM25Index(false)
+	records := errorCodeRecords()
+	idx.Add(records...)
+	before := idx.Search("error failed", 10, vectorstore.Filter{})
+
+	idx.Remove("e1234", "missing")
+	if idx.Len() != len(records)-1 {
+		t.Fatalf("Len = %d, want %d", idx.Len(), len(records)-1)
+	}
+	if results := idx.Search("e1234", 10, vectorstore.Filter{}); len(results) != 0 {
+		t.Fatalf("removed chunk found: %+v", results)
+	}
+	if _, found := idx.postings["e1234"]; found {
+		t.Fatal("postings of the removed chunk are kept")
+	}
+
+	// Adding the chunk back restores the same statistics, hence the same scores
+	idx.Add(records[1])
+	if after := idx.Search("error failed", 10, vectorstore.Filter{}); !reflect.DeepEqual(after, before) {
+		t.Fatalf("scores after remove and add = %+v, want %+v", after, before)
+	}
+
+	// Adding an existing chunk replaces its text
+	idx.Add(vectorstore.Record{ChunkID: "e1234", DocID: "guide", Text: "Error E4321: overheating."})
+	if results := idx.Search("e1234", 10, vectorstore.Filter{}); len(results) != 0 {
+		t.Fatalf("replaced text still found: %+v", results)
+	}
+	if results := idx.Search("e4321", 10, vectorstore.Filter{}); len(results) != 1 || idx.Len() != len(records) {
+		t.Fatalf("Search of the new text = %+v, Len %d", results, idx.Len())
+	}
+	if got := idx.ChunkIDs("models"); !reflect.DeepEqual(got, []string{"x200"}) {
+		t.Fatalf("ChunkIDs(models) = %v", got)
+	}
+}
@@ -9,12 +9,20 @@ import (
 	"unicode"
 )
 
+// ScoredChunk is a retrieved document chunk with its relevance score
+type ScoredChunk struct {
+	ChunkID   string
+	DocID     string
+	Filename  string
+	Text      string
+	Score     float64
+	Embedding []float64
+
+	MergedChunkIDs []string // IDs of the adjacent chunks merged into this passage, in document order
+}
+
 // Compute similarity score and retrieve  the top N chunks from database.
-func RetrieveTopNChunks(query string, documentEmbeddings map[string][]float64, client *openai.Client, topN int, docIDToText map[string]string, threshold float64) ([]struct {
-	ChunkID string
-	Text    string
-	Score   float64
-}, error) {
+func RetrieveTopNChunks(query string, documentEmbeddings map[string][]float64, client *openai.Client, topN int, docIDToText map[string]string, threshold float64) ([]ScoredChunk, error) {
 
 	fmt.Println("Embedding query for similarity search...")
 	//client := openai.NewClient()
@@ -55,20 +63,12 @@ func RetrieveTopNChunks(query string, documentEmbeddings map[string][]float64, c
 	})
 
 	// Collect the top N chunks' actual text using docIDToText
-	var topChunks []struct {
-		ChunkID string
-		Text    string
-		Score   float64
-	}
+	var topChunks []ScoredChunk
 	for i := 0; i < topN && i < len(scores); i++ {
 		chunkID := scores[i].chunkID
 		if text, exists := docIDToText[chunkID]; exists {
 			//topChunksText = append(topChunksText, text)
-			topChunks = append(topChunks, struct {
-				ChunkID string
-				Text    string
-				Score   float64
-			}{
+			topChunks = append(topChunks, ScoredChunk{
 				ChunkID: chunkID,
 				Text:    text,
 				Score:   scores[i].score,
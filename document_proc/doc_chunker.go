@@ -0,0 +1,358 @@
+package document_proc
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// Chunking strategies
+const (
+	ChunkByWords     = "words"     // Overlapping windows of words (OverlapChunk)
+	ChunkByTokens    = "tokens"    // Overlapping windows of tiktoken tokens, cut between words
+	ChunkBySentences = "sentences" // Whole sentences packed up to the token size
+	ChunkByHeadings  = "headings"  // Sections split at headings, each chunk prefixed with its heading path
+)
+
+// Chunk is a piece of document text to embed. HeadingPath lists the titles of the sections containing
+// the chunk, outermost first, and is empty for strategies that don't follow headings.
+type Chunk struct {
+	Text        string
+	HeadingPath []string
+}
+
+// Section returns the heading path as "Installation > Linux > Proxy"
+func (c Chunk) Section() string {
+	return strings.Join(c.HeadingPath, " > ")
+}
+
+// Chunker splits the extracted text of a document into chunks
+type Chunker interface {
+	Chunk(text string) []Chunk
+}
+
+// ChunkerOptions configures NewChunker. Sizes are in words for the words strategy and in tokens for the others.
+type ChunkerOptions struct {
+	Strategy      string
+	ChunkSize     int // Words per chunk (words strategy)
+	Overlap       int // Overlapping words (words strategy)
+	ChunkTokens   int // Tokens per chunk (tokens, sentences and headings strategies)
+	OverlapTokens int // Overlapping tokens (tokens and sentences strategies)
+	MinTokens     int // Sections below this size are merged with their first subsection (headings strategy)
+	MaxTokens     int // Hard limit for every strategy, the input limit of the embedding model
+}
+
+// NewChunker creates the chunker of the strategy. Chunks above MaxTokens are always split further.
+func NewChunker(options ChunkerOptions) (Chunker, error) {
+	if options.ChunkTokens <= 0 {
+		options.ChunkTokens = 400
+	}
+	if options.MaxTokens <= 0 {
+		options.MaxTokens = 8000
+	}
+	options.ChunkTokens = min(options.ChunkTokens, options.MaxTokens)
+	options.OverlapTokens = max(0, min(options.OverlapTokens, options.ChunkTokens/2))
+
+	tokens := loadTokenizer()
+	var chunker Chunker
+	switch options.Strategy {
+	case ChunkByWords, "":
+		if options.ChunkSize <= options.Overlap {
+			return nil, fmt.Errorf("chunk size %d must be larger than the overlap %d", options.ChunkSize, options.Overlap)
+		}
+		chunker = &wordChunker{size: options.ChunkSize, overlap: options.Overlap}
+	case ChunkByTokens:
+		chunker = &tokenChunker{tokens: tokens, size: options.ChunkTokens, overlap: options.OverlapTokens}
+	case ChunkBySentences:
+		chunker = &sentenceChunker{tokens: tokens, size: options.ChunkTokens, overlap: options.OverlapTokens}
+	case ChunkByHeadings:
+		chunker = &headingChunker{tokens: tokens, size: options.ChunkTokens, minTokens: options.MinTokens}
+	default:
+		return nil, fmt.Errorf("unknown chunking strategy %q", options.Strategy)
+	}
+	return &limitedChunker{chunker: chunker, tokens: tokens, maxTokens: options.MaxTokens}, nil
+}
+
+// tokenizer counts tokens with cl100k_base, the encoding of the OpenAI embedding models.
+// The encoding is downloaded on first use; when it can't be loaded, counts are estimated from the words.
+type tokenizer struct {
+	encoding *tiktoken.Tiktoken
+}
+
+var (
+	tokenizerOnce   sync.Once
+	sharedTokenizer = &tokenizer{}
+)
+
+func loadTokenizer() *tokenizer {
+	tokenizerOnce.Do(func() {
+		encoding, err := tiktoken.GetEncoding("cl100k_base")
+		if err != nil {
+			fmt.Printf("Error loading tiktoken encoding, estimating token counts from words: %v\n", err)
+			return
+		}
+		sharedTokenizer.encoding = encoding
+	})
+	return sharedTokenizer
+}
+
+func (t *tokenizer) count(text string) int {
+	if t.encoding == nil {
+		return (len(strings.Fields(text))*4 + 2) / 3 // About 0.75 words per token in English
+	}
+	return len(t.encoding.Encode(text, nil, nil))
+}
+
+// textUnit is a word, sentence or paragraph to pack into chunks
+type textUnit struct {
+	text   string
+	tokens int
+	sep    string // Joins the unit to the previous one
+}
+
+// pack joins consecutive units into chunks of at most size tokens. Each chunk after the first
+// starts with the last units of the previous one, up to overlap tokens.
+func pack(units []textUnit, size, overlap int) []string {
+	var chunks []string
+	for start := 0; start < len(units); {
+		end, total := start, 0
+		for end < len(units) && (end == start || total+units[end].tokens <= size) {
+			total += units[end].tokens
+			end++
+		}
+
+		var text strings.Builder
+		for i, unit := range units[start:end] {
+			if i > 0 {
+				text.WriteString(unit.sep)
+			}
+			text.WriteString(unit.text)
+		}
+		chunks = append(chunks, text.String())
+		if end == len(units) {
+			break
+		}
+
+		// Step back over the overlapping units, always moving forward
+		next, carried := end, 0
+		for next-1 > start && carried+units[next-1].tokens <= overlap {
+			next--
+			carried += units[next].tokens
+		}
+		start = next
+	}
+	return chunks
+}
+
+// wordUnits splits text into words measured in tokens
+func (t *tokenizer) wordUnits(text string) []textUnit {
+	words := strings.Fields(text)
+	units := make([]textUnit, len(words))
+	for i, word := range words {
+		units[i] = textUnit{text: word, tokens: t.count(" " + word), sep: " "}
+	}
+	return units
+}
+
+// sentenceUnits splits text into sentences, sentences longer than size are split into words
+func (t *tokenizer) sentenceUnits(text string, size int) []textUnit {
+	var units []textUnit
+	for _, sentence := range splitIntoSentences(strings.Join(strings.Fields(text), " ")) {
+		if tokens := t.count(sentence); tokens <= size {
+			units = append(units, textUnit{text: sentence, tokens: tokens, sep: " "})
+		} else {
+			units = append(units, t.wordUnits(sentence)...)
+		}
+	}
+	return units
+}
+
+// paragraphUnits splits text into paragraphs at blank lines, paragraphs longer than size are split into sentences
+func (t *tokenizer) paragraphUnits(text string, size int) []textUnit {
+	var units []textUnit
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		if tokens := t.count(paragraph); tokens <= size {
+			units = append(units, textUnit{text: paragraph, tokens: tokens, sep: "\n\n"})
+			continue
+		}
+		sentences := t.sentenceUnits(paragraph, size)
+		if len(sentences) > 0 {
+			sentences[0].sep = "\n\n"
+		}
+		units = append(units, sentences...)
+	}
+	return units
+}
+
+// wordChunker is the original word window chunking
+type wordChunker struct {
+	size, overlap int
+}
+
+func (c *wordChunker) Chunk(text string) []Chunk {
+	return plainChunks(OverlapChunk(text, c.size, c.overlap))
+}
+
+// tokenChunker cuts fixed windows of tokens, between words so no word is split
+type tokenChunker struct {
+	tokens        *tokenizer
+	size, overlap int
+}
+
+func (c *tokenChunker) Chunk(text string) []Chunk {
+	return plainChunks(pack(c.tokens.wordUnits(text), c.size, c.overlap))
+}
+
+// sentenceChunker packs whole sentences into windows of tokens
+type sentenceChunker struct {
+	tokens        *tokenizer
+	size, overlap int
+}
+
+func (c *sentenceChunker) Chunk(text string) []Chunk {
+	return plainChunks(pack(c.tokens.sentenceUnits(text, c.size), c.size, c.overlap))
+}
+
+func plainChunks(texts []string) []Chunk {
+	chunks := make([]Chunk, 0, len(texts))
+	for _, text := range texts {
+		if strings.TrimSpace(text) != "" {
+			chunks = append(chunks, Chunk{Text: text})
+		}
+	}
+	return chunks
+}
+
+// Markdown headings, as written by the extractors for HTML, slides and sheets
+var headingLine = regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*#*\s*$`)
+
+// headingChunker splits the text into sections at headings and packs the paragraphs of each section.
+// Chunks never span two sections, except that a small section is merged with its first subsection.
+type headingChunker struct {
+	tokens    *tokenizer
+	size      int
+	minTokens int
+}
+
+// headingSection is the text under a heading, up to the next heading
+type headingSection struct {
+	path    []string
+	heading string // The heading line, kept when the section is merged into its parent's chunk
+	body    string
+}
+
+func (c *headingChunker) Chunk(text string) []Chunk {
+	var sections []headingSection
+	var path []string
+	var levels []int
+	current := headingSection{}
+	var body []string
+
+	flush := func() {
+		current.body = strings.TrimSpace(strings.Join(body, "\n"))
+		if current.body != "" || current.heading != "" {
+			sections = append(sections, current)
+		}
+		body = nil
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		match := headingLine.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			body = append(body, line)
+			continue
+		}
+		flush()
+
+		// Close the sections at the same or a deeper level
+		level := len(match[1])
+		for len(levels) > 0 && levels[len(levels)-1] >= level {
+			levels, path = levels[:len(levels)-1], path[:len(path)-1]
+		}
+		levels, path = append(levels, level), append(path, match[2])
+		current = headingSection{path: append([]string(nil), path...), heading: match[2]}
+	}
+	flush()
+
+	var chunks []Chunk
+	var tokenCounts []int
+	for _, section := range sections {
+		if section.body == "" {
+			continue // Heading only, its title is in the path of its subsections
+		}
+		prefix := sectionPrefix(section.path)
+		budget := max(c.size-c.tokens.count(prefix), c.size/2)
+
+		for _, text := range pack(c.tokens.paragraphUnits(section.body, budget), budget, 0) {
+			tokens := c.tokens.count(text)
+
+			// Merge into the previous chunk when it's a small chunk of the parent section (or the same section)
+			if n := len(chunks); n > 0 && tokenCounts[n-1] < c.minTokens && len(chunks[n-1].HeadingPath) > 0 &&
+				hasPathPrefix(section.path, chunks[n-1].HeadingPath) {
+				previous := &chunks[n-1]
+				joined := previous.Text
+				if len(section.path) > len(previous.HeadingPath) {
+					joined += "\n\n" + strings.Join(section.path[len(previous.HeadingPath):], " > ")
+				}
+				joined += "\n\n" + text
+				if joinedTokens := c.tokens.count(joined); joinedTokens <= c.size {
+					previous.Text = joined
+					tokenCounts[n-1] = joinedTokens
+					continue
+				}
+			}
+
+			chunks = append(chunks, Chunk{Text: prefix + text, HeadingPath: section.path})
+			tokenCounts = append(tokenCounts, tokens+c.tokens.count(prefix))
+		}
+	}
+	return chunks
+}
+
+// sectionPrefix is the heading path written before the chunk text, so the embedding carries the section context
+func sectionPrefix(path []string) string {
+	if len(path) == 0 {
+		return ""
+	}
+	return strings.Join(path, " > ") + "\n\n"
+}
+
+func hasPathPrefix(path, prefix []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// limitedChunker splits chunks above the token limit of the embedding model into token windows
+type limitedChunker struct {
+	chunker   Chunker
+	tokens    *tokenizer
+	maxTokens int
+}
+
+func (c *limitedChunker) Chunk(text string) []Chunk {
+	var chunks []Chunk
+	for _, chunk := range c.chunker.Chunk(text) {
+		if c.tokens.count(chunk.Text) <= c.maxTokens {
+			chunks = append(chunks, chunk)
+			continue
+		}
+		for _, part := range pack(c.tokens.wordUnits(chunk.Text), c.maxTokens, 0) {
+			chunks = append(chunks, Chunk{Text: part, HeadingPath: chunk.HeadingPath})
+		}
+	}
+	return chunks
+}
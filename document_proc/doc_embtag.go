@@ -1,23 +1,45 @@
 package document_proc
 
 import (
-	"fmt"
+	"sort"
 )
 
-// GetRelevantTags scores each tag's embedding against the query embedding
-// and returns a list of tags that pass the threshold.
-func GetRelevantTags(queryEmbedding []float64, tagEmbeddings map[string][]float64, threshold float64) []string {
-	var relevantTags []string
+// GetRelevantTags scores each tag's embedding against the query (or chunk) embedding and returns the tags
+// that pass their threshold, best first. thresholds overrides defaultThreshold for single tags, and at most
+// maxTags tags are returned (all of them when maxTags <= 0).
+func GetRelevantTags(queryEmbedding []float64, tagEmbeddings map[string][]float64, thresholds map[string]float64, defaultThreshold float64, maxTags int) []string {
+	type scoredTag struct {
+		tag   string
+		score float64
+	}
+	var scored []scoredTag
 
 	for tag, embedding := range tagEmbeddings {
-		cosineScore := cosineSimilarity(queryEmbedding, embedding)
-		keywordScore := keywordMatchScore(tag, tag) // Simple keyword match for tags
-		combinedScore := weightedScore(cosineScore, keywordScore)
+		if len(embedding) != len(queryEmbedding) {
+			continue // Embedded with another model
+		}
+		threshold, ok := thresholds[tag]
+		if !ok {
+			threshold = defaultThreshold
+		}
+		if score := cosineSimilarity(queryEmbedding, embedding); score >= threshold {
+			scored = append(scored, scoredTag{tag: tag, score: score})
+		}
+	}
 
-		if combinedScore >= threshold {
-			relevantTags = append(relevantTags, tag)
-			fmt.Printf("Tag: %s, Score: %.4f\n", tag, combinedScore)
+	sort.Slice(scored, func(i, j int) bool {
+		if scored[i].score != scored[j].score {
+			return scored[i].score > scored[j].score
 		}
+		return scored[i].tag < scored[j].tag
+	})
+	if maxTags > 0 && len(scored) > maxTags {
+		scored = scored[:maxTags]
+	}
+
+	relevantTags := make([]string, len(scored))
+	for i, tag := range scored {
+		relevantTags[i] = tag.tag
 	}
 	return relevantTags
 }
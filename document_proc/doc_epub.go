@@ -0,0 +1,82 @@
+package document_proc
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// extractTextFromEPUB extracts the chapters of an EPUB book in reading (spine) order
+func extractTextFromEPUB(filePath string) (string, error) {
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error opening EPUB file: %v", err)
+	}
+	defer archive.Close()
+
+	// The container points to the package document listing the chapters
+	var container struct {
+		Rootfiles []struct {
+			FullPath string `xml:"full-path,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if err := readZipXML(&archive.Reader, "META-INF/container.xml", &container); err != nil {
+		return "", fmt.Errorf("error reading EPUB container: %v", err)
+	}
+	if len(container.Rootfiles) == 0 {
+		return "", fmt.Errorf("EPUB package document not found")
+	}
+	packagePath := container.Rootfiles[0].FullPath
+
+	var pkg struct {
+		Title    string `xml:"metadata>title"`
+		Manifest []struct {
+			ID        string `xml:"id,attr"`
+			Href      string `xml:"href,attr"`
+			MediaType string `xml:"media-type,attr"`
+		} `xml:"manifest>item"`
+		Spine []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"spine>itemref"`
+	}
+	if err := readZipXML(&archive.Reader, packagePath, &pkg); err != nil {
+		return "", fmt.Errorf("error reading EPUB package document: %v", err)
+	}
+
+	chapters := make(map[string]string) // Chapter paths by manifest ID
+	for _, item := range pkg.Manifest {
+		if item.MediaType == "application/xhtml+xml" || item.MediaType == "text/html" {
+			href, err := url.PathUnescape(item.Href)
+			if err != nil {
+				href = item.Href
+			}
+			chapters[item.ID] = path.Join(path.Dir(packagePath), href)
+		}
+	}
+
+	var sections []string
+	if title := strings.TrimSpace(pkg.Title); title != "" {
+		sections = append(sections, "# "+title)
+	}
+	for _, itemRef := range pkg.Spine {
+		chapterPath, found := chapters[itemRef.IDRef]
+		if !found {
+			continue
+		}
+		content, err := readZipEntry(&archive.Reader, chapterPath)
+		if err != nil {
+			return "", fmt.Errorf("error reading EPUB chapter %s: %v", chapterPath, err)
+		}
+		text, err := htmlText(bytes.NewReader(content))
+		if err != nil {
+			return "", fmt.Errorf("error parsing EPUB chapter %s: %v", chapterPath, err)
+		}
+		if text != "" {
+			sections = append(sections, text)
+		}
+	}
+	return strings.Join(sections, "\n\n"), nil
+}
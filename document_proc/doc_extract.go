@@ -0,0 +1,275 @@
+package document_proc
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// downloadClient downloads remote files, e.g. from the Telegram file API
+var downloadClient = &http.Client{Timeout: 2 * time.Minute}
+
+// Extractor extracts the text of one document format. Extractors keep the structure they can
+// as plain text: headings as Markdown "#" lines, table rows as "header: value" lines and slide titles.
+type Extractor interface {
+	Extract(filePath string) (string, error)
+}
+
+// ExtractorFunc adapts a function to the Extractor interface
+type ExtractorFunc func(filePath string) (string, error)
+
+func (f ExtractorFunc) Extract(filePath string) (string, error) {
+	return f(filePath)
+}
+
+// Registered extractors by MIME type (without parameters) and by lowercase extension (with the dot)
+var (
+	extractorsByMIME      = make(map[string]Extractor)
+	extractorsByExtension = make(map[string]Extractor)
+)
+
+// RegisterExtractor registers an extractor for MIME types and file extensions, replacing earlier registrations
+func RegisterExtractor(extractor Extractor, mimeTypes []string, extensions []string) {
+	for _, mimeType := range mimeTypes {
+		extractorsByMIME[mimeType] = extractor
+	}
+	for _, extension := range extensions {
+		extractorsByExtension[strings.ToLower(extension)] = extractor
+	}
+}
+
+func init() {
+	RegisterExtractor(ExtractorFunc(readLocalFile), []string{"text/plain"}, []string{".txt", ".text", ".log"})
+	RegisterExtractor(ExtractorFunc(extractTextFromDocx),
+		[]string{"application/vnd.openxmlformats-officedocument.wordprocessingml.document"}, []string{".docx"})
+	RegisterExtractor(ExtractorFunc(extractTextFromPDF), []string{"application/pdf"}, []string{".pdf"})
+	RegisterExtractor(ExtractorFunc(extractTextFromHTML), []string{"text/html", "application/xhtml+xml"}, []string{".html", ".htm", ".xhtml"})
+	RegisterExtractor(ExtractorFunc(extractTextFromMarkdown), []string{"text/markdown"}, []string{".md", ".markdown"})
+	RegisterExtractor(ExtractorFunc(extractTextFromCSV), []string{"text/csv", "text/tab-separated-values"}, []string{".csv", ".tsv"})
+	RegisterExtractor(ExtractorFunc(extractTextFromXLSX),
+		[]string{"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"}, []string{".xlsx"})
+	RegisterExtractor(ExtractorFunc(extractTextFromPPTX),
+		[]string{"application/vnd.openxmlformats-officedocument.presentationml.presentation"}, []string{".pptx"})
+	RegisterExtractor(ExtractorFunc(extractTextFromEPUB), []string{"application/epub+zip"}, []string{".epub"})
+}
+
+// DownloadAndExtractText extracts the text of a local file or a remote URL with the extractor registered for its format
+func DownloadAndExtractText(filePathOrURL string) (string, error) {
+	filePath := filePathOrURL
+	if isRemoteURL(filePathOrURL) {
+		downloaded, err := DownloadToTempFile(filePathOrURL)
+		if err != nil {
+			return "", err
+		}
+		defer os.Remove(downloaded)
+		filePath = downloaded
+	}
+
+	extractor, err := selectExtractor(filePath)
+	if err != nil {
+		return "", err
+	}
+	return extractor.Extract(filePath)
+}
+
+// CanExtract reports whether an extractor is registered for the format of the local file
+func CanExtract(filePath string) bool {
+	_, err := selectExtractor(filePath)
+	return err == nil
+}
+
+// selectExtractor picks the extractor by the sniffed MIME type of the file, then by its extension.
+// Text types are only sniffed heuristically (a text file with commas may look like CSV),
+// so for those a registered extension wins.
+func selectExtractor(filePath string) (Extractor, error) {
+	extension := strings.ToLower(filepath.Ext(filePath))
+	byExtension, extensionFound := extractorsByExtension[extension]
+
+	mtype, err := mimetype.DetectFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %v", err)
+	}
+	if !extensionFound || !strings.HasPrefix(mtype.String(), "text/") {
+		for m := mtype; m != nil; m = m.Parent() {
+			if extractor, found := extractorsByMIME[strings.TrimSpace(strings.Split(m.String(), ";")[0])]; found {
+				return extractor, nil
+			}
+		}
+	}
+	if extensionFound {
+		return byExtension, nil
+	}
+	return nil, fmt.Errorf("unsupported file type %s (%s)", mtype.String(), extension)
+}
+
+func isRemoteURL(filePathOrURL string) bool {
+	return strings.HasPrefix(filePathOrURL, "http://") || strings.HasPrefix(filePathOrURL, "https://")
+}
+
+// DownloadToTempFile saves a remote file to a temporary file with the same extension. The errors never
+// contain the URL, which may hold credentials such as the Telegram bot token.
+func DownloadToTempFile(fileURL string) (string, error) {
+	response, err := downloadClient.Get(fileURL)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return "", fmt.Errorf("error downloading file: %v", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error downloading file: status code %d", response.StatusCode)
+	}
+
+	extension := ""
+	if parsed, err := url.Parse(fileURL); err == nil {
+		extension = path.Ext(parsed.Path)
+	}
+	file, err := os.CreateTemp("", "document-*"+extension)
+	if err != nil {
+		return "", fmt.Errorf("error creating temporary file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, response.Body); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("error downloading file: %v", err)
+	}
+	return file.Name(), nil
+}
+
+// readZipEntry reads a file from a zip based format (XLSX, PPTX, EPUB). Missing entries return os.ErrNotExist.
+func readZipEntry(archive *zip.Reader, name string) ([]byte, error) {
+	name = strings.TrimPrefix(name, "/")
+	for _, file := range archive.File {
+		if file.Name == name {
+			reader, err := file.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer reader.Close()
+			return io.ReadAll(reader)
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// readZipXML unmarshals an XML file of a zip based format
+func readZipXML(archive *zip.Reader, name string, value interface{}) error {
+	content, err := readZipEntry(archive, name)
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(content, value)
+}
+
+// relationshipTargets maps the relationship IDs of an OOXML part to the paths of their targets in the archive
+func relationshipTargets(archive *zip.Reader, part string) (map[string]string, error) {
+	var relationships ooxmlRelationships
+	relsPath := path.Join(path.Dir(part), "_rels", path.Base(part)+".rels")
+	if err := readZipXML(archive, relsPath, &relationships); err != nil {
+		return nil, err
+	}
+
+	targets := make(map[string]string)
+	for _, relationship := range relationships.Relationships {
+		target := relationship.Target
+		if !strings.HasPrefix(target, "/") {
+			target = path.Join(path.Dir(part), target)
+		}
+		targets[relationship.ID] = strings.TrimPrefix(target, "/")
+	}
+	return targets, nil
+}
+
+// relationshipID returns the r:id attribute, whatever the relationships namespace (transitional or strict OOXML)
+func relationshipID(attrs []xml.Attr) string {
+	for _, attr := range attrs {
+		if attr.Name.Local == "id" && attr.Name.Space != "" {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// attrValue returns the value of an attribute by local name
+func attrValue(attrs []xml.Attr, local string) string {
+	for _, attr := range attrs {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// Relationships of an OOXML part (_rels/<part>.rels)
+type ooxmlRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Type   string `xml:"Type,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// tableText writes table rows as lines of "header: value" pairs, skipping empty cells,
+// so each record stays readable on its own once the text is chunked. Without a header the cells are joined with " | ".
+func tableText(header []string, rows [][]string) string {
+	var lines []string
+	for _, row := range rows {
+		var cells []string
+		for i, cell := range row {
+			cell = strings.Join(strings.Fields(cell), " ")
+			if cell == "" {
+				continue
+			}
+			if header == nil {
+				cells = append(cells, cell)
+				continue
+			}
+			key := ""
+			if i < len(header) {
+				key = strings.Join(strings.Fields(header[i]), " ")
+			}
+			if key == "" {
+				key = fmt.Sprintf("Column %d", i+1)
+			}
+			cells = append(cells, key+": "+cell)
+		}
+		if len(cells) == 0 {
+			continue
+		}
+		if header == nil {
+			lines = append(lines, strings.Join(cells, " | "))
+		} else {
+			lines = append(lines, strings.Join(cells, "; "))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// headerTableText uses the first non-empty row as header, as in spreadsheets and CSV files
+func headerTableText(rows [][]string) string {
+	for i, row := range rows {
+		for _, cell := range row {
+			if strings.TrimSpace(cell) != "" {
+				if i+1 == len(rows) {
+					return tableText(nil, rows[i:])
+				}
+				return tableText(row, rows[i+1:])
+			}
+		}
+	}
+	return ""
+}
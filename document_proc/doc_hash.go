@@ -0,0 +1,54 @@
+package document_proc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// HashFile returns the SHA-256 of the bytes of a local file, hex encoded. Remote files are downloaded
+// once with DownloadToTempFile and hashed from the local copy.
+func HashFile(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("error reading file: %v", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// NormalizeChunkText lowercases the text and collapses whitespace, so chunks differing only in
+// line breaks, indentation or case compare equal
+func NormalizeChunkText(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
+
+// HashChunk returns the SHA-256 of the normalised chunk text, hex encoded
+func HashChunk(text string) string {
+	hash := sha256.Sum256([]byte(NormalizeChunkText(text)))
+	return hex.EncodeToString(hash[:])
+}
+
+// dropDuplicateTexts keeps the first (best ranked) of the chunks with the same normalised text,
+// e.g. the same passage stored in two documents
+func dropDuplicateTexts(chunks []ScoredChunk) []ScoredChunk {
+	seen := make(map[string]struct{}, len(chunks))
+	unique := chunks[:0]
+	for _, chunk := range chunks {
+		key := NormalizeChunkText(chunk.Text)
+		if _, found := seen[key]; found {
+			continue
+		}
+		seen[key] = struct{}{}
+		unique = append(unique, chunk)
+	}
+	return unique
+}
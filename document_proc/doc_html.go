@@ -0,0 +1,202 @@
+package document_proc
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// extractTextFromHTML extracts the text of an HTML page, keeping headings, list items and tables
+func extractTextFromHTML(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error opening HTML file: %v", err)
+	}
+	defer file.Close()
+
+	return htmlText(file)
+}
+
+// htmlText converts an HTML document to plain text. Headings become Markdown "#" lines, list items "- " lines
+// and table rows "header: value" lines. Scripts, styles and navigation are skipped.
+func htmlText(reader io.Reader) (string, error) {
+	root, err := parseHTML(reader, "text/html")
+	if err != nil {
+		return "", err
+	}
+
+	writer := &htmlTextWriter{}
+	return writer.text(root), nil
+}
+
+// parseHTML parses a page, decoding the charset given in the content type or declared in the page
+func parseHTML(reader io.Reader, contentType string) (*html.Node, error) {
+	decoded, err := charset.NewReader(reader, contentType)
+	if err != nil {
+		return nil, fmt.Errorf("error detecting HTML charset: %v", err)
+	}
+	root, err := html.Parse(decoded)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing HTML: %v", err)
+	}
+	return root, nil
+}
+
+// htmlTextWriter collects the text of the page line by line
+type htmlTextWriter struct {
+	lines   []string
+	current strings.Builder
+	prefix  string // Prefix of the current line, "## " for headings or "- " for list items
+
+	skip func(node *html.Node) bool // Elements left out with their content, e.g. the boilerplate of crawled pages
+}
+
+// text writes the node and returns the text collected so far
+func (w *htmlTextWriter) text(node *html.Node) string {
+	w.walk(node)
+	w.blankLine()
+	return strings.TrimSpace(strings.Join(w.lines, "\n"))
+}
+
+// breakLine ends the current line, collapsing its whitespace
+func (w *htmlTextWriter) breakLine() {
+	line := strings.Join(strings.Fields(w.current.String()), " ")
+	if line != "" {
+		w.lines = append(w.lines, w.prefix+line)
+	}
+	w.current.Reset()
+	w.prefix = ""
+}
+
+// blankLine ends the current line and separates the next block with an empty line
+func (w *htmlTextWriter) blankLine() {
+	w.breakLine()
+	if len(w.lines) > 0 && w.lines[len(w.lines)-1] != "" {
+		w.lines = append(w.lines, "")
+	}
+}
+
+func (w *htmlTextWriter) walkChildren(node *html.Node) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		w.walk(child)
+	}
+}
+
+func (w *htmlTextWriter) walk(node *html.Node) {
+	switch node.Type {
+	case html.TextNode:
+		w.current.WriteString(node.Data)
+		return
+	case html.ElementNode:
+	default:
+		w.walkChildren(node)
+		return
+	}
+
+	if w.skip != nil && w.skip(node) {
+		return
+	}
+
+	switch node.DataAtom {
+	case atom.Script, atom.Style, atom.Noscript, atom.Template, atom.Head, atom.Nav, atom.Svg, atom.Iframe:
+		return
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		w.blankLine()
+		w.prefix = strings.Repeat("#", int(node.Data[1]-'0')) + " "
+		w.walkChildren(node)
+		w.blankLine()
+	case atom.Li:
+		w.breakLine()
+		w.prefix = "- "
+		w.walkChildren(node)
+		w.breakLine()
+	case atom.Br:
+		w.breakLine()
+	case atom.Pre:
+		w.blankLine()
+		w.lines = append(w.lines, strings.Split(strings.Trim(nodeText(node), "\n"), "\n")...)
+		w.blankLine()
+	case atom.Table:
+		w.blankLine()
+		if text := htmlTableText(node); text != "" {
+			w.lines = append(w.lines, strings.Split(text, "\n")...)
+		}
+		w.blankLine()
+	case atom.P, atom.Blockquote, atom.Ul, atom.Ol, atom.Dl, atom.Section, atom.Article, atom.Header, atom.Footer,
+		atom.Main, atom.Aside, atom.Figure, atom.Hr:
+		w.blankLine()
+		w.walkChildren(node)
+		w.blankLine()
+	case atom.Div, atom.Dt, atom.Dd, atom.Tr, atom.Figcaption, atom.Caption, atom.Address, atom.Details, atom.Summary:
+		w.breakLine()
+		w.walkChildren(node)
+		w.breakLine()
+	default:
+		w.walkChildren(node)
+	}
+}
+
+// htmlTableText writes the rows of a table, using the first row as header when it's made of <th> cells
+func htmlTableText(table *html.Node) string {
+	var rows [][]string
+	headerRow := false
+	var collect func(node *html.Node)
+	collect = func(node *html.Node) {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			switch child.DataAtom {
+			case atom.Table:
+				continue // Nested tables are rare layout tables, their text stays in the cell
+			case atom.Tr:
+				var row []string
+				allHeaders := true
+				for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.DataAtom == atom.Td || cell.DataAtom == atom.Th {
+						row = append(row, nodeText(cell))
+						allHeaders = allHeaders && cell.DataAtom == atom.Th
+					}
+				}
+				if len(rows) == 0 && len(row) > 0 {
+					headerRow = allHeaders
+				}
+				if len(row) > 0 {
+					rows = append(rows, row)
+				}
+			default:
+				collect(child) // thead, tbody, tfoot
+			}
+		}
+	}
+	collect(table)
+
+	if headerRow && len(rows) > 1 {
+		return tableText(rows[0], rows[1:])
+	}
+	return tableText(nil, rows)
+}
+
+// nodeText returns the text inside a node, without scripts and styles
+func nodeText(node *html.Node) string {
+	var text strings.Builder
+	var collect func(node *html.Node)
+	collect = func(node *html.Node) {
+		if node.Type == html.TextNode {
+			text.WriteString(node.Data)
+		}
+		if node.DataAtom == atom.Script || node.DataAtom == atom.Style {
+			return
+		}
+		if node.DataAtom == atom.Br {
+			text.WriteString("\n")
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			collect(child)
+		}
+	}
+	collect(node)
+	return text.String()
+}
@@ -0,0 +1,151 @@
+package document_proc
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Matching methods of the intent classifier
+const (
+	IntentMatchCentroid = "centroid" // Nearest mean embedding of the examples of each intent
+	IntentMatchKNN      = "knn"      // Similarity-weighted vote of the nearest examples
+)
+
+// IntentMatch is the intent detected for a message with its confidence, the cosine similarity to the
+// centroid of the intent (centroid) or the mean similarity of its examples among the neighbors (knn)
+type IntentMatch struct {
+	Intent     string
+	Confidence float64
+}
+
+// IntentClassifier detects the intent of a message from its embedding, using the embeddings of
+// example utterances of each intent. It is safe for concurrent use once trained.
+type IntentClassifier struct {
+	method    string
+	neighbors int
+	threshold float64
+	examples  []intentExample
+	centroids map[string][]float64
+}
+
+type intentExample struct {
+	intent    string
+	embedding []float64
+}
+
+// NewIntentClassifier creates a classifier matching with the given method. Matches below the
+// confidence threshold are rejected; neighbors is the k of the knn method.
+func NewIntentClassifier(method string, neighbors int, threshold float64) (*IntentClassifier, error) {
+	switch method {
+	case IntentMatchCentroid:
+	case IntentMatchKNN:
+		if neighbors < 1 {
+			return nil, fmt.Errorf("knn intent matching needs at least 1 neighbor, got %d", neighbors)
+		}
+	default:
+		return nil, fmt.Errorf("unknown intent matching method %q (expected %s or %s)", method, IntentMatchCentroid, IntentMatchKNN)
+	}
+	return &IntentClassifier{method: method, neighbors: neighbors, threshold: threshold}, nil
+}
+
+// Train replaces the examples of the classifier with the example embeddings of each intent
+func (c *IntentClassifier) Train(examples map[string][][]float64) {
+	c.examples = nil
+	c.centroids = make(map[string][]float64, len(examples))
+	for intent, embeddings := range examples {
+		var centroid []float64
+		count := 0
+		for _, embedding := range embeddings {
+			if len(embedding) == 0 || (centroid != nil && len(embedding) != len(centroid)) {
+				continue // Embedded with another model
+			}
+			if centroid == nil {
+				centroid = make([]float64, len(embedding))
+			}
+			for i, value := range embedding {
+				centroid[i] += value
+			}
+			count++
+			c.examples = append(c.examples, intentExample{intent: intent, embedding: embedding})
+		}
+		if count > 0 {
+			for i := range centroid {
+				centroid[i] /= float64(count)
+			}
+			c.centroids[intent] = centroid
+		}
+	}
+}
+
+// Len returns the number of intents the classifier can detect
+func (c *IntentClassifier) Len() int {
+	return len(c.centroids)
+}
+
+// Classify returns the best intent for the message embedding, and false when no intent reaches the threshold
+func (c *IntentClassifier) Classify(embedding []float64) (IntentMatch, bool) {
+	var best IntentMatch
+	if c.method == IntentMatchKNN {
+		best = c.classifyKNN(embedding)
+	} else {
+		best = c.classifyCentroid(embedding)
+	}
+	if best.Intent == "" || best.Confidence < c.threshold {
+		return best, false
+	}
+	return best, true
+}
+
+func (c *IntentClassifier) classifyCentroid(embedding []float64) IntentMatch {
+	best := IntentMatch{Confidence: math.Inf(-1)}
+	for intent, centroid := range c.centroids {
+		if len(centroid) != len(embedding) {
+			continue
+		}
+		score := cosineSimilarity(embedding, centroid)
+		if score > best.Confidence || (score == best.Confidence && intent < best.Intent) {
+			best = IntentMatch{Intent: intent, Confidence: score}
+		}
+	}
+	if best.Intent == "" {
+		return IntentMatch{}
+	}
+	return best
+}
+
+// classifyKNN weights the votes of the nearest examples by their similarity
+func (c *IntentClassifier) classifyKNN(embedding []float64) IntentMatch {
+	type neighbor struct {
+		intent string
+		score  float64
+	}
+	var neighbors []neighbor
+	for _, example := range c.examples {
+		if len(example.embedding) != len(embedding) {
+			continue
+		}
+		neighbors = append(neighbors, neighbor{intent: example.intent, score: cosineSimilarity(embedding, example.embedding)})
+	}
+	sort.Slice(neighbors, func(i, j int) bool { return neighbors[i].score > neighbors[j].score })
+	if len(neighbors) > c.neighbors {
+		neighbors = neighbors[:c.neighbors]
+	}
+
+	votes := make(map[string]float64)
+	counts := make(map[string]int)
+	for _, n := range neighbors {
+		votes[n.intent] += math.Max(n.score, 0)
+		counts[n.intent]++
+	}
+
+	var best IntentMatch
+	bestVotes := 0.0
+	for intent, vote := range votes {
+		if vote > bestVotes || (vote == bestVotes && vote > 0 && intent < best.Intent) {
+			bestVotes = vote
+			best = IntentMatch{Intent: intent, Confidence: vote / float64(counts[intent])}
+		}
+	}
+	return best
+}
@@ -0,0 +1,118 @@
+package document_proc
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewIntentClassifier(t *testing.T) {
+	tests := []struct {
+		method    string
+		neighbors int
+		wantErr   bool
+	}{
+		{IntentMatchCentroid, 0, false}, // k is only used by knn
+		{IntentMatchKNN, 3, false},
+		{IntentMatchKNN, 0, true},
+		{IntentMatchKNN, -1, true},
+		{"nearest", 3, true},
+		{"", 3, true},
+	}
+	for _, tt := range tests {
+		_, err := NewIntentClassifier(tt.method, tt.neighbors, 0.5)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewIntentClassifier(%q, %d) error = %v, want error %v", tt.method, tt.neighbors, err, tt.wantErr)
+		}
+	}
+}
+
+func TestIntentClassifierClassify(t *testing.T) {
+	examples := map[string][][]float64{
+		"billing": {{1, 0, 0}, {0.9, 0.1, 0}},
+		"setup":   {{0, 1, 0}, {0.1, 0.9, 0}, {0, 0.6, 0.8}},
+		// The 2-dimensional example was embedded with another model and is skipped
+		"refund": {{0, 0, 1}, {1, 0}},
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		neighbors  int
+		threshold  float64
+		query      []float64
+		wantIntent string
+		wantOK     bool
+	}{
+		{"centroid", IntentMatchCentroid, 0, 0.5, []float64{0.95, 0.05, 0}, "billing", true},
+		{"centroid second intent", IntentMatchCentroid, 0, 0.5, []float64{0, 1, 0.1}, "setup", true},
+		{"centroid below threshold", IntentMatchCentroid, 0, 0.99, []float64{0.5, 0.5, 0.5}, "", false},
+		{"knn", IntentMatchKNN, 3, 0.5, []float64{0.1, 0.9, 0}, "setup", true},
+		// The refund centroid is the closest, but the nearest example is a setup example
+		{"centroid outlier example", IntentMatchCentroid, 0, 0.5, []float64{0, 0.5, 0.9}, "refund", true},
+		{"knn nearest example", IntentMatchKNN, 1, 0.5, []float64{0, 0.5, 0.9}, "setup", true},
+		{"knn below threshold", IntentMatchKNN, 3, 0.9, []float64{0.5, 0.5, 0.5}, "", false},
+		{"no intent of the query dimension", IntentMatchCentroid, 0, 0, []float64{1, 0, 0, 0}, "", false},
+		{"knn no intent of the query dimension", IntentMatchKNN, 3, 0, []float64{1, 0, 0, 0}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			classifier, err := NewIntentClassifier(tt.method, tt.neighbors, tt.threshold)
+			if err != nil {
+				t.Fatalf("NewIntentClassifier: %v", err)
+			}
+			classifier.Train(examples)
+			if classifier.Len() != 3 {
+				t.Fatalf("Len = %d, want 3", classifier.Len())
+			}
+
+			match, ok := classifier.Classify(tt.query)
+			if ok != tt.wantOK {
+				t.Fatalf("Classify = %+v, %v; want ok %v", match, ok, tt.wantOK)
+			}
+			if ok && match.Intent != tt.wantIntent {
+				t.Fatalf("Classify = %+v, want %s", match, tt.wantIntent)
+			}
+		})
+	}
+}
+
+func TestIntentClassifierSkipsMixedDimensions(t *testing.T) {
+	classifier, _ := NewIntentClassifier(IntentMatchCentroid, 0, 0)
+	classifier.Train(map[string][][]float64{
+		"setup": {{0, 1, 0}, {1, 0}, {0, 1, 0}, nil},
+	})
+	if len(classifier.examples) != 2 {
+		t.Fatalf("%d examples kept, want 2", len(classifier.examples))
+	}
+	// The skipped examples don't pull the centroid away from (0, 1, 0)
+	match, ok := classifier.Classify([]float64{0, 1, 0})
+	if !ok || match.Intent != "setup" || math.Abs(match.Confidence-1) > 1e-9 {
+		t.Fatalf("Classify = %+v, %v; want setup with confidence 1", match, ok)
+	}
+}
+
+func TestIntentClassifierTies(t *testing.T) {
+	// Identical examples: the alphabetically first intent wins, whatever the map order
+	examples := map[string][][]float64{
+		"order":   {{1, 0}},
+		"billing": {{1, 0}},
+		"setup":   {{1, 0}},
+	}
+	for _, method := range []string{IntentMatchCentroid, IntentMatchKNN} {
+		classifier, _ := NewIntentClassifier(method, 3, 0.5)
+		classifier.Train(examples)
+		for i := 0; i < 20; i++ {
+			match, ok := classifier.Classify([]float64{1, 0})
+			if !ok || match.Intent != "billing" {
+				t.Fatalf("%s: Classify = %+v, %v; want billing", method, match, ok)
+			}
+		}
+	}
+}
+
+func TestIntentClassifierUntrained(t *testing.T) {
+	classifier, _ := NewIntentClassifier(IntentMatchKNN, 3, 0)
+	if match, ok := classifier.Classify([]float64{1, 0}); ok || match.Intent != "" {
+		t.Fatalf("Classify = %+v, %v; want no intent", match, ok)
+	}
+}
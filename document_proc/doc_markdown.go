@@ -0,0 +1,108 @@
+package document_proc
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	markdownImage      = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	markdownLink       = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	markdownEmphasis   = regexp.MustCompile(`(\*\*|__)(\S(?:.*?\S)?)(\*\*|__)`)
+	markdownCode       = regexp.MustCompile("`([^`]+)`")
+	markdownComment    = regexp.MustCompile(`(?s)<!--.*?-->`)
+	markdownListMarker = regexp.MustCompile(`^(\s*)[*+]\s+`)
+	markdownTableRule  = regexp.MustCompile(`^\|?\s*:?-{2,}:?\s*(\|\s*:?-{2,}:?\s*)*\|?$`)
+	markdownSetextRule = regexp.MustCompile(`^(=+|-+)$`)
+)
+
+// extractTextFromMarkdown extracts the text of a Markdown file. Headings are kept, tables become
+// "header: value" lines, and link, emphasis and code markup is removed.
+func extractTextFromMarkdown(filePath string) (string, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error reading Markdown file: %v", err)
+	}
+	return markdownText(string(content)), nil
+}
+
+func markdownText(content string) string {
+	content = strings.ReplaceAll(strings.TrimPrefix(content, "\uFEFF"), "\r\n", "\n")
+	content = markdownComment.ReplaceAllString(content, "")
+	lines := strings.Split(content, "\n")
+
+	// Front matter between "---" lines at the top of the file
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) == "---" {
+		for i := 1; i < len(lines); i++ {
+			if strings.TrimSpace(lines[i]) == "---" {
+				lines = lines[i+1:]
+				break
+			}
+		}
+	}
+
+	var output []string
+	inFence := false
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+		trimmed := strings.TrimSpace(line)
+
+		// Code blocks are kept verbatim without the fences
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			output = append(output, line)
+			continue
+		}
+
+		// Setext headings, a line underlined with === or ---
+		if trimmed != "" && i+1 < len(lines) && markdownSetextRule.MatchString(strings.TrimSpace(lines[i+1])) &&
+			!strings.HasPrefix(trimmed, "|") {
+			level := "#"
+			if strings.HasPrefix(strings.TrimSpace(lines[i+1]), "-") {
+				level = "##"
+			}
+			output = append(output, level+" "+markdownInline(trimmed))
+			i++
+			continue
+		}
+
+		// Tables, a header row followed by a |---|---| rule
+		if strings.HasPrefix(trimmed, "|") && i+1 < len(lines) && markdownTableRule.MatchString(strings.TrimSpace(lines[i+1])) {
+			header := markdownTableCells(trimmed)
+			var rows [][]string
+			i += 2
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), "|"); i++ {
+				rows = append(rows, markdownTableCells(strings.TrimSpace(lines[i])))
+			}
+			i--
+			output = append(output, tableText(header, rows))
+			continue
+		}
+
+		line = markdownListMarker.ReplaceAllString(line, "$1- ")
+		output = append(output, markdownInline(line))
+	}
+	return strings.TrimSpace(strings.Join(output, "\n"))
+}
+
+// markdownInline removes inline markup, keeping link and image texts
+func markdownInline(line string) string {
+	line = markdownImage.ReplaceAllString(line, "$1")
+	line = markdownLink.ReplaceAllString(line, "$1")
+	line = markdownEmphasis.ReplaceAllString(line, "$2")
+	return markdownCode.ReplaceAllString(line, "$1")
+}
+
+func markdownTableCells(line string) []string {
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "|"), "|")
+	cells := strings.Split(line, "|")
+	for i, cell := range cells {
+		cells[i] = markdownInline(strings.TrimSpace(cell))
+	}
+	return cells
+}
@@ -0,0 +1,440 @@
+package document_proc
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Pages with fewer visible characters are treated as scanned pages without a text layer
+const minPageTextChars = 10
+
+// PDFExtractor reads the text layer of PDF files in Go. The Python script is only run for OCR:
+// for pages without text (scanned pages) and for files the Go parser cannot read.
+type PDFExtractor struct {
+	OCRFallback bool
+	PythonPath  string
+	ScriptPath  string
+}
+
+func NewPDFExtractor(ocrFallback bool, pythonPath, scriptPath string) *PDFExtractor {
+	return &PDFExtractor{OCRFallback: ocrFallback, PythonPath: pythonPath, ScriptPath: scriptPath}
+}
+
+var pdfExtractor = NewPDFExtractor(false, "python", "./python_scripts/extractPDF.py")
+
+// SetPDFExtractor replaces the extractor used for PDF uploads
+func SetPDFExtractor(extractor *PDFExtractor) {
+	pdfExtractor = extractor
+}
+
+// extractTextFromPDF extracts the text of a PDF file
+func extractTextFromPDF(filePath string) (string, error) {
+	return pdfExtractor.Extract(filePath)
+}
+
+// Extract returns the text of the PDF pages separated by blank lines
+func (e *PDFExtractor) Extract(filePath string) (string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error reading PDF file: %v", err)
+	}
+
+	pages, err := extractPDFPages(data)
+	if err != nil {
+		if !e.OCRFallback {
+			return "", fmt.Errorf("error extracting PDF text: %v", err)
+		}
+		fmt.Printf("Error extracting PDF text (%v), falling back to the Python extractor\n", err)
+		return e.runScript(filePath)
+	}
+
+	var scanned []int
+	for i, text := range pages {
+		if visibleChars(text) < minPageTextChars {
+			scanned = append(scanned, i)
+		}
+	}
+	if len(scanned) > 0 && e.OCRFallback {
+		e.ocrPages(filePath, pages, scanned)
+	} else if len(scanned) == len(pages) {
+		return "", fmt.Errorf("no text layer found in PDF (scanned document?), enable PDF_OCR_FALLBACK to read it with OCR")
+	} else if len(scanned) > 0 {
+		fmt.Printf("%d of %d pages of %s have no text layer and are skipped\n", len(scanned), len(pages), filePath)
+	}
+
+	var texts []string
+	for _, text := range pages {
+		if text = strings.TrimSpace(text); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, "\n\n"), nil
+}
+
+// ocrPages replaces the text of the given pages (0-based) with the OCR output of the Python script
+func (e *PDFExtractor) ocrPages(filePath string, pages []string, indexes []int) {
+	numbers := make([]string, len(indexes))
+	for i, index := range indexes {
+		numbers[i] = strconv.Itoa(index + 1)
+	}
+	fmt.Printf("Running OCR on pages %s of %s\n", strings.Join(numbers, ","), filePath)
+
+	output, err := e.runScript(filePath, "--ocr-pages", strings.Join(numbers, ","))
+	if err != nil {
+		fmt.Printf("Error running OCR on %s: %v\n", filePath, err)
+		return
+	}
+
+	// The script prints the pages separated by form feeds
+	for i, text := range strings.Split(output, "\f") {
+		if i < len(indexes) && visibleChars(text) > visibleChars(pages[indexes[i]]) {
+			pages[indexes[i]] = text
+		}
+	}
+}
+
+func (e *PDFExtractor) runScript(filePath string, args ...string) (string, error) {
+	cmd := exec.Command(e.PythonPath, append([]string{e.ScriptPath, filePath}, args...)...)
+
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("error running Python script: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out.String(), nil
+}
+
+func visibleChars(text string) int {
+	count := 0
+	for _, r := range text {
+		if !unicode.IsSpace(r) {
+			count++
+		}
+	}
+	return count
+}
+
+// extractPDFPages returns the text of every page of the PDF
+func extractPDFPages(data []byte) ([]string, error) {
+	doc, err := parsePDF(data)
+	if err != nil {
+		return nil, err
+	}
+
+	catalog := doc.dict(doc.trailer["Root"])
+	pages := doc.pageList(catalog["Pages"], pdfPageAttributes{}, make(map[int]bool))
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("no pages found in PDF")
+	}
+
+	reader := newPDFContentReader(doc)
+	texts := make([]string, len(pages))
+	for i, page := range pages {
+		reader.spans = reader.spans[:0]
+		reader.run(doc.pageContents(page.dict), page.resources, page.rotation(), 0)
+		texts[i] = layoutPage(reader.spans)
+	}
+	return texts, nil
+}
+
+// pdfPageAttributes are the page attributes inherited from the page tree
+type pdfPageAttributes struct {
+	resources pdfDict
+	mediaBox  [4]float64
+	rotate    int
+}
+
+type pdfPage struct {
+	pdfPageAttributes
+	dict pdfDict
+}
+
+// pageList walks the page tree in order
+func (doc *pdfDocument) pageList(node interface{}, inherited pdfPageAttributes, visited map[int]bool) []pdfPage {
+	if num := refNum(node); num >= 0 {
+		if visited[num] {
+			return nil
+		}
+		visited[num] = true
+	}
+	dict := doc.dict(node)
+	if dict == nil {
+		return nil
+	}
+
+	if resources := doc.dict(dict["Resources"]); resources != nil {
+		inherited.resources = resources
+	}
+	if box := doc.array(dict["MediaBox"]); len(box) == 4 {
+		for i := range inherited.mediaBox {
+			inherited.mediaBox[i], _ = doc.number(box[i])
+		}
+	}
+	if rotate, ok := doc.integer(dict["Rotate"]); ok {
+		inherited.rotate = rotate
+	}
+
+	kids := doc.array(dict["Kids"])
+	if doc.name(dict["Type"]) == "Page" || (kids == nil && dict["Contents"] != nil) {
+		return []pdfPage{{pdfPageAttributes: inherited, dict: dict}}
+	}
+
+	var pages []pdfPage
+	for _, kid := range kids {
+		pages = append(pages, doc.pageList(kid, inherited, visited)...)
+	}
+	return pages
+}
+
+// pageContents concatenates the content streams of the page
+func (doc *pdfDocument) pageContents(page pdfDict) []byte {
+	streams := []interface{}{page["Contents"]}
+	if array := doc.array(page["Contents"]); array != nil {
+		streams = array
+	}
+
+	var contents []byte
+	for _, object := range streams {
+		stream, ok := doc.resolve(object).(*pdfStream)
+		if !ok {
+			continue
+		}
+		data, err := doc.decodeStream(stream)
+		if err != nil {
+			continue
+		}
+		contents = append(contents, data...)
+		contents = append(contents, '\n')
+	}
+	return contents
+}
+
+// rotation maps page space to the page as displayed, so rotated pages read left to right
+func (page pdfPage) rotation() pdfMatrix {
+	width := page.mediaBox[2] - page.mediaBox[0]
+	height := page.mediaBox[3] - page.mediaBox[1]
+	switch ((page.rotate % 360) + 360) % 360 {
+	case 90:
+		return pdfMatrix{0, -1, 1, 0, 0, width}
+	case 180:
+		return pdfMatrix{-1, 0, 0, -1, width, height}
+	case 270:
+		return pdfMatrix{0, 1, -1, 0, height, 0}
+	}
+	return identityMatrix
+}
+
+// pdfSegment is a run of text on a line, separated from other segments by a wide gap
+type pdfSegment struct {
+	text       string
+	x0, x1     float64
+	y, size    float64
+	line       int
+	wordsCount int
+}
+
+// layoutPage turns the glyphs of a page into text lines in reading order.
+// Glyphs are grouped into lines by baseline, words by the gaps between glyphs,
+// and two-column pages are read column by column.
+func layoutPage(spans []pdfTextSpan) string {
+	var glyphs []pdfTextSpan
+	for _, span := range spans {
+		if span.size > 0 && !math.IsNaN(span.x) && !math.IsNaN(span.y) {
+			glyphs = append(glyphs, span)
+		}
+	}
+	if len(glyphs) == 0 {
+		return ""
+	}
+	sort.SliceStable(glyphs, func(i, j int) bool { return glyphs[i].y > glyphs[j].y })
+
+	// Group glyphs whose baselines are close into lines
+	var lines [][]pdfTextSpan
+	var lineY, lineSize float64
+	for _, glyph := range glyphs {
+		if len(lines) > 0 && math.Abs(lineY-glyph.y) <= 0.4*max(lineSize, glyph.size) {
+			lines[len(lines)-1] = append(lines[len(lines)-1], glyph)
+			lineSize = max(lineSize, glyph.size)
+			continue
+		}
+		lines = append(lines, []pdfTextSpan{glyph})
+		lineY, lineSize = glyph.y, glyph.size
+	}
+
+	var segments []pdfSegment
+	for i, line := range lines {
+		segments = append(segments, lineSegments(line, i)...)
+	}
+	return joinSegments(orderColumns(segments))
+}
+
+// lineSegments joins the glyphs of a line into words and splits the line at wide gaps
+func lineSegments(line []pdfTextSpan, index int) []pdfSegment {
+	sort.SliceStable(line, func(i, j int) bool { return line[i].x < line[j].x })
+
+	var segments []pdfSegment
+	var text strings.Builder
+	var current pdfSegment
+	var previous *pdfTextSpan
+	pendingSpace := false
+
+	flush := func() {
+		current.text = strings.TrimSpace(text.String())
+		if current.text != "" {
+			current.wordsCount = len(strings.Fields(current.text))
+			segments = append(segments, current)
+		}
+		text.Reset()
+	}
+
+	for i := range line {
+		glyph := &line[i]
+		if previous != nil {
+			gap := glyph.x - previous.endX
+			size := max(glyph.size, previous.size)
+			if glyph.text == previous.text && math.Abs(glyph.x-previous.x) < 0.5*(previous.endX-previous.x) {
+				continue // Overprinted glyph (fake bold or shadow)
+			}
+			if gap > 1.5*size {
+				flush()
+				previous, pendingSpace = nil, false
+			} else if gap > 0.18*size {
+				pendingSpace = true
+			}
+		}
+		if previous == nil {
+			current = pdfSegment{x0: glyph.x, y: glyph.y, line: index}
+		}
+
+		if strings.TrimSpace(glyph.text) == "" {
+			pendingSpace = true
+		} else {
+			if pendingSpace && text.Len() > 0 {
+				text.WriteByte(' ')
+			}
+			text.WriteString(glyph.text)
+			pendingSpace = false
+		}
+		current.x1 = max(current.x1, glyph.endX)
+		current.size = max(current.size, glyph.size)
+		previous = glyph
+	}
+	flush()
+	return segments
+}
+
+// orderColumns reorders the segments of two-column pages so each column is read top to bottom.
+// Lines crossing the gutter (titles, full-width figures) keep their place between the column blocks.
+func orderColumns(segments []pdfSegment) []pdfSegment {
+	if len(segments) < 6 {
+		return segments
+	}
+
+	left, right := segments[0].x0, segments[0].x1
+	for _, segment := range segments {
+		left, right = min(left, segment.x0), max(right, segment.x1)
+	}
+	width := right - left
+	if width <= 0 {
+		return segments
+	}
+
+	// Text coverage of the page width, the gutter is the least covered spot in the middle half
+	const bins = 100
+	var coverage [bins]int
+	for _, segment := range segments {
+		first := int((segment.x0 - left) / width * bins)
+		last := min(int((segment.x1-left)/width*bins), bins-1)
+		for bin := max(first, 0); bin <= last; bin++ {
+			coverage[bin]++
+		}
+	}
+	gutter := bins / 4
+	for bin := bins / 4; bin < bins*3/4; bin++ {
+		if coverage[bin] < coverage[gutter] {
+			gutter = bin
+		}
+	}
+	gutterX := left + (float64(gutter)+0.5)*width/bins
+
+	var leftCount, rightCount, leftWords, rightWords int
+	for _, segment := range segments {
+		if segment.x1 <= gutterX {
+			leftCount++
+			leftWords += segment.wordsCount
+		} else if segment.x0 >= gutterX {
+			rightCount++
+			rightWords += segment.wordsCount
+		}
+	}
+	crossing := len(segments) - leftCount - rightCount
+	// Columns of prose: few lines cross the gutter and both sides hold several words per line (not a table)
+	if crossing > len(segments)/10 || leftCount < 3 || rightCount < 3 ||
+		leftWords < 3*leftCount || rightWords < 3*rightCount {
+		return segments
+	}
+
+	var ordered, leftBlock, rightBlock []pdfSegment
+	flushBlock := func() {
+		ordered = append(append(ordered, leftBlock...), rightBlock...)
+		leftBlock, rightBlock = nil, nil
+	}
+	for start := 0; start < len(segments); {
+		end := start
+		for end < len(segments) && segments[end].line == segments[start].line {
+			end++
+		}
+		line := segments[start:end]
+
+		fullWidth := false
+		for _, segment := range line {
+			if segment.x0 < gutterX && segment.x1 > gutterX {
+				fullWidth = true
+			}
+		}
+		if fullWidth {
+			flushBlock()
+			ordered = append(ordered, line...)
+		} else {
+			for _, segment := range line {
+				if segment.x1 <= gutterX {
+					leftBlock = append(leftBlock, segment)
+				} else {
+					rightBlock = append(rightBlock, segment)
+				}
+			}
+		}
+		start = end
+	}
+	flushBlock()
+	return ordered
+}
+
+// joinSegments writes the segments as lines, leaving a blank line at paragraph gaps and column breaks
+func joinSegments(segments []pdfSegment) string {
+	var text strings.Builder
+	for i, segment := range segments {
+		if i > 0 {
+			previous := segments[i-1]
+			gap := previous.y - segment.y
+			switch {
+			case segment.line == previous.line:
+				text.WriteByte(' ')
+			case gap < 0 || gap > 1.8*max(segment.size, previous.size):
+				text.WriteString("\n\n")
+			default:
+				text.WriteByte('\n')
+			}
+		}
+		text.WriteString(segment.text)
+	}
+	return text.String()
+}
@@ -0,0 +1,281 @@
+package document_proc
+
+import (
+	"bytes"
+	"math"
+)
+
+// pdfMatrix is a PDF transformation matrix [a b c d e f]
+type pdfMatrix [6]float64
+
+var identityMatrix = pdfMatrix{1, 0, 0, 1, 0, 0}
+
+// multiply returns m × n, applying m first
+func (m pdfMatrix) multiply(n pdfMatrix) pdfMatrix {
+	return pdfMatrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func translation(x, y float64) pdfMatrix {
+	return pdfMatrix{1, 0, 0, 1, x, y}
+}
+
+// pdfTextSpan is a shown glyph in page coordinates (y grows upwards)
+type pdfTextSpan struct {
+	text string
+	x, y float64
+	endX float64
+	size float64 // Font size on the page
+}
+
+// pdfGraphicsState is the part of the graphics state that affects text placement
+type pdfGraphicsState struct {
+	ctm       pdfMatrix
+	font      *pdfFont
+	fontSize  float64
+	charSpace float64
+	wordSpace float64
+	scale     float64 // Horizontal scaling
+	leading   float64
+	rise      float64
+}
+
+// Nesting limit for form XObjects
+const maxFormDepth = 8
+
+// pdfContentReader runs content streams and collects the shown glyphs
+type pdfContentReader struct {
+	doc   *pdfDocument
+	fonts map[pdfRef]*pdfFont
+	spans []pdfTextSpan
+	forms map[pdfRef]bool // Forms being run, to stop self-referencing forms
+}
+
+func newPDFContentReader(doc *pdfDocument) *pdfContentReader {
+	return &pdfContentReader{doc: doc, fonts: make(map[pdfRef]*pdfFont), forms: make(map[pdfRef]bool)}
+}
+
+// font loads a font of the resources by name, caching fonts shared between pages
+func (r *pdfContentReader) font(resources pdfDict, name pdfName) *pdfFont {
+	fontObject := r.doc.dict(resources["Font"])[name]
+	ref, isRef := fontObject.(pdfRef)
+	if isRef {
+		if font, found := r.fonts[ref]; found {
+			return font
+		}
+	}
+	font := r.doc.loadFont(fontObject)
+	if isRef {
+		r.fonts[ref] = font
+	}
+	return font
+}
+
+// run interprets a content stream with the given resources and initial transformation
+func (r *pdfContentReader) run(data []byte, resources pdfDict, ctm pdfMatrix, depth int) {
+	state := pdfGraphicsState{ctm: ctm, scale: 1}
+	var stack []pdfGraphicsState
+	textMatrix, lineMatrix := identityMatrix, identityMatrix
+
+	lexer := &pdfLexer{data: data}
+	var operands []interface{}
+	for {
+		object, err := lexer.readObject()
+		if err != nil {
+			return
+		}
+		operator, isOperator := object.(pdfKeyword)
+		if !isOperator {
+			operands = append(operands, object)
+			continue
+		}
+
+		number := func(i int) float64 {
+			if i >= len(operands) {
+				return 0
+			}
+			value, _ := r.doc.number(operands[i])
+			return value
+		}
+		nextLine := func(tx, ty float64) {
+			lineMatrix = translation(tx, ty).multiply(lineMatrix)
+			textMatrix = lineMatrix
+		}
+
+		switch operator {
+		case "q":
+			stack = append(stack, state)
+		case "Q":
+			if len(stack) > 0 {
+				state = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case "cm":
+			if len(operands) == 6 {
+				state.ctm = pdfMatrix{number(0), number(1), number(2), number(3), number(4), number(5)}.multiply(state.ctm)
+			}
+		case "BT":
+			textMatrix, lineMatrix = identityMatrix, identityMatrix
+		case "Tf":
+			if len(operands) == 2 {
+				if name, ok := operands[0].(pdfName); ok {
+					state.font = r.font(resources, name)
+				}
+				state.fontSize = number(1)
+			}
+		case "Tc":
+			state.charSpace = number(0)
+		case "Tw":
+			state.wordSpace = number(0)
+		case "Tz":
+			state.scale = number(0) / 100
+		case "TL":
+			state.leading = number(0)
+		case "Ts":
+			state.rise = number(0)
+		case "Td":
+			nextLine(number(0), number(1))
+		case "TD":
+			state.leading = -number(1)
+			nextLine(number(0), number(1))
+		case "Tm":
+			if len(operands) == 6 {
+				lineMatrix = pdfMatrix{number(0), number(1), number(2), number(3), number(4), number(5)}
+				textMatrix = lineMatrix
+			}
+		case "T*":
+			nextLine(0, -state.leading)
+		case "Tj":
+			if len(operands) > 0 {
+				r.show(operands[len(operands)-1], &state, &textMatrix)
+			}
+		case "'":
+			nextLine(0, -state.leading)
+			if len(operands) > 0 {
+				r.show(operands[len(operands)-1], &state, &textMatrix)
+			}
+		case "\"":
+			if len(operands) == 3 {
+				state.wordSpace, state.charSpace = number(0), number(1)
+				nextLine(0, -state.leading)
+				r.show(operands[2], &state, &textMatrix)
+			}
+		case "TJ":
+			if len(operands) == 0 {
+				break
+			}
+			array, _ := operands[len(operands)-1].(pdfArray)
+			for _, item := range array {
+				if _, isString := item.(pdfString); isString {
+					r.show(item, &state, &textMatrix)
+					continue
+				}
+				adjustment, _ := r.doc.number(item)
+				textMatrix = translation(-adjustment/1000*state.fontSize*state.scale, 0).multiply(textMatrix)
+			}
+		case "Do":
+			if len(operands) > 0 && depth < maxFormDepth {
+				if name, ok := operands[0].(pdfName); ok {
+					r.runForm(resources, name, state.ctm, depth)
+				}
+			}
+		case "BI":
+			skipInlineImage(lexer)
+		}
+		operands = operands[:0]
+	}
+}
+
+// runForm runs a form XObject, images and other XObjects are skipped
+func (r *pdfContentReader) runForm(resources pdfDict, name pdfName, ctm pdfMatrix, depth int) {
+	formObject := r.doc.dict(resources["XObject"])[name]
+	ref, _ := formObject.(pdfRef)
+	form, ok := r.doc.resolve(formObject).(*pdfStream)
+	if !ok || r.doc.name(form.dict["Subtype"]) != "Form" || r.forms[ref] {
+		return
+	}
+	data, err := r.doc.decodeStream(form)
+	if err != nil {
+		return
+	}
+
+	matrix := identityMatrix
+	if values := r.doc.array(form.dict["Matrix"]); len(values) == 6 {
+		for i := range matrix {
+			matrix[i], _ = r.doc.number(values[i])
+		}
+	}
+	formResources := r.doc.dict(form.dict["Resources"])
+	if formResources == nil {
+		formResources = resources
+	}
+
+	r.forms[ref] = true
+	r.run(data, formResources, matrix.multiply(ctm), depth+1)
+	delete(r.forms, ref)
+}
+
+// show places the glyphs of a shown string and advances the text matrix
+func (r *pdfContentReader) show(operand interface{}, state *pdfGraphicsState, textMatrix *pdfMatrix) {
+	data, ok := operand.(pdfString)
+	if !ok || state.font == nil {
+		return
+	}
+
+	fontMatrix := pdfMatrix{state.fontSize * state.scale, 0, 0, state.fontSize, 0, state.rise}
+	for _, glyph := range state.font.decode(data) {
+		start := fontMatrix.multiply(textMatrix.multiply(state.ctm))
+
+		advance := glyph.width*state.fontSize + state.charSpace
+		if glyph.space {
+			advance += state.wordSpace
+		}
+		*textMatrix = translation(advance*state.scale, 0).multiply(*textMatrix)
+
+		if glyph.text == "" {
+			continue
+		}
+		end := fontMatrix.multiply(textMatrix.multiply(state.ctm))
+		r.spans = append(r.spans, pdfTextSpan{
+			text: glyph.text,
+			x:    start[4],
+			y:    start[5],
+			endX: end[4],
+			size: math.Hypot(start[2], start[3]),
+		})
+	}
+}
+
+// skipInlineImage moves the lexer past the data of an inline image (BI ... ID data EI)
+func skipInlineImage(lexer *pdfLexer) {
+	for {
+		object, err := lexer.readObject()
+		if err != nil {
+			return
+		}
+		if keyword, ok := object.(pdfKeyword); ok && keyword == "ID" {
+			break
+		}
+	}
+	lexer.pos = min(lexer.pos+1, len(lexer.data)) // Single whitespace after ID
+
+	// The data ends at "EI" surrounded by whitespace
+	for {
+		index := bytes.Index(lexer.data[lexer.pos:], []byte("EI"))
+		if index < 0 {
+			lexer.pos = len(lexer.data)
+			return
+		}
+		end := lexer.pos + index
+		lexer.pos = end + 2
+		if end > 0 && isPDFSpace(lexer.data[end-1]) && (lexer.pos >= len(lexer.data) || isPDFSpace(lexer.data[lexer.pos])) {
+			return
+		}
+	}
+}
@@ -0,0 +1,538 @@
+package document_proc
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rc4"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// decodeStream decrypts the stream data and applies its filters
+func (doc *pdfDocument) decodeStream(stream *pdfStream) ([]byte, error) {
+	data := stream.data
+	if doc.crypt != nil && stream.dict["Type"] != pdfName("XRef") {
+		var err error
+		if data, err = doc.crypt.decryptStream(stream); err != nil {
+			return nil, err
+		}
+	}
+
+	var filters []pdfName
+	var params []pdfDict
+	switch filter := doc.resolve(stream.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []pdfName{filter}
+		params = []pdfDict{doc.dict(stream.dict["DecodeParms"])}
+	case pdfArray:
+		paramArray := doc.array(stream.dict["DecodeParms"])
+		for i, name := range filter {
+			filters = append(filters, doc.name(name))
+			if i < len(paramArray) {
+				params = append(params, doc.dict(paramArray[i]))
+			} else {
+				params = append(params, nil)
+			}
+		}
+	}
+
+	for i, filter := range filters {
+		var err error
+		switch filter {
+		case "FlateDecode", "Fl":
+			data, err = inflate(data)
+			if err == nil {
+				data, err = doc.unpredict(data, params[i])
+			}
+		case "LZWDecode", "LZW":
+			earlyChange := 1
+			if value, ok := doc.integer(params[i]["EarlyChange"]); ok {
+				earlyChange = value
+			}
+			data, err = decodeLZW(data, earlyChange)
+			if err == nil {
+				data, err = doc.unpredict(data, params[i])
+			}
+		case "ASCIIHexDecode", "AHx":
+			data = (&pdfLexer{data: append([]byte{'<'}, data...)}).readHexString()
+		case "ASCII85Decode", "A85":
+			data, err = decodeASCII85(data)
+		case "RunLengthDecode", "RL":
+			data = decodeRunLength(data)
+		case "Crypt":
+			// Identity crypt filter, decryption was applied above
+		default:
+			return nil, fmt.Errorf("unsupported stream filter %s", filter)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error applying %s: %v", filter, err)
+		}
+	}
+	return data, nil
+}
+
+// inflate decompresses zlib data, keeping what was decoded from truncated or damaged streams
+func inflate(data []byte) ([]byte, error) {
+	var reader io.ReadCloser
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		// Some writers omit the zlib header
+		reader = flate.NewReader(bytes.NewReader(data))
+	}
+	defer reader.Close()
+
+	decoded, err := io.ReadAll(reader)
+	if err != nil && len(decoded) == 0 {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+// unpredict reverses the PNG predictors used by FlateDecode and LZWDecode (mostly in xref streams)
+func (doc *pdfDocument) unpredict(data []byte, params pdfDict) ([]byte, error) {
+	predictor, _ := doc.integer(params["Predictor"])
+	if predictor < 10 {
+		return data, nil // TIFF predictor 2 is only used for images
+	}
+
+	colors, bits, columns := 1, 8, 1
+	if value, ok := doc.integer(params["Colors"]); ok && value > 0 {
+		colors = value
+	}
+	if value, ok := doc.integer(params["BitsPerComponent"]); ok && value > 0 {
+		bits = value
+	}
+	if value, ok := doc.integer(params["Columns"]); ok && value > 0 {
+		columns = value
+	}
+	pixelBytes := max((colors*bits+7)/8, 1)
+	rowBytes := (colors*bits*columns + 7) / 8
+
+	var output []byte
+	previous := make([]byte, rowBytes)
+	for position := 0; position+1+rowBytes <= len(data); position += 1 + rowBytes {
+		filterType := data[position]
+		row := append([]byte(nil), data[position+1:position+1+rowBytes]...)
+		for i := range row {
+			var left, upperLeft byte
+			if i >= pixelBytes {
+				left = row[i-pixelBytes]
+				upperLeft = previous[i-pixelBytes]
+			}
+			up := previous[i]
+			switch filterType {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upperLeft)
+			}
+		}
+		output = append(output, row...)
+		previous = row
+	}
+	return output, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+// decodeLZW decodes PDF LZW data. compress/lzw does not support the early code width change PDF uses by default.
+func decodeLZW(data []byte, earlyChange int) ([]byte, error) {
+	const clearCode, endCode = 256, 257
+
+	var output []byte
+	var table [][]byte
+	reset := func() {
+		table = make([][]byte, 258, 4096)
+		for i := 0; i < 256; i++ {
+			table[i] = []byte{byte(i)}
+		}
+	}
+	reset()
+
+	width := 9
+	var buffer uint32
+	bits := 0
+	var previous []byte
+	for _, b := range data {
+		buffer = buffer<<8 | uint32(b)
+		bits += 8
+		for bits >= width {
+			code := int(buffer>>(bits-width)) & (1<<width - 1)
+			bits -= width
+
+			switch {
+			case code == clearCode:
+				reset()
+				width = 9
+				previous = nil
+				continue
+			case code == endCode:
+				return output, nil
+			}
+
+			var entry []byte
+			switch {
+			case code < len(table):
+				entry = table[code]
+			case code == len(table) && previous != nil:
+				entry = append(append([]byte(nil), previous...), previous[0])
+			default:
+				return output, fmt.Errorf("invalid LZW code %d", code)
+			}
+			output = append(output, entry...)
+
+			if previous != nil && len(table) < 4096 {
+				table = append(table, append(append([]byte(nil), previous...), entry[0]))
+			}
+			previous = entry
+
+			if len(table)+earlyChange >= 1<<width && width < 12 {
+				width++
+			}
+		}
+	}
+	return output, nil
+}
+
+// decodeASCII85 decodes ASCII base-85 data ending with "~>"
+func decodeASCII85(data []byte) ([]byte, error) {
+	var output []byte
+	var group [5]byte
+	count := 0
+	flush := func(n int) {
+		value := uint32(0)
+		for i := 0; i < 5; i++ {
+			digit := byte(84) // Pad partial groups with "u"
+			if i < n {
+				digit = group[i]
+			}
+			value = value*85 + uint32(digit)
+		}
+		var decoded [4]byte
+		binary.BigEndian.PutUint32(decoded[:], value)
+		output = append(output, decoded[:n-1]...)
+	}
+
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case isPDFSpace(c):
+			continue
+		case c == '~':
+			i = len(data)
+			continue
+		case c == 'z' && count == 0:
+			output = append(output, 0, 0, 0, 0)
+			continue
+		case c < '!' || c > 'u':
+			return output, fmt.Errorf("invalid ASCII85 character %q", c)
+		}
+		group[count] = c - '!'
+		count++
+		if count == 5 {
+			flush(5)
+			count = 0
+		}
+	}
+	if count > 1 {
+		flush(count)
+	}
+	return output, nil
+}
+
+// decodeRunLength decodes RunLengthDecode data
+func decodeRunLength(data []byte) []byte {
+	var output []byte
+	for i := 0; i < len(data); {
+		length := int(data[i])
+		i++
+		switch {
+		case length == 128:
+			return output
+		case length < 128:
+			end := min(i+length+1, len(data))
+			output = append(output, data[i:end]...)
+			i = end
+		default:
+			if i < len(data) {
+				output = append(output, bytes.Repeat(data[i:i+1], 257-length)...)
+			}
+			i++
+		}
+	}
+	return output
+}
+
+// Padding used to derive the key from a password (ISO 32000-1, 7.6.3.3)
+var pdfPasswordPadding = []byte{
+	0x28, 0xBF, 0x4E, 0x5E, 0x4E, 0x75, 0x8A, 0x41, 0x64, 0x00, 0x4E, 0x56, 0xFF, 0xFA, 0x01, 0x08,
+	0x2E, 0x2E, 0x00, 0xB6, 0xD0, 0x68, 0x3E, 0x80, 0x2F, 0x0C, 0xA9, 0xFE, 0x64, 0x53, 0x69, 0x7A,
+}
+
+// pdfDecrypter decrypts the strings and streams of files protected by the standard security handler.
+// Only files that open without a password (empty user password) can be read.
+type pdfDecrypter struct {
+	key        []byte
+	revision   int
+	streamMode pdfName // Crypt filter method for streams (V2, AESV2, AESV3, None)
+	stringMode pdfName
+	encryptNum int
+}
+
+func newPDFDecrypter(doc *pdfDocument, encryptObject interface{}) (*pdfDecrypter, error) {
+	encrypt := doc.dict(encryptObject)
+	if encrypt == nil {
+		return nil, fmt.Errorf("invalid encryption dictionary")
+	}
+	if filter := doc.name(encrypt["Filter"]); filter != "Standard" {
+		return nil, fmt.Errorf("unsupported PDF security handler %s", filter)
+	}
+
+	version, _ := doc.integer(encrypt["V"])
+	revision, _ := doc.integer(encrypt["R"])
+	crypt := &pdfDecrypter{revision: revision, encryptNum: refNum(encryptObject), streamMode: "V2", stringMode: "V2"}
+
+	if version >= 4 {
+		filters := doc.dict(encrypt["CF"])
+		method := func(name interface{}) pdfName {
+			filterName := doc.name(name)
+			if filterName == "" || filterName == "Identity" {
+				return "None"
+			}
+			return doc.name(doc.dict(filters[filterName])["CFM"])
+		}
+		crypt.streamMode = method(encrypt["StmF"])
+		crypt.stringMode = method(encrypt["StrF"])
+	}
+
+	owner, _ := doc.resolve(encrypt["O"]).(pdfString)
+	user, _ := doc.resolve(encrypt["U"]).(pdfString)
+	if revision >= 5 {
+		userKey, _ := doc.resolve(encrypt["UE"]).(pdfString)
+		key, err := aes256FileKey(revision, user, userKey)
+		if err != nil {
+			return nil, err
+		}
+		crypt.key = key
+		return crypt, nil
+	}
+
+	permissions, _ := doc.integer(encrypt["P"])
+	keyLength := 5
+	if revision >= 3 {
+		if bits, ok := doc.integer(encrypt["Length"]); ok && bits >= 40 {
+			keyLength = bits / 8
+		} else {
+			keyLength = 16
+		}
+	}
+	var fileID []byte
+	if ids := doc.array(doc.trailer["ID"]); len(ids) > 0 {
+		fileID, _ = doc.resolve(ids[0]).(pdfString)
+	}
+	encryptMetadata, hasFlag := doc.resolve(encrypt["EncryptMetadata"]).(bool)
+
+	// Algorithm 2: key from the (empty) user password
+	digest := md5.New()
+	digest.Write(pdfPasswordPadding)
+	digest.Write(owner)
+	var p [4]byte
+	binary.LittleEndian.PutUint32(p[:], uint32(int32(permissions)))
+	digest.Write(p[:])
+	digest.Write(fileID)
+	if revision >= 4 && hasFlag && !encryptMetadata {
+		digest.Write([]byte{0xFF, 0xFF, 0xFF, 0xFF})
+	}
+	key := digest.Sum(nil)
+	if revision >= 3 {
+		for i := 0; i < 50; i++ {
+			sum := md5.Sum(key[:keyLength])
+			key = sum[:]
+		}
+	}
+	crypt.key = key[:keyLength]
+
+	// Algorithms 4 and 5: the key must reproduce the U entry
+	var check []byte
+	if revision == 2 {
+		check = rc4Crypt(crypt.key, pdfPasswordPadding)
+	} else {
+		sum := md5.Sum(append(append([]byte(nil), pdfPasswordPadding...), fileID...))
+		check = rc4Crypt(crypt.key, sum[:])
+		for i := 1; i <= 19; i++ {
+			xored := make([]byte, len(crypt.key))
+			for j := range xored {
+				xored[j] = crypt.key[j] ^ byte(i)
+			}
+			check = rc4Crypt(xored, check)
+		}
+		user = user[:min(len(user), 16)]
+		check = check[:min(len(check), len(user))]
+	}
+	if !bytes.Equal(check, user) {
+		return nil, fmt.Errorf("PDF is password protected")
+	}
+	return crypt, nil
+}
+
+// aes256FileKey derives the file key of AES-256 encryption (revisions 5 and 6) from the empty user password
+func aes256FileKey(revision int, user, userKey []byte) ([]byte, error) {
+	if len(user) < 48 || len(userKey) < 32 {
+		return nil, fmt.Errorf("invalid AES-256 encryption dictionary")
+	}
+	validationSalt, keySalt := user[32:40], user[40:48]
+	if !bytes.Equal(pdfHash(revision, validationSalt), user[:32]) {
+		return nil, fmt.Errorf("PDF is password protected")
+	}
+
+	block, err := aes.NewCipher(pdfHash(revision, keySalt))
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(key, userKey[:32])
+	return key, nil
+}
+
+// pdfHash computes the hash of the empty password with the salt (algorithm 2.B for revision 6)
+func pdfHash(revision int, salt []byte) []byte {
+	sum := sha256.Sum256(salt)
+	k := sum[:]
+	if revision < 6 {
+		return k
+	}
+
+	for round := 0; ; round++ {
+		k1 := bytes.Repeat(k, 64) // The password is empty
+		block, _ := aes.NewCipher(k[:16])
+		e := make([]byte, len(k1))
+		cipher.NewCBCEncrypter(block, k[16:32]).CryptBlocks(e, k1)
+
+		sumMod3 := 0
+		for _, b := range e[:16] {
+			sumMod3 += int(b)
+		}
+		var h hash.Hash
+		switch sumMod3 % 3 {
+		case 0:
+			h = sha256.New()
+		case 1:
+			h = sha512.New384()
+		default:
+			h = sha512.New()
+		}
+		h.Write(e)
+		k = h.Sum(nil)
+
+		if round >= 63 && int(e[len(e)-1]) <= round-31 {
+			return k[:32]
+		}
+	}
+}
+
+func rc4Crypt(key, data []byte) []byte {
+	c, err := rc4.NewCipher(key)
+	if err != nil {
+		return nil
+	}
+	output := make([]byte, len(data))
+	c.XORKeyStream(output, data)
+	return output
+}
+
+// objectKey derives the key of an object (algorithm 1), AES-256 uses the file key directly
+func (c *pdfDecrypter) objectKey(num, gen int, mode pdfName) []byte {
+	if mode == "AESV3" {
+		return c.key
+	}
+	digest := md5.New()
+	digest.Write(c.key)
+	digest.Write([]byte{byte(num), byte(num >> 8), byte(num >> 16), byte(gen), byte(gen >> 8)})
+	if mode == "AESV2" {
+		digest.Write([]byte("sAlT"))
+	}
+	return digest.Sum(nil)[:min(len(c.key)+5, 16)]
+}
+
+func (c *pdfDecrypter) decrypt(data []byte, num, gen int, mode pdfName) ([]byte, error) {
+	switch mode {
+	case "None":
+		return data, nil
+	case "AESV2", "AESV3":
+		if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+			if len(data) == 0 {
+				return data, nil
+			}
+			return nil, fmt.Errorf("invalid AES encrypted data length %d", len(data))
+		}
+		block, err := aes.NewCipher(c.objectKey(num, gen, mode))
+		if err != nil {
+			return nil, err
+		}
+		output := make([]byte, len(data)-aes.BlockSize)
+		cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(output, data[aes.BlockSize:])
+		// Remove the PKCS#5 padding
+		if padding := int(output[len(output)-1]); padding > 0 && padding <= aes.BlockSize && padding <= len(output) {
+			output = output[:len(output)-padding]
+		}
+		return output, nil
+	default:
+		return rc4Crypt(c.objectKey(num, gen, mode), data), nil
+	}
+}
+
+func (c *pdfDecrypter) decryptStream(stream *pdfStream) ([]byte, error) {
+	return c.decrypt(stream.data, stream.ref.num, stream.ref.gen, c.streamMode)
+}
+
+// decryptStrings decrypts the strings in an object read from the file
+func (c *pdfDecrypter) decryptStrings(object interface{}, num, gen int) interface{} {
+	switch value := object.(type) {
+	case pdfString:
+		decrypted, err := c.decrypt(value, num, gen, c.stringMode)
+		if err != nil {
+			return value
+		}
+		return pdfString(decrypted)
+	case pdfArray:
+		for i := range value {
+			value[i] = c.decryptStrings(value[i], num, gen)
+		}
+	case pdfDict:
+		for key := range value {
+			value[key] = c.decryptStrings(value[key], num, gen)
+		}
+	case *pdfStream:
+		c.decryptStrings(value.dict, num, gen)
+	}
+	return object
+}
@@ -0,0 +1,522 @@
+package document_proc
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Glyph names of the printable ASCII codes 0x20-0x7E
+var asciiGlyphNames = strings.Fields(`space exclam quotedbl numbersign dollar percent ampersand quotesingle
+	parenleft parenright asterisk plus comma hyphen period slash zero one two three four five six seven eight nine
+	colon semicolon less equal greater question at A B C D E F G H I J K L M N O P Q R S T U V W X Y Z
+	bracketleft backslash bracketright asciicircum underscore grave a b c d e f g h i j k l m n o p q r s t u v w x y z
+	braceleft bar braceright asciitilde`)
+
+// Glyph names of the Latin-1 codes 0xA0-0xFF
+var latin1GlyphNames = strings.Fields(`nbspace exclamdown cent sterling currency yen brokenbar section dieresis
+	copyright ordfeminine guillemotleft logicalnot sfthyphen registered macron degree plusminus twosuperior
+	threesuperior acute mu paragraph periodcentered cedilla onesuperior ordmasculine guillemotright onequarter
+	onehalf threequarters questiondown Agrave Aacute Acircumflex Atilde Adieresis Aring AE Ccedilla Egrave Eacute
+	Ecircumflex Edieresis Igrave Iacute Icircumflex Idieresis Eth Ntilde Ograve Oacute Ocircumflex Otilde Odieresis
+	multiply Oslash Ugrave Uacute Ucircumflex Udieresis Yacute Thorn germandbls agrave aacute acircumflex atilde
+	adieresis aring ae ccedilla egrave eacute ecircumflex edieresis igrave iacute icircumflex idieresis eth ntilde
+	ograve oacute ocircumflex otilde odieresis divide oslash ugrave uacute ucircumflex udieresis yacute thorn ydieresis`)
+
+// WinAnsiEncoding codes 0x80-0x9F that differ from Latin-1
+var winAnsiHigh = map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡', 0x88: 'ˆ', 0x89: '‰', 0x8A: 'Š',
+	0x8B: '‹', 0x8C: 'Œ', 0x8E: 'Ž', 0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—',
+	0x98: '˜', 0x99: '™', 0x9A: 'š', 0x9B: '›', 0x9C: 'œ', 0x9E: 'ž', 0x9F: 'Ÿ',
+}
+
+// StandardEncoding codes that differ from ASCII
+var standardHigh = map[byte]rune{
+	0x27: '’', 0x60: '‘', 0xA1: '¡', 0xA2: '¢', 0xA3: '£', 0xA4: '⁄', 0xA5: '¥', 0xA6: 'ƒ', 0xA7: '§', 0xA8: '¤',
+	0xA9: '\'', 0xAA: '“', 0xAB: '«', 0xAC: '‹', 0xAD: '›', 0xAE: 'ﬁ', 0xAF: 'ﬂ', 0xB1: '–', 0xB2: '†', 0xB3: '‡',
+	0xB4: '·', 0xB6: '¶', 0xB7: '•', 0xB8: '‚', 0xB9: '„', 0xBA: '”', 0xBB: '»', 0xBC: '…', 0xBD: '‰', 0xBF: '¿',
+	0xC1: '`', 0xC2: '´', 0xC3: 'ˆ', 0xC4: '˜', 0xC5: '¯', 0xC6: '˘', 0xC7: '˙', 0xC8: '¨', 0xCA: '˚', 0xCB: '¸',
+	0xCD: '˝', 0xCE: '˛', 0xCF: 'ˇ', 0xD0: '—', 0xE1: 'Æ', 0xE3: 'ª', 0xE8: 'Ł', 0xE9: 'Ø', 0xEA: 'Œ', 0xEB: 'º',
+	0xF1: 'æ', 0xF5: 'ı', 0xF8: 'ł', 0xF9: 'ø', 0xFA: 'œ', 0xFB: 'ß',
+}
+
+// MacRomanEncoding codes 0x80-0xFF
+var macRomanHigh = []rune("ÄÅÇÉÑÖÜáàâäãåçéèêëíìîïñóòôöõúùûü†°¢£§•¶ß®©™´¨≠ÆØ∞±≤≥¥µ∂∑∏π∫ªºΩæø¿¡¬√ƒ≈∆«»… ÀÃÕŒœ–—“”‘’÷◊ÿŸ⁄€‹›ﬁﬂ‡·‚„‰ÂÊÁËÈÍÎÏÌÓÔÒÚÛÙıˆ˜¯˘˙˚¸˝˛ˇ")
+
+// Glyph names outside ASCII and Latin-1
+var extraGlyphNames = map[string]rune{
+	"Euro": '€', "quotesinglbase": '‚', "florin": 'ƒ', "quotedblbase": '„', "ellipsis": '…', "dagger": '†',
+	"daggerdbl": '‡', "circumflex": 'ˆ', "perthousand": '‰', "Scaron": 'Š', "guilsinglleft": '‹', "OE": 'Œ',
+	"Zcaron": 'Ž', "quoteleft": '‘', "quoteright": '’', "quotedblleft": '“', "quotedblright": '”', "bullet": '•',
+	"endash": '–', "emdash": '—', "tilde": '˜', "trademark": '™', "scaron": 'š', "guilsinglright": '›', "oe": 'œ',
+	"zcaron": 'ž', "Ydieresis": 'Ÿ', "fi": 'ﬁ', "fl": 'ﬂ', "ff": 'ﬀ', "ffi": 'ﬃ', "ffl": 'ﬄ', "minus": '−',
+	"fraction": '⁄', "dotlessi": 'ı', "Lslash": 'Ł', "lslash": 'ł', "breve": '˘', "dotaccent": '˙', "ring": '˚',
+	"ogonek": '˛', "caron": 'ˇ', "hungarumlaut": '˝', "space": ' ', "hyphen": '-', "nbspace": ' ', "sfthyphen": '-',
+	"arrowright": '→', "arrowleft": '←', "arrowup": '↑', "arrowdown": '↓', "checkmark": '✓', "lozenge": '◊',
+	"notequal": '≠', "lessequal": '≤', "greaterequal": '≥', "infinity": '∞', "summation": '∑', "product": '∏',
+	"radical": '√', "approxequal": '≈', "integral": '∫', "partialdiff": '∂', "Delta": 'Δ', "Omega": 'Ω', "pi": 'π',
+	"mu": 'µ', "periodcentered": '·', "middot": '·',
+}
+
+// glyphRunes maps glyph names to Unicode, built from the tables above
+var glyphRunes = func() map[string]rune {
+	runes := make(map[string]rune, 256)
+	for i, name := range asciiGlyphNames {
+		runes[name] = rune(0x20 + i)
+	}
+	for i, name := range latin1GlyphNames {
+		runes[name] = rune(0xA0 + i)
+	}
+	for name, r := range extraGlyphNames {
+		runes[name] = r
+	}
+	return runes
+}()
+
+// glyphText returns the text of a glyph name: standard names, uniXXXX, uXXXX[XX] and ligatures such as f_f_i
+func glyphText(name string) string {
+	if r, found := glyphRunes[name]; found {
+		return string(r)
+	}
+	// Drop suffixes such as .sc or .alt
+	if dot := strings.IndexByte(name, '.'); dot > 0 {
+		return glyphText(name[:dot])
+	}
+	if strings.Contains(name, "_") {
+		var text strings.Builder
+		for _, part := range strings.Split(name, "_") {
+			text.WriteString(glyphText(part))
+		}
+		return text.String()
+	}
+	if strings.HasPrefix(name, "uni") && len(name) >= 7 && (len(name)-3)%4 == 0 {
+		var units []uint16
+		for i := 3; i < len(name); i += 4 {
+			value, err := strconv.ParseUint(name[i:i+4], 16, 16)
+			if err != nil {
+				return ""
+			}
+			units = append(units, uint16(value))
+		}
+		return string(utf16.Decode(units))
+	}
+	if strings.HasPrefix(name, "u") && len(name) >= 5 && len(name) <= 7 {
+		if value, err := strconv.ParseUint(name[1:], 16, 32); err == nil {
+			return string(rune(value))
+		}
+	}
+	return ""
+}
+
+// baseEncoding returns the code to text table of a named simple font encoding
+func baseEncoding(name pdfName) [256]string {
+	var table [256]string
+	for code := 0x20; code < 0x7F; code++ {
+		table[code] = string(rune(code))
+	}
+	switch name {
+	case "WinAnsiEncoding":
+		for code := 0xA0; code <= 0xFF; code++ {
+			table[code] = string(rune(code))
+		}
+		for code, r := range winAnsiHigh {
+			table[code] = string(r)
+		}
+		table[0xAD] = "-"
+	case "MacRomanEncoding", "MacExpertEncoding":
+		for i, r := range macRomanHigh {
+			table[0x80+i] = string(r)
+		}
+	default: // StandardEncoding
+		for code, r := range standardHigh {
+			table[code] = string(r)
+		}
+	}
+	return table
+}
+
+// pdfCMap maps character codes to Unicode (ToUnicode) or CIDs (encoding CMaps)
+type pdfCMap struct {
+	codespaces []pdfCodespace
+	unicode    map[uint32]string
+	cids       map[uint32]int
+	cidRanges  []pdfCIDRange
+}
+
+type pdfCodespace struct {
+	low, high []byte
+}
+
+type pdfCIDRange struct {
+	low, high uint32
+	cid       int
+}
+
+// parseCMap reads the codespace ranges, bfchar/bfrange (Unicode) and cidchar/cidrange mappings of a CMap stream
+func parseCMap(data []byte) *pdfCMap {
+	cmap := &pdfCMap{unicode: make(map[uint32]string), cids: make(map[uint32]int)}
+	lexer := &pdfLexer{data: data}
+
+	var operands []interface{}
+	for {
+		object, err := lexer.readObject()
+		if err != nil {
+			return cmap
+		}
+		keyword, isKeyword := object.(pdfKeyword)
+		if !isKeyword {
+			operands = append(operands, object)
+			continue
+		}
+
+		switch keyword {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				low, ok1 := operands[i].(pdfString)
+				high, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 && len(low) == len(high) && len(low) > 0 {
+					cmap.codespaces = append(cmap.codespaces, pdfCodespace{low: low, high: high})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				code, ok := operands[i].(pdfString)
+				if !ok {
+					continue
+				}
+				switch destination := operands[i+1].(type) {
+				case pdfString:
+					cmap.unicode[codeValue(code)] = decodeUTF16(destination)
+				case pdfName:
+					cmap.unicode[codeValue(code)] = glyphText(string(destination))
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				low, ok1 := operands[i].(pdfString)
+				high, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 {
+					continue
+				}
+				start, end := codeValue(low), codeValue(high)
+				if end < start || end-start > 0xFFFF {
+					continue
+				}
+				switch destination := operands[i+2].(type) {
+				case pdfString:
+					// The last byte of the destination is incremented for each code
+					for code := start; code <= end; code++ {
+						value := append(pdfString(nil), destination...)
+						if len(value) > 0 {
+							offset := int(code - start)
+							last := int(value[len(value)-1]) + offset
+							value[len(value)-1] = byte(last)
+							if len(value) >= 2 && last > 0xFF {
+								value[len(value)-2] += byte(last >> 8)
+							}
+						}
+						cmap.unicode[code] = decodeUTF16(value)
+					}
+				case pdfArray:
+					for j, item := range destination {
+						if value, ok := item.(pdfString); ok && start+uint32(j) <= end {
+							cmap.unicode[start+uint32(j)] = decodeUTF16(value)
+						}
+					}
+				}
+			}
+		case "endcidchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				code, ok1 := operands[i].(pdfString)
+				cid, ok2 := operands[i+1].(int)
+				if ok1 && ok2 {
+					cmap.cids[codeValue(code)] = cid
+				}
+			}
+		case "endcidrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				low, ok1 := operands[i].(pdfString)
+				high, ok2 := operands[i+1].(pdfString)
+				cid, ok3 := operands[i+2].(int)
+				if ok1 && ok2 && ok3 {
+					cmap.cidRanges = append(cmap.cidRanges, pdfCIDRange{low: codeValue(low), high: codeValue(high), cid: cid})
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+func codeValue(code []byte) uint32 {
+	value := uint32(0)
+	for _, b := range code {
+		value = value<<8 | uint32(b)
+	}
+	return value
+}
+
+// decodeUTF16 decodes UTF-16BE text, dropping a byte order mark
+func decodeUTF16(data []byte) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+	}
+	if len(units) > 0 && units[0] == 0xFEFF {
+		units = units[1:]
+	}
+	return string(utf16.Decode(units))
+}
+
+// codeLength returns the byte length of the code starting the data according to the codespace ranges
+func (c *pdfCMap) codeLength(data []byte) int {
+	for _, space := range c.codespaces {
+		n := len(space.low)
+		if n > len(data) {
+			continue
+		}
+		matches := true
+		for i := 0; i < n; i++ {
+			if data[i] < space.low[i] || data[i] > space.high[i] {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return n
+		}
+	}
+	return 0
+}
+
+func (c *pdfCMap) cid(code uint32) int {
+	if cid, found := c.cids[code]; found {
+		return cid
+	}
+	for _, r := range c.cidRanges {
+		if code >= r.low && code <= r.high {
+			return r.cid + int(code-r.low)
+		}
+	}
+	return int(code)
+}
+
+// pdfFont decodes the strings shown with a font into text and glyph widths
+type pdfFont struct {
+	composite  bool
+	toUnicode  *pdfCMap
+	encoding   [256]string // Simple fonts
+	cmap       *pdfCMap    // Composite fonts with an embedded encoding CMap
+	utf16Codes bool        // Composite fonts with a UCS-2/UTF-16 encoding CMap
+	codeBytes  int         // Code length of composite fonts without codespace ranges
+	firstChar  int
+	widths     []float64
+	cidWidths  map[int]float64
+	width      float64 // Default or missing width
+	widthScale float64 // Glyph space to text space (1/1000, or the FontMatrix of Type3 fonts)
+}
+
+// pdfGlyph is a decoded character code
+type pdfGlyph struct {
+	text  string
+	width float64 // Advance in text space units at font size 1
+	space bool    // Single byte code 32, which also gets the word spacing
+}
+
+// loadFont reads a font dictionary
+func (doc *pdfDocument) loadFont(fontObject interface{}) *pdfFont {
+	fontDict := doc.dict(fontObject)
+	font := &pdfFont{widthScale: 0.001, width: 500, codeBytes: 2}
+	if fontDict == nil {
+		return font
+	}
+
+	subtype := doc.name(fontDict["Subtype"])
+	if stream, ok := doc.resolve(fontDict["ToUnicode"]).(*pdfStream); ok {
+		if data, err := doc.decodeStream(stream); err == nil {
+			font.toUnicode = parseCMap(data)
+		}
+	}
+
+	if subtype == "Type0" {
+		font.composite = true
+		font.loadCompositeEncoding(doc, fontDict["Encoding"])
+		descendants := doc.array(fontDict["DescendantFonts"])
+		if len(descendants) > 0 {
+			font.loadCIDWidths(doc, doc.dict(descendants[0]))
+		}
+		return font
+	}
+
+	if subtype == "Type3" {
+		if matrix := doc.array(fontDict["FontMatrix"]); len(matrix) > 0 {
+			if scale, ok := doc.number(matrix[0]); ok {
+				font.widthScale = scale
+			}
+		}
+	}
+	font.loadSimpleEncoding(doc, fontDict)
+
+	font.firstChar, _ = doc.integer(fontDict["FirstChar"])
+	for _, width := range doc.array(fontDict["Widths"]) {
+		value, _ := doc.number(width)
+		font.widths = append(font.widths, value)
+	}
+	descriptor := doc.dict(fontDict["FontDescriptor"])
+	if missing, ok := doc.number(descriptor["MissingWidth"]); ok && missing > 0 {
+		font.width = missing
+	}
+	baseFont := string(doc.name(fontDict["BaseFont"]))
+	if strings.Contains(baseFont, "Courier") {
+		font.width = 600 // Monospaced standard font without widths
+	}
+	return font
+}
+
+// loadSimpleEncoding builds the code to text table from the base encoding and the Differences array
+func (font *pdfFont) loadSimpleEncoding(doc *pdfDocument, fontDict pdfDict) {
+	subtype := doc.name(fontDict["Subtype"])
+	base := pdfName("StandardEncoding")
+	if subtype == "TrueType" {
+		base = "WinAnsiEncoding"
+	}
+
+	var differences pdfArray
+	switch encoding := doc.resolve(fontDict["Encoding"]).(type) {
+	case pdfName:
+		base = encoding
+	case pdfDict:
+		if name := doc.name(encoding["BaseEncoding"]); name != "" {
+			base = name
+		}
+		differences = doc.array(encoding["Differences"])
+	}
+	font.encoding = baseEncoding(base)
+
+	code := 0
+	for _, item := range differences {
+		switch value := doc.resolve(item).(type) {
+		case int:
+			code = value
+		case pdfName:
+			if code >= 0 && code < 256 {
+				font.encoding[code] = glyphText(string(value))
+			}
+			code++
+		}
+	}
+}
+
+// loadCompositeEncoding reads the encoding CMap of a Type0 font
+func (font *pdfFont) loadCompositeEncoding(doc *pdfDocument, encoding interface{}) {
+	switch value := doc.resolve(encoding).(type) {
+	case pdfName:
+		name := string(value)
+		font.utf16Codes = strings.Contains(name, "UCS2") || strings.Contains(name, "UTF16")
+	case *pdfStream:
+		if data, err := doc.decodeStream(value); err == nil {
+			font.cmap = parseCMap(data)
+		}
+	}
+}
+
+// loadCIDWidths reads the DW and W entries of a CID font
+func (font *pdfFont) loadCIDWidths(doc *pdfDocument, cidFont pdfDict) {
+	font.width = 1000
+	if width, ok := doc.number(cidFont["DW"]); ok {
+		font.width = width
+	}
+	font.cidWidths = make(map[int]float64)
+
+	w := doc.array(cidFont["W"])
+	for i := 0; i < len(w); {
+		first, ok := doc.integer(w[i])
+		if !ok || i+1 >= len(w) {
+			break
+		}
+		if widths := doc.array(w[i+1]); widths != nil {
+			for j, width := range widths {
+				value, _ := doc.number(width)
+				font.cidWidths[first+j] = value
+			}
+			i += 2
+			continue
+		}
+		if i+2 >= len(w) {
+			break
+		}
+		last, _ := doc.integer(w[i+1])
+		value, _ := doc.number(w[i+2])
+		for cid := first; cid <= last && cid-first < 0xFFFF; cid++ {
+			font.cidWidths[cid] = value
+		}
+		i += 3
+	}
+}
+
+func (font *pdfFont) glyphWidth(code int) float64 {
+	if index := code - font.firstChar; index >= 0 && index < len(font.widths) && font.widths[index] > 0 {
+		return font.widths[index]
+	}
+	return font.width
+}
+
+// decode splits a shown string into glyphs
+func (font *pdfFont) decode(data []byte) []pdfGlyph {
+	var glyphs []pdfGlyph
+	for i := 0; i < len(data); {
+		length := 1
+		if font.composite {
+			length = font.codeBytes
+			if font.cmap != nil && len(font.cmap.codespaces) > 0 {
+				length = font.cmap.codeLength(data[i:])
+			} else if font.toUnicode != nil && len(font.toUnicode.codespaces) > 0 {
+				length = font.toUnicode.codeLength(data[i:])
+			}
+			if length == 0 {
+				length = font.codeBytes
+			}
+		}
+		length = min(length, len(data)-i)
+		code := codeValue(data[i : i+length])
+		i += length
+
+		glyph := pdfGlyph{text: font.codeText(code, data[i-length:i])}
+		if font.composite {
+			cid := int(code)
+			if font.cmap != nil {
+				cid = font.cmap.cid(code)
+			}
+			width, found := font.cidWidths[cid]
+			if !found {
+				width = font.width
+			}
+			glyph.width = width * font.widthScale
+		} else {
+			glyph.width = font.glyphWidth(int(code)) * font.widthScale
+			glyph.space = code == 32
+		}
+		glyphs = append(glyphs, glyph)
+	}
+	return glyphs
+}
+
+// codeText returns the Unicode text of a character code: ToUnicode first, then the font encoding
+func (font *pdfFont) codeText(code uint32, raw []byte) string {
+	if font.toUnicode != nil {
+		if text, found := font.toUnicode.unicode[code]; found {
+			return text
+		}
+	}
+	if font.composite {
+		if font.utf16Codes {
+			return decodeUTF16(raw)
+		}
+		return ""
+	}
+	if code < 256 {
+		if text := font.encoding[code]; text != "" {
+			return text
+		}
+	}
+	return ""
+}
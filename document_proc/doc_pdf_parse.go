@@ -0,0 +1,796 @@
+package document_proc
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// PDF object model. Integers are int, reals float64, strings pdfString, indirect references pdfRef.
+type (
+	pdfName    string
+	pdfString  []byte
+	pdfKeyword string // Operators in content streams and keywords such as obj, R or stream
+	pdfArray   []interface{}
+	pdfDict    map[pdfName]interface{}
+)
+
+// pdfRef is an indirect reference "num gen R"
+type pdfRef struct {
+	num, gen int
+}
+
+// pdfStream is a stream object with its still encoded (and possibly encrypted) data
+type pdfStream struct {
+	dict pdfDict
+	data []byte
+	ref  pdfRef
+}
+
+// pdfLexer reads PDF tokens and objects from a byte slice
+type pdfLexer struct {
+	data []byte
+	pos  int
+	refs bool // Parse "num gen R" as references (off in content streams)
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// skipSpace skips whitespace and comments
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isPDFSpace(c) {
+			l.pos++
+			continue
+		}
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+// errPDFEnd is returned when the lexer reaches the end of the data
+var errPDFEnd = fmt.Errorf("unexpected end of PDF data")
+
+// readObject reads the next object. Keywords, including ] and >> closing a container, are returned as pdfKeyword.
+func (l *pdfLexer) readObject() (interface{}, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, errPDFEnd
+	}
+
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		return l.readName(), nil
+	case c == '(':
+		return l.readLiteralString(), nil
+	case c == '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return l.readDict()
+		}
+		return l.readHexString(), nil
+	case c == '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return pdfKeyword(">>"), nil
+		}
+		l.pos++
+		return pdfKeyword(">"), nil
+	case c == '[':
+		l.pos++
+		return l.readArray()
+	case c == ']' || c == '{' || c == '}' || c == ')':
+		l.pos++
+		return pdfKeyword(string(c)), nil
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return l.readNumberOrRef(), nil
+	}
+
+	keyword := l.readRegular()
+	switch keyword {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	return pdfKeyword(keyword), nil
+}
+
+// readRegular reads a run of regular characters
+func (l *pdfLexer) readRegular() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	if l.pos == start && l.pos < len(l.data) {
+		l.pos++ // Skip an unexpected delimiter
+	}
+	return string(l.data[start:l.pos])
+}
+
+func (l *pdfLexer) readName() pdfName {
+	l.pos++ // "/"
+	var name []byte
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		c := l.data[l.pos]
+		if c == '#' && l.pos+2 < len(l.data) {
+			if value, err := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8); err == nil {
+				name = append(name, byte(value))
+				l.pos += 3
+				continue
+			}
+		}
+		name = append(name, c)
+		l.pos++
+	}
+	return pdfName(name)
+}
+
+// readNumber reads an int or a float64, nil at the end of the data
+func (l *pdfLexer) readNumber() interface{} {
+	l.skipSpace()
+	token := l.readRegular()
+	if token == "" {
+		return nil
+	}
+	if integer, err := strconv.Atoi(token); err == nil {
+		return integer
+	}
+	if real, err := strconv.ParseFloat(token, 64); err == nil {
+		return real
+	}
+	// Malformed numbers such as "--5" or "1.2.3" are read as 0
+	return 0
+}
+
+// readNumberOrRef reads a number, or a "num gen R" reference when references are enabled
+func (l *pdfLexer) readNumberOrRef() interface{} {
+	number := l.readNumber()
+	num, ok := number.(int)
+	if !l.refs || !ok {
+		return number
+	}
+
+	// Look ahead for "gen R"
+	saved := l.pos
+	l.skipSpace()
+	if l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '9' {
+		if gen, ok := l.readNumber().(int); ok {
+			l.skipSpace()
+			if l.pos < len(l.data) && l.data[l.pos] == 'R' &&
+				(l.pos+1 == len(l.data) || isPDFSpace(l.data[l.pos+1]) || isPDFDelimiter(l.data[l.pos+1])) {
+				l.pos++
+				return pdfRef{num: num, gen: gen}
+			}
+		}
+	}
+	l.pos = saved
+	return number
+}
+
+func (l *pdfLexer) readLiteralString() pdfString {
+	l.pos++ // "("
+	var value []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return value
+			}
+		case '\r':
+			// End of line sequences are read as \n
+			if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+				l.pos++
+			}
+			c = '\n'
+		case '\\':
+			if l.pos >= len(l.data) {
+				return value
+			}
+			escaped := l.data[l.pos]
+			l.pos++
+			switch escaped {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// Line continuation
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if escaped >= '0' && escaped <= '7' {
+					octal := int(escaped - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						octal = octal*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(octal)
+				} else {
+					c = escaped // \( \) \\ and unknown escapes
+				}
+			}
+		}
+		value = append(value, c)
+	}
+	return value
+}
+
+func (l *pdfLexer) readHexString() pdfString {
+	l.pos++ // "<"
+	var value []byte
+	var high byte
+	odd := false
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		if c == '>' {
+			break
+		}
+		nibble, ok := hexNibble(c)
+		if !ok {
+			continue
+		}
+		if odd {
+			value = append(value, high<<4|nibble)
+		} else {
+			high = nibble
+		}
+		odd = !odd
+	}
+	if odd {
+		value = append(value, high<<4)
+	}
+	return value
+}
+
+func hexNibble(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+func (l *pdfLexer) readArray() (pdfArray, error) {
+	array := pdfArray{}
+	for {
+		object, err := l.readObject()
+		if err != nil {
+			return array, err
+		}
+		if keyword, ok := object.(pdfKeyword); ok && keyword == "]" {
+			return array, nil
+		}
+		array = append(array, object)
+	}
+}
+
+func (l *pdfLexer) readDict() (pdfDict, error) {
+	dict := pdfDict{}
+	for {
+		key, err := l.readObject()
+		if err != nil {
+			return dict, err
+		}
+		if keyword, ok := key.(pdfKeyword); ok && keyword == ">>" {
+			return dict, nil
+		}
+		name, ok := key.(pdfName)
+		if !ok {
+			continue // Skip junk between the entries
+		}
+		value, err := l.readObject()
+		if err != nil {
+			return dict, err
+		}
+		if keyword, ok := value.(pdfKeyword); ok && keyword == ">>" {
+			return dict, nil
+		}
+		dict[name] = value
+	}
+}
+
+// Object headers "num gen obj", used to rebuild a damaged cross-reference table
+var pdfObjectHeader = regexp.MustCompile(`(?m)(?:^|[\r\n\s])(\d+)\s+(\d+)\s+obj\b`)
+
+// pdfXrefEntry locates an object in the file or in an object stream
+type pdfXrefEntry struct {
+	offset int
+	gen    int
+	stream int // Object stream number of compressed objects
+	index  int // Index in the object stream
+	inStm  bool
+}
+
+// pdfDocument gives access to the objects of a parsed PDF file
+type pdfDocument struct {
+	data    []byte
+	xref    map[int]pdfXrefEntry
+	trailer pdfDict
+	objects map[int]interface{}
+	loading map[int]bool
+	crypt   *pdfDecrypter
+}
+
+// parsePDF reads the cross-reference data of the file and sets up decryption
+func parsePDF(data []byte) (*pdfDocument, error) {
+	if !bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF-")) {
+		return nil, fmt.Errorf("not a PDF file")
+	}
+
+	doc := &pdfDocument{
+		data:    data,
+		xref:    make(map[int]pdfXrefEntry),
+		trailer: pdfDict{},
+		objects: make(map[int]interface{}),
+		loading: make(map[int]bool),
+	}
+
+	if err := doc.readXref(); err != nil || doc.dict(doc.trailer["Root"]) == nil {
+		// Damaged or missing cross-reference data (or offsets pointing elsewhere), locate the objects by scanning the file
+		doc.rebuildXref()
+	}
+	if doc.trailer["Root"] == nil {
+		return nil, fmt.Errorf("PDF document catalog not found")
+	}
+
+	if encrypt := doc.trailer["Encrypt"]; encrypt != nil {
+		crypt, err := newPDFDecrypter(doc, encrypt)
+		if err != nil {
+			return nil, err
+		}
+		doc.crypt = crypt
+	}
+	return doc, nil
+}
+
+// readXref follows the chain of cross-reference tables and streams from the last startxref
+func (doc *pdfDocument) readXref() error {
+	index := bytes.LastIndex(doc.data, []byte("startxref"))
+	if index < 0 {
+		return fmt.Errorf("startxref not found")
+	}
+	lexer := &pdfLexer{data: doc.data, pos: index + len("startxref")}
+	offset, ok := lexer.readNumber().(int)
+	if !ok {
+		return fmt.Errorf("invalid startxref offset")
+	}
+
+	visited := make(map[int]bool)
+	for offset > 0 && offset < len(doc.data) && !visited[offset] {
+		visited[offset] = true
+
+		var trailer pdfDict
+		var err error
+		lexer := &pdfLexer{data: doc.data, pos: offset, refs: true}
+		lexer.skipSpace()
+		if bytes.HasPrefix(doc.data[lexer.pos:], []byte("xref")) {
+			lexer.pos += len("xref")
+			trailer, err = doc.readXrefTable(lexer)
+		} else {
+			trailer, err = doc.readXrefStream(lexer)
+		}
+		if err != nil {
+			return err
+		}
+
+		// Newer sections come first, keep their trailer entries
+		for key, value := range trailer {
+			if _, found := doc.trailer[key]; !found && key != "Prev" && key != "XRefStm" {
+				doc.trailer[key] = value
+			}
+		}
+
+		// Hybrid files list the compressed objects in an additional stream
+		if stmOffset, ok := trailer["XRefStm"].(int); ok && stmOffset > 0 && stmOffset < len(doc.data) && !visited[stmOffset] {
+			visited[stmOffset] = true
+			if _, err := doc.readXrefStream(&pdfLexer{data: doc.data, pos: stmOffset, refs: true}); err != nil {
+				return err
+			}
+		}
+
+		prev, ok := trailer["Prev"].(int)
+		if !ok {
+			break
+		}
+		offset = prev
+	}
+	return nil
+}
+
+// pdfMinXrefEntrySize is the shortest xref table entry, "0 0 n" and a line break. Entries are 20 bytes
+// in well-formed files, the subsections of damaged ones are bounded by the data left.
+const pdfMinXrefEntrySize = 6
+
+// readXrefTable reads a classic "xref" section and its trailer dictionary
+func (doc *pdfDocument) readXrefTable(lexer *pdfLexer) (pdfDict, error) {
+	for {
+		lexer.skipSpace()
+		if bytes.HasPrefix(doc.data[lexer.pos:], []byte("trailer")) {
+			lexer.pos += len("trailer")
+			object, err := lexer.readObject()
+			if err != nil {
+				return nil, fmt.Errorf("error reading trailer: %v", err)
+			}
+			trailer, ok := object.(pdfDict)
+			if !ok {
+				return nil, fmt.Errorf("invalid trailer")
+			}
+			return trailer, nil
+		}
+
+		start, ok1 := lexer.readNumber().(int)
+		count, ok2 := lexer.readNumber().(int)
+		if !ok1 || !ok2 || count < 0 || count > (len(doc.data)-lexer.pos)/pdfMinXrefEntrySize {
+			return nil, fmt.Errorf("invalid xref subsection")
+		}
+		for i := 0; i < count; i++ {
+			offset, ok1 := lexer.readNumber().(int)
+			gen, ok2 := lexer.readNumber().(int)
+			lexer.skipSpace()
+			kind := lexer.readRegular()
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("invalid xref entry")
+			}
+			if _, found := doc.xref[start+i]; !found && kind == "n" {
+				doc.xref[start+i] = pdfXrefEntry{offset: offset, gen: gen}
+			} else if !found {
+				doc.xref[start+i] = pdfXrefEntry{offset: -1} // Free, keeps older sections from reviving it
+			}
+		}
+	}
+}
+
+// readXrefStream reads a cross-reference stream (PDF 1.5) and returns its dictionary as the trailer
+func (doc *pdfDocument) readXrefStream(lexer *pdfLexer) (pdfDict, error) {
+	object, err := doc.readIndirectObject(lexer, -1)
+	if err != nil {
+		return nil, fmt.Errorf("error reading xref stream: %v", err)
+	}
+	stream, ok := object.(*pdfStream)
+	if !ok || stream.dict["Type"] != pdfName("XRef") {
+		return nil, fmt.Errorf("invalid xref stream")
+	}
+	data, err := doc.decodeStream(stream)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding xref stream: %v", err)
+	}
+
+	widths, _ := stream.dict["W"].(pdfArray)
+	if len(widths) != 3 {
+		return nil, fmt.Errorf("invalid xref stream widths")
+	}
+	w := [3]int{}
+	for i := range w {
+		w[i], _ = widths[i].(int)
+		if w[i] < 0 || w[i] > 8 {
+			return nil, fmt.Errorf("invalid xref stream widths")
+		}
+	}
+	entrySize := w[0] + w[1] + w[2]
+	if entrySize == 0 {
+		return nil, fmt.Errorf("invalid xref stream widths")
+	}
+
+	sections, ok := stream.dict["Index"].(pdfArray)
+	if !ok {
+		size, _ := stream.dict["Size"].(int)
+		sections = pdfArray{0, size}
+	}
+
+	position := 0
+	for i := 0; i+1 < len(sections); i += 2 {
+		start, _ := sections[i].(int)
+		count, _ := sections[i+1].(int)
+		for j := 0; j < count && position+entrySize <= len(data); j++ {
+			fields := [3]int{1, 0, 0} // The type defaults to 1 when its width is 0
+			for k := 0; k < 3; k++ {
+				if w[k] == 0 {
+					continue
+				}
+				value := 0
+				for _, b := range data[position : position+w[k]] {
+					value = value<<8 | int(b)
+				}
+				fields[k] = value
+				position += w[k]
+			}
+
+			num := start + j
+			if _, found := doc.xref[num]; found {
+				continue
+			}
+			switch fields[0] {
+			case 1:
+				doc.xref[num] = pdfXrefEntry{offset: fields[1], gen: fields[2]}
+			case 2:
+				doc.xref[num] = pdfXrefEntry{stream: fields[1], index: fields[2], inStm: true}
+			default:
+				doc.xref[num] = pdfXrefEntry{offset: -1}
+			}
+		}
+	}
+	return stream.dict, nil
+}
+
+// rebuildXref scans the file for object headers, used when the cross-reference data is damaged
+func (doc *pdfDocument) rebuildXref() {
+	doc.xref = make(map[int]pdfXrefEntry)
+	doc.objects = make(map[int]interface{})
+	for _, match := range pdfObjectHeader.FindAllSubmatchIndex(doc.data, -1) {
+		num, _ := strconv.Atoi(string(doc.data[match[2]:match[3]]))
+		gen, _ := strconv.Atoi(string(doc.data[match[4]:match[5]]))
+		doc.xref[num] = pdfXrefEntry{offset: match[2], gen: gen} // Later definitions win
+	}
+
+	// Register the objects inside object streams and find the catalog
+	var catalog interface{}
+	for num := range doc.xref {
+		object := doc.getObject(num)
+		stream, ok := object.(*pdfStream)
+		if ok && stream.dict["Type"] == pdfName("ObjStm") {
+			for index, contained := range doc.objectStreamNumbers(stream) {
+				if _, found := doc.xref[contained]; !found {
+					doc.xref[contained] = pdfXrefEntry{stream: num, index: index, inStm: true}
+				}
+			}
+		}
+	}
+	for num := range doc.xref {
+		if dict, ok := doc.getObject(num).(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+			catalog = pdfRef{num: num, gen: doc.xref[num].gen}
+		}
+	}
+
+	// Keep Encrypt and ID from the last trailer dictionary in the file
+	trailer := pdfDict{}
+	for index := bytes.Index(doc.data, []byte("trailer")); index >= 0; {
+		lexer := &pdfLexer{data: doc.data, pos: index + len("trailer"), refs: true}
+		if dict, err := lexer.readObject(); err == nil {
+			if dict, ok := dict.(pdfDict); ok {
+				for key, value := range dict {
+					trailer[key] = value
+				}
+			}
+		}
+		next := bytes.Index(doc.data[index+1:], []byte("trailer"))
+		if next < 0 {
+			break
+		}
+		index += next + 1
+	}
+	if catalog != nil && doc.getObject(refNum(trailer["Root"])) == nil {
+		trailer["Root"] = catalog
+	}
+	doc.trailer = trailer
+}
+
+func refNum(object interface{}) int {
+	if ref, ok := object.(pdfRef); ok {
+		return ref.num
+	}
+	return -1
+}
+
+// resolve follows indirect references
+func (doc *pdfDocument) resolve(object interface{}) interface{} {
+	for i := 0; i < 32; i++ {
+		ref, ok := object.(pdfRef)
+		if !ok {
+			return object
+		}
+		object = doc.getObject(ref.num)
+	}
+	return nil
+}
+
+// dict returns the resolved object as a dictionary (the dictionary of a stream), nil otherwise
+func (doc *pdfDocument) dict(object interface{}) pdfDict {
+	switch value := doc.resolve(object).(type) {
+	case pdfDict:
+		return value
+	case *pdfStream:
+		return value.dict
+	}
+	return nil
+}
+
+func (doc *pdfDocument) array(object interface{}) pdfArray {
+	array, _ := doc.resolve(object).(pdfArray)
+	return array
+}
+
+func (doc *pdfDocument) number(object interface{}) (float64, bool) {
+	switch value := doc.resolve(object).(type) {
+	case int:
+		return float64(value), true
+	case float64:
+		return value, true
+	}
+	return 0, false
+}
+
+func (doc *pdfDocument) integer(object interface{}) (int, bool) {
+	number, ok := doc.number(object)
+	return int(number), ok
+}
+
+func (doc *pdfDocument) name(object interface{}) pdfName {
+	name, _ := doc.resolve(object).(pdfName)
+	return name
+}
+
+// getObject returns the object with the given number, nil for missing or unreadable objects
+func (doc *pdfDocument) getObject(num int) interface{} {
+	if object, found := doc.objects[num]; found {
+		return object
+	}
+	entry, found := doc.xref[num]
+	if !found || entry.offset < 0 || doc.loading[num] {
+		return nil
+	}
+	doc.loading[num] = true
+	defer delete(doc.loading, num)
+
+	var object interface{}
+	if entry.inStm {
+		object = doc.readCompressedObject(entry)
+	} else if entry.offset < len(doc.data) {
+		var err error
+		object, err = doc.readIndirectObject(&pdfLexer{data: doc.data, pos: entry.offset, refs: true}, num)
+		if err != nil {
+			object = nil
+		}
+	}
+
+	if doc.crypt != nil && !entry.inStm && num != doc.crypt.encryptNum {
+		object = doc.crypt.decryptStrings(object, num, entry.gen)
+	}
+	doc.objects[num] = object
+	return object
+}
+
+// readIndirectObject reads "num gen obj ... endobj" at the lexer position. expected is the object number, -1 for any.
+func (doc *pdfDocument) readIndirectObject(lexer *pdfLexer, expected int) (interface{}, error) {
+	num, ok1 := lexer.readNumber().(int)
+	gen, ok2 := lexer.readNumber().(int)
+	lexer.skipSpace()
+	if !ok1 || !ok2 || lexer.readRegular() != "obj" {
+		return nil, fmt.Errorf("invalid object header")
+	}
+	if expected >= 0 && num != expected {
+		return nil, fmt.Errorf("expected object %d, found %d", expected, num)
+	}
+
+	object, err := lexer.readObject()
+	if err != nil {
+		return nil, err
+	}
+	dict, ok := object.(pdfDict)
+	if !ok {
+		return object, nil
+	}
+
+	// A dictionary followed by "stream" starts a stream object
+	lexer.skipSpace()
+	if !bytes.HasPrefix(doc.data[lexer.pos:], []byte("stream")) {
+		return dict, nil
+	}
+	lexer.pos += len("stream")
+	if lexer.pos < len(doc.data) && doc.data[lexer.pos] == '\r' {
+		lexer.pos++
+	}
+	if lexer.pos < len(doc.data) && doc.data[lexer.pos] == '\n' {
+		lexer.pos++
+	}
+
+	start := lexer.pos
+	length, ok := doc.integer(dict["Length"])
+	end := start + length
+	if !ok || length < 0 || length > len(doc.data)-start || !bytes.HasPrefix(bytes.TrimLeft(doc.data[end:min(end+32, len(doc.data))], "\r\n \t"), []byte("endstream")) {
+		// Wrong or missing length, find the end of the stream
+		index := bytes.Index(doc.data[start:], []byte("endstream"))
+		if index < 0 {
+			return nil, fmt.Errorf("endstream not found")
+		}
+		end = start + index
+		for end > start && (doc.data[end-1] == '\n' || doc.data[end-1] == '\r') {
+			end--
+		}
+	}
+	return &pdfStream{dict: dict, data: doc.data[start:end], ref: pdfRef{num: num, gen: gen}}, nil
+}
+
+// objectStreamNumbers returns the numbers of the objects stored in an object stream, in order
+func (doc *pdfDocument) objectStreamNumbers(stream *pdfStream) []int {
+	data, err := doc.decodeStream(stream)
+	if err != nil {
+		return nil
+	}
+	count, _ := doc.integer(stream.dict["N"])
+	lexer := &pdfLexer{data: data}
+	numbers := make([]int, 0, max(min(count, len(data)/4), 0)) // At least "0 0 " per object
+	for i := 0; i < count; i++ {
+		num, ok1 := lexer.readNumber().(int)
+		_, ok2 := lexer.readNumber().(int)
+		if !ok1 || !ok2 {
+			break
+		}
+		numbers = append(numbers, num)
+	}
+	return numbers
+}
+
+// readCompressedObject reads an object stored in an object stream
+func (doc *pdfDocument) readCompressedObject(entry pdfXrefEntry) interface{} {
+	stream, ok := doc.getObject(entry.stream).(*pdfStream)
+	if !ok {
+		return nil
+	}
+	data, err := doc.decodeStream(stream)
+	if err != nil {
+		return nil
+	}
+
+	first, _ := doc.integer(stream.dict["First"])
+	lexer := &pdfLexer{data: data}
+	offset := -1
+	for i := 0; i <= entry.index; i++ {
+		lexer.readNumber()
+		value, ok := lexer.readNumber().(int)
+		if !ok {
+			return nil
+		}
+		offset = value
+	}
+	if offset < 0 || first < 0 || first+offset >= len(data) {
+		return nil
+	}
+
+	object, err := (&pdfLexer{data: data, pos: first + offset, refs: true}).readObject()
+	if err != nil {
+		return nil
+	}
+	return object
+}
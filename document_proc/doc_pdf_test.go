@@ -0,0 +1,71 @@
+package document_proc
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtractPDFPagesFixtures(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"simple.pdf", "Hello from a simple PDF"},          // Classic xref table
+		{"xref_stream.pdf", "Hello from a compressed PDF"}, // Xref stream and Flate content
+		{"damaged_xref.pdf", "Hello from a damaged PDF"},   // Wrong xref offsets, rebuilt by scanning
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			pages, err := extractPDFPages(data)
+			if err != nil {
+				t.Fatalf("extractPDFPages: %v", err)
+			}
+			if len(pages) != 1 || strings.TrimSpace(pages[0]) != tt.want {
+				t.Fatalf("pages = %q, want [%q]", pages, tt.want)
+			}
+		})
+	}
+}
+
+// Malformed files must fail with an error, never panic or hang
+func TestExtractPDFPagesMalformed(t *testing.T) {
+	inputs := []string{
+		"%PDF-1.4\nxref\n0 999999999\ntrailer<<>>startxref\n9\n%%EOF",
+		"%PDF-1.4\nxref\n0 2\n0000000000 65535 f \ntrailer",
+		"%PDF-1.4\nstartxref\n-5\n%%EOF",
+		"%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\ntrailer << /Root 1 0 R /XRefStm -3 >>\nstartxref\n9\n%%EOF",
+		"%PDF-1.5\n1 0 obj\n<< /Type /XRef /W [1 -4 1] /Size 3 /Length 6 >>\nstream\n\x01\x00\x00\x00\x00\x00\nendstream\nendobj\nstartxref\n9\n%%EOF",
+		"%PDF-1.4\n1 0 obj\n<< /Length 99999999999999999 >>\nstream\nabc",
+		"%PDF-1.4\n1 0 obj\n<< /Type /ObjStm /N 999999999999 /First -7 /Length 4 >>\nstream\n1 0 \nendstream\nendobj\n",
+		"%PDF-1.4\n1 0 obj (unterminated \\",
+		"%PDF-1.4\n1 0 obj <ab",
+		"%PDF-1.4\n1 0 obj /",
+		"%PDF-",
+	}
+	for _, input := range inputs {
+		if _, err := extractPDFPages([]byte(input)); err == nil {
+			t.Errorf("extractPDFPages(%q) succeeded", input)
+		}
+	}
+}
+
+func FuzzExtractPDFPages(f *testing.F) {
+	for _, file := range []string{"simple.pdf", "xref_stream.pdf", "damaged_xref.pdf"} {
+		data, err := os.ReadFile(filepath.Join("testdata", file))
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte("%PDF-1.4\nxref\n0 999999999\ntrailer<<>>startxref\n9\n%%EOF"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		extractPDFPages(data)
+	})
+}
@@ -0,0 +1,174 @@
+package document_proc
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// pptxSlideText is the text of a slide (or its notes) read from the DrawingML shapes
+type pptxSlideText struct {
+	title string
+	body  []string
+}
+
+// extractTextFromPPTX extracts the slides in presentation order, each under a "## Slide N: title" heading
+// followed by its text, tables as "header: value" lines and the speaker notes.
+func extractTextFromPPTX(filePath string) (string, error) {
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error opening PPTX file: %v", err)
+	}
+	defer archive.Close()
+
+	var presentation struct {
+		Slides []struct {
+			Attrs []xml.Attr `xml:",any,attr"`
+		} `xml:"sldIdLst>sldId"`
+	}
+	if err := readZipXML(&archive.Reader, "ppt/presentation.xml", &presentation); err != nil {
+		return "", fmt.Errorf("error reading PPTX presentation: %v", err)
+	}
+	targets, err := relationshipTargets(&archive.Reader, "ppt/presentation.xml")
+	if err != nil {
+		return "", fmt.Errorf("error reading PPTX presentation: %v", err)
+	}
+
+	var sections []string
+	for i, slideEntry := range presentation.Slides {
+		slidePath := targets[relationshipID(slideEntry.Attrs)]
+		if slidePath == "" {
+			continue
+		}
+		content, err := readZipEntry(&archive.Reader, slidePath)
+		if err != nil {
+			return "", fmt.Errorf("error reading PPTX slide %d: %v", i+1, err)
+		}
+		slide, err := pptxText(content)
+		if err != nil {
+			return "", fmt.Errorf("error parsing PPTX slide %d: %v", i+1, err)
+		}
+
+		heading := fmt.Sprintf("## Slide %d", i+1)
+		if slide.title != "" {
+			heading += ": " + slide.title
+		}
+		lines := append([]string{heading}, slide.body...)
+
+		// Speaker notes are linked from the slide relationships
+		slideTargets, _ := relationshipTargets(&archive.Reader, slidePath)
+		for _, target := range slideTargets {
+			if !strings.Contains(target, "notesSlides/") {
+				continue
+			}
+			if content, err := readZipEntry(&archive.Reader, target); err == nil {
+				if notes, err := pptxText(content); err == nil && len(notes.body) > 0 {
+					lines = append(lines, "Notes: "+strings.Join(notes.body, " "))
+				}
+			}
+		}
+		sections = append(sections, strings.Join(lines, "\n"))
+	}
+	return strings.Join(sections, "\n\n"), nil
+}
+
+// pptxText reads the paragraphs of the shapes of a slide. The title placeholder gives the title,
+// the slide number and date placeholders are skipped.
+func pptxText(content []byte) (pptxSlideText, error) {
+	var slide pptxSlideText
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+
+	var paragraph strings.Builder
+	var shapeParagraphs []string
+	placeholder := ""
+	inShape := 0
+
+	// Table state, cells hold paragraphs too
+	var tableRows [][]string
+	var row []string
+	var cell []string
+	inCell := false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return slide, err
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "sp":
+				inShape++
+				if inShape == 1 {
+					shapeParagraphs, placeholder = nil, ""
+				}
+			case "ph":
+				placeholder = attrValue(element.Attr, "type")
+				if placeholder == "" {
+					placeholder = "body"
+				}
+			case "p":
+				paragraph.Reset()
+			case "t":
+				var text string
+				if err := decoder.DecodeElement(&text, &element); err != nil {
+					return slide, err
+				}
+				paragraph.WriteString(text)
+			case "br":
+				paragraph.WriteString(" ")
+			case "tbl":
+				tableRows = nil
+			case "tr":
+				row = nil
+			case "tc":
+				cell, inCell = nil, true
+			}
+
+		case xml.EndElement:
+			switch element.Name.Local {
+			case "p":
+				text := strings.Join(strings.Fields(paragraph.String()), " ")
+				if text == "" {
+					break
+				}
+				if inCell {
+					cell = append(cell, text)
+				} else if inShape > 0 {
+					shapeParagraphs = append(shapeParagraphs, text)
+				}
+			case "tc":
+				row = append(row, strings.Join(cell, " "))
+				inCell = false
+			case "tr":
+				tableRows = append(tableRows, row)
+			case "tbl":
+				if len(tableRows) > 1 {
+					slide.body = append(slide.body, tableText(tableRows[0], tableRows[1:]))
+				} else if text := tableText(nil, tableRows); text != "" {
+					slide.body = append(slide.body, text)
+				}
+			case "sp":
+				inShape--
+				if inShape > 0 {
+					break
+				}
+				switch placeholder {
+				case "title", "ctrTitle":
+					slide.title = strings.Join(shapeParagraphs, " ")
+				case "sldNum", "dt", "ftr", "hdr", "sldImg":
+				default:
+					slide.body = append(slide.body, shapeParagraphs...)
+				}
+			}
+		}
+	}
+	return slide, nil
+}
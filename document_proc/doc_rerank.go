@@ -0,0 +1,207 @@
+package document_proc
+
+import (
+	"crossplatform_chatbot/ai_clients/chat"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// Reranker rescores first-pass retrieval candidates against the query
+type Reranker interface {
+	// Rerank returns the chunks with their Score replaced by the reranker's relevance score, best match first
+	Rerank(query string, chunks []ScoredChunk) ([]ScoredChunk, error)
+}
+
+// ChatCompleter is the part of a chat provider used by the LLM reranker
+type ChatCompleter interface {
+	ChatCompletion(messages []chat.Message, opts chat.Options) (string, error)
+}
+
+const rerankInstructions = `You are a relevance judge for a support knowledge base.
+Rate how well each numbered passage helps answer the question, from 0 (unrelated) to 10 (directly answers it).
+Reply with one line per passage in the form "<number>: <score>" and nothing else.`
+
+// Lines of the judge's reply, e.g. "3: 7" or "[3] 7.5"
+var judgeScorePattern = regexp.MustCompile(`(?m)^\s*\[?(\d+)\]?\s*[:=\-]?\s*(\d+(?:\.\d+)?)`)
+
+// LLMReranker asks a chat model to judge the relevance of all candidates in a single request
+type LLMReranker struct {
+	Provider ChatCompleter
+}
+
+// NewLLMReranker creates a reranker using the given chat provider as relevance judge
+func NewLLMReranker(provider ChatCompleter) *LLMReranker {
+	return &LLMReranker{Provider: provider}
+}
+
+// Rerank scores each chunk from 0 to 1 based on the judge's rating. Chunks the judge skipped score 0.
+func (r *LLMReranker) Rerank(query string, chunks []ScoredChunk) ([]ScoredChunk, error) {
+	if len(chunks) == 0 {
+		return chunks, nil
+	}
+
+	var passages strings.Builder
+	for i, chunk := range chunks {
+		fmt.Fprintf(&passages, "[%d] %s\n\n", i+1, strings.TrimSpace(chunk.Text))
+	}
+
+	messages := []chat.Message{
+		{Role: chat.RoleSystem, Content: rerankInstructions},
+		{Role: chat.RoleUser, Content: fmt.Sprintf("Question: %s\n\nPassages:\n%s", query, passages.String())},
+	}
+
+	// Allow a few tokens per "<number>: <score>" line
+	reply, err := r.Provider.ChatCompletion(messages, chat.Options{MaxTokens: 8*len(chunks) + 16, Temperature: chat.Temperature(0.1)})
+	if err != nil {
+		return nil, fmt.Errorf("error getting relevance judgement: %v", err)
+	}
+
+	ratings := make(map[int]float64)
+	for _, match := range judgeScorePattern.FindAllStringSubmatch(reply, -1) {
+		index, err := strconv.Atoi(match[1])
+		if err != nil || index < 1 || index > len(chunks) {
+			continue
+		}
+		rating, err := strconv.ParseFloat(match[2], 64)
+		if err != nil {
+			continue
+		}
+		if _, rated := ratings[index-1]; !rated {
+			ratings[index-1] = min(rating, 10) / 10
+		}
+	}
+	if len(ratings) == 0 {
+		return nil, fmt.Errorf("error parsing relevance judgement: %q", reply)
+	}
+
+	reranked := make([]ScoredChunk, len(chunks))
+	for i, chunk := range chunks {
+		chunk.Score = ratings[i]
+		reranked[i] = chunk
+	}
+	sortByScore(reranked)
+	return reranked, nil
+}
+
+// HTTPReranker calls a rerank endpoint in the format used by Cohere, Jina and Voyage
+// (POST {"model", "query", "documents", "top_n"} -> {"results": [{"index", "relevance_score"}]}).
+// Hugging Face text-embeddings-inference responses ([{"index", "score"}]) are accepted as well.
+type HTTPReranker struct {
+	URL    string
+	APIKey string
+	Model  string
+	Client *resty.Client
+}
+
+// NewHTTPReranker creates a reranker calling the endpoint at url
+func NewHTTPReranker(url, apiKey, model string) *HTTPReranker {
+	return &HTTPReranker{
+		URL:    url,
+		APIKey: apiKey,
+		Model:  model,
+		Client: resty.New().SetTimeout(30 * time.Second),
+	}
+}
+
+// rerankResult is a single entry of a rerank API response
+type rerankResult struct {
+	Index          int      `json:"index"`
+	RelevanceScore *float64 `json:"relevance_score"`
+	Score          *float64 `json:"score"`
+}
+
+// Rerank sends the chunk texts to the endpoint and orders them by the returned relevance scores
+func (r *HTTPReranker) Rerank(query string, chunks []ScoredChunk) ([]ScoredChunk, error) {
+	if len(chunks) == 0 {
+		return chunks, nil
+	}
+
+	documents := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		documents[i] = chunk.Text
+	}
+
+	request := map[string]interface{}{
+		"query":     query,
+		"documents": documents,
+		"texts":     documents, // text-embeddings-inference
+		"top_n":     len(documents),
+	}
+	if r.Model != "" {
+		request["model"] = r.Model
+	}
+
+	req := r.Client.R().
+		SetHeader("Content-Type", "application/json").
+		SetBody(request)
+	if r.APIKey != "" {
+		req.SetHeader("Authorization", "Bearer "+r.APIKey)
+	}
+
+	response, err := req.Post(r.URL)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request to reranker: %v", err)
+	}
+	if response.StatusCode() != 200 {
+		return nil, fmt.Errorf("reranker returned status code %d: %s", response.StatusCode(), response.String())
+	}
+
+	results, err := parseRerankResponse(response.Body())
+	if err != nil {
+		return nil, fmt.Errorf("error parsing response from reranker: %v", err)
+	}
+
+	scores := make(map[int]float64, len(results))
+	for _, result := range results {
+		if result.Index < 0 || result.Index >= len(chunks) {
+			continue
+		}
+		switch {
+		case result.RelevanceScore != nil:
+			scores[result.Index] = *result.RelevanceScore
+		case result.Score != nil:
+			scores[result.Index] = *result.Score
+		}
+	}
+
+	// Chunks missing from the response are dropped
+	reranked := make([]ScoredChunk, 0, len(scores))
+	for index, chunk := range chunks {
+		if score, found := scores[index]; found {
+			chunk.Score = score
+			reranked = append(reranked, chunk)
+		}
+	}
+	sortByScore(reranked)
+	return reranked, nil
+}
+
+// parseRerankResponse accepts both {"results": [...]} and a bare array of results
+func parseRerankResponse(body []byte) ([]rerankResult, error) {
+	var wrapped struct {
+		Results []rerankResult `json:"results"`
+	}
+	if err := json.Unmarshal(body, &wrapped); err == nil && wrapped.Results != nil {
+		return wrapped.Results, nil
+	}
+
+	var results []rerankResult
+	if err := json.Unmarshal(body, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// sortByScore sorts the chunks by score, highest first, keeping the previous order for ties
+func sortByScore(chunks []ScoredChunk) {
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return chunks[i].Score > chunks[j].Score
+	})
+}
@@ -0,0 +1,202 @@
+package document_proc
+
+import (
+	"crossplatform_chatbot/ai_clients/openai"
+	"crossplatform_chatbot/vectorstore"
+	"fmt"
+	"sort"
+)
+
+// Fusion modes for combining the semantic and lexical result lists
+const (
+	FusionWeighted = "weighted" // Weighted sum of cosine similarity and normalized BM25 score
+	FusionRRF      = "rrf"      // Reciprocal rank fusion
+)
+
+// FusionConfig defines how semantic and lexical results are combined
+type FusionConfig struct {
+	Mode           string
+	SemanticWeight float64
+	LexicalWeight  float64
+	RRFK           int // Rank constant of reciprocal rank fusion (commonly 60)
+}
+
+// Retriever runs hybrid retrieval: nearest neighbours from the vector store and BM25 matches
+// from the lexical index are fused into a single ranking.
+type Retriever struct {
+	Store   vectorstore.VectorStore
+	Lexical *BM25Index
+	Client  *openai.Client // Used to embed the query
+	Fusion  FusionConfig
+
+	Reranker         Reranker // Optional second stage rescoring the best fused candidates
+	RerankCandidates int      // Number of fused candidates passed to the reranker
+
+	Selection SelectionConfig
+}
+
+// Retrieve returns the top N chunks for the query. numCandidates chunks are taken from each list before fusion.
+// With weighted fusion the threshold applies to the combined score, with RRF it applies to the cosine similarity
+// of chunks found only by the semantic search (lexical matches are always kept).
+// When a reranker is set, the best RerankCandidates chunks are rescored by it before the top N are selected.
+func (r *Retriever) Retrieve(query string, topN, numCandidates int, threshold float64, filter vectorstore.Filter) ([]ScoredChunk, error) {
+	fmt.Println("Embedding query for similarity search...")
+	queryEmbedding, err := r.Client.EmbedText(query)
+	if err != nil {
+		return nil, fmt.Errorf("error embedding query: %v", err)
+	}
+
+	if numCandidates < topN {
+		numCandidates = topN
+	}
+	semantic, err := r.Store.Search(queryEmbedding, numCandidates, 0, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error searching vector store: %v", err)
+	}
+
+	var lexical []vectorstore.Result
+	if r.Lexical != nil {
+		lexical = r.Lexical.Search(query, numCandidates, filter)
+	}
+
+	// Look up the embeddings of chunks found only by the lexical search to get their cosine similarity
+	semanticScores := make(map[string]float64, len(semantic))
+	for _, result := range semantic {
+		semanticScores[result.ChunkID] = result.Score
+	}
+	var missing []string
+	for _, result := range lexical {
+		if _, found := semanticScores[result.ChunkID]; !found {
+			missing = append(missing, result.ChunkID)
+		}
+	}
+	if len(missing) > 0 {
+		records, err := r.Store.Get(missing...)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving lexical matches: %v", err)
+		}
+		for _, record := range records {
+			semantic = append(semantic, vectorstore.Result{Record: record, Score: cosineSimilarity(queryEmbedding, record.Embedding)})
+		}
+	}
+
+	var scores []ScoredChunk
+	if r.Fusion.Mode == FusionRRF {
+		scores = r.fuseRRF(semantic, lexical, threshold)
+	} else {
+		scores = r.fuseWeighted(query, semantic, lexical, threshold)
+	}
+
+	// Sort the chunks based on score (highest score first)
+	sort.Slice(scores, func(i, j int) bool {
+		return scores[i].Score > scores[j].Score
+	})
+	scores = dropDuplicateTexts(scores)
+
+	if r.Reranker != nil {
+		scores = r.rerank(query, scores)
+	}
+
+	if r.Selection.Mode == SelectionMMR {
+		scores = SelectMMR(scores, topN, r.Selection.Lambda)
+	} else if len(scores) > topN {
+		scores = scores[:topN]
+	}
+	if r.Selection.MergeAdjacent {
+		scores = MergeAdjacentChunks(scores)
+	}
+	for _, chunk := range scores {
+		fmt.Printf("Top relevant chunk selected. %s: %f\n", chunk.ChunkID, chunk.Score)
+	}
+
+	return scores, nil
+}
+
+// rerank rescores the best fused candidates, keeping the fused ranking if the reranker fails
+func (r *Retriever) rerank(query string, candidates []ScoredChunk) []ScoredChunk {
+	if r.RerankCandidates > 0 && len(candidates) > r.RerankCandidates {
+		candidates = candidates[:r.RerankCandidates]
+	}
+	if len(candidates) == 0 {
+		return candidates
+	}
+
+	reranked, err := r.Reranker.Rerank(query, candidates)
+	if err != nil {
+		fmt.Printf("Error reranking chunks, using fused ranking: %v\n", err)
+		return candidates
+	}
+	for _, chunk := range reranked {
+		fmt.Printf("Reranked score for chunk %s: %f\n", chunk.ChunkID, chunk.Score)
+	}
+	return reranked
+}
+
+// fuseWeighted combines the cosine similarity with the BM25 score normalized by the best lexical match
+func (r *Retriever) fuseWeighted(query string, semantic, lexical []vectorstore.Result, threshold float64) []ScoredChunk {
+	lexicalScores := make(map[string]float64, len(lexical))
+	if len(lexical) > 0 && lexical[0].Score > 0 {
+		for _, result := range lexical {
+			lexicalScores[result.ChunkID] = result.Score / lexical[0].Score
+		}
+	}
+
+	var scores []ScoredChunk
+	for _, result := range semantic {
+		keywordScore := lexicalScores[result.ChunkID]
+		if r.Lexical == nil {
+			keywordScore = keywordMatchScore(query, result.Text) // Fuzzy matching without a lexical index
+		}
+		combinedScore := r.Fusion.SemanticWeight*result.Score + r.Fusion.LexicalWeight*keywordScore
+
+		fmt.Printf("Combined score for chunk %s: %f\n", result.ChunkID, combinedScore)
+
+		// Only add the chunk if it meets the threshold
+		if combinedScore >= threshold {
+			scores = append(scores, newScoredChunk(result, combinedScore))
+		}
+	}
+	return scores
+}
+
+// fuseRRF scores each chunk by the sum of weight / (k + rank) over the lists it appears in
+func (r *Retriever) fuseRRF(semantic, lexical []vectorstore.Result, threshold float64) []ScoredChunk {
+	k := float64(r.Fusion.RRFK)
+	if k <= 0 {
+		k = 60
+	}
+
+	fused := make(map[string]float64)
+	for rank, result := range lexical {
+		fused[result.ChunkID] += r.Fusion.LexicalWeight / (k + float64(rank+1))
+	}
+
+	// The semantic list may contain appended lexical matches, so rank it by score first
+	sort.Slice(semantic, func(i, j int) bool {
+		return semantic[i].Score > semantic[j].Score
+	})
+
+	var scores []ScoredChunk
+	for rank, result := range semantic {
+		_, lexicalMatch := fused[result.ChunkID]
+		if !lexicalMatch && result.Score < threshold {
+			continue
+		}
+		score := fused[result.ChunkID] + r.Fusion.SemanticWeight/(k+float64(rank+1))
+
+		fmt.Printf("Fused score for chunk %s: %f\n", result.ChunkID, score)
+		scores = append(scores, newScoredChunk(result, score))
+	}
+	return scores
+}
+
+func newScoredChunk(result vectorstore.Result, score float64) ScoredChunk {
+	return ScoredChunk{
+		ChunkID:   result.ChunkID,
+		DocID:     result.DocID,
+		Filename:  result.Filename,
+		Text:      result.Text,
+		Score:     score,
+		Embedding: result.Embedding,
+	}
+}
@@ -0,0 +1,115 @@
+package document_proc
+
+import (
+	"crossplatform_chatbot/vectorstore"
+	"sort"
+	"testing"
+)
+
+// errorCodeSemantic is the semantic ranking of the error chunks for "What does error E1234 mean?": embeddings
+// capture the topic but not the exact code, so a generic chunk about the fan ranks above the E1234 chunk
+func errorCodeSemantic() []vectorstore.Result {
+	scores := map[string]float64{"fan": 0.82, "e1234": 0.81, "e1235": 0.80, "e2001": 0.70, "x200": 0.40}
+	var semantic []vectorstore.Result
+	for _, record := range errorCodeRecords() {
+		semantic = append(semantic, vectorstore.Result{Record: record, Score: scores[record.ChunkID]})
+	}
+	sort.Slice(semantic, func(i, j int) bool { return semantic[i].Score > semantic[j].Score })
+	return semantic
+}
+
+func sortedChunkIDs(scores []ScoredChunk) []string {
+	sort.Slice(scores, func(i, j int) bool { return scores[i].Score > scores[j].Score })
+	ids := make([]string, len(scores))
+	for i, chunk := range scores {
+		ids[i] = chunk.ChunkID
+	}
+	return ids
+}
+
+func TestFusionRanksExactCodeFirst(t *testing.T) {
+	const query = "What does error E1234 mean?"
+	idx := NewBM25Index(true)
+	idx.Add(errorCodeRecords()...)
+	lexical := idx.Search(query, 10, vectorstore.Filter{})
+
+	tests := []struct {
+		name   string
+		fusion FusionConfig
+	}{
+		{"weighted", FusionConfig{Mode: FusionWeighted, SemanticWeight: 0.7, LexicalWeight: 0.3}},
+		{"rrf", FusionConfig{Mode: FusionRRF, SemanticWeight: 1, LexicalWeight: 1, RRFK: 60}},
+		{"rrf default k", FusionConfig{Mode: FusionRRF, SemanticWeight: 1, LexicalWeight: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Retriever{Lexical: idx, Fusion: tt.fusion}
+			var scores []ScoredChunk
+			if tt.fusion.Mode == FusionRRF {
+				scores = r.fuseRRF(errorCodeSemantic(), lexical, 0.5)
+			} else {
+				scores = r.fuseWeighted(query, errorCodeSemantic(), lexical, 0.5)
+			}
+			ids := sortedChunkIDs(scores)
+			if len(ids) == 0 || ids[0] != "e1234" {
+				t.Fatalf("fused ranking = %v, want e1234 first", ids)
+			}
+		})
+	}
+
+	// Semantic search alone ranks the generic chunk first
+	if semantic := errorCodeSemantic(); semantic[0].ChunkID != "fan" {
+		t.Fatalf("semantic ranking starts with %s", semantic[0].ChunkID)
+	}
+}
+
+func TestFuseWeighted(t *testing.T) {
+	semantic := []vectorstore.Result{
+		{Record: vectorstore.Record{ChunkID: "a"}, Score: 0.9},
+		{Record: vectorstore.Record{ChunkID: "b"}, Score: 0.5},
+		{Record: vectorstore.Record{ChunkID: "c"}, Score: 0.2},
+	}
+	lexical := []vectorstore.Result{
+		{Record: vectorstore.Record{ChunkID: "b"}, Score: 8},
+		{Record: vectorstore.Record{ChunkID: "c"}, Score: 2},
+	}
+	r := &Retriever{Lexical: NewBM25Index(false), Fusion: FusionConfig{SemanticWeight: 0.5, LexicalWeight: 0.5}}
+
+	// BM25 scores are normalized by the best lexical match: b 1, c 0.25
+	want := map[string]float64{"a": 0.45, "b": 0.75, "c": 0.225}
+	scores := r.fuseWeighted("query", semantic, lexical, 0.3)
+	if len(scores) != 2 {
+		t.Fatalf("fuseWeighted = %+v, want a and b above the threshold", scores)
+	}
+	for _, chunk := range scores {
+		if diff := chunk.Score - want[chunk.ChunkID]; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("score of %s = %f, want %f", chunk.ChunkID, chunk.Score, want[chunk.ChunkID])
+		}
+	}
+}
+
+func TestFuseRRF(t *testing.T) {
+	semantic := []vectorstore.Result{
+		{Record: vectorstore.Record{ChunkID: "c"}, Score: 0.3}, // Lexical match appended to the semantic list
+		{Record: vectorstore.Record{ChunkID: "a"}, Score: 0.9},
+		{Record: vectorstore.Record{ChunkID: "b"}, Score: 0.6},
+		{Record: vectorstore.Record{ChunkID: "d"}, Score: 0.2},
+	}
+	lexical := []vectorstore.Result{
+		{Record: vectorstore.Record{ChunkID: "c"}, Score: 5},
+		{Record: vectorstore.Record{ChunkID: "b"}, Score: 3},
+	}
+	r := &Retriever{Fusion: FusionConfig{Mode: FusionRRF, SemanticWeight: 1, LexicalWeight: 2, RRFK: 10}}
+
+	// Semantic ranks a 1, b 2, c 3; d is below the threshold and not a lexical match, c is kept as one
+	want := map[string]float64{"a": 1.0 / 11, "b": 1.0/12 + 2.0/12, "c": 1.0/13 + 2.0/11}
+	scores := r.fuseRRF(semantic, lexical, 0.25)
+	if len(scores) != len(want) {
+		t.Fatalf("fuseRRF = %+v, want %d chunks", scores, len(want))
+	}
+	for _, chunk := range scores {
+		if diff := chunk.Score - want[chunk.ChunkID]; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("score of %s = %f, want %f", chunk.ChunkID, chunk.Score, want[chunk.ChunkID])
+		}
+	}
+}
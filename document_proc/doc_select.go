@@ -0,0 +1,174 @@
+package document_proc
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Selection modes for picking the final chunks from the ranked candidates
+const (
+	SelectionTopN = "topn" // Highest scores first
+	SelectionMMR  = "mmr"  // Maximal Marginal Relevance
+)
+
+// SelectionConfig defines how the final chunks are picked from the ranked candidates
+type SelectionConfig struct {
+	Mode          string
+	Lambda        float64 // MMR trade-off: 1 ranks by relevance only, 0 by novelty only
+	MergeAdjacent bool    // Merge neighbouring chunks of the same document into one passage
+}
+
+// SelectMMR picks topN chunks by Maximal Marginal Relevance: each step takes the chunk maximising
+// lambda * relevance - (1 - lambda) * max similarity to the chunks already selected.
+// Relevance is the chunk score relative to the best candidate, similarity is the cosine of the chunk embeddings.
+func SelectMMR(candidates []ScoredChunk, topN int, lambda float64) []ScoredChunk {
+	if topN <= 0 || len(candidates) == 0 {
+		return nil
+	}
+	if len(candidates) <= topN {
+		return candidates
+	}
+
+	maxScore := 0.0
+	for _, chunk := range candidates {
+		maxScore = math.Max(maxScore, chunk.Score)
+	}
+
+	remaining := make([]int, len(candidates))
+	for i := range candidates {
+		remaining[i] = i
+	}
+	// Highest similarity of each candidate to the selected chunks
+	redundancy := make([]float64, len(candidates))
+
+	selected := make([]ScoredChunk, 0, topN)
+	for len(selected) < topN && len(remaining) > 0 {
+		best, bestValue := 0, math.Inf(-1)
+		for position, index := range remaining {
+			relevance := 0.0
+			if maxScore > 0 {
+				relevance = candidates[index].Score / maxScore
+			}
+			value := lambda*relevance - (1-lambda)*redundancy[index]
+			if value > bestValue {
+				best, bestValue = position, value
+			}
+		}
+
+		chosen := candidates[remaining[best]]
+		selected = append(selected, chosen)
+		remaining = append(remaining[:best], remaining[best+1:]...)
+		fmt.Printf("MMR selected chunk %s: %f\n", chosen.ChunkID, bestValue)
+
+		for _, index := range remaining {
+			if len(chosen.Embedding) == 0 || len(candidates[index].Embedding) == 0 {
+				continue
+			}
+			similarity := cosineSimilarity(chosen.Embedding, candidates[index].Embedding)
+			redundancy[index] = math.Max(redundancy[index], similarity)
+		}
+	}
+
+	return selected
+}
+
+// MergeAdjacentChunks collapses chunks of the same document with consecutive chunk numbers into one passage.
+// The overlapping words are removed, the merged passage keeps the ID of its first chunk and the best score.
+func MergeAdjacentChunks(chunks []ScoredChunk) []ScoredChunk {
+	type position struct {
+		chunk ScoredChunk
+		index int
+	}
+
+	byDoc := make(map[string][]position)
+	var docOrder []string
+	var unnumbered []ScoredChunk
+	for _, chunk := range chunks {
+		index, ok := chunkIndex(chunk)
+		if !ok {
+			unnumbered = append(unnumbered, chunk)
+			continue
+		}
+		if _, seen := byDoc[chunk.DocID]; !seen {
+			docOrder = append(docOrder, chunk.DocID)
+		}
+		byDoc[chunk.DocID] = append(byDoc[chunk.DocID], position{chunk, index})
+	}
+
+	merged := unnumbered
+	for _, docID := range docOrder {
+		positions := byDoc[docID]
+		sort.Slice(positions, func(i, j int) bool {
+			return positions[i].index < positions[j].index
+		})
+
+		current := positions[0].chunk
+		for i := 1; i < len(positions); i++ {
+			if positions[i].index != positions[i-1].index+1 {
+				merged = append(merged, current)
+				current = positions[i].chunk
+				continue
+			}
+			next := positions[i].chunk
+			if len(current.MergedChunkIDs) == 0 {
+				current.MergedChunkIDs = []string{current.ChunkID}
+			}
+			current.MergedChunkIDs = append(current.MergedChunkIDs, next.ChunkID)
+			current.Text = joinOverlapping(current.Text, next.Text)
+			current.Score = math.Max(current.Score, next.Score)
+			current.Embedding = nil // No longer matches the merged text
+		}
+		merged = append(merged, current)
+	}
+
+	sortByScore(merged)
+	return merged
+}
+
+// chunkIndex parses the chunk number from IDs in the "<docID>_chunk_<n>" format
+func chunkIndex(chunk ScoredChunk) (int, bool) {
+	separator := strings.LastIndex(chunk.ChunkID, "_chunk_")
+	if separator < 0 || chunk.DocID == "" {
+		return 0, false
+	}
+	index, err := strconv.Atoi(chunk.ChunkID[separator+len("_chunk_"):])
+	if err != nil {
+		return 0, false
+	}
+	return index, true
+}
+
+// joinOverlapping appends next to previous, dropping the longest run of words that ends previous and starts next.
+// The texts are joined as written, so the lines of table rows and heading prefixes are kept; chunks that don't
+// overlap are separated by a blank line.
+func joinOverlapping(previous, next string) string {
+	previousWords := strings.Fields(previous)
+	nextWords := strings.Fields(next)
+	previous = strings.TrimRightFunc(previous, unicode.IsSpace)
+
+	for overlap := min(len(previousWords), len(nextWords)); overlap > 0; overlap-- {
+		if slices.Equal(previousWords[len(previousWords)-overlap:], nextWords[:overlap]) {
+			return previous + next[wordsEnd(next, overlap):]
+		}
+	}
+	return previous + "\n\n" + strings.TrimLeftFunc(next, unicode.IsSpace)
+}
+
+// wordsEnd returns the offset right after the first n words of the text
+func wordsEnd(text string, n int) int {
+	end := 0
+	for ; n > 0; n-- {
+		start := end + strings.IndexFunc(text[end:], func(r rune) bool { return !unicode.IsSpace(r) })
+		length := strings.IndexFunc(text[start:], unicode.IsSpace)
+		if length < 0 {
+			return len(text)
+		}
+		end = start + length
+	}
+	return end
+}
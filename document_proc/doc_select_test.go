@@ -0,0 +1,93 @@
+package document_proc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJoinOverlapping(t *testing.T) {
+	tests := []struct {
+		name, previous, next, want string
+	}{
+		{"word overlap", "plug the router in and wait", "and wait for the light", "plug the router in and wait for the light"},
+		{"table rows keep their lines",
+			"Model: X-200\nColor: black\nWeight: 2 kg",
+			"Color: black\nWeight: 2 kg\nPrice: 99 EUR\n  Stock: 4",
+			"Model: X-200\nColor: black\nWeight: 2 kg\nPrice: 99 EUR\n  Stock: 4"},
+		{"overlap inside a line", "Weight: 2 kg\nPrice:", "Price: 99 EUR\nStock: 4", "Weight: 2 kg\nPrice: 99 EUR\nStock: 4"},
+		{"heading prefixes without overlap",
+			"Setup > Install\n\nPlug the router in.\n",
+			"Setup > Reset\n\nHold the button.",
+			"Setup > Install\n\nPlug the router in.\n\nSetup > Reset\n\nHold the button."},
+		{"next contained in previous", "a b c d", "c d\n", "a b c d\n"},
+		{"empty next", "a b", "", "a b\n\n"},
+	}
+	for _, tt := range tests {
+		if got := joinOverlapping(tt.previous, tt.next); got != tt.want {
+			t.Errorf("%s: joinOverlapping = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMergeAdjacentChunks(t *testing.T) {
+	chunks := []ScoredChunk{
+		{ChunkID: "manual_chunk_2", DocID: "manual", Text: "Color: black\nWeight: 2 kg\nPrice: 99 EUR", Score: 0.9, Embedding: []float64{1}},
+		{ChunkID: "faq_chunk_0", DocID: "faq", Text: "Questions", Score: 0.5},
+		{ChunkID: "manual_chunk_1", DocID: "manual", Text: "Model: X-200\nColor: black\nWeight: 2 kg", Score: 0.7, Embedding: []float64{1}},
+		{ChunkID: "manual_chunk_4", DocID: "manual", Text: "Warranty", Score: 0.8},
+		{ChunkID: "legacy", DocID: "old", Text: "Unnumbered", Score: 0.6},
+	}
+	merged := MergeAdjacentChunks(chunks)
+
+	var ids []string
+	for _, chunk := range merged {
+		ids = append(ids, chunk.ChunkID)
+	}
+	if want := []string{"manual_chunk_1", "manual_chunk_4", "legacy", "faq_chunk_0"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("merged chunks = %v, want %v", ids, want)
+	}
+
+	passage := merged[0]
+	if passage.Text != "Model: X-200\nColor: black\nWeight: 2 kg\nPrice: 99 EUR" {
+		t.Errorf("merged text = %q", passage.Text)
+	}
+	if passage.Score != 0.9 || passage.Embedding != nil {
+		t.Errorf("merged score %f, embedding %v; want the best score and no embedding", passage.Score, passage.Embedding)
+	}
+	if want := []string{"manual_chunk_1", "manual_chunk_2"}; !reflect.DeepEqual(passage.MergedChunkIDs, want) {
+		t.Errorf("MergedChunkIDs = %v, want %v", passage.MergedChunkIDs, want)
+	}
+	if merged[1].MergedChunkIDs != nil {
+		t.Errorf("chunk without neighbour has MergedChunkIDs %v", merged[1].MergedChunkIDs)
+	}
+}
+
+func TestSelectMMR(t *testing.T) {
+	candidates := []ScoredChunk{
+		{ChunkID: "a", Score: 1.0, Embedding: []float64{1, 0}},
+		{ChunkID: "a_copy", Score: 0.95, Embedding: []float64{1, 0.05}},
+		{ChunkID: "b", Score: 0.8, Embedding: []float64{0, 1}},
+		{ChunkID: "no_embedding", Score: 0.5},
+	}
+	tests := []struct {
+		name   string
+		topN   int
+		lambda float64
+		want   []string
+	}{
+		{"relevance only", 2, 1, []string{"a", "a_copy"}},
+		{"diversity", 2, 0.5, []string{"a", "b"}},
+		{"diversity third pick", 3, 0.5, []string{"a", "b", "no_embedding"}},
+		{"all candidates", 4, 0.5, []string{"a", "a_copy", "b", "no_embedding"}}, // Returned as ranked
+		{"none", 0, 0.5, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, chunk := range SelectMMR(candidates, tt.topN, tt.lambda) {
+			got = append(got, chunk.ChunkID)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: SelectMMR = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package document_proc
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// extractTextFromCSV extracts a CSV or TSV file as "header: value" lines, one line per row
+func extractTextFromCSV(filePath string) (string, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error reading CSV file: %v", err)
+	}
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.Comma = csvDelimiter(content)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return "", fmt.Errorf("error parsing CSV file: %v", err)
+	}
+	return headerTableText(rows), nil
+}
+
+// csvDelimiter guesses the delimiter from the first line (comma, semicolon or tab)
+func csvDelimiter(content []byte) rune {
+	firstLine, _, _ := bytes.Cut(content, []byte("\n"))
+	delimiter, most := ',', 0
+	for _, candidate := range []rune{',', ';', '\t'} {
+		if count := bytes.Count(firstLine, []byte(string(candidate))); count > most {
+			delimiter, most = candidate, count
+		}
+	}
+	return delimiter
+}
+
+// XLSX (SpreadsheetML) parts
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name  string     `xml:"name,attr"`
+		Attrs []xml.Attr `xml:",any,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRichText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxRichText) String() string {
+	text := t.Text
+	for _, run := range t.Runs {
+		text += run.Text
+	}
+	return text
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string       `xml:"r,attr"`
+			Type   string       `xml:"t,attr"`
+			Value  string       `xml:"v"`
+			Inline xlsxRichText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// extractTextFromXLSX extracts every worksheet under a "## sheet name" heading, with rows as "header: value" lines
+func extractTextFromXLSX(filePath string) (string, error) {
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error opening XLSX file: %v", err)
+	}
+	defer archive.Close()
+
+	var workbook xlsxWorkbook
+	if err := readZipXML(&archive.Reader, "xl/workbook.xml", &workbook); err != nil {
+		return "", fmt.Errorf("error reading XLSX workbook: %v", err)
+	}
+	targets, err := relationshipTargets(&archive.Reader, "xl/workbook.xml")
+	if err != nil {
+		return "", fmt.Errorf("error reading XLSX workbook: %v", err)
+	}
+
+	var sharedStrings struct {
+		Items []xlsxRichText `xml:"si"`
+	}
+	// Workbooks with only numbers have no shared strings
+	if err := readZipXML(&archive.Reader, "xl/sharedStrings.xml", &sharedStrings); err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("error reading XLSX shared strings: %v", err)
+	}
+
+	var sections []string
+	for _, sheetEntry := range workbook.Sheets {
+		target := targets[relationshipID(sheetEntry.Attrs)]
+		if target == "" {
+			continue
+		}
+		var sheet xlsxSheet
+		if err := readZipXML(&archive.Reader, target, &sheet); err != nil {
+			return "", fmt.Errorf("error reading XLSX sheet %s: %v", sheetEntry.Name, err)
+		}
+
+		var rows [][]string
+		for _, sheetRow := range sheet.Rows {
+			var row []string
+			for _, cell := range sheetRow.Cells {
+				// Empty cells are left out of the file, place the value by its reference (e.g. C7)
+				if column := cellColumn(cell.Ref); column >= len(row) {
+					row = append(row, make([]string, column-len(row))...)
+				}
+				value := cell.Value
+				switch cell.Type {
+				case "s":
+					var index int
+					if _, err := fmt.Sscan(cell.Value, &index); err == nil && index >= 0 && index < len(sharedStrings.Items) {
+						value = sharedStrings.Items[index].String()
+					}
+				case "inlineStr":
+					value = cell.Inline.String()
+				case "b":
+					value = map[string]string{"1": "TRUE", "0": "FALSE"}[cell.Value]
+				}
+				row = append(row, value)
+			}
+			rows = append(rows, row)
+		}
+
+		if text := headerTableText(rows); text != "" {
+			sections = append(sections, "## "+sheetEntry.Name+"\n"+text)
+		}
+	}
+	return strings.Join(sections, "\n\n"), nil
+}
+
+// cellColumn returns the 0-based column of a cell reference such as "AB12", -1 without a reference
+func cellColumn(ref string) int {
+	column := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		column = column*26 + int(c-'A'+1)
+	}
+	return column - 1
+}
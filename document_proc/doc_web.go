@@ -0,0 +1,671 @@
+package document_proc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ErrDisallowedByRobots is returned for pages excluded by the robots.txt of their site
+var ErrDisallowedByRobots = errors.New("disallowed by robots.txt")
+
+// ErrBlockedAddress is returned for pages on loopback, private or link-local addresses, which the crawler
+// doesn't fetch so that it can't be used to reach the internal network (including through redirects)
+var ErrBlockedAddress = errors.New("address not allowed")
+
+// Shared address space (carrier-grade NAT) and "this network", not covered by netip's classification
+var blockedPrefixes = []netip.Prefix{netip.MustParsePrefix("100.64.0.0/10"), netip.MustParsePrefix("0.0.0.0/8")}
+
+const (
+	maxWebPageSize  = 20 << 20         // Larger responses are rejected
+	maxSitemaps     = 50               // Sitemaps read for one crawl, including those listed in sitemap indexes
+	maxCrawlDelay   = 30 * time.Second // Upper bound for the Crawl-delay of robots.txt
+	robotsTTL       = 24 * time.Hour   // robots.txt is fetched again after a day
+	robotsRetryTTL  = time.Minute      // or after a minute when it couldn't be fetched
+	webFetchTimeout = 30 * time.Second
+)
+
+// WebPage is a fetched page. NotModified is set when the server answered the conditional request with 304,
+// the body is empty then.
+type WebPage struct {
+	URL          string
+	ContentType  string
+	ETag         string
+	LastModified string
+	Body         []byte
+	NotModified  bool
+}
+
+// WebCrawler fetches pages politely: it follows robots.txt, sends one request at a time to each site
+// and waits between requests to the same site (the configured delay, or the Crawl-delay of robots.txt if longer).
+type WebCrawler struct {
+	client    *http.Client
+	userAgent string
+	delay     time.Duration
+
+	allowAddress func(addr netip.Addr) bool // Addresses the crawler may connect to, public ones by default
+
+	mu    sync.Mutex
+	sites map[string]*crawlSite // By scheme and host
+}
+
+// crawlSite holds the robots.txt rules of a site and the time its next request may be sent
+type crawlSite struct {
+	origin string
+
+	robotsMu      sync.Mutex
+	robots        *robotsRules
+	robotsExpires time.Time
+
+	gate       sync.Mutex // Held during a request, so requests to the site don't overlap
+	next       time.Time
+	crawlDelay time.Duration
+}
+
+// NewWebCrawler creates a crawler identifying itself with the user agent
+func NewWebCrawler(userAgent string, delay time.Duration) *WebCrawler {
+	c := &WebCrawler{
+		userAgent: userAgent,
+		delay:     delay,
+		sites:     make(map[string]*crawlSite),
+
+		allowAddress: isPublicAddress,
+	}
+
+	// The address is checked when connecting, after DNS resolution, so redirects and
+	// hosts resolving to internal addresses are rejected too. No proxy is used for the same reason.
+	dialer := &net.Dialer{Timeout: webFetchTimeout, Control: c.checkDialAddress}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	c.client = &http.Client{Timeout: webFetchTimeout, Transport: transport}
+	return c
+}
+
+// AllowPrivateAddresses lets the crawler fetch pages on loopback, private and link-local addresses, e.g. an intranet
+func (c *WebCrawler) AllowPrivateAddresses() {
+	c.allowAddress = func(netip.Addr) bool { return true }
+}
+
+// isPublicAddress reports whether the address is routable on the internet
+func isPublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() || addr.IsMulticast() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkDialAddress rejects connections to addresses the crawler may not reach
+func (c *WebCrawler) checkDialAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !c.allowAddress(addr) {
+		return fmt.Errorf("%s: %w", host, ErrBlockedAddress)
+	}
+	return nil
+}
+
+// CheckHost returns ErrBlockedAddress when the host of the URL resolves to an address the crawler may not reach.
+// Connections are checked again when they are made, this gives a clear error before the crawl starts.
+func (c *WebCrawler) CheckHost(pageURL string) error {
+	parsed, err := url.Parse(pageURL)
+	if err != nil {
+		return fmt.Errorf("invalid page URL %q", pageURL)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), webFetchTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", parsed.Hostname())
+	if err != nil {
+		return fmt.Errorf("error resolving %s: %v", parsed.Hostname(), err)
+	}
+	for _, addr := range addrs {
+		if !c.allowAddress(addr) {
+			return fmt.Errorf("%s: %w", parsed.Hostname(), ErrBlockedAddress)
+		}
+	}
+	return nil
+}
+
+func (c *WebCrawler) site(pageURL *url.URL) *crawlSite {
+	origin := pageURL.Scheme + "://" + pageURL.Host
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	site, found := c.sites[origin]
+	if !found {
+		site = &crawlSite{origin: origin}
+		c.sites[origin] = site
+	}
+	return site
+}
+
+// Allowed reports whether robots.txt lets the crawler fetch the page
+func (c *WebCrawler) Allowed(pageURL string) bool {
+	parsed, err := url.Parse(pageURL)
+	if err != nil {
+		return false
+	}
+	return c.robots(c.site(parsed)).allowed(robotsPath(parsed))
+}
+
+// Fetch downloads a page. With an ETag or Last-Modified value from an earlier fetch the request is conditional,
+// and an unchanged page is returned with NotModified set. ErrDisallowedByRobots is returned for excluded pages.
+func (c *WebCrawler) Fetch(pageURL, etag, lastModified string) (*WebPage, error) {
+	parsed, err := url.Parse(pageURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid page URL %q", pageURL)
+	}
+	site := c.site(parsed)
+	if !c.robots(site).allowed(robotsPath(parsed)) {
+		return nil, fmt.Errorf("%s: %w", pageURL, ErrDisallowedByRobots)
+	}
+
+	headers := map[string]string{}
+	if etag != "" {
+		headers["If-None-Match"] = etag
+	}
+	if lastModified != "" {
+		headers["If-Modified-Since"] = lastModified
+	}
+	response, body, err := c.get(site, pageURL, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &WebPage{
+		URL:          response.Request.URL.String(),
+		ContentType:  response.Header.Get("Content-Type"),
+		ETag:         response.Header.Get("ETag"),
+		LastModified: response.Header.Get("Last-Modified"),
+		Body:         body,
+	}
+	switch {
+	case response.StatusCode == http.StatusNotModified:
+		page.NotModified = true
+		if page.ETag == "" {
+			page.ETag = etag
+		}
+		if page.LastModified == "" {
+			page.LastModified = lastModified
+		}
+	case response.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("error fetching %s: status code %d", pageURL, response.StatusCode)
+	}
+	return page, nil
+}
+
+// get sends a GET request to the site once the previous one is finished and the delay has passed.
+// The body is read before the site is released.
+func (c *WebCrawler) get(site *crawlSite, pageURL string, headers map[string]string) (*http.Response, []byte, error) {
+	request, err := http.NewRequest(http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating request for %s: %v", pageURL, err)
+	}
+	request.Header.Set("User-Agent", c.userAgent)
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+
+	site.gate.Lock()
+	defer site.gate.Unlock()
+	time.Sleep(time.Until(site.next))
+	defer func() {
+		site.next = time.Now().Add(max(c.delay, site.crawlDelay))
+	}()
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error fetching %s: %v", pageURL, err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxWebPageSize+1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading %s: %v", pageURL, err)
+	}
+	if len(body) > maxWebPageSize {
+		return nil, nil, fmt.Errorf("error reading %s: larger than %d MB", pageURL, maxWebPageSize>>20)
+	}
+	return response, body, nil
+}
+
+// robots returns the robots.txt rules of the site, fetching them when they are missing or expired.
+// A missing robots.txt allows everything; while it can't be read (server errors) the site is not crawled.
+func (c *WebCrawler) robots(site *crawlSite) *robotsRules {
+	site.robotsMu.Lock()
+	defer site.robotsMu.Unlock()
+	if site.robots != nil && time.Now().Before(site.robotsExpires) {
+		return site.robots
+	}
+
+	rules, ttl := &robotsRules{}, robotsTTL
+	response, body, err := c.get(site, site.origin+"/robots.txt", nil)
+	switch {
+	case err != nil:
+		fmt.Printf("Error fetching robots.txt of %s, not crawling it for now: %v\n", site.origin, err)
+		rules, ttl = disallowAll(), robotsRetryTTL
+	case response.StatusCode == http.StatusOK:
+		rules = parseRobots(string(body), c.userAgent)
+	case response.StatusCode >= 500:
+		fmt.Printf("Error fetching robots.txt of %s, not crawling it for now: status code %d\n", site.origin, response.StatusCode)
+		rules, ttl = disallowAll(), robotsRetryTTL
+	}
+
+	site.gate.Lock()
+	site.crawlDelay = min(rules.crawlDelay, maxCrawlDelay)
+	site.gate.Unlock()
+	site.robots, site.robotsExpires = rules, time.Now().Add(ttl)
+	return rules
+}
+
+// robotsRules are the Allow and Disallow lines of the robots.txt group that applies to the crawler
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+type robotsRule struct {
+	pattern string
+	allow   bool
+}
+
+func disallowAll() *robotsRules {
+	return &robotsRules{rules: []robotsRule{{pattern: "/"}}}
+}
+
+// parseRobots reads the group of the most specific user agent matching ours, or the "*" group
+func parseRobots(content, userAgent string) *robotsRules {
+	// The product token of the user agent, e.g. "mybot" for "MyBot/1.0 (+https://example.com)"
+	agent := strings.ToLower(userAgent)
+	if i := strings.IndexAny(agent, "/ "); i >= 0 {
+		agent = agent[:i]
+	}
+
+	groups := make(map[string]*robotsRules)
+	var current []*robotsRules // Groups of the user agent lines being read
+	readingRules := false
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// User agent lines after rules start a new group
+			if readingRules {
+				current, readingRules = nil, false
+			}
+			name := strings.ToLower(value)
+			if groups[name] == nil {
+				groups[name] = &robotsRules{}
+			}
+			current = append(current, groups[name])
+		case "allow", "disallow":
+			readingRules = true
+			if value == "" {
+				continue // An empty Disallow allows everything
+			}
+			for _, group := range current {
+				group.rules = append(group.rules, robotsRule{pattern: value, allow: key == "allow"})
+			}
+		case "crawl-delay":
+			readingRules = true
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				for _, group := range current {
+					group.crawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		}
+	}
+
+	best := ""
+	for name := range groups {
+		if name != "*" && strings.Contains(agent, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		best = "*"
+	}
+	if rules, found := groups[best]; found {
+		return rules
+	}
+	return &robotsRules{}
+}
+
+// allowed applies the longest matching rule, Allow wins ties
+func (r *robotsRules) allowed(urlPath string) bool {
+	allow, longest := true, -1
+	for _, rule := range r.rules {
+		if !robotsMatch(rule.pattern, urlPath) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			allow, longest = rule.allow, len(rule.pattern)
+		}
+	}
+	return allow
+}
+
+// robotsMatch matches a path against a robots.txt pattern, where "*" matches any characters and "$" ends the path
+func robotsMatch(pattern, urlPath string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(urlPath, parts[0]) {
+		return false
+	}
+	rest := urlPath[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(rest, part)
+		}
+		index := strings.Index(rest, part)
+		if index < 0 {
+			return false
+		}
+		rest = rest[index+len(part):]
+	}
+	return !anchored || rest == ""
+}
+
+// robotsPath is the path and query of the URL as matched by robots.txt rules
+func robotsPath(pageURL *url.URL) string {
+	urlPath := pageURL.EscapedPath()
+	if urlPath == "" {
+		urlPath = "/"
+	}
+	if pageURL.RawQuery != "" {
+		urlPath += "?" + pageURL.RawQuery
+	}
+	return urlPath
+}
+
+// IsSitemapURL reports whether the URL names a sitemap (sitemap.xml, a sitemap index or a gzipped sitemap)
+func IsSitemapURL(pageURL string) bool {
+	parsed, err := url.Parse(pageURL)
+	if err != nil {
+		return false
+	}
+	name := strings.ToLower(path.Base(parsed.Path))
+	return strings.HasSuffix(name, ".xml") || strings.HasSuffix(name, ".xml.gz")
+}
+
+// SitemapURLs returns the page URLs listed in a sitemap, following sitemap indexes, up to limit pages
+func (c *WebCrawler) SitemapURLs(sitemapURL string, limit int) ([]string, error) {
+	var pageURLs []string
+	seen := make(map[string]bool)
+	queue := []string{sitemapURL}
+	for read := 0; len(queue) > 0 && read < maxSitemaps && len(pageURLs) < limit; read++ {
+		current := queue[0]
+		queue = queue[1:]
+
+		page, err := c.Fetch(current, "", "")
+		if err == nil {
+			var sitemap parsedSitemap
+			if sitemap, err = parseSitemap(page.Body); err == nil {
+				queue = append(queue, sitemap.sitemaps...)
+				for _, pageURL := range sitemap.pages {
+					if !seen[pageURL] && len(pageURLs) < limit {
+						seen[pageURL] = true
+						pageURLs = append(pageURLs, pageURL)
+					}
+				}
+				continue
+			}
+		}
+		// The sitemap given by the caller must be readable, the ones listed in an index are skipped
+		if read == 0 {
+			return nil, fmt.Errorf("error reading sitemap %s: %w", current, err)
+		}
+		fmt.Printf("Error reading sitemap %s: %v\n", current, err)
+	}
+	return pageURLs, nil
+}
+
+// parsedSitemap lists the pages of a sitemap or the sitemaps of a sitemap index
+type parsedSitemap struct {
+	pages    []string
+	sitemaps []string
+}
+
+// parseSitemap reads an XML sitemap or sitemap index, gzipped or not, or a text sitemap with one URL per line
+func parseSitemap(content []byte) (parsedSitemap, error) {
+	if bytes.HasPrefix(content, []byte{0x1f, 0x8b}) {
+		reader, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return parsedSitemap{}, fmt.Errorf("error decompressing sitemap: %v", err)
+		}
+		if content, err = io.ReadAll(io.LimitReader(reader, maxWebPageSize)); err != nil {
+			return parsedSitemap{}, fmt.Errorf("error decompressing sitemap: %v", err)
+		}
+	}
+
+	var sitemap parsedSitemap
+	if trimmed := bytes.TrimSpace(content); bytes.HasPrefix(trimmed, []byte("<")) {
+		var document struct {
+			Pages    []string `xml:"url>loc"`
+			Sitemaps []string `xml:"sitemap>loc"`
+		}
+		if err := xml.Unmarshal(trimmed, &document); err != nil {
+			return sitemap, fmt.Errorf("error parsing sitemap: %v", err)
+		}
+		for _, loc := range document.Pages {
+			sitemap.pages = append(sitemap.pages, strings.TrimSpace(loc))
+		}
+		for _, loc := range document.Sitemaps {
+			sitemap.sitemaps = append(sitemap.sitemaps, strings.TrimSpace(loc))
+		}
+		return sitemap, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); isRemoteURL(line) {
+			sitemap.pages = append(sitemap.pages, line)
+		}
+	}
+	if len(sitemap.pages) == 0 {
+		return sitemap, fmt.Errorf("no URLs found in sitemap")
+	}
+	return sitemap, nil
+}
+
+// ExtractWebPage extracts the text of a fetched page. HTML pages keep only their main content,
+// other documents linked from the site (PDF, DOCX, ...) go through the registered extractors.
+func ExtractWebPage(page *WebPage) (string, error) {
+	mediaType, _, _ := mime.ParseMediaType(page.ContentType)
+	if mediaType == "" {
+		mediaType = strings.Split(mimetype.Detect(page.Body).String(), ";")[0]
+	}
+	if mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+		return webPageText(bytes.NewReader(page.Body), page.ContentType)
+	}
+
+	// Save the document with an extension, for the extractors selected by extension
+	extension := ""
+	if parsed, err := url.Parse(page.URL); err == nil {
+		extension = path.Ext(parsed.Path)
+	}
+	if extension == "" {
+		if extensions, _ := mime.ExtensionsByType(mediaType); len(extensions) > 0 {
+			extension = extensions[0]
+		}
+	}
+	file, err := os.CreateTemp("", "webpage-*"+extension)
+	if err != nil {
+		return "", fmt.Errorf("error creating temporary file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(page.Body)
+	file.Close()
+	if err != nil {
+		return "", fmt.Errorf("error writing temporary file: %v", err)
+	}
+
+	extractor, err := selectExtractor(file.Name())
+	if err != nil {
+		return "", err
+	}
+	return extractor.Extract(file.Name())
+}
+
+// Class names and IDs of page boilerplate: menus, breadcrumbs, sidebars, cookie banners, share buttons...
+var boilerplateName = regexp.MustCompile(`(?i)(^|[\s_-])(nav|navbar|navigation|menu|breadcrumbs?|sidebar|footer|cookies?|consent|share|social|related|ads?|advert|advertisement|comments?|skip-link|pagination|popup|modal)([\s_-]|$)`)
+
+// webPageText converts a crawled page to text like htmlText, keeping its main content: the <main> element
+// or the only <article> when there is one, without headers, footers, sidebars, forms and menus.
+// The page title becomes the top heading when the content has none.
+func webPageText(reader io.Reader, contentType string) (string, error) {
+	root, err := parseHTML(reader, contentType)
+	if err != nil {
+		return "", err
+	}
+	content, isPageBody := mainContent(root)
+
+	writer := &htmlTextWriter{skip: func(node *html.Node) bool {
+		return node != content && isBoilerplate(node, isPageBody)
+	}}
+	text := writer.text(content)
+
+	// Pages with unusual markup may lose everything to the boilerplate rules, keep their full text then
+	if text == "" {
+		fallback := &htmlTextWriter{}
+		text = fallback.text(content)
+	}
+
+	hasTitle := findElement(content, func(node *html.Node) bool { return node.DataAtom == atom.H1 }) != nil
+	if title := pageTitle(root); title != "" && text != "" && !hasTitle {
+		text = "# " + title + "\n\n" + text
+	}
+	return text, nil
+}
+
+// mainContent returns the element holding the content of the page, or the body when the page doesn't mark it up.
+// isPageBody is set in the latter case: the page header and footer are then inside the content.
+func mainContent(root *html.Node) (content *html.Node, isPageBody bool) {
+	if found := findElement(root, func(node *html.Node) bool {
+		return node.DataAtom == atom.Main || attribute(node, "role") == "main"
+	}); found != nil {
+		return found, false
+	}
+
+	var articles []*html.Node
+	collectElements(root, func(node *html.Node) bool { return node.DataAtom == atom.Article }, &articles)
+	if len(articles) == 1 {
+		return articles[0], false
+	}
+
+	if body := findElement(root, func(node *html.Node) bool { return node.DataAtom == atom.Body }); body != nil {
+		return body, true
+	}
+	return root, true
+}
+
+// isBoilerplate reports whether the element is navigation or other page furniture.
+// Headers are kept inside the main content, where they hold the article title.
+func isBoilerplate(node *html.Node, isPageBody bool) bool {
+	switch node.DataAtom {
+	case atom.Nav, atom.Aside, atom.Footer, atom.Form, atom.Button, atom.Dialog, atom.Menu:
+		return true
+	case atom.Header:
+		return isPageBody
+	case atom.Html, atom.Body, atom.Main, atom.Article:
+		return false
+	}
+
+	switch attribute(node, "role") {
+	case "navigation", "banner", "contentinfo", "complementary", "search", "menu", "menubar", "dialog":
+		return true
+	}
+	if attribute(node, "aria-hidden") == "true" || hasAttribute(node, "hidden") {
+		return true
+	}
+	return boilerplateName.MatchString(attribute(node, "class") + " " + attribute(node, "id"))
+}
+
+// pageTitle returns the <title> of the page
+func pageTitle(root *html.Node) string {
+	if title := findElement(root, func(node *html.Node) bool { return node.DataAtom == atom.Title }); title != nil {
+		return strings.Join(strings.Fields(nodeText(title)), " ")
+	}
+	return ""
+}
+
+// findElement returns the first element, in document order, for which match is true
+func findElement(node *html.Node, match func(node *html.Node) bool) *html.Node {
+	if node.Type == html.ElementNode && match(node) {
+		return node
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if found := findElement(child, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// collectElements appends the elements for which match is true, without looking inside them
+func collectElements(node *html.Node, match func(node *html.Node) bool, found *[]*html.Node) {
+	if node.Type == html.ElementNode && match(node) {
+		*found = append(*found, node)
+		return
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		collectElements(child, match, found)
+	}
+}
+
+func attribute(node *html.Node, key string) string {
+	for _, attr := range node.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func hasAttribute(node *html.Node, key string) bool {
+	for _, attr := range node.Attr {
+		if attr.Key == key {
+			return true
+		}
+	}
+	return false
+}
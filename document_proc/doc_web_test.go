@@ -0,0 +1,282 @@
+package document_proc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestCrawler returns a crawler without delay that may reach the local test servers
+func newTestCrawler() *WebCrawler {
+	crawler := NewWebCrawler("TestBot/1.0 (+https://example.com/bot)", 0)
+	crawler.AllowPrivateAddresses()
+	return crawler
+}
+
+func TestRobotsMatch(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/", "/anything", true},
+		{"/private", "/private/page", true},
+		{"/private", "/public", false},
+		{"/*.pdf", "/docs/manual.pdf", true},
+		{"/*.pdf$", "/docs/manual.pdf", true},
+		{"/*.pdf$", "/docs/manual.pdf?download=1", false},
+		{"/search$", "/search", true},
+		{"/search$", "/search/results", false},
+		{"/a*b*c", "/axxbyyc", true},
+		{"/a*b*c", "/axxcyyb", false},
+	}
+	for _, tt := range tests {
+		if got := robotsMatch(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("robotsMatch(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParseRobots(t *testing.T) {
+	content := `# Comment
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Crawl-delay: 2
+
+User-agent: otherbot
+Disallow: /
+
+User-agent: testbot
+User-agent: anotherbot
+Disallow: /admin
+Disallow:
+`
+	rules := parseRobots(content, "TestBot/1.0 (+https://example.com/bot)")
+	if len(rules.rules) != 1 || rules.rules[0].pattern != "/admin" {
+		t.Fatalf("rules = %+v, want the testbot group", rules.rules)
+	}
+	if !rules.allowed("/private") || rules.allowed("/admin/users") {
+		t.Error("testbot group not applied")
+	}
+
+	fallback := parseRobots(content, "UnknownBot")
+	if fallback.crawlDelay.Seconds() != 2 {
+		t.Errorf("crawl delay = %s, want 2s", fallback.crawlDelay)
+	}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/", true},
+		{"/private/page", false},
+		{"/private/public/page", true}, // The longest rule wins
+	}
+	for _, tt := range tests {
+		if got := fallback.allowed(tt.path); got != tt.want {
+			t.Errorf("allowed(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	if empty := parseRobots("", "TestBot"); !empty.allowed("/anything") {
+		t.Error("an empty robots.txt must allow everything")
+	}
+}
+
+func TestParseSitemap(t *testing.T) {
+	urlset := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc> https://example.com/a </loc></url>
+  <url><loc>https://example.com/b</loc></url>
+</urlset>`)
+	index := []byte(`<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>https://example.com/sitemap-1.xml</loc></sitemap>
+</sitemapindex>`)
+	var gzipped bytes.Buffer
+	writer := gzip.NewWriter(&gzipped)
+	writer.Write(urlset)
+	writer.Close()
+
+	tests := []struct {
+		name         string
+		content      []byte
+		wantPages    []string
+		wantSitemaps []string
+	}{
+		{"urlset", urlset, []string{"https://example.com/a", "https://example.com/b"}, nil},
+		{"index", index, nil, []string{"https://example.com/sitemap-1.xml"}},
+		{"gzip", gzipped.Bytes(), []string{"https://example.com/a", "https://example.com/b"}, nil},
+		{"text", []byte("https://example.com/a\nnot a url\nhttps://example.com/b\n"), []string{"https://example.com/a", "https://example.com/b"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sitemap, err := parseSitemap(tt.content)
+			if err != nil {
+				t.Fatalf("parseSitemap: %v", err)
+			}
+			if !reflect.DeepEqual(sitemap.pages, tt.wantPages) || !reflect.DeepEqual(sitemap.sitemaps, tt.wantSitemaps) {
+				t.Fatalf("parseSitemap = %+v, want pages %v and sitemaps %v", sitemap, tt.wantPages, tt.wantSitemaps)
+			}
+		})
+	}
+
+	for _, content := range []string{"<urlset><url><loc>", "no urls here"} {
+		if _, err := parseSitemap([]byte(content)); err == nil {
+			t.Errorf("parseSitemap(%q) succeeded", content)
+		}
+	}
+}
+
+func TestWebPageText(t *testing.T) {
+	page := `<html><head><title>Router manual</title></head><body>
+<header><nav class="menu"><a href="/">Home</a> <a href="/docs">Docs</a></nav></header>
+<main>
+  <h2>Installation</h2>
+  <p>Plug the router in.</p>
+  <div class="share-buttons">Share on social media</div>
+</main>
+<footer>Copyright</footer>
+</body></html>`
+	text, err := webPageText(strings.NewReader(page), "text/html; charset=utf-8")
+	if err != nil {
+		t.Fatalf("webPageText: %v", err)
+	}
+	for _, want := range []string{"# Router manual", "Installation", "Plug the router in."} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text %q misses %q", text, want)
+		}
+	}
+	for _, boilerplate := range []string{"Home", "Share on social media", "Copyright"} {
+		if strings.Contains(text, boilerplate) {
+			t.Errorf("text %q keeps boilerplate %q", text, boilerplate)
+		}
+	}
+}
+
+func TestWebCrawlerConditionalFetch(t *testing.T) {
+	const etag = `"v1"`
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+		case "/page":
+			requests++
+			if r.Header.Get("User-Agent") != "TestBot/1.0 (+https://example.com/bot)" {
+				t.Errorf("User-Agent = %q", r.Header.Get("User-Agent"))
+			}
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><body><main><p>Page content</p></main></body></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	crawler := newTestCrawler()
+
+	page, err := crawler.Fetch(server.URL+"/page", "", "")
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if page.NotModified || page.ETag != etag || page.LastModified == "" {
+		t.Fatalf("first fetch = %+v, want the page with its validators", page)
+	}
+	text, err := ExtractWebPage(page)
+	if err != nil || text != "Page content" {
+		t.Fatalf("ExtractWebPage = %q, %v", text, err)
+	}
+
+	// The validators of the first fetch make the second one conditional
+	page, err = crawler.Fetch(server.URL+"/page", page.ETag, page.LastModified)
+	if err != nil {
+		t.Fatalf("conditional Fetch: %v", err)
+	}
+	if !page.NotModified || page.ETag != etag || len(page.Body) != 0 {
+		t.Fatalf("conditional fetch = %+v, want not modified with the previous ETag", page)
+	}
+	if requests != 2 {
+		t.Fatalf("page requested %d times, want 2", requests)
+	}
+
+	if _, err := crawler.Fetch(server.URL+"/private/page", "", ""); !errors.Is(err, ErrDisallowedByRobots) {
+		t.Fatalf("Fetch of a disallowed page = %v, want ErrDisallowedByRobots", err)
+	}
+	if _, err := crawler.Fetch(server.URL+"/missing", "", ""); err == nil {
+		t.Fatal("Fetch of a missing page succeeded")
+	}
+}
+
+func TestWebCrawlerSitemapURLs(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			w.Write([]byte(`<sitemapindex><sitemap><loc>` + server.URL + `/pages.xml</loc></sitemap></sitemapindex>`))
+		case "/pages.xml":
+			w.Write([]byte(`<urlset><url><loc>` + server.URL + `/a</loc></url><url><loc>` + server.URL + `/b</loc></url>` +
+				`<url><loc>` + server.URL + `/a</loc></url></urlset>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	pages, err := newTestCrawler().SitemapURLs(server.URL+"/sitemap.xml", 10)
+	if err != nil {
+		t.Fatalf("SitemapURLs: %v", err)
+	}
+	if want := []string{server.URL + "/a", server.URL + "/b"}; !reflect.DeepEqual(pages, want) {
+		t.Fatalf("SitemapURLs = %v, want %v", pages, want)
+	}
+}
+
+func TestWebCrawlerBlocksPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal"))
+	}))
+	defer server.Close()
+	crawler := NewWebCrawler("TestBot", 0)
+
+	if err := crawler.CheckHost(server.URL); !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("CheckHost = %v, want ErrBlockedAddress", err)
+	}
+	// The connection itself is refused, which covers redirects and DNS answers changing after the check
+	if _, err := crawler.client.Get(server.URL); !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("Get = %v, want ErrBlockedAddress", err)
+	}
+
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false}, // Cloud metadata endpoint
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::ffff:127.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := isPublicAddress(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("isPublicAddress(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
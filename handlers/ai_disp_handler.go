@@ -25,15 +25,19 @@ func (h *Handler) HandlerGetAIConfig(c *gin.Context) {
 		default:
 			cfg := config.GetConfig() // Fetch the latest config
 
+			provider := cfg.BotConfig.AIProvider
+
+			// Use* flags are kept for the frontend, AIProvider holds the registry name of the active model
 			aiConfig = gin.H{
-				"UseOpenAI":     cfg.BotConfig.UseOpenAI,
-				"UseMistral":    cfg.BotConfig.UseMistral,
-				"UseMETA":       cfg.BotConfig.UseMETA,
+				"AIProvider":    provider,
+				"UseOpenAI":     provider == "openai",
+				"UseMistral":    provider == "mistral",
+				"UseMETA":       provider == "meta",
 				"UseDialogflow": cfg.BotConfig.UseDialogflow,
 			}
 
 			// Check if at least one value is updated
-			if aiConfig["UseOpenAI"].(bool) || aiConfig["UseMistral"].(bool) || aiConfig["UseMETA"].(bool) || aiConfig["UseDialogflow"].(bool) {
+			if provider != "" || cfg.BotConfig.UseDialogflow {
 				updated = true
 				break
 			}
@@ -4,7 +4,10 @@ import (
 	"crossplatform_chatbot/bot"
 	config "crossplatform_chatbot/configs"
 	"crossplatform_chatbot/models"
+	"crossplatform_chatbot/service"
+	"crossplatform_chatbot/vectorstore"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -123,6 +126,10 @@ func (h *Handler) HandlerGeneralBot(c *gin.Context) {
 		return
 	}
 
+	if !h.applySessionFilter(c, req) {
+		return
+	}
+
 	// Store the context (to use later for sending the response)
 	b := h.Service.GetBot("general")
 	genBot := b.(bot.GeneralBot)
@@ -131,7 +138,7 @@ func (h *Handler) HandlerGeneralBot(c *gin.Context) {
 	genBot.StoreContext(req.SessionID, c)
 
 	// Delegate the request to the service layer.
-	response, intent, topChunkIDs, topChunkScores, err := h.Service.HandleGeneral(req)
+	result, err := h.Service.HandleGeneral(req)
 
 	if err != nil {
 		fmt.Printf("Error handling general request: %s\n", err.Error())
@@ -139,24 +146,106 @@ func (h *Handler) HandlerGeneralBot(c *gin.Context) {
 		return
 	}
 
-	// Combine chunk IDs and scores into a single list of objects
-	var combinedChunks []map[string]interface{}
-	for i := range topChunkIDs {
-		combinedChunks = append(combinedChunks, map[string]interface{}{
-			"id":    topChunkIDs[i],
-			"score": topChunkScores[i],
-		})
-	}
-
 	// Prepare the combined response
 	responseData := gin.H{
-		"response": response,
-		"intent":   intent,
-		"chunks":   combinedChunks,
+		"response":  result.Response,
+		"intent":    result.Intent,
+		"chunks":    combineChunks(result.ChunkIDs(), result.ChunkScores()),
+		"sources":   result.Sources,
+		"handoff":   result.Handoff,
+		"grounding": result.Grounding,
 	}
 
 	// Send the combined response
 	c.JSON(http.StatusOK, responseData)
-	fmt.Printf("Sent message: %s\n", response)
+	fmt.Printf("Sent message: %s\n", result.Response)
+
+}
+
+// applySessionFilter saves the filter expression sent with the request for the session, responding with
+// an error and returning false when it can't be applied
+func (h *Handler) applySessionFilter(c *gin.Context, req models.GeneralRequest) bool {
+	if req.Filter == nil {
+		return true
+	}
+	if err := h.Service.SetSessionFilter(req.SessionID, *req.Filter); err != nil {
+		if errors.Is(err, vectorstore.ErrInvalidFilter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+		fmt.Printf("Error saving session filter: %s\n", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save filter"})
+		return false
+	}
+	return true
+}
+
+// HandlerGeneralBotStream handles incoming POST requests from the frontend and streams the answer as Server-Sent Events:
+// a "chunks" event with the retrieved chunks, "token" events with the incremental text and a final "done" event.
+// With the grounding check in rewrite mode a single "token" event carries the checked answer.
+func (h *Handler) HandlerGeneralBotStream(c *gin.Context) {
+	var req models.GeneralRequest
+
+	// Parse the incoming request from the frontend and bind to the req struct
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fmt.Printf("failed to bind request: %s\n", err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if !h.applySessionFilter(c, req) {
+		return
+	}
+
+	// Set the headers for the event stream
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Disable proxy buffering
+
+	handlers := service.StreamHandlers{
+		OnChunks: func(chunkIDs []string, chunkScores []float64) error {
+			c.SSEvent("chunks", gin.H{"chunks": combineChunks(chunkIDs, chunkScores)})
+			c.Writer.Flush()
+			return c.Request.Context().Err() // Stop generating if the client went away
+		},
+		OnToken: func(token string) error {
+			c.SSEvent("token", gin.H{"text": token})
+			c.Writer.Flush()
+			return c.Request.Context().Err()
+		},
+	}
+
+	// Delegate the request to the service layer.
+	result, err := h.Service.HandleGeneralStream(req, handlers)
+	if err != nil {
+		fmt.Printf("Error handling general stream request: %s\n", err.Error())
+		c.SSEvent("error", gin.H{"error": "Failed to handle request"})
+		c.Writer.Flush()
+		return
+	}
+
+	// Send the final event with the full response
+	c.SSEvent("done", gin.H{
+		"response":  result.Response,
+		"intent":    result.Intent,
+		"chunks":    combineChunks(result.ChunkIDs(), result.ChunkScores()),
+		"sources":   result.Sources,
+		"handoff":   result.Handoff,
+		"grounding": result.Grounding,
+	})
+	c.Writer.Flush()
+	fmt.Printf("Streamed message: %s\n", result.Response)
+}
 
+// combineChunks combines chunk IDs and scores into a single list of objects
+func combineChunks(chunkIDs []string, chunkScores []float64) []map[string]interface{} {
+	var combinedChunks []map[string]interface{}
+	for i := range chunkIDs {
+		combinedChunks = append(combinedChunks, map[string]interface{}{
+			"id":    chunkIDs[i],
+			"score": chunkScores[i],
+		})
+	}
+	return combinedChunks
 }
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"cloud.google.com/go/dialogflow/apiv2/dialogflowpb"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// HandleDialogflowFulfillment answers the fulfillment requests of a Dialogflow ES agent (WebhookRequest JSON)
+// with a WebhookResponse generated from the documents. On errors Dialogflow falls back to the intent's static responses.
+func (h *Handler) HandleDialogflowFulfillment(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request"})
+		return
+	}
+	var req dialogflowpb.WebhookRequest
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(body, &req); err != nil {
+		fmt.Printf("Invalid fulfillment request: %v\n", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid WebhookRequest"})
+		return
+	}
+	if req.GetQueryResult().GetQueryText() == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The request has no query text"})
+		return
+	}
+
+	response, err := h.Service.HandleDialogflowFulfillment(&req)
+	if err != nil {
+		fmt.Printf("Error handling fulfillment request: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to handle request"})
+		return
+	}
+
+	data, err := protojson.Marshal(response)
+	if err != nil {
+		fmt.Printf("Error encoding fulfillment response: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode response"})
+		return
+	}
+	c.Data(http.StatusOK, "application/json", data)
+}
@@ -1,11 +1,17 @@
 package handlers
 
 import (
+	document "crossplatform_chatbot/document_proc"
+	"crossplatform_chatbot/service"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // HandlerGetDocuments handles the retrieval of uploaded documents
@@ -23,8 +29,14 @@ func (h *Handler) HandlerGetDocuments(c *gin.Context) {
 		return
 	}
 
-	// Return only the filenames as a JSON array
-	c.JSON(http.StatusOK, gin.H{"filenames": filenames})
+	documents, err := h.Service.GetDocuments()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve documents"})
+		return
+	}
+
+	// Return the filenames as a JSON array, with the ID and active version of each document
+	c.JSON(http.StatusOK, gin.H{"filenames": filenames, "documents": documents})
 }
 
 func (h *Handler) HandlerDocumentUpload(c *gin.Context) {
@@ -45,20 +57,255 @@ func (h *Handler) HandlerDocumentUpload(c *gin.Context) {
 		return
 	}
 
-	// Save the uploaded file to a temporary location
-	filePath := fmt.Sprintf("/tmp/%s", file.Filename)
+	// Optional metadata stored with every chunk, a JSON object such as {"product": "X", "version": 2}
+	attributes, err := service.ParseDocumentAttributes(c.PostForm("metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Generate a unique document ID
+	fileID := uuid.New().String()
+
+	// Save the uploaded file to a temporary location (unique per upload, the file is processed after the response
+	// and removed when its job is finished)
+	filePath := service.UploadPath(file.Filename)
 	if err := c.SaveUploadedFile(file, filePath); err != nil {
 		fmt.Printf("Error saving file: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving the file"})
 		return
 	}
 
-	// Generate a unique document ID
-	fileID := uuid.New().String()
+	// Queue the document for ingestion, the client follows the job through /api/document/jobs/:id
+	job, err := h.Service.EnqueueDocumentUpload(file.Filename, fileID, filePath, "general", sessionID, attributes)
+	if err != nil {
+		os.Remove(filePath)
+		if errors.Is(err, service.ErrIngestQueueFull) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		fmt.Printf("Error processing document: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-	if err := h.Service.HandleDocumentUpload(file.Filename, fileID, filePath); err != nil {
+	c.JSON(http.StatusAccepted, gin.H{"jobID": job.ID, "status": job.Status})
+}
+
+// HandlerIngestURL queues the ingestion of a web page, or of every page listed in a sitemap.xml.
+// Pages already ingested from the same URL are updated when they changed.
+func (h *Handler) HandlerIngestURL(c *gin.Context) {
+	var req struct {
+		URL       string                 `json:"url" binding:"required"`
+		SessionID string                 `json:"sessionID"`
+		Metadata  map[string]interface{} `json:"metadata"` // Stored with every chunk of the pages
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A URL is required"})
+		return
+	}
+	attributes, err := service.NormalizeDocumentAttributes(req.Metadata)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	jobs, skipped, err := h.Service.EnqueueURLIngest(req.URL, "general", req.SessionID, attributes)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidSourceURL):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL, an http or https URL is required"})
+		case errors.Is(err, document.ErrBlockedAddress):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The URL points to a local or private address"})
+		case errors.Is(err, document.ErrDisallowedByRobots):
+			c.JSON(http.StatusForbidden, gin.H{"error": "The page is disallowed by robots.txt"})
+		case errors.Is(err, service.ErrIngestQueueFull):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		default:
+			fmt.Printf("Error queueing URL ingestion: %v\n", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	queued := make([]gin.H, 0, len(jobs))
+	for _, job := range jobs {
+		queued = append(queued, gin.H{"jobID": job.ID, "url": job.SourceURL, "status": job.Status})
+	}
+	c.JSON(http.StatusAccepted, gin.H{"jobs": queued, "skipped": skipped})
+}
+
+// HandlerDeleteDocument removes a document with all its versions, chunks and tags
+func (h *Handler) HandlerDeleteDocument(c *gin.Context) {
+	if err := h.Service.DeleteDocument(c.Param("docID")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+			return
+		}
+		fmt.Printf("Error deleting document: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete document"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// HandlerReplaceDocument queues the uploaded file as the next version of an existing document
+func (h *Handler) HandlerReplaceDocument(c *gin.Context) {
+	docID := c.Param("docID")
+
+	file, err := c.FormFile("document")
+	if err != nil {
+		fmt.Printf("Error receiving file: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file upload"})
+		return
+	}
+
+	// Without metadata the new version keeps the metadata of the active version
+	attributes, err := service.ParseDocumentAttributes(c.PostForm("metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Save the uploaded file to a temporary location (unique per upload, the file is processed after the response
+	// and removed when its job is finished)
+	filePath := service.UploadPath(file.Filename)
+	if err := c.SaveUploadedFile(file, filePath); err != nil {
+		fmt.Printf("Error saving file: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving the file"})
+		return
+	}
+
+	job, err := h.Service.EnqueueDocumentReplace(docID, file.Filename, filePath, "general", c.PostForm("sessionID"), attributes)
+	if err != nil {
+		os.Remove(filePath)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+			return
+		}
+		if errors.Is(err, service.ErrIngestQueueFull) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
 		fmt.Printf("Error processing document: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+
+	c.JSON(http.StatusAccepted, gin.H{"jobID": job.ID, "status": job.Status})
+}
+
+// HandlerGetDocumentVersions lists the versions of a document, newest first
+func (h *Handler) HandlerGetDocumentVersions(c *gin.Context) {
+	versions, err := h.Service.GetDocumentVersions(c.Param("docID"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve document versions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"versions": versions})
+}
+
+// HandlerGetMetadataValues returns the distinct values of a chunk metadata key, for the web client to offer as filters
+func (h *Handler) HandlerGetMetadataValues(c *gin.Context) {
+	values, err := h.Service.GetMetadataValues(c.Param("key"))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAttributes) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve metadata values"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"key": c.Param("key"), "values": values})
+}
+
+// HandlerRollbackDocument makes an earlier version of a document the active one
+func (h *Handler) HandlerRollbackDocument(c *gin.Context) {
+	var req struct {
+		Version int `json:"version" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A version number is required"})
+		return
+	}
+
+	if err := h.Service.RollbackDocument(c.Param("docID"), req.Version); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document version not found"})
+			return
+		}
+		fmt.Printf("Error rolling back document: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to roll back document"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"docID": c.Param("docID"), "version": req.Version})
+}
+
+// HandlerGetIngestJob reports the status and progress of a document ingestion job
+func (h *Handler) HandlerGetIngestJob(c *gin.Context) {
+	job, err := h.Service.GetIngestJob(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve job"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// HandlerIngestJobEvents streams the progress of a document ingestion job as Server-Sent Events:
+// "progress" events while the job runs and a final "done" or "failed" event as the completion notice.
+func (h *Handler) HandlerIngestJobEvents(c *gin.Context) {
+	jobID := c.Param("id")
+	if _, err := h.Service.GetIngestJob(jobID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	// Set the headers for the event stream
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Disable proxy buffering
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	lastUpdate := time.Time{}
+	for {
+		job, err := h.Service.GetIngestJob(jobID)
+		if err != nil {
+			c.SSEvent("error", gin.H{"error": "Failed to retrieve job"})
+			c.Writer.Flush()
+			return
+		}
+
+		if job.IsFinished() {
+			c.SSEvent(job.Status, job)
+			c.Writer.Flush()
+			return
+		}
+		if job.UpdatedAt.After(lastUpdate) {
+			lastUpdate = job.UpdatedAt
+			c.SSEvent("progress", job)
+			c.Writer.Flush()
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return // Client went away
+		case <-ticker.C:
+		}
+	}
 }
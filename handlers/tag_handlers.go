@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"crossplatform_chatbot/service"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// HandlerGetTags returns the tag taxonomy
+func (h *Handler) HandlerGetTags(c *gin.Context) {
+	tags, err := h.Service.GetTags()
+	if err != nil {
+		fmt.Printf("Error retrieving tags: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tags"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+// HandlerSaveTag adds a tag to the taxonomy or updates its description and threshold
+func (h *Handler) HandlerSaveTag(c *gin.Context) {
+	var req struct {
+		Name        string   `json:"name" binding:"required"`
+		Description string   `json:"description"`
+		Threshold   *float64 `json:"threshold"` // Similarity threshold of embedding based tagging, the default when omitted
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A tag name is required"})
+		return
+	}
+
+	tag, err := h.Service.SaveTag(req.Name, req.Description, req.Threshold)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidTag):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tag names can't be empty or contain commas"})
+			return
+		case errors.Is(err, service.ErrInvalidThreshold):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The threshold must be between -1 and 1"})
+			return
+		}
+		fmt.Printf("Error saving tag: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save tag"})
+		return
+	}
+	c.JSON(http.StatusOK, tag)
+}
+
+// HandlerDeleteTag removes a tag from the taxonomy and from the intents mapped to it
+func (h *Handler) HandlerDeleteTag(c *gin.Context) {
+	if err := h.Service.DeleteTag(c.Param("name")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+			return
+		}
+		fmt.Printf("Error deleting tag: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tag"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// HandlerGetIntentTags returns the tags searched for each Dialogflow intent
+func (h *Handler) HandlerGetIntentTags(c *gin.Context) {
+	intents, err := h.Service.GetIntentTags()
+	if err != nil {
+		fmt.Printf("Error retrieving intent tags: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve intents"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"intents": intents})
+}
+
+// HandlerSaveIntentTags maps a Dialogflow intent to tags of the taxonomy
+func (h *Handler) HandlerSaveIntentTags(c *gin.Context) {
+	var req struct {
+		Intent string   `json:"intent" binding:"required"`
+		Tags   []string `json:"tags"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Intent) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An intent is required"})
+		return
+	}
+
+	mapping, err := h.Service.SaveIntentTags(req.Intent, req.Tags)
+	if err != nil {
+		if errors.Is(err, service.ErrUnknownTag) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		fmt.Printf("Error saving intent tags: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save intent"})
+		return
+	}
+	c.JSON(http.StatusOK, mapping)
+}
+
+// HandlerDeleteIntentTags removes the mapping of an intent
+func (h *Handler) HandlerDeleteIntentTags(c *gin.Context) {
+	if err := h.Service.DeleteIntentTags(c.Param("intent")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Intent not found"})
+			return
+		}
+		fmt.Printf("Error deleting intent tags: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete intent"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// HandlerGetIntentExamples returns the example utterances of the local intent classifier, optionally of one ?intent=
+func (h *Handler) HandlerGetIntentExamples(c *gin.Context) {
+	examples, err := h.Service.GetIntentExamples(c.Query("intent"))
+	if err != nil {
+		fmt.Printf("Error retrieving intent examples: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve intent examples"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"examples": examples})
+}
+
+// HandlerAddIntentExamples adds example utterances to an intent of the local intent classifier
+func (h *Handler) HandlerAddIntentExamples(c *gin.Context) {
+	var req struct {
+		Intent     string   `json:"intent" binding:"required"`
+		Utterances []string `json:"utterances" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": service.ErrInvalidIntentExample.Error()})
+		return
+	}
+
+	examples, err := h.Service.AddIntentExamples(req.Intent, req.Utterances)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidIntentExample) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		fmt.Printf("Error saving intent examples: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save intent examples"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"examples": examples})
+}
+
+// HandlerDeleteIntentExample removes an example utterance of the local intent classifier
+func (h *Handler) HandlerDeleteIntentExample(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid example ID"})
+		return
+	}
+	if err := h.Service.DeleteIntentExample(uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Intent example not found"})
+			return
+		}
+		fmt.Printf("Error deleting intent example: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete intent example"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
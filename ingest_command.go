@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	config "crossplatform_chatbot/configs"
+	"crossplatform_chatbot/database"
+	"crossplatform_chatbot/service"
+)
+
+// runIngestCommand implements "chatbot ingest <dir> [--recursive] [--tags a,b] [--meta k=v,...] [--dry-run] [--prune] [--watch]",
+// the bulk import of a directory tree (and the zip archives in it) into the knowledge base
+func runIngestCommand(args []string) error {
+	flags := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	recursive := flags.Bool("recursive", false, "include subdirectories")
+	tags := flags.String("tags", "", "comma separated tags of the taxonomy added to every ingested document")
+	meta := flags.String("meta", "", "comma separated key=value metadata of every ingested document, e.g. product=X,version=2")
+	dryRun := flags.Bool("dry-run", false, "report the changes without storing anything")
+	prune := flags.Bool("prune", false, "delete the documents of files removed from the directory")
+	watch := flags.Bool("watch", false, "keep the documents in sync with the directory until interrupted (implies --prune)")
+	interval := flags.Duration("interval", 30*time.Second, "polling interval of the watch mode")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: chatbot ingest <directory|file|archive.zip> [flags]")
+		flags.PrintDefaults()
+	}
+
+	// Flags may follow the directory, as in "ingest ./kb --recursive"
+	var paths []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		paths = append(paths, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	if len(paths) != 1 {
+		flags.Usage()
+		return errors.New("one directory to ingest is required")
+	}
+	if *watch && *dryRun {
+		return errors.New("--watch and --dry-run can't be combined")
+	}
+
+	options := service.BulkIngestOptions{
+		Recursive: *recursive,
+		DryRun:    *dryRun,
+		Prune:     *prune || *watch,
+	}
+	if *watch {
+		options.Settle = 2 * time.Second // Files still being written are picked up by the next pass
+	}
+	for _, tag := range strings.Split(*tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			options.Tags = append(options.Tags, tag)
+		}
+	}
+
+	attributes, err := parseMetaFlag(*meta)
+	if err != nil {
+		return err
+	}
+	options.Attributes = attributes
+
+	conf := config.GetConfig()
+	db := database.NewDatabase(conf)
+	if err := db.Init(); err != nil {
+		return fmt.Errorf("database initialization failed: %w", err)
+	}
+	svc := service.NewIngestService(&conf.BotConfig, &conf.EmbeddingConfig, db)
+
+	sync, err := svc.NewDirectorySync(paths[0], options)
+	if err != nil {
+		return err
+	}
+
+	if *watch {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		fmt.Printf("Watching %s every %s, press Ctrl+C to stop\n", paths[0], *interval)
+		return sync.Watch(ctx, *interval, printIngestReport)
+	}
+
+	report, err := sync.Run()
+	if err != nil {
+		return err
+	}
+	printIngestReport(report)
+	if failed := report.Count(service.BulkFailed); failed > 0 {
+		return fmt.Errorf("%d files failed", failed)
+	}
+	return nil
+}
+
+// parseMetaFlag parses the key=value pairs of the --meta flag into document metadata
+func parseMetaFlag(meta string) (map[string]string, error) {
+	values := make(map[string]interface{})
+	for _, pair := range strings.Split(meta, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		key, value, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid --meta pair %q, expected key=value", pair)
+		}
+		values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return service.NormalizeDocumentAttributes(values)
+}
+
+// printIngestReport prints one line per file and the totals
+func printIngestReport(report *service.BulkIngestReport) {
+	for _, entry := range report.Entries {
+		details := ""
+		switch {
+		case entry.Error != "":
+			details = ": " + entry.Error
+		case entry.Action == service.BulkDuplicate:
+			details = fmt.Sprintf(" (same as %s)", entry.DocID)
+		case entry.Chunks > 0 && entry.Version > 1:
+			details = fmt.Sprintf(" (%d chunks, version %d)", entry.Chunks, entry.Version)
+		case entry.Chunks > 0:
+			details = fmt.Sprintf(" (%d chunks)", entry.Chunks)
+		}
+		fmt.Printf("%-9s %s%s\n", entry.Action, entry.Path, details)
+	}
+
+	var totals []string
+	for _, action := range []string{service.BulkNew, service.BulkChanged, service.BulkUnchanged, service.BulkDeleted,
+		service.BulkDuplicate, service.BulkSkipped, service.BulkFailed} {
+		if count := report.Count(action); count > 0 {
+			totals = append(totals, fmt.Sprintf("%d %s", count, action))
+		}
+	}
+	if len(totals) == 0 {
+		totals = []string{"no files"}
+	}
+	fmt.Println(strings.Join(totals, ", "))
+}
+
+// exitOnIngestCommand runs the ingest subcommand when the program is started with it, and exits
+func exitOnIngestCommand() {
+	if len(os.Args) < 2 || os.Args[1] != "ingest" {
+		return
+	}
+	if err := runIngestCommand(os.Args[2:]); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "ingest:", err)
+		}
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
@@ -17,6 +17,8 @@ import (
 )
 
 func main() {
+	// "chatbot ingest <dir>" imports documents instead of running the server
+	exitOnIngestCommand()
 
 	// Initialize config (only once)
 	conf := config.GetConfig()
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminKeyMiddleware checks the admin API key, sent as "Authorization: Bearer <key>" or in the X-Admin-Key header.
+// Without a configured key the admin endpoints are disabled, since they change the documents and the taxonomy.
+func AdminKeyMiddleware(apiKey string) gin.HandlerFunc {
+	if apiKey == "" {
+		fmt.Println("Warning: ADMIN_API_KEY is not set, the admin endpoints are disabled")
+	}
+	return func(c *gin.Context) {
+		if apiKey == "" {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "admin API is not configured"})
+			c.Abort()
+			return
+		}
+		key := c.GetHeader("X-Admin-Key")
+		if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+			key = bearer
+		}
+		if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebhookAuthMiddleware checks the credentials Dialogflow sends with fulfillment requests: a shared secret as
+// "Authorization: Bearer <secret>" or in the X-Webhook-Secret header, and/or basic auth. When both are configured
+// either is accepted. Without credentials the webhook is disabled, since it runs retrieval and generation for anyone.
+func WebhookAuthMiddleware(secret, user, password string) gin.HandlerFunc {
+	if secret == "" && user == "" {
+		fmt.Println("Warning: DIALOGFLOW_WEBHOOK_SECRET and DIALOGFLOW_WEBHOOK_USER are not set, the fulfillment webhook is disabled")
+	}
+	return func(c *gin.Context) {
+		if secret == "" && user == "" {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "fulfillment webhook is not configured"})
+			c.Abort()
+			return
+		}
+
+		authorized := false
+		if secret != "" {
+			key := c.GetHeader("X-Webhook-Secret")
+			if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+				key = bearer
+			}
+			authorized = subtle.ConstantTimeCompare([]byte(key), []byte(secret)) == 1
+		}
+		if !authorized && user != "" {
+			if u, p, ok := c.Request.BasicAuth(); ok {
+				authorized = subtle.ConstantTimeCompare([]byte(u), []byte(user)) == 1 &&
+					subtle.ConstantTimeCompare([]byte(p), []byte(password)) == 1
+			}
+		}
+		if !authorized {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -23,14 +23,36 @@ type Document struct {
 	DocText   string
 	//Embedding []float64 `gorm:"type:float8[]"`
 	Embedding string `gorm:"type:float8[]"` // Store as a string and ensure it's passed correctly
+	Version   int    `gorm:"default:1"`     // Version of the document the chunk belongs to
+
+	ContentHash string `gorm:"index"` // SHA-256 of the normalised chunk text, used to reuse embeddings
+	HeadingPath string // Section of the chunk, e.g. "Installation > Linux > Proxy" (headings chunking)
+
+	Tags     pq.StringArray    `gorm:"type:text[]"`                // Tags of the chunk, matched by the intent tags
+	Metadata map[string]string `gorm:"type:jsonb;serializer:json"` // Attributes of the document (product, version, language...), source_url and section
+}
+
+// document_versions
+type DocumentVersion struct {
+	ID         uint           `json:"-" gorm:"primaryKey"`
+	DocID      string         `json:"doc_id" gorm:"uniqueIndex:idx_document_versions_doc_version;not null"`
+	Version    int            `json:"version" gorm:"uniqueIndex:idx_document_versions_doc_version"`
+	Filename   string         `json:"filename"`
+	Tags       pq.StringArray `json:"tags" gorm:"type:text[]"`
+	FileHash   string         `json:"file_hash" gorm:"index"` // SHA-256 of the uploaded file
+	ChunkCount int            `json:"chunk_count"`
+	Active     bool           `json:"active"` // The version currently served by search
+	CreatedAt  time.Time      `json:"created_at"`
+
+	Attributes map[string]string `json:"attributes,omitempty" gorm:"type:jsonb;serializer:json"` // Metadata given at upload, copied to every chunk
 }
 
 // documents_metadata
 type DocumentMetadata struct {
 	ID        int                    `json:"id" gorm:"primaryKey;autoIncrement"`
-	DocID     string                 `json:"doc_id" gorm:"type:text;not null"` // Foreign key linking to documents
-	Tags      pq.StringArray         `json:"tags" gorm:"type:text[];not null"` // Array of tags
-	Metadata  map[string]interface{} `json:"metadata" gorm:"type:jsonb"`       // JSONB for additional metadata
+	DocID     string                 `json:"doc_id" gorm:"type:text;not null"`           // Foreign key linking to documents
+	Tags      pq.StringArray         `json:"tags" gorm:"type:text[];not null"`           // Array of tags
+	Metadata  map[string]interface{} `json:"metadata" gorm:"type:jsonb;serializer:json"` // JSONB for additional metadata, e.g. the source URL of crawled pages
 	CreatedAt time.Time              `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
 }
 
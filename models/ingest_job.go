@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Statuses of a document ingestion job
+const (
+	JobQueued     = "queued"
+	JobExtracting = "extracting"
+	JobEmbedding  = "embedding"
+	JobTagging    = "tagging"
+	JobDone       = "done"
+	JobFailed     = "failed"
+)
+
+// ingest_jobs
+type IngestJob struct {
+	ID             string     `json:"id" gorm:"primaryKey;type:text"`
+	Filename       string     `json:"filename"`
+	DocID          string     `json:"doc_id"`
+	Replace        bool       `json:"replace"`           // Ingest a new version of an existing document
+	Version        int        `json:"version,omitempty"` // Document version created by the job
+	FilePath       string     `json:"-"`                 // Temporary copy of the uploaded file, removed when the job finishes, or the page URL
+	Status         string     `json:"status" gorm:"index"`
+	TotalChunks    int        `json:"total_chunks"`
+	EmbeddedChunks int        `json:"embedded_chunks"`
+	TaggedChunks   int        `json:"tagged_chunks"`
+	Error          string     `json:"error,omitempty"`
+	DuplicateOf    string     `json:"duplicate_of,omitempty"` // Stored document identical to the uploaded file
+	SourceURL      string     `json:"source_url,omitempty"`   // Web page fetched by the job instead of an uploaded file
+	Unchanged      bool       `json:"unchanged,omitempty"`    // The web page was not modified since it was last ingested
+	Platform       string     `json:"platform"`               // Platform notified on completion (telegram, general)
+	ChatID         string     `json:"-"`                      // Chat or session notified on completion
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+
+	Attributes map[string]string `json:"attributes,omitempty" gorm:"type:jsonb;serializer:json"` // Metadata of the document (product, version, language...)
+
+	TelegramFileID string `json:"-"` // File sent to the Telegram bot, downloaded by the worker (its URL contains the bot token)
+}
+
+// IsFinished reports whether the job reached a final status
+func (j *IngestJob) IsFinished() bool {
+	return j.Status == JobDone || j.Status == JobFailed
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// intent_examples
+type IntentExample struct {
+	ID        uint            `json:"id" gorm:"primaryKey"`
+	Intent    string          `json:"intent" gorm:"type:text;not null;uniqueIndex:idx_intent_examples_utterance"`
+	Utterance string          `json:"utterance" gorm:"type:text;not null;uniqueIndex:idx_intent_examples_utterance"`
+	Embedding pq.Float64Array `json:"-" gorm:"type:float8[]"` // Embedded once, when the local classifier is first trained with it
+	CreatedAt time.Time       `json:"created_at"`
+}
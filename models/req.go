@@ -4,4 +4,8 @@ package models
 type GeneralRequest struct {
 	Message   string `json:"message"`
 	SessionID string `json:"sessionID"`
+
+	// Filter expression scoping the session to matching chunks, e.g. "product=X AND version>=2".
+	// It applies to the following messages of the session until changed, an empty string removes it.
+	Filter *string `json:"filter"`
 }
@@ -0,0 +1,10 @@
+package models
+
+// Source is a document chunk cited in a bot answer
+type Source struct {
+	Index    int    `json:"index"` // Citation number used in the answer, e.g. 1 for [1]
+	Filename string `json:"filename"`
+	DocID    string `json:"docID"`
+	ChunkID  string `json:"chunkID"`
+	Snippet  string `json:"snippet"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// tags
+type Tag struct {
+	Name        string    `json:"name" gorm:"primaryKey;type:text"`
+	Description string    `json:"description"` // Guides auto-tagging and is embedded for embedding based tagging
+	Threshold   *float64  `json:"threshold"`   // Minimum similarity of a chunk for embedding based tagging, DOC_TAG_THRESHOLD when null
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// intent_tags
+type IntentTags struct {
+	Intent    string         `json:"intent" gorm:"primaryKey;type:text"` // Dialogflow intent display name
+	Tags      pq.StringArray `json:"tags" gorm:"type:text[]"`            // Documents with any of the tags are searched for the intent
+	UpdatedAt time.Time      `json:"updated_at"`
+}
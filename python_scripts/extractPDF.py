@@ -62,9 +62,24 @@ def extract_text_from_pdf(file_path):
     logging.info(f"Text extraction completed for file: {file_path}")
     return extracted_text
 
+def ocr_pages(file_path, page_numbers):
+    # OCR the given pages (1-based), used by the Go extractor for pages without a text layer
+    texts = []
+    for number in page_numbers:
+        try:
+            images = convert_from_path(file_path, first_page=number, last_page=number)
+            text = ''.join(pytesseract.image_to_string(image) for image in images)
+            texts.append(text.replace('\f', ''))
+            logging.info(f"OCR text extraction completed for page {number}")
+        except Exception as e:
+            logging.error(f"Error running OCR on page {number}: {e}", exc_info=True)
+            print(f"Error running OCR on page {number}: {e}", file=sys.stderr)
+            texts.append('')
+    return texts
+
 if __name__ == "__main__":
     if len(sys.argv) < 2:
-        print("Usage: python pdf_extractor.py <path_to_pdf>")
+        print("Usage: python pdf_extractor.py <path_to_pdf> [--ocr-pages 1,3]")
         logging.error("No file path provided. Exiting script.")
         sys.exit(1)
     
@@ -76,8 +91,13 @@ if __name__ == "__main__":
         # Attempt to decrypt the PDF if necessary
         decrypted_file_path = decrypt_pdf(file_path)
         
-        text = extract_text_from_pdf(decrypted_file_path)
-        print(text)  # Print extracted text to stdout
+        if len(sys.argv) > 3 and sys.argv[2] == "--ocr-pages":
+            # Only OCR the requested pages, printed separated by form feeds
+            page_numbers = [int(number) for number in sys.argv[3].split(',') if number]
+            print('\f'.join(ocr_pages(decrypted_file_path, page_numbers)))
+        else:
+            text = extract_text_from_pdf(decrypted_file_path)
+            print(text)  # Print extracted text to stdout
         logging.info("Text output successfully printed.")
     except Exception as e:
         logging.error(f"Error extracting text: {e}", exc_info=True)
@@ -4,6 +4,7 @@ import (
 	"crossplatform_chatbot/database"
 	"crossplatform_chatbot/models"
 	"crossplatform_chatbot/utils"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -15,13 +16,23 @@ type DAO interface {
 	CreateUser(userIDStr string, req ValidateUserReq) error
 	GetUser(userIDStr string) (*models.User, error)
 	CreateDocumentEmbedding(filename, docID, chunkID, docText string, embedding []float64) error
-	FetchEmbeddings() (map[string][]float64, map[string]string, error)
 	GetAllDocuments() ([]models.Document, error)
+	GetAllChunkTexts() ([]models.Document, error)
 	//SaveDocumentMetadata(docID string, tags []string) error
-	GetChunkEmbeddings(docID string) ([][]float64, error)
 	RetrieveTagEmbeddings() (map[string][]float64, error)
-	StoreTagEmbeddings(tagDescriptions map[string]string, embedFunc func(string) ([]float64, error)) error
-	GetDocumentChunksByTags(tags []string) ([]models.Document, error)
+	StoreTagEmbeddings(tagDescriptions map[string]string, embedFunc func([]string) ([][]float64, error)) error
+	CreateIngestJob(job *models.IngestJob) error
+	UpdateIngestJob(jobID string, fields map[string]interface{}) error
+	GetIngestJob(jobID string) (*models.IngestJob, error)
+	GetUnfinishedIngestJobs() ([]models.IngestJob, error)
+	GetDocumentChunks(docID string) ([]models.Document, error)
+	GetDocumentVersions(docID string) ([]models.DocumentVersion, error)
+	GetActiveDocumentVersions() ([]models.DocumentVersion, error)
+	GetEmbeddingsByContentHash(hashes []string) (map[string]string, error)
+	GetDocumentMetadataBySourceURL(sourceURL string) (*models.DocumentMetadata, error)
+	GetDocumentMetadataWithKey(key string) ([]models.DocumentMetadata, error)
+	UpdateDocumentMetadata(docID string, metadata map[string]interface{}) error
+	GetChunkMetadataValues(key string) ([]string, error)
 }
 
 // dao struct implements the DAO interface.
@@ -87,29 +98,6 @@ func (d *dao) CreateDocumentEmbedding(filename, docID, chunkID, docText string,
 	return d.db.GetDB().Create(&docEmbedding).Error
 }
 
-// FetchEmbeddings retrieves and converts all document embeddings from the database.
-func (d *dao) FetchEmbeddings() (map[string][]float64, map[string]string, error) {
-	var embeddings []models.Document
-
-	if err := d.db.GetDB().Find(&embeddings).Error; err != nil {
-		return nil, nil, fmt.Errorf("error retrieving embeddings: %v", err)
-	}
-
-	documentEmbeddings := make(map[string][]float64)
-	docText := make(map[string]string)
-
-	for _, embedding := range embeddings {
-		floatSlice, err := utils.PostgresArrayToFloat64Slice(embedding.Embedding)
-		if err != nil {
-			return nil, nil, fmt.Errorf("error parsing embedding for docID %s: %v", embedding.ChunkID, err)
-		}
-		documentEmbeddings[embedding.ChunkID] = floatSlice
-		docText[embedding.ChunkID] = embedding.DocText
-	}
-
-	return documentEmbeddings, docText, nil
-}
-
 // GetAllDocuments retrieves all uploaded documents from the database.
 func (d *dao) GetAllDocuments() ([]models.Document, error) {
 	var documents []models.Document
@@ -122,22 +110,18 @@ func (d *dao) GetAllDocuments() ([]models.Document, error) {
 	return documents, nil
 }
 
-func (d *dao) GetChunkEmbeddings(docID string) ([][]float64, error) {
-	var chunks []models.Document
-	if err := d.db.GetDB().Where("doc_id = ?", docID).Find(&chunks).Error; err != nil {
-		return nil, fmt.Errorf("error retrieving chunks for docID %s: %w", docID, err)
-	}
+// GetAllChunkTexts retrieves the text, tags and metadata of all chunks without their embeddings,
+// for the indexes that don't need the vectors.
+func (d *dao) GetAllChunkTexts() ([]models.Document, error) {
+	var documents []models.Document
 
-	var embeddings [][]float64
-	for _, chunk := range chunks {
-		embedding, err := utils.ParseEmbeddingString(chunk.Embedding)
-		if err != nil {
-			return nil, fmt.Errorf("error parsing embedding for chunk %s: %w", chunk.ChunkID, err)
-		}
-		embeddings = append(embeddings, embedding)
+	err := d.db.GetDB().Select("id", "filename", "doc_id", "chunk_id", "doc_text", "tags", "metadata").
+		Find(&documents).Error
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving chunk texts: %w", err)
 	}
 
-	return embeddings, nil
+	return documents, nil
 }
 
 // RetrieveTagEmbeddings gets embeddings for tags and stores from the database
@@ -158,55 +142,159 @@ func (d *dao) RetrieveTagEmbeddings() (map[string][]float64, error) {
 	return embeddingsMap, nil
 }
 
-// StoreTagEmbeddings generates embeddings for tags and stores them in the database
-func (d *dao) StoreTagEmbeddings(tagDescriptions map[string]string, embedFunc func(string) ([]float64, error)) error {
+// StoreTagEmbeddings generates embeddings for the tag descriptions in one batch and stores them in the database,
+// replacing the stored embeddings of the tags
+func (d *dao) StoreTagEmbeddings(tagDescriptions map[string]string, embedFunc func([]string) ([][]float64, error)) error {
+	tags := make([]string, 0, len(tagDescriptions))
+	descriptions := make([]string, 0, len(tagDescriptions))
 	for tag, description := range tagDescriptions {
-		// Generate the embedding for each tag using the provided embed function
-		embedding, err := embedFunc(description)
-		if err != nil {
-			return fmt.Errorf("error generating embedding for tag %s: %v", tag, err)
-		}
+		tags = append(tags, tag)
+		descriptions = append(descriptions, description)
+	}
 
-		// Insert the tag and embedding into the database
-		query := `INSERT INTO tag_embeddings (tag_name, embedding) VALUES ($1, $2) ON CONFLICT (tag_name) DO NOTHING`
-		if err := d.db.GetDB().Exec(query, tag, embedding).Error; err != nil {
+	// Generate the embeddings for all tags using the provided embed function
+	embeddings, err := embedFunc(descriptions)
+	if err != nil {
+		return fmt.Errorf("error generating tag embeddings: %v", err)
+	}
+
+	for i, tag := range tags {
+		// Insert or update the tag and embedding in the database
+		query := `INSERT INTO tag_embeddings (tag_name, embedding) VALUES ($1, $2) ON CONFLICT (tag_name) DO UPDATE SET embedding = EXCLUDED.embedding`
+		if err := d.db.GetDB().Exec(query, tag, pq.Array(embeddings[i])).Error; err != nil {
 			return fmt.Errorf("error inserting tag embedding for %s: %v", tag, err)
 		}
 	}
 	return nil
 }
 
-// GetDocumentChunksByTags retrieves document chunks matching the specified tags and decodes their embeddings.
-func (d *dao) GetDocumentChunksByTags(tags []string) ([]models.Document, error) {
-	var docIDs []string
+// CreateIngestJob inserts a new document ingestion job.
+func (d *dao) CreateIngestJob(job *models.IngestJob) error {
+	return d.db.GetDB().Create(job).Error
+}
 
-	// Query the document_metadata table to get doc_ids where any of the tags match
-	err := d.db.GetDB().Table("document_metadata").
-		Where("tags && ?::text[]", pq.Array(tags)). // Use pq.Array and cast to text[]
-		Pluck("doc_id", &docIDs).Error
+// UpdateIngestJob updates the given columns of an ingestion job.
+func (d *dao) UpdateIngestJob(jobID string, fields map[string]interface{}) error {
+	err := d.db.GetDB().Model(&models.IngestJob{}).Where("id = ?", jobID).Updates(fields).Error
 	if err != nil {
-		return nil, fmt.Errorf("error retrieving doc_ids by tags: %w", err)
+		return fmt.Errorf("error updating ingestion job %s: %w", jobID, err)
+	}
+	return nil
+}
+
+// GetIngestJob retrieves an ingestion job by ID.
+func (d *dao) GetIngestJob(jobID string) (*models.IngestJob, error) {
+	var job models.IngestJob
+	if err := d.db.GetDB().Where("id = ?", jobID).First(&job).Error; err != nil {
+		return nil, err
 	}
+	return &job, nil
+}
 
-	if len(docIDs) == 0 {
-		return nil, nil // No matching documents found for the tags
+// GetUnfinishedIngestJobs retrieves the jobs that are neither done nor failed, oldest first.
+func (d *dao) GetUnfinishedIngestJobs() ([]models.IngestJob, error) {
+	var jobs []models.IngestJob
+	err := d.db.GetDB().Where("status NOT IN ?", []string{models.JobDone, models.JobFailed}).
+		Order("created_at").
+		Find(&jobs).Error
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving unfinished ingestion jobs: %w", err)
 	}
+	return jobs, nil
+}
 
-	// Query the documents table to get the document chunks for the retrieved doc_ids
+// GetDocumentChunks retrieves the chunks of the active version of a document.
+func (d *dao) GetDocumentChunks(docID string) ([]models.Document, error) {
 	var documents []models.Document
-	err = d.db.GetDB().Where("doc_id IN ?", docIDs).Find(&documents).Error
+	err := d.db.GetDB().Where("doc_id = ?", docID).Order("id").Find(&documents).Error
 	if err != nil {
-		return nil, fmt.Errorf("error retrieving document chunks: %w", err)
+		return nil, fmt.Errorf("error retrieving chunks of document %s: %w", docID, err)
 	}
+	return documents, nil
+}
 
-	// Decode embeddings and replace the string with the decoded embeddings
-	for i, doc := range documents {
-		embedding, err := utils.PostgresArrayToFloat64Slice(doc.Embedding)
-		if err != nil {
-			return nil, fmt.Errorf("error decoding embedding for document: %w", err)
-		}
-		documents[i].Embedding = utils.Float64SliceToPostgresArray(embedding) // Encode back if needed, or just use decoded embedding downstream
+// GetDocumentVersions retrieves the version history of a document, newest first.
+func (d *dao) GetDocumentVersions(docID string) ([]models.DocumentVersion, error) {
+	var versions []models.DocumentVersion
+	err := d.db.GetDB().Where("doc_id = ?", docID).Order("version DESC").Find(&versions).Error
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving versions of document %s: %w", docID, err)
 	}
+	return versions, nil
+}
 
-	return documents, nil
+// GetActiveDocumentVersions retrieves the active version of every document.
+func (d *dao) GetActiveDocumentVersions() ([]models.DocumentVersion, error) {
+	var versions []models.DocumentVersion
+	err := d.db.GetDB().Where("active = ?", true).Order("created_at").Find(&versions).Error
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving document versions: %w", err)
+	}
+	return versions, nil
+}
+
+// GetEmbeddingsByContentHash retrieves a stored embedding for each of the chunk content hashes found,
+// including chunks of earlier document versions.
+func (d *dao) GetEmbeddingsByContentHash(hashes []string) (map[string]string, error) {
+	embeddings := make(map[string]string)
+	if len(hashes) == 0 {
+		return embeddings, nil
+	}
+
+	var documents []models.Document
+	err := d.db.GetDB().Unscoped().
+		Select("DISTINCT ON (content_hash) content_hash, embedding").
+		Where("content_hash IN ? AND embedding IS NOT NULL", hashes).
+		Order("content_hash, id DESC").
+		Find(&documents).Error
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving embeddings by content hash: %w", err)
+	}
+
+	for _, doc := range documents {
+		embeddings[doc.ContentHash] = doc.Embedding
+	}
+	return embeddings, nil
+}
+
+// GetDocumentMetadataBySourceURL retrieves the metadata of the document ingested from a web page.
+func (d *dao) GetDocumentMetadataBySourceURL(sourceURL string) (*models.DocumentMetadata, error) {
+	var metadata models.DocumentMetadata
+	if err := d.db.GetDB().Where("metadata->>'source_url' = ?", sourceURL).Order("id DESC").First(&metadata).Error; err != nil {
+		return nil, err
+	}
+	return &metadata, nil
+}
+
+// GetDocumentMetadataWithKey retrieves the metadata of the documents having the additional metadata key.
+func (d *dao) GetDocumentMetadataWithKey(key string) ([]models.DocumentMetadata, error) {
+	var metadata []models.DocumentMetadata
+	if err := d.db.GetDB().Where("metadata->>? IS NOT NULL", key).Order("id").Find(&metadata).Error; err != nil {
+		return nil, fmt.Errorf("error retrieving document metadata with %s: %w", key, err)
+	}
+	return metadata, nil
+}
+
+// UpdateDocumentMetadata replaces the additional metadata of a document.
+func (d *dao) UpdateDocumentMetadata(docID string, metadata map[string]interface{}) error {
+	value, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("error encoding metadata of document %s: %w", docID, err)
+	}
+	err = d.db.GetDB().Exec(`UPDATE document_metadata SET metadata = ? WHERE doc_id = ?`, string(value), docID).Error
+	if err != nil {
+		return fmt.Errorf("error updating metadata of document %s: %w", docID, err)
+	}
+	return nil
+}
+
+// GetChunkMetadataValues retrieves the distinct values of a metadata key of the active chunks, sorted.
+func (d *dao) GetChunkMetadataValues(key string) ([]string, error) {
+	var values []string
+	err := d.db.GetDB().Raw(`SELECT DISTINCT metadata->>?::text FROM documents
+		WHERE deleted_at IS NULL AND metadata->>?::text IS NOT NULL ORDER BY 1`, key, key).Scan(&values).Error
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving values of metadata %s: %w", key, err)
+	}
+	return values, nil
 }
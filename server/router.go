@@ -2,6 +2,7 @@ package server
 
 import (
 	"crossplatform_chatbot/handlers"
+	"crossplatform_chatbot/middleware"
 	"fmt"
 	"log"
 	"net/http"
@@ -27,7 +28,7 @@ func (s *Server) InitRoutes(handler *handlers.Handler) {
 		//AllowOrigins: []string{"https://petersun1937.github.io/Custom_Frontend_Chatbot"}, // for deployment
 		//AllowOrigins:     []string{"http://localhost:3000"}, // localhost needs to be specified directly
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "ngrok-skip-browser-warning"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Admin-Key", "ngrok-skip-browser-warning"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
@@ -45,16 +46,48 @@ func (s *Server) InitRoutes(handler *handlers.Handler) {
 	s.router.GET("/instagram/webhook", handler.VerifyMessengerWebhook) // For webhook verification
 	s.router.POST("/instagram/webhook", handler.HandleMessengerWebhook)
 	s.router.POST("/api/message", handler.HandlerGeneralBot)
+	s.router.POST("/api/message/stream", handler.HandlerGeneralBotStream)
+
+	// Fulfillment webhook of a Dialogflow agent, authenticated with a shared secret or basic auth
+	s.router.POST("/dialogflow/fulfillment",
+		middleware.WebhookAuthMiddleware(s.svrcfg.DialogflowWebhookSecret, s.svrcfg.DialogflowWebhookUser, s.svrcfg.DialogflowWebhookPassword),
+		handler.HandleDialogflowFulfillment)
 
 	// AI Provider Configuration Endpoint
 	s.router.GET("/api/ai-config", handler.HandlerGetAIConfig)
 
+	adminKey := middleware.AdminKeyMiddleware(s.svrcfg.AdminAPIKey)
 	s.router.POST("/api/document/upload", handler.HandlerDocumentUpload)
+	s.router.POST("/api/document/url", adminKey, handler.HandlerIngestURL) // Fetches arbitrary URLs
 	s.router.GET("/api/document/list", handler.HandlerGetDocuments)
+	s.router.GET("/api/document/jobs/:id", handler.HandlerGetIngestJob)
+	s.router.GET("/api/document/jobs/:id/events", handler.HandlerIngestJobEvents)
+	s.router.GET("/api/document/metadata/:key", handler.HandlerGetMetadataValues)
+	s.router.GET("/api/document/:docID/versions", handler.HandlerGetDocumentVersions)
 	s.router.OPTIONS("/api/document/list", func(c *gin.Context) {
 		c.Status(http.StatusNoContent)
 	})
 
+	// Replacing, deleting and rolling back documents, protected by the admin API key
+	s.router.PUT("/api/document/:docID", adminKey, handler.HandlerReplaceDocument)
+	s.router.DELETE("/api/document/:docID", adminKey, handler.HandlerDeleteDocument)
+	s.router.POST("/api/document/:docID/rollback", adminKey, handler.HandlerRollbackDocument)
+
+	// Tag taxonomy, intent mapping and intent examples, protected by the admin API key
+	admin := s.router.Group("/api/admin")
+	admin.Use(adminKey)
+	{
+		admin.GET("/tags", handler.HandlerGetTags)
+		admin.POST("/tags", handler.HandlerSaveTag)
+		admin.DELETE("/tags/:name", handler.HandlerDeleteTag)
+		admin.GET("/intents", handler.HandlerGetIntentTags)
+		admin.POST("/intents", handler.HandlerSaveIntentTags)
+		admin.DELETE("/intents/:intent", handler.HandlerDeleteIntentTags)
+		admin.GET("/intent-examples", handler.HandlerGetIntentExamples)
+		admin.POST("/intent-examples", handler.HandlerAddIntentExamples)
+		admin.DELETE("/intent-examples/:id", handler.HandlerDeleteIntentExample)
+	}
+
 	//r.POST("/login", handlers.Login)
 
 	// Protected routes
@@ -0,0 +1,113 @@
+package service
+
+import (
+	document "crossplatform_chatbot/document_proc"
+	"crossplatform_chatbot/models"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Citations in the answer, e.g. [1] or [1, 3]
+var citationPattern = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// Maximum length of the chunk text returned with a source
+const snippetLength = 200
+
+// MessageResult is the outcome of processing a user message
+type MessageResult struct {
+	Response string
+	Intent   string
+	Chunks   []document.ScoredChunk // Retrieved chunks, numbered from 1 in the prompt
+	Sources  []models.Source        // Chunks cited in the response
+
+	Handoff   bool             // The question was passed on to a human agent
+	Grounding *GroundingResult // Outcome of the grounding check, nil if it did not run
+
+	Language string // Language code of the query when it is not the default Dialogflow language, the response is written in it
+}
+
+// ChunkIDs returns the IDs of the retrieved chunks
+func (r *MessageResult) ChunkIDs() []string {
+	ids, _ := chunkIDsAndScores(r.Chunks)
+	return ids
+}
+
+// ChunkScores returns the scores of the retrieved chunks
+func (r *MessageResult) ChunkScores() []float64 {
+	_, scores := chunkIDsAndScores(r.Chunks)
+	return scores
+}
+
+// ReplyWithSources returns the response followed by a compact "Sources:" footer for the messaging platforms
+func (r *MessageResult) ReplyWithSources() string {
+	if len(r.Sources) == 0 {
+		return r.Response
+	}
+
+	var footer strings.Builder
+	footer.WriteString("\n\nSources:")
+	for _, source := range r.Sources {
+		fmt.Fprintf(&footer, "\n[%d] %s", source.Index, source.Filename)
+	}
+	return r.Response + footer.String()
+}
+
+// chunkIDsAndScores splits the chunks into their IDs and scores
+func chunkIDsAndScores(chunks []document.ScoredChunk) ([]string, []float64) {
+	var ids []string
+	var scores []float64
+	for _, chunk := range chunks {
+		ids = append(ids, chunk.ChunkID)
+		scores = append(scores, chunk.Score)
+	}
+	return ids, scores
+}
+
+// parseCitations returns the chunks cited as [n] in the response, ordered by citation number.
+// Numbers outside the retrieved chunks are ignored.
+func parseCitations(response string, chunks []document.ScoredChunk) []models.Source {
+	cited := make(map[int]struct{})
+	for _, match := range citationPattern.FindAllStringSubmatch(response, -1) {
+		for _, number := range strings.Split(match[1], ",") {
+			index, err := strconv.Atoi(strings.TrimSpace(number))
+			if err != nil || index < 1 || index > len(chunks) {
+				continue
+			}
+			cited[index] = struct{}{}
+		}
+	}
+
+	sources := make([]models.Source, 0, len(cited))
+	for index := range cited {
+		chunk := chunks[index-1]
+		sources = append(sources, models.Source{
+			Index:    index,
+			Filename: chunk.Filename,
+			DocID:    chunk.DocID,
+			ChunkID:  chunk.ChunkID,
+			Snippet:  snippet(chunk.Text),
+		})
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].Index < sources[j].Index
+	})
+	return sources
+}
+
+// snippet shortens the text to snippetLength characters at a word boundary
+func snippet(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= snippetLength {
+		return text
+	}
+
+	cut := string(runes[:snippetLength])
+	if space := strings.LastIndex(cut, " "); space > 0 {
+		cut = cut[:space]
+	}
+	return cut + "..."
+}
@@ -2,15 +2,18 @@ package service
 
 import (
 	"context"
-	"crossplatform_chatbot/utils"
+	document "crossplatform_chatbot/document_proc"
+	"crossplatform_chatbot/vectorstore"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
-
-	document "crossplatform_chatbot/document_proc"
+	"sync"
 
 	dialogflow "cloud.google.com/go/dialogflow/apiv2"
 	"cloud.google.com/go/dialogflow/apiv2/dialogflowpb"
 	"google.golang.org/api/option"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 // type DialogflowService struct {
@@ -23,41 +26,78 @@ import (
 
 // DialogflowService
 
-// handleMessageDialogflow handles a message from the platform, sends it to Dialogflow for intent detection,
-// retrieves the corresponding context using RAG, generates a response with OpenAI, and sends it back to the user.
-func (s *Service) handleMessageDialogflow(chatID, message, history string) (string, string, []string, []float64, error) {
+// dialogflowSessions creates the Dialogflow sessions client on first use and keeps it for the following messages
+type dialogflowSessions struct {
+	mu     sync.Mutex
+	client *dialogflow.SessionsClient
+}
 
-	// Detect intent using Dialogflow
-	response, err := s.fetchDialogflowResponse(chatID, message)
-	if err != nil {
-		return "", "", nil, nil, fmt.Errorf("error detecting intent: %v", err)
+func (d *dialogflowSessions) get(credentialsFile string) (*dialogflow.SessionsClient, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.client == nil {
+		client, err := dialogflow.NewSessionsClient(context.Background(), option.WithCredentialsFile(credentialsFile))
+		if err != nil {
+			return nil, err // Retried with the next message
+		}
+		d.client = client
 	}
+	return d.client, nil
+}
 
-	intent := response.GetQueryResult().GetIntent().GetDisplayName()
-	fmt.Printf("Detected intent: %s\n", intent)
+// handleMessageDialogflow handles a message from the platform, sends it to Dialogflow (or the local classifier) for intent detection,
+// and retrieves the corresponding document chunks matching the filter using RAG. Returns the chunks and the detected intent.
+func (s *Service) handleMessageDialogflow(chatID, message string, filter vectorstore.Filter) ([]document.ScoredChunk, intentDetection, error) {
 
-	// Fetch document context
-	context, topChunkIDs, topChunkScores, err := s.fetchDocumentContext(intent, message)
+	// Detect intent using Dialogflow or the local classifier
+	detection, err := s.detectIntent(chatID, message)
 	if err != nil {
-		return "", "", nil, nil, fmt.Errorf("error fetching document context: %v", err)
+		return nil, intentDetection{}, fmt.Errorf("error detecting intent: %v", err)
 	}
+	fmt.Printf("Detected intent: %s (confidence %.2f, language %q, parameters %v)\n",
+		detection.Intent, detection.Confidence, detection.Language, detection.Parameters)
 
-	// Generate response using OpenAI with context
-	//prompt := fmt.Sprintf("Context:\n%s\nUser query: %s", context, message)
-	prompt := fmt.Sprintf("Conversation history:\n%s\n\nContext:\n%s\nUser query: %s", history, context, message)
-	/*finalResponse, err := s.openaiClient.GetResponse(prompt)
+	// Fetch document context
+	chunks, err := s.fetchDocumentContext(s.retriever, detection, message, filter)
 	if err != nil {
-		return "", "", nil, nil, fmt.Errorf("error generating OpenAI response: %v", err)
-	}*/
+		return nil, intentDetection{}, fmt.Errorf("error fetching document context: %v", err)
+	}
 
-	//return finalResponse, intent, topChunkIDs, topChunkScores, nil
-	return prompt, intent, topChunkIDs, topChunkScores, nil
+	return chunks, detection, nil
+}
+
+// detectionFromQueryResult returns the intent, confidence, parameters and language matched by Dialogflow.
+// The language code of the result echoes the language of the request, usually DIALOGFLOW_LANGUAGE, so it is
+// only kept when it is another language, e.g. set by the integration of a fulfillment request.
+func (s *Service) detectionFromQueryResult(result *dialogflowpb.QueryResult) intentDetection {
+	detection := intentDetection{
+		Intent:     result.GetIntent().GetDisplayName(),
+		Confidence: float64(result.GetIntentDetectionConfidence()),
+		Parameters: dialogflowParameters(result.GetParameters()),
+	}
+	if language := result.GetLanguageCode(); !sameLanguage(language, s.botConfig.DialogflowLanguage) {
+		detection.Language = language
+	}
+	return detection
+}
+
+// sameLanguage reports whether the language codes have the same primary language, e.g. en and en-US.
+// An empty code is the default language.
+func sameLanguage(a, b string) bool {
+	if a == "" || b == "" {
+		return true
+	}
+	primary := func(code string) string {
+		code, _, _ = strings.Cut(strings.ReplaceAll(code, "_", "-"), "-")
+		return strings.ToLower(code)
+	}
+	return primary(a) == primary(b)
 }
 
 // fetchDialogflowResponse sends the message to Dialogflow and retrieves the response with detected intent.
 func (s *Service) fetchDialogflowResponse(sessionID, text string) (*dialogflowpb.DetectIntentResponse, error) {
 	conf := s.botConfig
-	response, err := s.detectIntentText(conf.DialogflowProjectID, sessionID, text, "en")
+	response, err := s.detectIntentText(conf.DialogflowProjectID, sessionID, text, conf.DialogflowLanguage)
 	if err != nil {
 		return nil, fmt.Errorf("error detecting intent with Dialogflow: %v", err)
 	}
@@ -68,11 +108,10 @@ func (s *Service) fetchDialogflowResponse(sessionID, text string) (*dialogflowpb
 func (s *Service) detectIntentText(projectID, sessionID, text, languageCode string) (*dialogflowpb.DetectIntentResponse, error) {
 	ctx := context.Background()
 	//client, err := dialogflow.NewSessionsClient(ctx)
-	client, err := dialogflow.NewSessionsClient(ctx, option.WithCredentialsFile(s.botConfig.GoogleCredentialsFilePath))
+	client, err := s.dialogflow.get(s.botConfig.GoogleCredentialsFilePath)
 	if err != nil {
 		return nil, fmt.Errorf("error creating Dialogflow client: %v", err)
 	}
-	defer client.Close()
 
 	sessionPath := fmt.Sprintf("projects/%s/agent/sessions/%s", projectID, sessionID)
 	req := &dialogflowpb.DetectIntentRequest{
@@ -89,126 +128,162 @@ func (s *Service) detectIntentText(projectID, sessionID, text, languageCode stri
 	return client.DetectIntent(ctx, req)
 }
 
-// fetchDocumentContext retrieves the document chunks based on the detected intent's associated tags.
-func (s *Service) fetchDocumentContext(intent, userMessage string) (string, []string, []float64, error) {
+// fetchDocumentContext retrieves the document chunks based on the detected intent's associated tags. The query is
+// expanded with the intent parameters, and the parameters set as filters restrict the search to the chunks with
+// the same metadata, unless no chunk matches them. A low confidence intent is not trusted to pick the tags.
+func (s *Service) fetchDocumentContext(retriever *document.Retriever, detection intentDetection, userMessage string, filter vectorstore.Filter) ([]document.ScoredChunk, error) {
 	// Special case: Directly return an empty context for "Default Welcome Intent"
-	if intent == "Default Welcome Intent" {
-		return "", []string{}, []float64{}, nil
+	if detection.Intent == welcomeIntent {
+		return nil, nil
 	}
 
-	tags := mapTags(intent)
-	if len(tags) > 0 {
-		//topChunkIDs, topChunkScores, chunkScores, err := s.retrieveChunksByTags(tags, userMessage)
-		return s.retrieveChunksByTags(tags, userMessage)
-	}
+	query := expandQuery(userMessage, detection.Parameters)
+	scoped := filter
+	scoped.Where = filter.Where.And(s.parameterFilter(detection.Parameters))
 
-	//topChunkIDs, topChunkScores, chunkScores, err := s.fallbackContext(userMessage)
-	return s.fallbackContext(userMessage)
-}
+	// Tags mapped to the intent in the taxonomy (managed through /api/admin/intents)
+	var tags []string
+	if detection.Confidence >= s.botConfig.IntentMinConfidence {
+		tags = s.taxonomy.tagsForIntent(detection.Intent)
+	} else {
+		fmt.Printf("Intent confidence %.2f below %.2f, searching all documents\n", detection.Confidence, s.botConfig.IntentMinConfidence)
+	}
 
-// Defines tags associated with an intent.
-func mapTags(intent string) []string {
-	switch intent {
-	case "FAQ Intent":
-		return []string{"FAQs", "Product Information", "User Guide & How-To", "Shipping & Returns"}
-	case "Product Inquiry Intent":
-		return []string{"Product Information", "Account & Billing", "Order Status & Tracking", "Shipping & Returns"}
-	case "Troubleshooting Intent":
-		return []string{"Technical Troubleshooting", "Installation & Setup", "Security & Privacy"}
-	case "Installation Intent":
-		return []string{"Installation & Setup"}
-	default:
-		return nil
+	chunks, err := s.retrieveIntentChunks(retriever, tags, query, scoped)
+	if err == nil && len(chunks) == 0 && scoped.Where != filter.Where {
+		fmt.Println("No chunks match the intent parameters, searching without them.")
+		chunks, err = s.retrieveIntentChunks(retriever, tags, query, filter)
 	}
+	return chunks, err
 }
 
-// retrieveChunksByTags fetches document chunks that match the specified tags
-func (s *Service) retrieveChunksByTags(tags []string, userMessage string) (string, []string, []float64, error) {
-	documentChunks, err := s.repository.GetDocumentChunksByTags(tags)
-	if err != nil {
-		return "", nil, nil, fmt.Errorf("error retrieving document chunks: %v", err)
+// retrieveIntentChunks searches the chunks with any of the tags, or all chunks when there are no tags
+func (s *Service) retrieveIntentChunks(retriever *document.Retriever, tags []string, query string, filter vectorstore.Filter) ([]document.ScoredChunk, error) {
+	if len(tags) > 0 {
+		//topChunkIDs, topChunkScores, chunkScores, err := s.retrieveChunksByTags(tags, userMessage)
+		return s.retrieveChunksByTags(retriever, tags, query, filter)
 	}
 
-	docIDToText := make(map[string]string)
-	documentEmbeddings := make(map[string][]float64) // Map[ChunkID] -> Embeddin
+	//topChunkIDs, topChunkScores, chunkScores, err := s.fallbackContext(userMessage)
+	return s.fallbackContext(retriever, query, filter)
+}
 
-	for _, chunk := range documentChunks {
-		// Convert embedding from string to []float64
-		floatSlice, err := utils.PostgresArrayToFloat64Slice(chunk.Embedding)
-		if err != nil {
-			fmt.Printf("Error parsing embedding for chunkID %s: %v\n", chunk.ChunkID, err)
-			continue // Skip this chunk if there's an error
-		}
-		documentEmbeddings[chunk.ChunkID] = floatSlice
-		docIDToText[chunk.ChunkID] = chunk.DocText
-	}
-	// Apply scoring using RetrieveTopNChunks
-	topChunks, err := document.RetrieveTopNChunks(userMessage, documentEmbeddings, s.aiClients.OpenAI, s.embConfig.NumTopChunks, docIDToText, s.embConfig.ScoreThreshold)
+// retrieveChunksByTags fetches the document chunks having any of the specified tags and matching the filter
+func (s *Service) retrieveChunksByTags(retriever *document.Retriever, tags []string, userMessage string, filter vectorstore.Filter) ([]document.ScoredChunk, error) {
+	// Apply scoring to the tagged chunks
+	filter.Tags = tags
+	topChunks, err := s.retrieveTopChunks(retriever, userMessage, filter)
 	if err != nil || len(topChunks) == 0 {
 		fmt.Println("No relevant chunks found for the given tags.")
-		return "", nil, nil, nil
+		return nil, nil
 	}
 
-	/*var contextChunks []string
-	for _, chunk := range documentEmbeddings {
-		contextChunks = append(contextChunks, chunk.DocText)
-	}*/
-
-	// Prepare output: context, IDs, and scores
-	var contextBuilder []string
-	var topChunkIDs []string
-	var topChunkScores []float64
-
-	// Build context, separate IDs and scores TODO: build context later?
 	for _, chunk := range topChunks {
 		fmt.Printf("ChunkID: %s, Score: %.4f\n", chunk.ChunkID, chunk.Score)
-		contextBuilder = append(contextBuilder, chunk.Text)
-		topChunkIDs = append(topChunkIDs, chunk.ChunkID)
-		topChunkScores = append(topChunkScores, chunk.Score)
 	}
-
-	context := strings.Join(contextBuilder, "\n")
-	return context, topChunkIDs, topChunkScores, nil
+	return topChunks, nil
 }
 
-// fallbackContext retrieves document chunks based on similarity to the user's message, functions as basic openAI mode.
-func (s *Service) fallbackContext(userMessage string) (string, []string, []float64, error) {
-	documentEmbeddings, chunkText, err := s.repository.FetchEmbeddings()
-	if err != nil {
-		return "", nil, nil, fmt.Errorf("error fetching embeddings: %v", err)
-	}
-
+// fallbackContext retrieves document chunks matching the filter based on similarity to the user's message,
+// functions as basic openAI mode.
+func (s *Service) fallbackContext(retriever *document.Retriever, userMessage string, filter vectorstore.Filter) ([]document.ScoredChunk, error) {
 	// topChunks, err := document.RetrieveTopNChunks(userMessage, documentEmbeddings, 3, chunkText, 0.75)
 	// if err != nil || len(topChunks) == 0 {
 	// 	return "", fmt.Errorf("no relevant chunks found: %v", err)
 	// }
-	topChunks, err := document.RetrieveTopNChunks(userMessage, documentEmbeddings, s.aiClients.OpenAI, s.embConfig.NumTopChunks, chunkText, s.embConfig.ScoreThreshold)
+	topChunks, err := s.retrieveTopChunks(retriever, userMessage, filter)
 	if err != nil || len(topChunks) == 0 {
 		fmt.Printf("No relevant chunks found for message: %s\n", userMessage)
-		return "", nil, nil, nil
+		return nil, nil
 	}
 
-	// Prepare the context by joining the texts of the top chunks
-	var contextBuilder []string
-	var chunkIDs []string
-	var chunkScores []float64
-
 	for _, chunk := range topChunks {
 		// Log the chunkID and score for debugging or analysis
 		fmt.Printf("ChunkID: %s, Score: %.4f\n", chunk.ChunkID, chunk.Score)
+	}
+	return topChunks, nil
+}
 
-		// Append the text of the chunk to the context
-		contextBuilder = append(contextBuilder, chunk.Text)
-		chunkIDs = append(chunkIDs, chunk.ChunkID)
-		chunkScores = append(chunkScores, chunk.Score)
+// dialogflowParameters converts the intent parameters to strings, a list of values each. Composite values
+// (e.g. @sys.unit-currency) are dropped and so are the parameters Dialogflow didn't fill.
+func dialogflowParameters(parameters *structpb.Struct) map[string][]string {
+	values := make(map[string][]string)
+	for name, value := range parameters.GetFields() {
+		if texts := parameterTexts(value); len(texts) > 0 {
+			values[name] = texts
+		}
 	}
+	return values
+}
 
-	// Combine all top chunk texts into a single context string
-	context := strings.Join(contextBuilder, "\n")
+func parameterTexts(value *structpb.Value) []string {
+	var text string
+	switch kind := value.GetKind().(type) {
+	case *structpb.Value_StringValue:
+		text = strings.TrimSpace(kind.StringValue)
+	case *structpb.Value_NumberValue:
+		text = strconv.FormatFloat(kind.NumberValue, 'f', -1, 64)
+	case *structpb.Value_BoolValue:
+		text = strconv.FormatBool(kind.BoolValue)
+	case *structpb.Value_ListValue:
+		var texts []string
+		for _, item := range kind.ListValue.GetValues() {
+			texts = append(texts, parameterTexts(item)...)
+		}
+		return texts
+	}
+	if text == "" {
+		return nil
+	}
+	return []string{text}
+}
 
-	//context := strings.Join(topChunks, "\n")
-	fmt.Printf("Retrieved fallback context: %s\n", context)
-	return context, chunkIDs, chunkScores, nil
+// expandQuery appends the parameter values missing from the message to the retrieval query,
+// so that slots filled in earlier turns (a product, an OS) still steer the search
+func expandQuery(message string, parameters map[string][]string) string {
+	names := make([]string, 0, len(parameters))
+	for name := range parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	query := message
+	for _, name := range names {
+		for _, value := range parameters[name] {
+			if !strings.Contains(strings.ToLower(query), strings.ToLower(value)) {
+				query += " " + value
+			}
+		}
+	}
+	return query
+}
 
-	//return strings.Join(topChunks, "\n"), nil
+// parameterFilter returns the filter on the chunk metadata for the parameters listed in DIALOGFLOW_PARAMETER_FILTERS:
+// each key must have one of the values of its parameter. Returns nil when no such parameter is set.
+func (s *Service) parameterFilter(parameters map[string][]string) *vectorstore.Expression {
+	var where *vectorstore.Expression
+	for _, mapping := range strings.Split(s.botConfig.ParameterFilters, ",") {
+		name, key, found := strings.Cut(strings.TrimSpace(mapping), ":")
+		if !found {
+			key = name
+		}
+		name, key = strings.TrimSpace(name), strings.TrimSpace(key)
+
+		var anyValue *vectorstore.Expression
+		for i, value := range parameters[name] {
+			comparison, err := vectorstore.Compare(key, "=", value)
+			if err != nil {
+				fmt.Printf("Ignoring parameter filter %q: %v\n", mapping, err)
+				anyValue = nil
+				break
+			}
+			if i == 0 {
+				anyValue = comparison
+			} else {
+				anyValue = anyValue.Or(comparison)
+			}
+		}
+		where = where.And(anyValue)
+	}
+	return where
 }
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/dialogflow/apiv2/dialogflowpb"
+)
+
+// Fulfillment answers are generated with the provider and handoff settings of the web bot
+const fulfillmentBot = "general"
+
+// HandleDialogflowFulfillment answers a fulfillment request of a Dialogflow ES agent: the documents mapped to
+// the matched intent are searched for the query, with the intent parameters as filters and query expansion, and
+// the answer is generated from them in the language of the query as for the other platforms. The conversation is
+// kept under the Dialogflow session ID. Dialogflow falls back to the static responses of the intent when the
+// webhook takes more than 5 seconds, so the LLM reranking and the grounding check are skipped.
+func (s *Service) HandleDialogflowFulfillment(req *dialogflowpb.WebhookRequest) (*dialogflowpb.WebhookResponse, error) {
+	queryResult := req.GetQueryResult()
+	chatID := dialogflowSessionID(req.GetSession())
+	message := queryResult.GetQueryText()
+	detection := s.detectionFromQueryResult(queryResult)
+	fmt.Printf("Fulfillment request for intent %s in session %s: %s\n", detection.Intent, chatID, message)
+
+	history, err := s.getConversationHistory(chatID, 5)
+	if err != nil {
+		fmt.Printf("Error retrieving conversation history: %v\n", err)
+		history = nil
+	}
+
+	result := &MessageResult{Intent: detection.Intent, Language: detection.Language}
+	result.Chunks, err = s.fetchDocumentContext(s.fulfillmentRetriever, detection, message, s.sessionFilter(chatID))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching document context: %w", err)
+	}
+	if err := s.answerWithContext(chatID, message, fulfillmentBot, history, result, nil, false); err != nil {
+		return nil, err
+	}
+	if err := s.saveConversation(chatID, message, result.Response); err != nil {
+		return nil, fmt.Errorf("error saving to Redis: %w", err)
+	}
+
+	return fulfillmentResponse(result), nil
+}
+
+// fulfillmentResponse returns the answer as fulfillment text, and as a text message followed by a card
+// for each cited source for the integrations that render rich messages
+func fulfillmentResponse(result *MessageResult) *dialogflowpb.WebhookResponse {
+	messages := []*dialogflowpb.Intent_Message{{
+		Message: &dialogflowpb.Intent_Message_Text_{
+			Text: &dialogflowpb.Intent_Message_Text{Text: []string{result.Response}},
+		},
+	}}
+	for _, source := range result.Sources {
+		messages = append(messages, &dialogflowpb.Intent_Message{
+			Message: &dialogflowpb.Intent_Message_Card_{
+				Card: &dialogflowpb.Intent_Message_Card{
+					Title:    fmt.Sprintf("[%d] %s", source.Index, source.Filename),
+					Subtitle: source.Snippet,
+				},
+			},
+		})
+	}
+	return &dialogflowpb.WebhookResponse{
+		FulfillmentText:     result.Response,
+		FulfillmentMessages: messages,
+	}
+}
+
+// dialogflowSessionID returns the session ID at the end of a Dialogflow session path,
+// e.g. projects/<project>/agent/sessions/<session ID>
+func dialogflowSessionID(session string) string {
+	if i := strings.LastIndex(session, "/sessions/"); i >= 0 {
+		return session[i+len("/sessions/"):]
+	}
+	return session
+}
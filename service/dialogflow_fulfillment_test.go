@@ -0,0 +1,50 @@
+package service
+
+import (
+	"crossplatform_chatbot/models"
+	"testing"
+)
+
+func TestFulfillmentResponse(t *testing.T) {
+	result := &MessageResult{
+		Response: "Hold the reset button for 10 seconds [2].",
+		Sources: []models.Source{
+			{Index: 2, Filename: "manual.pdf", DocID: "manual", ChunkID: "manual_chunk_3", Snippet: "Hold the reset button"},
+		},
+	}
+	response := fulfillmentResponse(result)
+
+	if response.GetFulfillmentText() != result.Response {
+		t.Fatalf("FulfillmentText = %q, want %q", response.GetFulfillmentText(), result.Response)
+	}
+	messages := response.GetFulfillmentMessages()
+	if len(messages) != 2 {
+		t.Fatalf("%d fulfillment messages, want a text and a card", len(messages))
+	}
+	if text := messages[0].GetText().GetText(); len(text) != 1 || text[0] != result.Response {
+		t.Errorf("text message = %v, want the response", text)
+	}
+	card := messages[1].GetCard()
+	if card.GetTitle() != "[2] manual.pdf" || card.GetSubtitle() != "Hold the reset button" {
+		t.Errorf("card = %q / %q, want the cited source", card.GetTitle(), card.GetSubtitle())
+	}
+
+	// Without sources only the text message is returned
+	if messages := fulfillmentResponse(&MessageResult{Response: "Hello"}).GetFulfillmentMessages(); len(messages) != 1 {
+		t.Errorf("%d fulfillment messages without sources, want 1", len(messages))
+	}
+}
+
+func TestDialogflowSessionID(t *testing.T) {
+	tests := map[string]string{
+		"projects/support-bot/agent/sessions/abc-123":                                    "abc-123",
+		"projects/support-bot/locations/eu/agent/environments/draft/users/-/sessions/x9": "x9",
+		"abc-123": "abc-123", // Not a session path
+		"":        "",
+	}
+	for session, want := range tests {
+		if got := dialogflowSessionID(session); got != want {
+			t.Errorf("dialogflowSessionID(%q) = %q, want %q", session, got, want)
+		}
+	}
+}
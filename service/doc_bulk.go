@@ -0,0 +1,434 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	document "crossplatform_chatbot/document_proc"
+	"crossplatform_chatbot/models"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Keys of the document metadata of files ingested from a directory
+const (
+	metaSourcePath = "source_path" // Absolute path of the file, "archive.zip!/entry" for files in zip archives
+	metaModifiedAt = "modified_at"
+	metaIngestedAt = "ingested_at"
+)
+
+// zipEntrySeparator separates the path of a zip archive from the path of a file inside it
+const zipEntrySeparator = "!/"
+
+// maxZipEntrySize is the size of the largest file extracted from a zip archive
+const maxZipEntrySize = 512 << 20
+
+// Actions reported for the files of a directory
+const (
+	BulkNew       = "new"
+	BulkChanged   = "changed"   // Ingested as the next version of the document
+	BulkUnchanged = "unchanged" // Same content hash as the stored document
+	BulkDeleted   = "deleted"   // The file was removed, its document is deleted
+	BulkSkipped   = "skipped"   // No extractor for the file format
+	BulkDuplicate = "duplicate" // Identical to a document stored from another source
+	BulkFailed    = "failed"
+)
+
+// BulkIngestOptions configures the ingestion of a directory
+type BulkIngestOptions struct {
+	Recursive bool          // Include subdirectories
+	Tags      []string      // Added to the tags of every ingested document
+	DryRun    bool          // Report the changes without storing anything
+	Prune     bool          // Delete the documents of files removed from the directory
+	Settle    time.Duration // Files modified more recently are left for the next pass (watch mode)
+
+	Attributes map[string]string // Metadata stored with every chunk (product, version, language...)
+}
+
+// BulkIngestEntry is the outcome for one file of the directory
+type BulkIngestEntry struct {
+	Path    string // Relative to the directory
+	Action  string
+	DocID   string
+	Version int
+	Chunks  int // Chunks of the file, counted without embedding in dry runs
+	Error   string
+}
+
+// BulkIngestReport lists the outcome for each file of a pass over the directory
+type BulkIngestReport struct {
+	Entries []BulkIngestEntry
+}
+
+// Count returns the number of files with the action
+func (r *BulkIngestReport) Count(action string) int {
+	count := 0
+	for _, entry := range r.Entries {
+		if entry.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+// DirectorySync ingests the files of a directory, including the files in zip archives, and keeps the
+// documents in sync with them: new files are ingested, changed files become new document versions and,
+// with Prune, the documents of removed files are deleted. Files are matched to their documents by the
+// source path stored in the document metadata.
+type DirectorySync struct {
+	service *Service
+	root    string
+	options BulkIngestOptions
+	synced  map[string]syncedFile // Files processed in an earlier pass, by path
+}
+
+// syncedFile is skipped by later passes while its size and modification time don't change
+type syncedFile struct {
+	size    int64
+	modTime time.Time
+	keys    []string // Source paths of the file, one per entry for zip archives
+}
+
+// sourceFile is a file to ingest, a regular file or an entry of a zip archive
+type sourceFile struct {
+	key     string // Source path stored in the document metadata
+	name    string // File name used for the document
+	path    string // Local file to extract, a temporary copy for zip entries
+	modTime time.Time
+}
+
+// NewDirectorySync creates the sync of a directory, or of a single file or zip archive
+func (s *Service) NewDirectorySync(root string, options BulkIngestOptions) (*DirectorySync, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving %s: %w", root, err)
+	}
+	if _, err := os.Stat(root); err != nil {
+		return nil, err
+	}
+
+	// Tags added to the documents must be in the taxonomy, like the auto-tagging results
+	known, unknown := s.taxonomy.canonical(options.Tags)
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("%s: %w", strings.Join(unknown, ", "), ErrUnknownTag)
+	}
+	options.Tags = known
+	return &DirectorySync{service: s, root: root, options: options, synced: make(map[string]syncedFile)}, nil
+}
+
+// Run makes one pass over the directory. Files unchanged since an earlier pass are not reported again.
+func (d *DirectorySync) Run() (*BulkIngestReport, error) {
+	known, err := d.knownDocuments()
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := d.listFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &BulkIngestReport{}
+	present := make(map[string]bool) // Source paths found in this pass
+	for _, filePath := range paths {
+		info, err := os.Stat(filePath)
+		if err != nil {
+			report.Entries = append(report.Entries, BulkIngestEntry{Path: d.relative(filePath), Action: BulkFailed, Error: err.Error()})
+			continue
+		}
+
+		// Unchanged since the last pass, or still being written
+		previous, synced := d.synced[filePath]
+		unchanged := synced && previous.size == info.Size() && previous.modTime.Equal(info.ModTime())
+		if unchanged || time.Since(info.ModTime()) < d.options.Settle {
+			present[filePath] = true
+			for _, key := range previous.keys {
+				present[key] = true
+			}
+			continue
+		}
+
+		entries, keys, err := d.syncFile(filePath, info, known)
+		report.Entries = append(report.Entries, entries...)
+		for _, key := range keys {
+			present[key] = true
+		}
+		if err != nil {
+			present[filePath] = true // Keep the documents of a zip archive that couldn't be read
+			report.Entries = append(report.Entries, BulkIngestEntry{Path: d.relative(filePath), Action: BulkFailed, Error: err.Error()})
+			continue
+		}
+
+		failed := false
+		for _, entry := range entries {
+			failed = failed || entry.Action == BulkFailed
+		}
+		if !failed && !d.options.DryRun {
+			d.synced[filePath] = syncedFile{size: info.Size(), modTime: info.ModTime(), keys: keys}
+		}
+	}
+
+	if d.options.Prune {
+		report.Entries = append(report.Entries, d.prune(known, present)...)
+	}
+	return report, nil
+}
+
+// Watch runs a pass every interval until the context is cancelled, passing each report with changes to onReport
+func (d *DirectorySync) Watch(ctx context.Context, interval time.Duration, onReport func(*BulkIngestReport)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		report, err := d.Run()
+		if err != nil {
+			fmt.Printf("Error syncing %s: %v\n", d.root, err)
+		} else if len(report.Entries) > 0 {
+			onReport(report)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// knownDocuments returns the metadata of the documents ingested from the directory, by source path
+func (d *DirectorySync) knownDocuments() (map[string]models.DocumentMetadata, error) {
+	all, err := d.service.repository.GetDocumentMetadataWithKey(metaSourcePath)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]models.DocumentMetadata)
+	for _, metadata := range all {
+		if key := metadataString(metadata.Metadata, metaSourcePath); d.inScope(key) {
+			known[key] = metadata
+		}
+	}
+	return known, nil
+}
+
+// inScope reports whether the source path belongs to the synced directory, or file
+func (d *DirectorySync) inScope(key string) bool {
+	filePath, _, _ := strings.Cut(key, zipEntrySeparator)
+	if filePath == d.root {
+		return true
+	}
+	relative, found := strings.CutPrefix(filePath, d.root+string(filepath.Separator))
+	return found && (d.options.Recursive || !strings.ContainsRune(relative, filepath.Separator))
+}
+
+// listFiles returns the regular files of the directory in lexical order, hidden files and directories excluded
+func (d *DirectorySync) listFiles() ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(d.root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		hidden := filePath != d.root && strings.HasPrefix(entry.Name(), ".")
+		if entry.IsDir() {
+			if filePath != d.root && (hidden || !d.options.Recursive) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !hidden && entry.Type().IsRegular() {
+			paths = append(paths, filePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s: %w", d.root, err)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// relative returns the source path relative to the directory, for the report
+func (d *DirectorySync) relative(key string) string {
+	if relative, err := filepath.Rel(d.root, key); err == nil && relative != "." && !strings.HasPrefix(relative, "..") {
+		return relative
+	}
+	// The synced path is a single file or archive
+	return filepath.Base(d.root) + strings.TrimPrefix(key, d.root)
+}
+
+// syncFile ingests a regular file, or each supported file of a zip archive, returning their source paths
+func (d *DirectorySync) syncFile(filePath string, info os.FileInfo, known map[string]models.DocumentMetadata) ([]BulkIngestEntry, []string, error) {
+	if strings.EqualFold(filepath.Ext(filePath), ".zip") {
+		return d.syncArchive(filePath, known)
+	}
+	file := sourceFile{key: filePath, name: filepath.Base(filePath), path: filePath, modTime: info.ModTime()}
+	return []BulkIngestEntry{d.syncSourceFile(file, known)}, []string{filePath}, nil
+}
+
+// syncArchive ingests the files of a zip archive, each one as its own document
+func (d *DirectorySync) syncArchive(archivePath string, known map[string]models.DocumentMetadata) ([]BulkIngestEntry, []string, error) {
+	archive, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening zip archive: %w", err)
+	}
+	defer archive.Close()
+
+	tempDir, err := os.MkdirTemp("", "ingest-zip-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	var entries []BulkIngestEntry
+	var keys []string
+	for i, zipped := range archive.File {
+		name := path.Base(zipped.Name)
+		if zipped.FileInfo().IsDir() || strings.HasPrefix(zipped.Name, "__MACOSX/") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		key := archivePath + zipEntrySeparator + zipped.Name
+		keys = append(keys, key)
+
+		// Extract the entry under its own name, extractors are picked by extension
+		localPath := filepath.Join(tempDir, fmt.Sprintf("%d", i), name)
+		if err := extractZipEntry(zipped, localPath); err != nil {
+			entries = append(entries, BulkIngestEntry{Path: d.relative(key), Action: BulkFailed, Error: err.Error()})
+			continue
+		}
+		file := sourceFile{key: key, name: name, path: localPath, modTime: zipped.Modified}
+		entries = append(entries, d.syncSourceFile(file, known))
+	}
+	return entries, keys, nil
+}
+
+func extractZipEntry(zipped *zip.File, localPath string) error {
+	if err := os.MkdirAll(filepath.Dir(localPath), 0o700); err != nil {
+		return fmt.Errorf("error creating temporary directory: %w", err)
+	}
+	reader, err := zipped.Open()
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", zipped.Name, err)
+	}
+	defer reader.Close()
+
+	file, err := os.Create(localPath)
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %w", err)
+	}
+	defer file.Close()
+	// The declared size can't be trusted, a zip bomb is only caught by counting the extracted bytes
+	written, err := io.Copy(file, io.LimitReader(reader, maxZipEntrySize+1))
+	if err != nil {
+		return fmt.Errorf("error extracting %s: %w", zipped.Name, err)
+	}
+	if written > maxZipEntrySize {
+		return fmt.Errorf("error extracting %s: larger than %d MB", zipped.Name, maxZipEntrySize>>20)
+	}
+	return nil
+}
+
+// syncSourceFile ingests the file as a new document, or as the next version of its document when it changed
+func (d *DirectorySync) syncSourceFile(file sourceFile, known map[string]models.DocumentMetadata) BulkIngestEntry {
+	entry := BulkIngestEntry{Path: d.relative(file.key)}
+	fail := func(err error) BulkIngestEntry {
+		entry.Action, entry.Error = BulkFailed, err.Error()
+		return entry
+	}
+
+	if !document.CanExtract(file.path) {
+		entry.Action = BulkSkipped
+		return entry
+	}
+	contentHash, err := document.HashFile(file.path)
+	if err != nil {
+		return fail(err)
+	}
+
+	existing, found := known[file.key]
+	entry.Action = BulkNew
+	if found {
+		entry.DocID = existing.DocID
+		entry.Action = BulkChanged
+		if metadataString(existing.Metadata, metaContentHash) == contentHash {
+			entry.Action = BulkUnchanged
+			return entry
+		}
+	}
+
+	s := d.service
+	if d.options.DryRun {
+		var duplicate *DuplicateDocumentError
+		if err := findDuplicateFile(s.database.GetDB(), contentHash); errors.As(err, &duplicate) {
+			entry.Action, entry.DocID = BulkDuplicate, duplicate.DocID
+			return entry
+		}
+		text, err := document.DownloadAndExtractText(file.path)
+		if err != nil {
+			return fail(err)
+		}
+		entry.Chunks = len(s.chunker.Chunk(text))
+		return entry
+	}
+
+	// The source path is stored in the transaction of the chunks, a document without it would never be synced again
+	metadata := map[string]interface{}{
+		metaSourcePath:  file.key,
+		metaContentHash: contentHash,
+		metaModifiedAt:  file.modTime.UTC().Format(time.RFC3339),
+		metaIngestedAt:  time.Now().UTC().Format(time.RFC3339),
+	}
+	var chunkCount int
+	progress := func(status string, done, total int) { chunkCount = total }
+	if found {
+		entry.Version, err = s.replaceDocument(existing.DocID, file.name, file.path, d.options.Attributes, d.options.Tags, metadata, progress)
+	} else {
+		entry.DocID, entry.Version = fmt.Sprintf("%s_%s", file.name, uuid.New().String()), 1
+		err = s.ingestDocument(file.name, entry.DocID, file.path, d.options.Attributes, d.options.Tags, metadata, progress)
+	}
+	var duplicate *DuplicateDocumentError
+	if errors.As(err, &duplicate) {
+		entry.Action, entry.DocID, entry.Version = BulkDuplicate, duplicate.DocID, duplicate.Version
+		return entry
+	}
+	if err != nil {
+		return fail(err)
+	}
+	entry.Chunks = chunkCount
+	return entry
+}
+
+// prune deletes the documents of the files that are no longer in the directory
+func (d *DirectorySync) prune(known map[string]models.DocumentMetadata, present map[string]bool) []BulkIngestEntry {
+	keys := make([]string, 0, len(known))
+	for key := range known {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var entries []BulkIngestEntry
+	for _, key := range keys {
+		// The entries of an archive that was not read in this pass are kept
+		filePath, _, _ := strings.Cut(key, zipEntrySeparator)
+		if present[key] || present[filePath] {
+			continue
+		}
+
+		entry := BulkIngestEntry{Path: d.relative(key), Action: BulkDeleted, DocID: known[key].DocID}
+		if !d.options.DryRun {
+			if err := d.service.DeleteDocument(known[key].DocID); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				entry.Action, entry.Error = BulkFailed, err.Error()
+			}
+			delete(d.synced, key)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
@@ -0,0 +1,28 @@
+package service
+
+import (
+	config "crossplatform_chatbot/configs"
+	document "crossplatform_chatbot/document_proc"
+	"fmt"
+)
+
+// newChunker creates the chunker of the configured strategy (DOC_CHUNK_STRATEGY)
+func newChunker(embConfig config.EmbeddingConfig) (document.Chunker, error) {
+	return document.NewChunker(document.ChunkerOptions{
+		Strategy:      embConfig.ChunkStrategy,
+		ChunkSize:     embConfig.ChunkSize,
+		Overlap:       embConfig.OverlapSize,
+		ChunkTokens:   embConfig.ChunkTokens,
+		OverlapTokens: embConfig.ChunkOverlapTokens,
+		MinTokens:     embConfig.MinChunkTokens,
+		MaxTokens:     embConfig.MaxChunkTokens,
+	})
+}
+
+// migrateChunkHeadings adds the heading path column to the documents table
+func (s *Service) migrateChunkHeadings() error {
+	if err := s.database.GetDB().Exec(`ALTER TABLE documents ADD COLUMN IF NOT EXISTS heading_path text`).Error; err != nil {
+		return fmt.Errorf("error adding chunk heading path column: %w", err)
+	}
+	return nil
+}
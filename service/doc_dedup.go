@@ -0,0 +1,124 @@
+package service
+
+import (
+	document "crossplatform_chatbot/document_proc"
+	"crossplatform_chatbot/models"
+	"crossplatform_chatbot/utils"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Policies for uploads identical to a stored document
+const (
+	DuplicateReject = "reject" // Fail the ingestion job
+	DuplicateLink   = "link"   // Finish the job with the existing document instead of storing a copy
+)
+
+// DuplicateDocumentError is returned when the uploaded file is identical to the active version of a stored document
+type DuplicateDocumentError struct {
+	DocID   string
+	Version int
+}
+
+func (e *DuplicateDocumentError) Error() string {
+	return fmt.Sprintf("identical to version %d of document %s", e.Version, e.DocID)
+}
+
+// migrateContentHashes adds the chunk content hash column to the documents table and fills it for
+// the chunks stored before deduplication. The SQL normalisation mirrors document.NormalizeChunkText.
+func (s *Service) migrateContentHashes() error {
+	statements := []string{
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS content_hash text`,
+		`CREATE INDEX IF NOT EXISTS idx_documents_content_hash ON documents (content_hash)`,
+		`UPDATE documents
+		SET content_hash = encode(sha256(convert_to(lower(btrim(regexp_replace(doc_text, '\s+', ' ', 'g'))), 'UTF8')), 'hex')
+		WHERE content_hash IS NULL AND doc_text IS NOT NULL`,
+	}
+
+	for _, statement := range statements {
+		if err := s.database.GetDB().Exec(statement).Error; err != nil {
+			return fmt.Errorf("error running content hash migration %q: %w", statement, err)
+		}
+	}
+	return nil
+}
+
+// checkDuplicateFile returns the SHA-256 of the file, or a DuplicateDocumentError if a stored document has the same content
+func (s *Service) checkDuplicateFile(filePath string) (string, error) {
+	fileHash, err := document.HashFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error hashing document: %w", err)
+	}
+	return fileHash, findDuplicateFile(s.database.GetDB(), fileHash)
+}
+
+// findDuplicateFile looks for an active document version with the file hash.
+// It runs again inside the storing transaction to catch identical uploads processed in parallel.
+func findDuplicateFile(tx *gorm.DB, fileHash string) error {
+	var existing models.DocumentVersion
+	err := tx.Where("file_hash = ? AND active = ?", fileHash, true).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error looking up duplicate document: %w", err)
+	}
+	return &DuplicateDocumentError{DocID: existing.DocID, Version: existing.Version}
+}
+
+// embedChunks returns the embeddings of the chunks. Embeddings stored for identical chunks,
+// in any document or version, are reused and each distinct new text is sent to the embedding API once.
+func (s *Service) embedChunks(chunks []string, progress ingestProgress) ([][]float64, error) {
+	hashes := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		hashes[i] = document.HashChunk(chunk)
+	}
+
+	stored, err := s.repository.GetEmbeddingsByContentHash(utils.RemoveDuplicates(hashes))
+	if err != nil {
+		return nil, err
+	}
+
+	embeddings := make([][]float64, len(chunks))
+	pending := make(map[string][]int) // Chunk positions by hash of the texts to embed
+	var texts []string
+	for i, hash := range hashes {
+		if value, found := stored[hash]; found {
+			embedding, err := utils.PostgresArrayToFloat64Slice(value)
+			if err == nil {
+				embeddings[i] = embedding
+				continue
+			}
+			fmt.Printf("Error parsing stored embedding for hash %s, embedding again: %v\n", hash, err)
+		}
+		if _, queued := pending[hash]; !queued {
+			texts = append(texts, chunks[i])
+		}
+		pending[hash] = append(pending[hash], i)
+	}
+
+	reused := len(chunks)
+	for _, positions := range pending {
+		reused -= len(positions)
+	}
+	fmt.Printf("Embedding %d new chunk texts, reusing %d stored embeddings\n", len(texts), reused)
+	progress(models.JobEmbedding, reused, len(chunks))
+
+	if len(texts) > 0 {
+		newEmbeddings, err := s.aiClients.OpenAI.EmbedTexts(texts, func(done, total int) {
+			progress(models.JobEmbedding, reused+done*(len(chunks)-reused)/total, len(chunks))
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error embedding chunks: %v", err)
+		}
+		for i, text := range texts {
+			for _, position := range pending[document.HashChunk(text)] {
+				embeddings[position] = newEmbeddings[i]
+			}
+		}
+	}
+
+	return embeddings, nil
+}
@@ -0,0 +1,314 @@
+package service
+
+import (
+	"crossplatform_chatbot/models"
+	"crossplatform_chatbot/utils"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// migrateDocumentVersions adds the version column to the documents table, creates the version history table
+// and records the documents uploaded before versioning as their first, active version.
+func (s *Service) migrateDocumentVersions() error {
+	db := s.database.GetDB()
+	if err := db.Exec(`ALTER TABLE documents ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1`).Error; err != nil {
+		return fmt.Errorf("error adding document version column: %w", err)
+	}
+	if err := db.AutoMigrate(&models.DocumentVersion{}); err != nil {
+		return fmt.Errorf("error migrating document versions: %w", err)
+	}
+
+	err := db.Exec(`INSERT INTO document_versions (doc_id, version, filename, tags, chunk_count, active, created_at)
+		SELECT d.doc_id, 1, MIN(d.filename),
+			COALESCE((SELECT m.tags FROM document_metadata m WHERE m.doc_id = d.doc_id ORDER BY m.id LIMIT 1), '{}'),
+			COUNT(*), true, MIN(d.created_at)
+		FROM documents d
+		WHERE d.deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM document_versions v WHERE v.doc_id = d.doc_id)
+		GROUP BY d.doc_id`).Error
+	if err != nil {
+		return fmt.Errorf("error recording versions of existing documents: %w", err)
+	}
+	return nil
+}
+
+// GetDocuments returns the active version of every uploaded document
+func (s *Service) GetDocuments() ([]models.DocumentVersion, error) {
+	return s.repository.GetActiveDocumentVersions()
+}
+
+// GetDocumentVersions returns the version history of a document, newest first.
+// gorm.ErrRecordNotFound is returned for unknown documents.
+func (s *Service) GetDocumentVersions(docID string) ([]models.DocumentVersion, error) {
+	versions, err := s.repository.GetDocumentVersions(docID)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("document %s: %w", docID, gorm.ErrRecordNotFound)
+	}
+	return versions, nil
+}
+
+// EnqueueDocumentReplace queues the ingestion of a new version of an existing document. Without attributes,
+// the new version keeps those of the active version. gorm.ErrRecordNotFound is returned for unknown documents.
+func (s *Service) EnqueueDocumentReplace(docID, filename, filePath, platform, chatID string, attributes map[string]string) (*models.IngestJob, error) {
+	if _, err := s.GetDocumentVersions(docID); err != nil {
+		return nil, err
+	}
+	return s.enqueueIngestJob(&models.IngestJob{
+		Filename: filename,
+		DocID:    docID,
+		Replace:  true,
+		FilePath: filePath,
+		Platform: platform,
+		ChatID:   chatID,
+
+		Attributes: attributes,
+	})
+}
+
+// replaceDocument ingests the file as the next version of the document and returns the new version number.
+// The chunks of the previous version are soft deleted in the same transaction that stores the new ones,
+// so the document is never served half replaced, and stay available for rollback.
+// Nil attributes keep the attributes of the active version, nil metadata keeps the metadata of the document.
+func (s *Service) replaceDocument(docID, filename, filePath string, attributes map[string]string, tags []string, metadata map[string]interface{}, progress ingestProgress) (int, error) {
+	if progress == nil {
+		progress = func(string, int, int) {}
+	}
+
+	versions, err := s.GetDocumentVersions(docID)
+	if err != nil {
+		return 0, err
+	}
+	version := versions[0].Version + 1
+	if attributes == nil {
+		attributes = activeAttributes(versions)
+	}
+
+	fileHash, err := s.checkDuplicateFile(filePath)
+	if err != nil {
+		return 0, err
+	}
+
+	// Extracting and embedding take a while, they run before the transaction
+	documents, chunkTags, err := s.ProcessDocument(filename, docID, version, filePath, attributes, progress)
+	if err != nil {
+		return 0, err
+	}
+	tags = addChunkTags(documents, chunkTags, tags)
+
+	var previousChunkIDs []string
+	err = s.database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := findDuplicateFile(tx, fileHash); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Document{}).Where("doc_id = ?", docID).Pluck("chunk_id", &previousChunkIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("doc_id = ?", docID).Delete(&models.Document{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(newDocumentModels(documents)).Error; err != nil {
+			return err
+		}
+		if err := setDocumentTags(tx, docID, tags); err != nil {
+			return err
+		}
+		if metadata != nil {
+			if err := setDocumentMetadata(tx, docID, metadata); err != nil {
+				return err
+			}
+		}
+
+		// The unique (doc_id, version) index rejects a concurrent replace of the same document
+		record := newDocumentVersion(filename, docID, version, fileHash, tags, len(documents))
+		record.Attributes = attributes
+		if err := activateVersion(tx, docID, &record); err != nil {
+			return err
+		}
+		return notifyDocumentChange(tx, docID)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error storing version %d of document %s: %w", version, docID, err)
+	}
+
+	if err := s.unindexChunks(previousChunkIDs); err != nil {
+		return 0, err
+	}
+	if err := s.indexDocuments(documents); err != nil {
+		return 0, err
+	}
+	fmt.Printf("Document %s replaced with version %d (%d chunks)\n", docID, version, len(documents))
+	return version, nil
+}
+
+// RollbackDocument makes an earlier version of the document the active one again.
+// gorm.ErrRecordNotFound is returned for unknown documents or versions.
+func (s *Service) RollbackDocument(docID string, version int) error {
+	var previousChunkIDs []string
+	err := s.database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var target models.DocumentVersion
+		if err := tx.Where("doc_id = ? AND version = ?", docID, version).First(&target).Error; err != nil {
+			return err
+		}
+		if target.Active {
+			return nil
+		}
+
+		if err := tx.Model(&models.Document{}).Where("doc_id = ?", docID).Pluck("chunk_id", &previousChunkIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("doc_id = ?", docID).Delete(&models.Document{}).Error; err != nil {
+			return err
+		}
+		restored := tx.Unscoped().Model(&models.Document{}).
+			Where("doc_id = ? AND version = ?", docID, version).
+			Update("deleted_at", nil)
+		if restored.Error != nil {
+			return restored.Error
+		}
+		if restored.RowsAffected == 0 {
+			return fmt.Errorf("no stored chunks for version %d", version)
+		}
+
+		if err := setDocumentTags(tx, docID, target.Tags); err != nil {
+			return err
+		}
+		if err := activateVersion(tx, docID, &target); err != nil {
+			return err
+		}
+		return notifyDocumentChange(tx, docID)
+	})
+	if err != nil {
+		return fmt.Errorf("error rolling back document %s to version %d: %w", docID, version, err)
+	}
+
+	// Swap the chunks in the indexes once the transaction is committed
+	if err := s.unindexChunks(previousChunkIDs); err != nil {
+		return err
+	}
+	documents, err := s.repository.GetDocumentChunks(docID)
+	if err != nil {
+		return err
+	}
+	if err := s.indexDocuments(documents); err != nil {
+		return err
+	}
+	fmt.Printf("Document %s rolled back to version %d\n", docID, version)
+	return nil
+}
+
+// DeleteDocument removes all versions of the document, its chunks and its tags.
+// gorm.ErrRecordNotFound is returned for unknown documents.
+func (s *Service) DeleteDocument(docID string) error {
+	var chunkIDs []string
+	err := s.database.GetDB().Transaction(func(tx *gorm.DB) error {
+		// Include the soft deleted chunks of earlier versions
+		if err := tx.Unscoped().Model(&models.Document{}).Where("doc_id = ?", docID).Pluck("chunk_id", &chunkIDs).Error; err != nil {
+			return err
+		}
+		versions := tx.Where("doc_id = ?", docID).Delete(&models.DocumentVersion{})
+		if versions.Error != nil {
+			return versions.Error
+		}
+		if len(chunkIDs) == 0 && versions.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if err := tx.Unscoped().Where("doc_id = ?", docID).Delete(&models.Document{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("doc_id = ?", docID).Delete(&models.DocumentMetadata{}).Error; err != nil {
+			return err
+		}
+		return notifyDocumentChange(tx, docID)
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting document %s: %w", docID, err)
+	}
+
+	if err := s.unindexChunks(chunkIDs); err != nil {
+		return err
+	}
+	fmt.Printf("Document %s deleted (%d chunks)\n", docID, len(chunkIDs))
+	return nil
+}
+
+// unindexChunks removes the chunks from the vector store and the BM25 index
+func (s *Service) unindexChunks(chunkIDs []string) error {
+	if err := s.vectorStore.Delete(chunkIDs...); err != nil {
+		return fmt.Errorf("error removing chunks from vector store: %w", err)
+	}
+	s.lexicalIndex.Remove(chunkIDs...)
+	return nil
+}
+
+// newDocumentVersion builds the version history row of a newly ingested version
+func newDocumentVersion(filename, docID string, version int, fileHash string, tags []string, chunkCount int) models.DocumentVersion {
+	return models.DocumentVersion{
+		DocID:      docID,
+		Version:    version,
+		Filename:   filename,
+		Tags:       tags,
+		FileHash:   fileHash,
+		ChunkCount: chunkCount,
+		Active:     true,
+		CreatedAt:  time.Now(),
+	}
+}
+
+// activeAttributes returns the attributes of the active version in the version history
+func activeAttributes(versions []models.DocumentVersion) map[string]string {
+	for _, version := range versions {
+		if version.Active {
+			return version.Attributes
+		}
+	}
+	return nil
+}
+
+// activateVersion marks the version as the active one of the document, creating its row if it is new
+func activateVersion(tx *gorm.DB, docID string, version *models.DocumentVersion) error {
+	if err := tx.Model(&models.DocumentVersion{}).Where("doc_id = ?", docID).Update("active", false).Error; err != nil {
+		return err
+	}
+	version.Active = true
+	return tx.Save(version).Error
+}
+
+// setDocumentMetadata replaces the additional metadata of the document
+func setDocumentMetadata(tx *gorm.DB, docID string, metadata map[string]interface{}) error {
+	value, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("error encoding metadata of document %s: %w", docID, err)
+	}
+	return tx.Exec(`UPDATE document_metadata SET metadata = ? WHERE doc_id = ?`, string(value), docID).Error
+}
+
+// addChunkTags adds the tags to every chunk and returns them with the tags of the chunks
+func addChunkTags(documents []models.Document, chunkTags, tags []string) []string {
+	if len(tags) == 0 {
+		return chunkTags
+	}
+	for i := range documents {
+		documents[i].Tags = utils.RemoveDuplicates(append(append([]string{}, documents[i].Tags...), tags...))
+	}
+	return utils.RemoveDuplicates(append(append([]string{}, chunkTags...), tags...))
+}
+
+// setDocumentTags replaces the tags of the document used for tag-based retrieval
+func setDocumentTags(tx *gorm.DB, docID string, tags []string) error {
+	result := tx.Model(&models.DocumentMetadata{}).Where("doc_id = ?", docID).Update("tags", pq.StringArray(tags))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	return tx.Create(&models.DocumentMetadata{DocID: docID, Tags: tags}).Error
+}
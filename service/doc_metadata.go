@@ -0,0 +1,132 @@
+package service
+
+import (
+	"crossplatform_chatbot/vectorstore"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidAttributes is returned for document metadata that is not an object of scalar values with valid keys
+var ErrInvalidAttributes = errors.New("invalid document metadata")
+
+// Chunk metadata keys set by ingestion, which uploads can't set
+const metaSection = "section" // Heading path of the chunk (headings chunking)
+
+var reservedAttributes = []string{metaSection, metaSourceURL, vectorstore.FilterKeyTag, vectorstore.FilterKeyDocID, vectorstore.FilterKeyFilename}
+
+// ParseDocumentAttributes decodes the metadata given with an upload, a JSON object such as
+// {"product": "X", "version": 2, "language": "en"}. An empty string is no metadata.
+func ParseDocumentAttributes(raw string) (map[string]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &values); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAttributes, err)
+	}
+	return NormalizeDocumentAttributes(values)
+}
+
+// NormalizeDocumentAttributes checks the keys of the document metadata and converts its values to strings
+func NormalizeDocumentAttributes(values map[string]interface{}) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	attributes := make(map[string]string, len(values))
+	for key, value := range values {
+		if !vectorstore.IsFilterKey(key) {
+			return nil, fmt.Errorf("%w: invalid key %q", ErrInvalidAttributes, key)
+		}
+		for _, reserved := range reservedAttributes {
+			if strings.EqualFold(key, reserved) {
+				return nil, fmt.Errorf("%w: %s is set by ingestion", ErrInvalidAttributes, key)
+			}
+		}
+		switch value := value.(type) {
+		case string:
+			attributes[key] = value
+		case float64:
+			attributes[key] = strconv.FormatFloat(value, 'f', -1, 64)
+		case bool:
+			attributes[key] = strconv.FormatBool(value)
+		default:
+			return nil, fmt.Errorf("%w: %s must be a string, number or boolean", ErrInvalidAttributes, key)
+		}
+	}
+	return attributes, nil
+}
+
+// chunkMetadata is the metadata stored with a chunk: the document attributes and the section of the chunk
+func chunkMetadata(attributes map[string]string, section string) map[string]string {
+	metadata := make(map[string]string, len(attributes)+1)
+	for key, value := range attributes {
+		metadata[key] = value
+	}
+	if section != "" {
+		metadata[metaSection] = section
+	}
+	return metadata
+}
+
+// migrateChunkMetadata adds the tag and metadata columns to the documents table. The chunks stored before
+// get the tags of their document and their heading path as section.
+func (s *Service) migrateChunkMetadata() error {
+	db := s.database.GetDB()
+	backfill := !db.Migrator().HasColumn("documents", "tags")
+
+	statements := []string{
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS tags text[] NOT NULL DEFAULT '{}'`,
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS metadata jsonb`,
+		`CREATE INDEX IF NOT EXISTS idx_documents_tags ON documents USING gin (tags)`,
+		`CREATE INDEX IF NOT EXISTS idx_documents_metadata ON documents USING gin (metadata)`,
+	}
+	if backfill {
+		statements = append(statements,
+			`UPDATE documents d SET tags = m.tags FROM document_metadata m WHERE m.doc_id = d.doc_id`,
+			`UPDATE documents SET metadata = jsonb_build_object('section', heading_path)
+				WHERE metadata IS NULL AND COALESCE(heading_path, '') <> ''`,
+		)
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("error migrating chunk metadata: %w", err)
+		}
+	}
+	return nil
+}
+
+// SetSessionFilter scopes the document search of a chat or web session to the chunks matching the filter
+// expression, e.g. `product=X AND version>=2`. An empty expression removes the scope.
+func (s *Service) SetSessionFilter(chatID, expression string) error {
+	if _, err := vectorstore.ParseFilter(expression); err != nil {
+		return err
+	}
+	return s.saveSessionFilter(chatID, strings.TrimSpace(expression))
+}
+
+// sessionFilter returns the search filter of the session, an empty filter when it has none
+func (s *Service) sessionFilter(chatID string) vectorstore.Filter {
+	expression, err := s.getSessionFilter(chatID)
+	if err != nil {
+		fmt.Printf("Error retrieving session filter: %v\n", err)
+		return vectorstore.Filter{}
+	}
+	where, err := vectorstore.ParseFilter(expression)
+	if err != nil {
+		fmt.Printf("Ignoring session filter %q: %v\n", expression, err)
+		return vectorstore.Filter{}
+	}
+	return vectorstore.Filter{Where: where}
+}
+
+// GetMetadataValues returns the distinct values of a chunk metadata key, e.g. the products the web client
+// can scope a conversation to
+func (s *Service) GetMetadataValues(key string) ([]string, error) {
+	if !vectorstore.IsFilterKey(key) {
+		return nil, fmt.Errorf("%w: invalid key %q", ErrInvalidAttributes, key)
+	}
+	return s.repository.GetChunkMetadataValues(key)
+}
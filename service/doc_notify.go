@@ -0,0 +1,124 @@
+package service
+
+import (
+	"crossplatform_chatbot/vectorstore"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// Postgres channel announcing the documents whose chunks changed, so that the servers refresh their
+// in-memory indexes after an ingest command, another server or the sync of a directory changed them
+const documentChangesChannel = "document_changes"
+
+// processID tells the notifications of this process apart, its own changes are already indexed
+var processID = uuid.New().String()
+
+// notifyDocumentChange announces the change of the document's chunks, delivered when the transaction commits
+func notifyDocumentChange(tx *gorm.DB, docID string) error {
+	return tx.Exec("SELECT pg_notify(?, ?)", documentChangesChannel, processID+" "+docID).Error
+}
+
+// listenDocumentChanges refreshes the indexes of the documents changed by other processes. The listener
+// reconnects by itself, the notifications missed while disconnected are made up by checking every document.
+func (s *Service) listenDocumentChanges(dsn string) error {
+	listener := pq.NewListener(dsn, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			fmt.Printf("Document change listener: %v\n", err)
+		}
+	})
+	if err := listener.Listen(documentChangesChannel); err != nil {
+		listener.Close()
+		return fmt.Errorf("error listening to %s: %w", documentChangesChannel, err)
+	}
+
+	go func() {
+		for notification := range listener.Notify {
+			if notification == nil {
+				s.refreshAllDocumentIndexes()
+				continue
+			}
+			sender, docID, ok := strings.Cut(notification.Extra, " ")
+			if !ok || sender == processID {
+				continue
+			}
+			if err := s.refreshDocumentIndexes(docID); err != nil {
+				fmt.Printf("Error refreshing the indexes of document %s: %v\n", docID, err)
+			}
+		}
+	}()
+	return nil
+}
+
+// refreshDocumentIndexes replaces the indexed chunks of the document with its active chunks in Postgres
+func (s *Service) refreshDocumentIndexes(docID string) error {
+	documents, err := s.repository.GetDocumentChunks(docID)
+	if err != nil {
+		return err
+	}
+
+	hnswStore, inMemory := s.vectorStore.(*vectorstore.HNSWStore)
+	records := make([]vectorstore.Record, 0, len(documents))
+	active := make(map[string]bool, len(documents))
+	for _, doc := range documents {
+		active[doc.ChunkID] = true
+		// pgvector reads the vectors from Postgres, BM25 only needs the texts
+		if !inMemory {
+			records = append(records, chunkTextRecord(doc))
+			continue
+		}
+		record, err := documentToRecord(doc)
+		if err != nil {
+			fmt.Printf("Error parsing embedding for chunkID %s: %v\n", doc.ChunkID, err)
+			continue
+		}
+		records = append(records, record)
+	}
+
+	var stale []string
+	for _, chunkID := range s.lexicalIndex.ChunkIDs(docID) {
+		if !active[chunkID] {
+			stale = append(stale, chunkID)
+		}
+	}
+	if inMemory {
+		if err := hnswStore.Delete(stale...); err != nil {
+			return fmt.Errorf("error removing chunks from vector store: %w", err)
+		}
+		if err := hnswStore.Upsert(records...); err != nil {
+			return fmt.Errorf("error loading chunks into vector store: %w", err)
+		}
+	}
+	s.lexicalIndex.Remove(stale...)
+	s.lexicalIndex.Add(records...)
+	fmt.Printf("Indexes of document %s refreshed (%d chunks)\n", docID, len(records))
+	return nil
+}
+
+// refreshAllDocumentIndexes refreshes the indexed documents and the documents stored in Postgres
+func (s *Service) refreshAllDocumentIndexes() {
+	versions, err := s.repository.GetActiveDocumentVersions()
+	if err != nil {
+		fmt.Printf("Error listing documents to refresh: %v\n", err)
+		return
+	}
+	docIDs := s.lexicalIndex.DocIDs()
+	for _, version := range versions {
+		docIDs = append(docIDs, version.DocID)
+	}
+
+	refreshed := make(map[string]bool)
+	for _, docID := range docIDs {
+		if refreshed[docID] {
+			continue
+		}
+		refreshed[docID] = true
+		if err := s.refreshDocumentIndexes(docID); err != nil {
+			fmt.Printf("Error refreshing the indexes of document %s: %v\n", docID, err)
+		}
+	}
+}
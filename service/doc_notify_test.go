@@ -0,0 +1,62 @@
+package service
+
+import (
+	document "crossplatform_chatbot/document_proc"
+	"crossplatform_chatbot/models"
+	"crossplatform_chatbot/repository"
+	"crossplatform_chatbot/vectorstore"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// chunksDAO returns the active chunks of the documents, the other DAO methods are not used by the refresh
+type chunksDAO struct {
+	repository.DAO
+	chunks map[string][]models.Document
+}
+
+func (d *chunksDAO) GetDocumentChunks(docID string) ([]models.Document, error) {
+	return d.chunks[docID], nil
+}
+
+func TestRefreshDocumentIndexes(t *testing.T) {
+	store := vectorstore.NewHNSWStore(vectorstore.HNSWConfig{})
+	lexical := document.NewBM25Index(false)
+	// Version 1 of the document, indexed before another process replaced it
+	indexed := []vectorstore.Record{
+		{ChunkID: "manual_v1_0", DocID: "manual", Text: "old router setup", Embedding: []float64{1, 0, 0}},
+		{ChunkID: "manual_v1_1", DocID: "manual", Text: "old router reset", Embedding: []float64{0, 1, 0}},
+		{ChunkID: "other_0", DocID: "other", Text: "modem setup", Embedding: []float64{0, 0, 1}},
+	}
+	if err := store.Upsert(indexed...); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	lexical.Add(indexed...)
+
+	dao := &chunksDAO{chunks: map[string][]models.Document{
+		"manual": {{DocID: "manual", ChunkID: "manual_v2_0", DocText: "new router setup", Embedding: "{1,0,0}"}},
+	}}
+	s := &Service{repository: dao, vectorStore: store, lexicalIndex: lexical}
+
+	if err := s.refreshDocumentIndexes("manual"); err != nil {
+		t.Fatalf("refreshDocumentIndexes: %v", err)
+	}
+	if got := lexical.ChunkIDs("manual"); !reflect.DeepEqual(got, []string{"manual_v2_0"}) {
+		t.Fatalf("BM25 chunks of manual = %v, want the new version only", got)
+	}
+	if store.Len() != 2 || lexical.Len() != 2 {
+		t.Fatalf("indexes hold %d and %d chunks, want 2", store.Len(), lexical.Len())
+	}
+
+	// The document was deleted by another process
+	delete(dao.chunks, "manual")
+	if err := s.refreshDocumentIndexes("manual"); err != nil {
+		t.Fatalf("refreshDocumentIndexes after delete: %v", err)
+	}
+	docIDs := lexical.DocIDs()
+	sort.Strings(docIDs)
+	if !reflect.DeepEqual(docIDs, []string{"other"}) || store.Len() != 1 {
+		t.Fatalf("indexed documents = %v with %d vectors, want other only", docIDs, store.Len())
+	}
+}
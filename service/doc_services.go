@@ -4,6 +4,7 @@ import (
 	document "crossplatform_chatbot/document_proc"
 	"crossplatform_chatbot/models"
 	"crossplatform_chatbot/utils"
+	"crossplatform_chatbot/vectorstore"
 	"fmt"
 
 	"gorm.io/gorm"
@@ -34,102 +35,173 @@ func (s *Service) GetUploadedDocuments() ([]string, error) {
 	return uniqueFilenames, nil
 }
 
+// ingestProgress is called when ingestion enters a new stage and after each processed chunk
+type ingestProgress func(status string, done, total int)
+
+// HandleDocumentUpload processes and stores the document within the call.
+// A DuplicateDocumentError is returned if the file is identical to a stored document.
 func (s *Service) HandleDocumentUpload(filename, fileID, filePath string) error {
+	return s.ingestDocument(filename, fmt.Sprintf("%s_%s", filename, fileID), filePath, nil, nil, nil, nil)
+}
+
+// ingestDocument extracts, chunks, embeds and tags a new document, stores the chunks as its first version
+// and indexes them for retrieval. The attributes (product, version, language...) are stored with every chunk,
+// the tags are added to the chunk tags and the metadata (e.g. the source of the file) is stored with the document.
+// Files identical to a stored document are not ingested again.
+func (s *Service) ingestDocument(filename, docID, filePath string, attributes map[string]string, tags []string, metadata map[string]interface{}, progress ingestProgress) error {
+	if progress == nil {
+		progress = func(string, int, int) {}
+	}
+
+	fileHash, err := s.checkDuplicateFile(filePath)
+	if err != nil {
+		return err
+	}
+
 	// step 1: call bot to process documents
 	//b := s.GetBot("general").(bot.GeneralBot)
 
 	//documents, tags, err := b.ProcessDocument(filename, fileID, filePath)
-	documents, tags, err := s.ProcessDocument(filename, fileID, filePath)
+	documents, chunkTags, err := s.ProcessDocument(filename, docID, 1, filePath, attributes, progress)
 	if err != nil {
 		return err
 	}
+	tags = addChunkTags(documents, chunkTags, tags)
 
 	// dao version
 	// return s.repository.CreateDocumentsAndMeta(fileID, documents, tags)
 
 	// service version
 	// step 2: make db data
-	documentModels := make([]*models.Document, 0)
-	documentID := ""
-	for _, doc := range documents {
-		model := models.Document{
-			Filename:  doc.Filename,
-			DocID:     doc.DocID,
-			ChunkID:   doc.ChunkID,
-			DocText:   doc.DocText,
-			Embedding: doc.Embedding,
-		}
-		documentModels = append(documentModels, &model)
-		documentID = doc.DocID
-	}
-	metadata := models.DocumentMetadata{
-		DocID: documentID,
-		Tags:  tags,
+	documentModels := newDocumentModels(documents)
+	documentMetadata := models.DocumentMetadata{
+		DocID:    docID,
+		Tags:     tags,
+		Metadata: metadata,
 	}
+	version := newDocumentVersion(filename, docID, 1, fileHash, tags, len(documents))
+	version.Attributes = attributes
 
 	// step 3: do transaction
-	return s.database.GetDB().Transaction(func(tx *gorm.DB) error {
+	err = s.database.GetDB().Transaction(func(tx *gorm.DB) error {
+		// an identical file may have been stored while this one was processed
+		if err := findDuplicateFile(tx, fileHash); err != nil {
+			return err
+		}
+
 		// batch insert Documents
 		if err := tx.Create(documentModels).Error; err != nil {
 			return err
 		}
 
 		// insert DocumentMetadata
-		if err := tx.Create(&metadata).Error; err != nil {
+		if err := tx.Create(&documentMetadata).Error; err != nil {
 			return err
 		}
 
-		return nil
+		// record the first version
+		if err := tx.Create(&version).Error; err != nil {
+			return err
+		}
+		return notifyDocumentChange(tx, docID)
 	})
+	if err != nil {
+		return err
+	}
+
+	// step 4: add the new chunks to the vector store and the lexical index
+	return s.indexDocuments(documents)
+}
+
+// indexDocuments upserts the document chunks into the vector store and the BM25 index
+func (s *Service) indexDocuments(documents []models.Document) error {
+	records := make([]vectorstore.Record, 0, len(documents))
+	for _, doc := range documents {
+		record, err := documentToRecord(doc)
+		if err != nil {
+			return fmt.Errorf("error parsing embedding for chunkID %s: %w", doc.ChunkID, err)
+		}
+		records = append(records, record)
+	}
+	if err := s.vectorStore.Upsert(records...); err != nil {
+		return err
+	}
+	s.lexicalIndex.Add(records...)
+	return nil
 }
 
-func (s *Service) ProcessDocument(filename, sessionID, filePath string) ([]models.Document, []string, error) {
+// ProcessDocument turns the file into the embedded and tagged chunks of the given document version, with the
+// attributes and section of each chunk as metadata, and collects the tags of all chunks
+func (s *Service) ProcessDocument(filename, docID string, version int, filePath string, attributes map[string]string, progress ingestProgress) ([]models.Document, []string, error) {
 	// Extract text from the uploaded file
+	progress(models.JobExtracting, 0, 0)
 	docText, err := document.DownloadAndExtractText(filePath)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error processing document: %w", err)
 	}
 
-	chunks := document.OverlapChunk(docText, s.embConfig.ChunkSize, s.embConfig.OverlapSize)
+	chunks := s.chunker.Chunk(docText)
+	texts := make([]string, len(chunks))
+	for i := range chunks {
+		texts[i] = utils.SanitizeText(chunks[i].Text)
+	}
 	documents := make([]models.Document, 0)
 	tagList := []string{}
 
+	// Embed the chunks in batches, reusing the stored embeddings of identical chunks
+	progress(models.JobEmbedding, 0, len(chunks))
+	embeddings, err := s.embedChunks(texts, progress)
+	if err != nil {
+		return nil, nil, err
+	}
 	for i, chunk := range chunks {
-		document, err := s.StoreDocumentChunks(filename, fmt.Sprintf("%s_%s", filename, sessionID), chunk, i)
-		if err != nil {
-			return nil, nil, err
-		}
-		documents = append(documents, document)
-		// Auto-tagging using OpenAI
-		tags, err := s.aiClients.OpenAI.AutoTagWithOpenAI(chunk)
+		doc := newDocumentChunk(filename, docID, version, texts[i], chunk.Section(), i, embeddings[i])
+		doc.Metadata = chunkMetadata(attributes, chunk.Section())
+		documents = append(documents, doc)
+	}
+
+	// Tag the chunks with the configured strategy (DOC_TAG_STRATEGY)
+	progress(models.JobTagging, 0, len(chunks))
+	for i, chunk := range texts {
+		tags, err := s.tagChunk(chunk, embeddings[i])
 		if err != nil {
 			return nil, nil, fmt.Errorf("error auto-tagging document: %w", err)
 		}
+		documents[i].Tags = utils.RemoveDuplicates(tags)
 		tagList = append(tagList, tags...)
+		progress(models.JobTagging, i+1, len(chunks))
 	}
 
 	// Remove duplicates from the tag list
 	return documents, utils.RemoveDuplicates(tagList), nil
 }
 
-func (s *Service) StoreDocumentChunks(filename, docID, chunkText string, chunkID int) (models.Document, error) {
-	embedding, err := s.aiClients.OpenAI.EmbedText(chunkText)
-	if err != nil {
-		return models.Document{}, fmt.Errorf("error embedding chunk: %v", err)
+// newDocumentChunk builds the stored document row of a chunk.
+// Chunks of later versions get the version in their ID, so the rows of older versions can be kept for rollback.
+func newDocumentChunk(filename, docID string, version int, chunkText, headingPath string, chunkID int, embedding []float64) models.Document {
+	id := fmt.Sprintf("%s_chunk_%d", docID, chunkID)
+	if version > 1 {
+		id = fmt.Sprintf("%s_v%d_chunk_%d", docID, version, chunkID)
 	}
-
-	document := models.Document{
+	return models.Document{
 		Filename:  filename,
 		DocID:     docID,
-		ChunkID:   fmt.Sprintf("%s_chunk_%d", docID, chunkID),
+		ChunkID:   id,
 		DocText:   utils.SanitizeText(chunkText),
 		Embedding: utils.Float64SliceToPostgresArray(embedding),
-	}
+		Version:   version,
 
-	/*err = s.repository.CreateDocumentEmbedding(document)
-	if err != nil {
-		return models.Document{}, fmt.Errorf("error storing document chunk: %v", err)
-	}*/
+		ContentHash: document.HashChunk(chunkText),
+		HeadingPath: headingPath,
+	}
+}
 
-	return document, nil
+// newDocumentModels copies the chunks into the rows inserted by the ingestion transaction
+func newDocumentModels(documents []models.Document) []*models.Document {
+	documentModels := make([]*models.Document, 0, len(documents))
+	for _, doc := range documents {
+		model := doc
+		documentModels = append(documentModels, &model)
+	}
+	return documentModels
 }
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"fmt"
+)
+
+// Tagging strategies of uploaded documents (DOC_TAG_STRATEGY)
+const (
+	TagStrategyNone      = "none"      // Documents are not tagged
+	TagStrategyLLM       = "llm"       // The completion model picks the tags of each chunk
+	TagStrategyEmbedding = "embedding" // Chunk embeddings are scored against the tag embeddings, without completion calls
+	TagStrategyHybrid    = "hybrid"    // Embedding tagging, with the completion model for chunks no tag is similar enough to
+)
+
+func validTagStrategy(strategy string) error {
+	switch strategy {
+	case TagStrategyNone, TagStrategyLLM, TagStrategyEmbedding, TagStrategyHybrid:
+		return nil
+	default:
+		return fmt.Errorf("unknown tagging strategy %q", strategy)
+	}
+}
+
+func usesTagEmbeddings(strategy string) bool {
+	return strategy == TagStrategyEmbedding || strategy == TagStrategyHybrid
+}
+
+// tagChunk returns the tags of the taxonomy for a chunk with the configured strategy.
+// Nothing is tagged while the taxonomy has no tags.
+func (s *Service) tagChunk(text string, embedding []float64) ([]string, error) {
+	descriptions := s.taxonomy.descriptions()
+	strategy := s.embConfig.TagStrategy
+	if len(descriptions) == 0 || strategy == TagStrategyNone {
+		return nil, nil
+	}
+
+	if usesTagEmbeddings(strategy) {
+		if !s.taxonomy.hasEmbeddings() {
+			// Embedded on first use when the startup sync failed
+			if err := s.syncTagEmbeddings(); err != nil {
+				return nil, fmt.Errorf("error embedding tags: %w", err)
+			}
+		}
+		tags := s.taxonomy.relevantTags(embedding, s.embConfig.TagThreshold, s.embConfig.TagMaxPerChunk)
+		if len(tags) > 0 || strategy == TagStrategyEmbedding {
+			return tags, nil
+		}
+	}
+
+	// Auto-tagging using OpenAI, restricted to the tags of the taxonomy
+	tags, err := s.aiClients.OpenAI.AutoTagWithOpenAI(text, descriptions)
+	if err != nil {
+		return nil, err
+	}
+	known, unknown := s.taxonomy.canonical(tags)
+	if len(unknown) > 0 {
+		fmt.Printf("Dropping tags outside the taxonomy: %q\n", unknown)
+	}
+	return known, nil
+}
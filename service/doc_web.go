@@ -0,0 +1,192 @@
+package service
+
+import (
+	document "crossplatform_chatbot/document_proc"
+	"crossplatform_chatbot/models"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidSourceURL is returned for URLs that are not absolute http or https URLs
+var ErrInvalidSourceURL = errors.New("invalid URL")
+
+// Keys of the document metadata of crawled pages
+const (
+	metaSourceURL    = "source_url"
+	metaETag         = "etag"
+	metaLastModified = "last_modified"
+	metaContentHash  = "content_hash" // SHA-256 of the extracted text
+	metaCrawledAt    = "crawled_at"
+)
+
+// EnqueueURLIngest queues an ingestion job for a web page, or for each page listed in a sitemap, with the attributes
+// stored on every chunk. Pages excluded by robots.txt are returned as skipped. Posting the same URL again updates
+// the pages that changed.
+func (s *Service) EnqueueURLIngest(sourceURL, platform, chatID string, attributes map[string]string) ([]*models.IngestJob, []string, error) {
+	parsed, err := url.Parse(sourceURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, nil, fmt.Errorf("%q: %w", sourceURL, ErrInvalidSourceURL)
+	}
+	if err := s.crawler.CheckHost(sourceURL); err != nil {
+		return nil, nil, err
+	}
+
+	pageURLs := []string{sourceURL}
+	if document.IsSitemapURL(sourceURL) {
+		if pageURLs, err = s.crawler.SitemapURLs(sourceURL, s.embConfig.WebCrawlMaxPages); err != nil {
+			return nil, nil, err
+		}
+		fmt.Printf("Sitemap %s lists %d pages\n", sourceURL, len(pageURLs))
+	}
+
+	jobs := make([]*models.IngestJob, 0, len(pageURLs))
+	var skipped []string
+	for _, pageURL := range pageURLs {
+		if !s.crawler.Allowed(pageURL) {
+			skipped = append(skipped, pageURL)
+			continue
+		}
+		job, err := s.enqueueIngestJob(&models.IngestJob{
+			Filename:  pageURL,
+			DocID:     fmt.Sprintf("%s_%s", pageName(pageURL), uuid.New().String()),
+			SourceURL: pageURL,
+			FilePath:  pageURL,
+			Platform:  platform,
+			ChatID:    chatID,
+
+			Attributes: attributes,
+		})
+		if err != nil {
+			return jobs, skipped, err
+		}
+		jobs = append(jobs, job)
+	}
+	if len(jobs) == 0 && len(skipped) > 0 && len(pageURLs) == 1 {
+		return nil, skipped, fmt.Errorf("%s: %w", sourceURL, document.ErrDisallowedByRobots)
+	}
+	return jobs, skipped, nil
+}
+
+// pageName is the last path segment of the page URL, or its host, used in the document ID
+func pageName(pageURL string) string {
+	parsed, err := url.Parse(pageURL)
+	if err != nil {
+		return "page"
+	}
+	if name := path.Base(parsed.Path); name != "/" && name != "." {
+		return name
+	}
+	return parsed.Host
+}
+
+// ingestWebPage fetches the page of the job and ingests it as a new document, or as the next version
+// of the document already ingested from the same URL. Pages whose ETag, Last-Modified date or extracted text
+// did not change are not ingested again; the job is marked unchanged and the active version is returned.
+func (s *Service) ingestWebPage(job *models.IngestJob, progress ingestProgress) (int, error) {
+	// Documents ingested from the URL by an earlier crawl
+	var previous map[string]interface{}
+	existing, err := s.repository.GetDocumentMetadataBySourceURL(job.SourceURL)
+	switch {
+	case err == nil:
+		job.DocID, previous = existing.DocID, existing.Metadata
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return 0, fmt.Errorf("error looking up document of %s: %w", job.SourceURL, err)
+	}
+
+	progress(models.JobExtracting, 0, 0)
+	page, err := s.crawler.Fetch(job.SourceURL, metadataString(previous, metaETag), metadataString(previous, metaLastModified))
+	if err != nil {
+		return 0, err
+	}
+	if page.NotModified && existing != nil {
+		job.Unchanged = true
+		return s.activeVersion(job.DocID)
+	}
+
+	// The extracted text is ingested as a text file, so the stored file hash is the hash of the text:
+	// dynamic parts of the markup (scripts, tokens, ads) don't make the page look changed
+	text, err := document.ExtractWebPage(page)
+	if err != nil {
+		return 0, fmt.Errorf("error processing page: %w", err)
+	}
+	if strings.TrimSpace(text) == "" {
+		return 0, fmt.Errorf("no text found on page %s", job.SourceURL)
+	}
+	file, err := os.CreateTemp("", "webpage-*.txt")
+	if err != nil {
+		return 0, fmt.Errorf("error creating temporary file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(text)
+	file.Close()
+	if err != nil {
+		return 0, fmt.Errorf("error writing temporary file: %v", err)
+	}
+	contentHash, err := document.HashFile(file.Name())
+	if err != nil {
+		return 0, err
+	}
+
+	metadata := map[string]interface{}{
+		metaSourceURL:    job.SourceURL,
+		metaETag:         page.ETag,
+		metaLastModified: page.LastModified,
+		metaContentHash:  contentHash,
+		metaCrawledAt:    time.Now().UTC().Format(time.RFC3339),
+	}
+
+	// The source URL is stored with the chunks, next to the attributes of the job or of the previous crawl
+	attributes := job.Attributes
+	if attributes == nil && existing != nil {
+		versions, err := s.GetDocumentVersions(job.DocID)
+		if err != nil {
+			return 0, err
+		}
+		attributes = activeAttributes(versions)
+	}
+	attributes = chunkMetadata(attributes, "")
+	attributes[metaSourceURL] = job.SourceURL
+
+	// The validators and hash for the next crawl are stored with the chunks of a new version
+	switch {
+	case existing != nil && metadataString(previous, metaContentHash) == contentHash:
+		job.Unchanged = true
+		version, err := s.activeVersion(job.DocID)
+		if err != nil {
+			return 0, err
+		}
+		return version, s.repository.UpdateDocumentMetadata(job.DocID, metadata)
+	case existing != nil:
+		job.Replace = true
+		return s.replaceDocument(job.DocID, job.Filename, file.Name(), attributes, nil, metadata, progress)
+	default:
+		return 1, s.ingestDocument(job.Filename, job.DocID, file.Name(), attributes, nil, metadata, progress)
+	}
+}
+
+// activeVersion returns the version of the document currently served by search
+func (s *Service) activeVersion(docID string) (int, error) {
+	versions, err := s.GetDocumentVersions(docID)
+	if err != nil {
+		return 0, err
+	}
+	for _, version := range versions {
+		if version.Active {
+			return version.Version, nil
+		}
+	}
+	return versions[0].Version, nil
+}
+
+func metadataString(metadata map[string]interface{}, key string) string {
+	value, _ := metadata[key].(string)
+	return value
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	document "crossplatform_chatbot/document_proc"
+	"crossplatform_chatbot/models"
+	"crossplatform_chatbot/repository"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// crawlDAO stores the metadata of one crawled document, the other DAO methods are not used by the re-crawl checks
+type crawlDAO struct {
+	repository.DAO
+	metadata *models.DocumentMetadata
+	versions []models.DocumentVersion
+	updated  map[string]interface{}
+}
+
+func (d *crawlDAO) GetDocumentMetadataBySourceURL(string) (*models.DocumentMetadata, error) {
+	return d.metadata, nil
+}
+
+func (d *crawlDAO) GetDocumentVersions(string) ([]models.DocumentVersion, error) {
+	return d.versions, nil
+}
+
+func (d *crawlDAO) UpdateDocumentMetadata(_ string, metadata map[string]interface{}) error {
+	d.updated = metadata
+	return nil
+}
+
+func TestIngestWebPageUnchanged(t *testing.T) {
+	const text = "Page content"
+	hash := sha256.Sum256([]byte(text))
+	contentHash := hex.EncodeToString(hash[:])
+
+	etag := `"v1"`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/page" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		// A new ETag, but the extracted text is the same: dynamic markup changes are not a new version
+		w.Header().Set("ETag", `"v2"`)
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><script>var token = "changes every time";</script><main><p>` + text + `</p></main></body></html>`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		etag        string
+		wantUpdated bool
+	}{
+		{"not modified", etag, false},          // 304 to the conditional request
+		{"same content hash", `"stale"`, true}, // Fetched again, the text hash matches
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dao := &crawlDAO{
+				metadata: &models.DocumentMetadata{DocID: "page_1", Metadata: map[string]interface{}{
+					metaSourceURL: server.URL + "/page", metaETag: tt.etag, metaContentHash: contentHash,
+				}},
+				versions: []models.DocumentVersion{{DocID: "page_1", Version: 3, Active: true}},
+			}
+			crawler := document.NewWebCrawler("TestBot", 0)
+			crawler.AllowPrivateAddresses()
+			s := &Service{repository: dao, crawler: crawler}
+
+			job := &models.IngestJob{SourceURL: server.URL + "/page", Filename: server.URL + "/page", DocID: "new_id"}
+			version, err := s.ingestWebPage(job, func(string, int, int) {})
+			if err != nil {
+				t.Fatalf("ingestWebPage: %v", err)
+			}
+			if !job.Unchanged || job.Replace || job.DocID != "page_1" || version != 3 {
+				t.Fatalf("job = %+v, version %d; want unchanged version 3 of page_1", job, version)
+			}
+			if (dao.updated != nil) != tt.wantUpdated {
+				t.Fatalf("metadata updated = %v, want %v", dao.updated, tt.wantUpdated)
+			}
+			if tt.wantUpdated && (dao.updated[metaETag] != `"v2"` || dao.updated[metaContentHash] != contentHash) {
+				t.Fatalf("updated metadata = %v, want the new ETag and the same hash", dao.updated)
+			}
+		})
+	}
+}
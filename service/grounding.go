@@ -0,0 +1,162 @@
+package service
+
+import (
+	"crossplatform_chatbot/ai_clients/chat"
+	document "crossplatform_chatbot/document_proc"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// Policies for messages where retrieval finds no document chunks
+const (
+	NoContextFree       = "free"       // Answer from the model's own knowledge
+	NoContextDisclaimer = "disclaimer" // Answer, followed by a disclaimer
+	NoContextCanned     = "canned"     // Reply with a fixed message without calling the model
+	NoContextHandoff    = "handoff"    // Reply with a fixed message and pass the question to a human
+)
+
+// Modes of the post-generation grounding check
+const (
+	GroundingOff     = "off"
+	GroundingFlag    = "flag"    // Keep the answer and mark it as partly unsupported
+	GroundingRewrite = "rewrite" // Replace the answer with a version without the unsupported claims
+)
+
+// Intent answered without document context, excluded from the no-context policy
+const welcomeIntent = "Default Welcome Intent"
+
+// Appended to answers flagged by the grounding check
+const unsupportedNote = "Note: some details in this answer could not be verified in our documentation."
+
+const groundingInstructions = `You verify support answers against documentation.
+Compare the answer with the numbered context passages and list every claim in the answer that the context does not support.
+Reply with JSON only, in the form {"supported": true, "unsupported_claims": [], "revised_answer": ""}.
+revised_answer is the answer with the unsupported claims removed, keeping citations such as [1]. Leave it empty when all claims are supported.`
+
+// GroundingResult is the outcome of checking an answer against its context
+type GroundingResult struct {
+	Supported         bool     `json:"supported"`
+	UnsupportedClaims []string `json:"unsupportedClaims,omitempty"`
+	Rewritten         bool     `json:"rewritten"`
+}
+
+// groundingJudgement is the JSON reply of the grounding judge
+type groundingJudgement struct {
+	Supported         bool     `json:"supported"`
+	UnsupportedClaims []string `json:"unsupported_claims"`
+	RevisedAnswer     string   `json:"revised_answer"`
+}
+
+// replyWithoutContext returns the fixed reply of the canned and handoff policies.
+// For handoff, the configured webhook is notified so a human can pick up the conversation.
+func (s *Service) replyWithoutContext(chatID, message, botTag string, result *MessageResult) {
+	if s.botConfig.NoContextPolicy != NoContextHandoff {
+		result.Response = s.botConfig.NoContextMessage
+		return
+	}
+
+	result.Response = s.botConfig.HandoffMessage
+	result.Handoff = true
+	if err := s.notifyHandoff(chatID, message, botTag); err != nil {
+		fmt.Printf("Error notifying handoff for chat %s: %v\n", chatID, err)
+	}
+}
+
+// notifyHandoff posts the unanswered question to the handoff webhook, if one is configured
+func (s *Service) notifyHandoff(chatID, message, botTag string) error {
+	fmt.Printf("Handing off chat %s (%s) to a human agent\n", chatID, botTag)
+	if s.botConfig.HandoffWebhookURL == "" {
+		return nil
+	}
+
+	response, err := resty.New().SetTimeout(10*time.Second).R().
+		SetHeader("Content-Type", "application/json").
+		SetBody(map[string]interface{}{
+			"chatID":    chatID,
+			"platform":  botTag,
+			"message":   message,
+			"timestamp": time.Now().UTC().Format(time.RFC3339),
+		}).
+		Post(s.botConfig.HandoffWebhookURL)
+	if err != nil {
+		return fmt.Errorf("error sending handoff notification: %v", err)
+	}
+	if response.IsError() {
+		return fmt.Errorf("handoff webhook returned status code %d: %s", response.StatusCode(), response.String())
+	}
+	return nil
+}
+
+// verifyGrounding checks the response against the retrieved chunks and flags or rewrites unsupported claims.
+// A failing check leaves the response unchanged.
+func (s *Service) verifyGrounding(result *MessageResult, handlers *StreamHandlers) error {
+	if s.botConfig.GroundingCheck == GroundingOff || s.botConfig.GroundingCheck == "" || len(result.Chunks) == 0 {
+		return nil
+	}
+
+	judgement, err := s.judgeGrounding(result.Response, result.Chunks)
+	if err != nil {
+		fmt.Printf("Error checking answer grounding: %v\n", err)
+		return nil
+	}
+
+	result.Grounding = &GroundingResult{
+		Supported:         judgement.Supported,
+		UnsupportedClaims: judgement.UnsupportedClaims,
+	}
+	if judgement.Supported {
+		return nil
+	}
+	fmt.Printf("Unsupported claims in answer: %v\n", judgement.UnsupportedClaims)
+
+	// In rewrite mode the answer was not streamed yet, see answerWithContext
+	if s.botConfig.GroundingCheck == GroundingRewrite && strings.TrimSpace(judgement.RevisedAnswer) != "" {
+		result.Response = strings.TrimSpace(judgement.RevisedAnswer)
+		result.Grounding.Rewritten = true
+		return nil
+	}
+	return appendToResponse(result, handlers, unsupportedNote)
+}
+
+// judgeGrounding asks the grounding provider which claims of the answer are not supported by the chunks
+func (s *Service) judgeGrounding(answer string, chunks []document.ScoredChunk) (*groundingJudgement, error) {
+	providerName := s.botConfig.GroundingProvider
+	if providerName == "" {
+		providerName = s.botConfig.AIProvider
+	}
+	provider, ok := s.aiClients.Providers.Get(providerName)
+	if !ok {
+		return nil, fmt.Errorf("unknown grounding provider: %s", providerName)
+	}
+
+	messages := []chat.Message{
+		{Role: chat.RoleSystem, Content: groundingInstructions},
+		{Role: chat.RoleUser, Content: fmt.Sprintf("Context:\n%s\n\nAnswer:\n%s", buildContext(chunks), answer)},
+	}
+	reply, err := provider.ChatCompletion(messages, chat.Options{MaxTokens: 1000, Temperature: chat.Temperature(0.1)})
+	if err != nil {
+		return nil, fmt.Errorf("error getting grounding judgement: %v", err)
+	}
+
+	// Models sometimes wrap the JSON in a code block or add a sentence around it
+	start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON in grounding judgement: %q", reply)
+	}
+	var judgement groundingJudgement
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &judgement); err != nil {
+		return nil, fmt.Errorf("error parsing grounding judgement: %v", err)
+	}
+	return &judgement, nil
+}
+
+// appendToResponse adds a paragraph to the response, streaming it as a token when streaming
+func appendToResponse(result *MessageResult, handlers *StreamHandlers, text string) error {
+	addition := "\n\n" + text
+	result.Response += addition
+	return streamWholeResponse(handlers, addition)
+}
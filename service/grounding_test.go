@@ -0,0 +1,93 @@
+package service
+
+import (
+	"crossplatform_chatbot/ai_clients"
+	"crossplatform_chatbot/ai_clients/chat"
+	"crossplatform_chatbot/bot"
+	config "crossplatform_chatbot/configs"
+	document "crossplatform_chatbot/document_proc"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// groundingProvider streams the answer word by word, and judges it with a fixed judgement
+type groundingProvider struct {
+	answer    string
+	judgement string
+}
+
+func (p *groundingProvider) ChatCompletion(messages []chat.Message, _ chat.Options) (string, error) {
+	if messages[0].Content == groundingInstructions {
+		return p.judgement, nil
+	}
+	return p.answer, nil
+}
+
+func (p *groundingProvider) ChatCompletionStream(messages []chat.Message, opts chat.Options, onToken chat.TokenHandler) (string, error) {
+	for _, word := range strings.SplitAfter(p.answer, " ") {
+		if err := onToken(word); err != nil {
+			return "", err
+		}
+	}
+	return p.answer, nil
+}
+
+func (p *groundingProvider) Describe() string {
+	return "grounding test provider"
+}
+
+// groundingService returns a service answering with the provider and the grounding check in the given mode
+func groundingService(t *testing.T, mode string, provider *groundingProvider) *Service {
+	aiClients := ai_clients.AIClients{Providers: ai_clients.NewRegistry()}
+	aiClients.Providers.Register("test", provider)
+	botConfig := &config.BotConfig{AIProvider: "test", GroundingCheck: mode}
+	general, err := bot.NewGeneralBot(botConfig, config.EmbeddingConfig{}, aiClients, nil, nil)
+	if err != nil {
+		t.Fatalf("NewGeneralBot: %v", err)
+	}
+	return &Service{
+		bots:      map[string]bot.Bot{"general": general},
+		botConfig: botConfig,
+		aiClients: aiClients,
+	}
+}
+
+func TestAnswerWithContextStreaming(t *testing.T) {
+	provider := &groundingProvider{
+		answer:    "The router has 4 ports [1]. It supports 5G [1].",
+		judgement: `{"supported": false, "unsupported_claims": ["It supports 5G"], "revised_answer": "The router has 4 ports [1]."}`,
+	}
+	chunks := []document.ScoredChunk{{ChunkID: "manual_chunk_0", DocID: "manual", Text: "The router has 4 ports.", Score: 0.9}}
+
+	tests := []struct {
+		mode           string
+		checkGrounding bool
+		wantResponse   string
+		wantTokens     []string
+	}{
+		// The checked answer is sent whole, never the unsupported claim
+		{GroundingRewrite, true, "The router has 4 ports [1].", []string{"The router has 4 ports [1]."}},
+		{GroundingFlag, true, provider.answer + "\n\n" + unsupportedNote,
+			[]string{"The ", "router ", "has ", "4 ", "ports ", "[1]. ", "It ", "supports ", "5G ", "[1].", "\n\n" + unsupportedNote}},
+		{GroundingRewrite, false, provider.answer, []string{"The ", "router ", "has ", "4 ", "ports ", "[1]. ", "It ", "supports ", "5G ", "[1]."}},
+	}
+	for _, tt := range tests {
+		s := groundingService(t, tt.mode, provider)
+		var tokens []string
+		handlers := &StreamHandlers{OnToken: func(token string) error {
+			tokens = append(tokens, token)
+			return nil
+		}}
+		result := &MessageResult{Chunks: chunks}
+		if err := s.answerWithContext("chat", "How many ports?", "general", nil, result, handlers, tt.checkGrounding); err != nil {
+			t.Fatalf("%s: answerWithContext: %v", tt.mode, err)
+		}
+		if result.Response != tt.wantResponse {
+			t.Errorf("%s: response = %q, want %q", tt.mode, result.Response, tt.wantResponse)
+		}
+		if strings.Join(tokens, "") != result.Response || !reflect.DeepEqual(tokens, tt.wantTokens) {
+			t.Errorf("%s: streamed tokens = %q, want %q", tt.mode, tokens, tt.wantTokens)
+		}
+	}
+}
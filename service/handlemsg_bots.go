@@ -66,11 +66,11 @@ func (s *Service) HandleLine(req *http.Request) error {
 					fmt.Printf("Error getting chat ID: %v\n", err)
 					return fmt.Errorf("error getting chat ID: %v", err)
 				}
-				response, _, _, _, err := s.processUserMessage(chatID, message.Text, "line")
+				result, err := s.processUserMessage(chatID, message.Text, "line")
 				if err != nil {
 					return fmt.Errorf("error processing user message: %w", err)
 				}
-				err = b.SendReply(event, response)
+				err = b.SendReply(event, result.ReplyWithSources())
 				if err != nil {
 					return fmt.Errorf("error occurred while sending the response: %s", err.Error())
 				}
@@ -96,18 +96,19 @@ func (s *Service) HandleTelegram(update tgbotapi.Update) error {
 	if update.Message != nil {
 		if update.Message.Document != nil {
 
-			// get filename, fileURL, fileID
-			fileID, fileURL, filename, err := tgBot.GetDocFile(update)
+			// get filename, fileID
+			fileID, filename, err := tgBot.GetDocFile(update)
 			if err != nil {
 				return fmt.Errorf("error getting file:  %w", err)
 			}
 
-			// If the message contains a document, handle the document upload
-			err = s.HandleDocumentUpload(filename, fileID, fileURL)
+			// If the message contains a document, queue it for ingestion and answer right away (a notice follows when it's done)
+			_, err = s.EnqueueTelegramDocument(filename, fileID, chatID)
 			if err != nil {
 				b.SendReply(update.Message, "Error handling document: "+err.Error())
 				return fmt.Errorf("error handling the document:  %w", err)
 			}
+			b.SendReply(update.Message, fmt.Sprintf("Processing document %s, I'll let you know when it's ready.", filename))
 
 			//b.SendTelegramMessage(update.Message.Chat.ID, "Document processed and stored in chunks for future queries.")
 
@@ -131,12 +132,12 @@ func (s *Service) HandleTelegram(update tgbotapi.Update) error {
 
 			//tgBot.HandleTgMessage(update.Message)
 			// Process the message and generate a response using the service layer.
-			response, _, _, _, err := s.processUserMessage(chatID, update.Message.Text, "telegram")
+			result, err := s.processUserMessage(chatID, update.Message.Text, "telegram")
 			if err != nil {
 				return fmt.Errorf("error processing user message: %w", err)
 			}
 
-			err = b.SendReply(update.Message, response)
+			err = b.SendReply(update.Message, result.ReplyWithSources())
 			if err != nil {
 				return fmt.Errorf("error occurred while sending the response: %s", err.Error())
 			}
@@ -159,12 +160,13 @@ func (s *Service) HandleMessenger(event bot.MessengerEvent) error {
 			senderID := msg.Sender.ID
 			if messageText := strings.TrimSpace(msg.Message.Text); messageText != "" {
 				//fbBot.HandleMessengerMessage(senderID, messageText)
-				response, _, _, _, err := s.processUserMessage(senderID, messageText, "facebook")
+				result, err := s.processUserMessage(senderID, messageText, "facebook")
 				if err != nil {
 					return fmt.Errorf("error processing user message: %w", err)
 				}
-				fmt.Printf("Sent message %s \n", response)
-				err = b.SendReply(senderID, response)
+				reply := result.ReplyWithSources()
+				fmt.Printf("Sent message %s \n", reply)
+				err = b.SendReply(senderID, reply)
 				if err != nil {
 					//c.JSON(http.StatusInternalServerError, gin.H{"error": "An error occurred while sending the response"})
 					return fmt.Errorf("error occurred while sending the response: %s", err.Error())
@@ -189,12 +191,13 @@ func (s *Service) HandleInstagram(event bot.InstagramEvent) error {
 			senderID := msg.Sender.ID
 			if messageText := strings.TrimSpace(msg.Message.Text); messageText != "" {
 				//igBot.HandleInstagramMessage(senderID, messageText)
-				response, _, _, _, err := s.processUserMessage(senderID, messageText, "facebook")
+				result, err := s.processUserMessage(senderID, messageText, "facebook")
 				if err != nil {
 					return fmt.Errorf("error processing user message: %w", err)
 				}
-				fmt.Printf("Sent message %s \n", response)
-				err = b.SendReply(senderID, response)
+				reply := result.ReplyWithSources()
+				fmt.Printf("Sent message %s \n", reply)
+				err = b.SendReply(senderID, reply)
 				if err != nil {
 					//c.JSON(http.StatusInternalServerError, gin.H{"error": "An error occurred while sending the response"})
 					return fmt.Errorf("error occurred while sending the response: %s", err.Error())
@@ -206,15 +209,26 @@ func (s *Service) HandleInstagram(event bot.InstagramEvent) error {
 }
 
 // HandleGeneral processes requests from the frontend for the general bot.
-func (s *Service) HandleGeneral(req models.GeneralRequest) (string, string, []string, []float64, error) {
+func (s *Service) HandleGeneral(req models.GeneralRequest) (*MessageResult, error) {
 
 	// Process the message and generate a response using the service layer.
-	response, intent, topChunkIDs, topChunkScores, err := s.processUserMessage(req.SessionID, req.Message, "general")
+	result, err := s.processUserMessage(req.SessionID, req.Message, "general")
 	if err != nil {
-		return "", "", nil, nil, fmt.Errorf("error processing user message: %w", err)
+		return nil, fmt.Errorf("error processing user message: %w", err)
 	}
 
-	return response, intent, topChunkIDs, topChunkScores, nil
+	return result, nil
+}
+
+// HandleGeneralStream processes requests from the frontend for the general bot, streaming the retrieved chunks
+// and the response tokens through the handlers. Commands are sent back as a single token.
+func (s *Service) HandleGeneralStream(req models.GeneralRequest, handlers StreamHandlers) (*MessageResult, error) {
+	result, err := s.processUserMessageStream(req.SessionID, req.Message, "general", &handlers)
+	if err != nil {
+		return nil, fmt.Errorf("error processing user message: %w", err)
+	}
+
+	return result, nil
 }
 
 // getChatID returns a chat ID with a given platform
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"crossplatform_chatbot/bot"
+	document "crossplatform_chatbot/document_proc"
+	"crossplatform_chatbot/models"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/google/uuid"
+)
+
+// ErrIngestQueueFull is returned when more documents are waiting for ingestion than the queue holds (DOC_INGEST_QUEUE_SIZE)
+var ErrIngestQueueFull = errors.New("the ingestion queue is full, try again later")
+
+// startIngestWorkers creates the ingestion job table, starts the worker pool and requeues
+// the jobs that were still pending when the server stopped.
+func (s *Service) startIngestWorkers(workers, queueSize int) error {
+	if err := s.database.GetDB().AutoMigrate(&models.IngestJob{}); err != nil {
+		return fmt.Errorf("error migrating ingestion jobs: %w", err)
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+	s.ingestQueue = make(chan string, queueSize)
+	for i := 0; i < workers; i++ {
+		go s.ingestWorker()
+	}
+
+	jobs, err := s.repository.GetUnfinishedIngestJobs()
+	if err != nil {
+		return err
+	}
+	// The pending jobs may not all fit in the queue, they are handed over as the workers free it
+	go func() {
+		for _, job := range jobs {
+			fmt.Printf("Requeueing ingestion job %s for %s\n", job.ID, job.Filename)
+			s.ingestQueue <- job.ID
+		}
+	}()
+
+	fmt.Printf("Started %d document ingestion workers\n", workers)
+	return nil
+}
+
+// EnqueueDocumentUpload persists an ingestion job for the document and queues it for the worker pool.
+// The platform and chat ID identify who is notified once the job finishes, the attributes (product,
+// version, language...) are stored with every chunk of the document.
+func (s *Service) EnqueueDocumentUpload(filename, fileID, filePath, platform, chatID string, attributes map[string]string) (*models.IngestJob, error) {
+	return s.enqueueIngestJob(&models.IngestJob{
+		Filename: filename,
+		DocID:    fmt.Sprintf("%s_%s", filename, fileID),
+		FilePath: filePath,
+		Platform: platform,
+		ChatID:   chatID,
+
+		Attributes: attributes,
+	})
+}
+
+// EnqueueTelegramDocument queues the ingestion of a document sent to the Telegram bot. Only the file ID
+// is stored, the download URL contains the bot token and is resolved by the worker.
+func (s *Service) EnqueueTelegramDocument(filename, fileID, chatID string) (*models.IngestJob, error) {
+	return s.enqueueIngestJob(&models.IngestJob{
+		Filename: filename,
+		DocID:    fmt.Sprintf("%s_%s", filename, fileID),
+		Platform: "telegram",
+		ChatID:   chatID,
+
+		TelegramFileID: fileID,
+	})
+}
+
+// enqueueIngestJob persists the job as queued and hands it to the worker pool.
+// ErrIngestQueueFull is returned, and the job marked failed, when the queue is full.
+func (s *Service) enqueueIngestJob(job *models.IngestJob) (*models.IngestJob, error) {
+	job.ID = uuid.New().String()
+	job.Status = models.JobQueued
+	if err := s.repository.CreateIngestJob(job); err != nil {
+		return nil, fmt.Errorf("error creating ingestion job: %w", err)
+	}
+
+	select {
+	case s.ingestQueue <- job.ID:
+	default:
+		fields := map[string]interface{}{"status": models.JobFailed, "error": ErrIngestQueueFull.Error(), "finished_at": time.Now()}
+		if err := s.repository.UpdateIngestJob(job.ID, fields); err != nil {
+			fmt.Println(err)
+		}
+		return nil, ErrIngestQueueFull
+	}
+	return job, nil
+}
+
+// GetIngestJob returns the ingestion job with the given ID
+func (s *Service) GetIngestJob(jobID string) (*models.IngestJob, error) {
+	return s.repository.GetIngestJob(jobID)
+}
+
+// ingestWorker processes queued jobs until the queue is closed
+func (s *Service) ingestWorker() {
+	for jobID := range s.ingestQueue {
+		s.runIngestJob(jobID)
+	}
+}
+
+// runIngestJob ingests the job's document, recording the progress and the outcome on the job
+func (s *Service) runIngestJob(jobID string) {
+	job, err := s.repository.GetIngestJob(jobID)
+	if err != nil {
+		fmt.Printf("Error loading ingestion job %s: %v\n", jobID, err)
+		return
+	}
+	start := time.Now()
+	fmt.Printf("Running ingestion job %s for %s\n", job.ID, job.Filename)
+
+	progress := func(status string, done, total int) {
+		fields := map[string]interface{}{"status": status, "total_chunks": total}
+		switch status {
+		case models.JobEmbedding:
+			fields["embedded_chunks"] = done
+		case models.JobTagging:
+			fields["tagged_chunks"] = done
+		}
+		if err := s.repository.UpdateIngestJob(job.ID, fields); err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	version, err := s.executeIngestJob(job, progress)
+	removeUploadedFile(job)
+
+	finishedAt := time.Now()
+	fields := map[string]interface{}{"status": models.JobDone, "error": "", "version": version, "finished_at": finishedAt}
+
+	// A crawled page may update the document ingested from the same URL before
+	if job.SourceURL != "" {
+		fields["doc_id"], fields["replace"], fields["unchanged"] = job.DocID, job.Replace, job.Unchanged
+	}
+
+	// Identical files are linked to the stored document or rejected, depending on the duplicate policy
+	var duplicate *DuplicateDocumentError
+	if errors.As(err, &duplicate) {
+		fmt.Printf("Ingestion job %s: %s is %v\n", job.ID, job.Filename, duplicate)
+		job.DuplicateOf = duplicate.DocID
+		fields["duplicate_of"] = duplicate.DocID
+		if s.embConfig.DuplicatePolicy == DuplicateLink {
+			job.DocID = duplicate.DocID
+			fields["doc_id"] = duplicate.DocID
+			fields["version"] = duplicate.Version
+			err = nil
+		}
+	}
+
+	if err != nil {
+		fmt.Printf("Ingestion job %s failed: %v\n", job.ID, err)
+		fields["status"] = models.JobFailed
+		fields["error"] = err.Error()
+		fields["version"] = 0
+	} else {
+		fmt.Printf("Ingestion job %s done in %s\n", job.ID, time.Since(start))
+	}
+	if err := s.repository.UpdateIngestJob(job.ID, fields); err != nil {
+		fmt.Println(err)
+	}
+
+	job.Status = fields["status"].(string)
+	job.Error = fields["error"].(string)
+	s.notifyIngestJob(job)
+}
+
+// executeIngestJob ingests the document of the job and returns the version created. A panic in the
+// pipeline, e.g. on a malformed file, is returned as an error so the job is marked failed.
+func (s *Service) executeIngestJob(job *models.IngestJob, progress ingestProgress) (version int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("Ingestion job %s panicked: %v\n%s", job.ID, r, debug.Stack())
+			version, err = 0, errors.New("internal error while processing the document")
+		}
+	}()
+
+	// Telegram files are downloaded once, then hashed and extracted from the local copy
+	filePath := job.FilePath
+	if job.TelegramFileID != "" {
+		fileURL, err := s.telegramFileURL(job.TelegramFileID)
+		if err != nil {
+			return 0, err
+		}
+		if filePath, err = document.DownloadToTempFile(fileURL); err != nil {
+			return 0, err
+		}
+		defer os.Remove(filePath)
+	}
+
+	switch {
+	case job.SourceURL != "":
+		return s.ingestWebPage(job, progress)
+	case job.Replace:
+		return s.replaceDocument(job.DocID, job.Filename, filePath, job.Attributes, nil, nil, progress)
+	default:
+		return 1, s.ingestDocument(job.Filename, job.DocID, filePath, job.Attributes, nil, nil, progress)
+	}
+}
+
+// telegramFileURL returns the download URL of a file sent to the Telegram bot
+func (s *Service) telegramFileURL(fileID string) (string, error) {
+	tgBot, ok := s.GetBot("telegram").(bot.TgBot)
+	if !ok {
+		return "", errors.New("telegram bot not found")
+	}
+	fileURL, err := tgBot.GetFileURL(fileID)
+	if err != nil {
+		return "", errors.New("error getting the file from Telegram")
+	}
+	return fileURL, nil
+}
+
+// removeUploadedFile deletes the temporary copy of an uploaded file once its job is finished
+func removeUploadedFile(job *models.IngestJob) {
+	if job.SourceURL != "" || !isUploadPath(job.FilePath) {
+		return
+	}
+	if err := os.Remove(job.FilePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("Error removing uploaded file %s: %v\n", job.FilePath, err)
+	}
+}
+
+// UploadPath returns a temporary path, unique per upload, where an uploaded file is kept until its job is finished
+func UploadPath(filename string) string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("%s_%s", uuid.New().String(), filepath.Base(filename)))
+}
+
+// isUploadPath reports whether the path is a temporary upload path
+func isUploadPath(path string) bool {
+	return path != "" && filepath.Dir(path) == filepath.Clean(os.TempDir())
+}
+
+// notifyIngestJob sends a completion notice for the job to the chat that uploaded the document.
+// The web client follows the job through the job status endpoints instead.
+func (s *Service) notifyIngestJob(job *models.IngestJob) {
+	if job.Platform != "telegram" || job.ChatID == "" {
+		return
+	}
+
+	chatID, err := strconv.ParseInt(job.ChatID, 10, 64)
+	if err != nil {
+		fmt.Printf("Invalid Telegram chat ID %s for job %s\n", job.ChatID, job.ID)
+		return
+	}
+
+	text := fmt.Sprintf("Document %s is processed and ready for questions.", job.Filename)
+	if job.Replace {
+		text = fmt.Sprintf("Document %s is updated and ready for questions.", job.Filename)
+	}
+	if job.DuplicateOf != "" {
+		text = fmt.Sprintf("Document %s was uploaded before and is ready for questions.", job.Filename)
+	}
+	if job.Status == models.JobFailed {
+		text = fmt.Sprintf("Sorry, processing document %s failed: %s", job.Filename, job.Error)
+		if job.DuplicateOf != "" {
+			text = fmt.Sprintf("Document %s was already uploaded, it was not stored again.", job.Filename)
+		}
+	}
+
+	b := s.GetBot("telegram")
+	if _, ok := b.(bot.TgBot); !ok {
+		return
+	}
+	if err := b.SendReply(&tgbotapi.Message{Chat: &tgbotapi.Chat{ID: chatID}}, text); err != nil {
+		fmt.Printf("Error sending job notice for %s: %v\n", job.ID, err)
+	}
+}
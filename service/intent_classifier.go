@@ -0,0 +1,319 @@
+package service
+
+import (
+	document "crossplatform_chatbot/document_proc"
+	"crossplatform_chatbot/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Intent detection of the Dialogflow mode (INTENT_CLASSIFIER)
+const (
+	IntentClassifierDialogflow = "dialogflow" // DetectIntent API of the Dialogflow agent
+	IntentClassifierLocal      = "local"      // Embeddings of the example utterances in intent_examples
+)
+
+// Intent of the messages the local classifier can't match confidently, as named by Dialogflow.
+// It is not mapped to tags, so these questions are answered from all documents.
+const fallbackIntent = "Default Fallback Intent"
+
+// ErrInvalidIntentExample is returned for examples without intent or utterance
+var ErrInvalidIntentExample = errors.New("an intent and at least one utterance are required")
+
+// Example utterances seeded into an empty table, for the intents of the default tag mapping
+var defaultIntentExamples = map[string][]string{
+	welcomeIntent: {
+		"Hi", "Hello", "Hey there", "Good morning", "Hello, can you help me?",
+	},
+	"FAQ Intent": {
+		"What are your opening hours?", "Do you ship internationally?", "What is your return policy?",
+		"How long does delivery take?", "Where can I find the user manual?",
+	},
+	"Product Inquiry Intent": {
+		"What are the specifications of this product?", "How much does it cost?", "Is this model compatible with my device?",
+		"What is the difference between the two models?", "Is the product in stock?",
+	},
+	"Troubleshooting Intent": {
+		"My device won't turn on", "I get an error when I start the app", "It keeps disconnecting from the network",
+		"The screen is frozen", "Why does it not work anymore?",
+	},
+	"Installation Intent": {
+		"How do I install the software?", "How do I set up my device?", "The installation fails",
+		"How do I configure it for the first time?", "What are the installation requirements?",
+	},
+}
+
+// intentDetection is the intent detected for a message
+type intentDetection struct {
+	Intent     string
+	Confidence float64             // Dialogflow intent detection confidence, or the similarity of the local match
+	Parameters map[string][]string // Entity values extracted by Dialogflow, e.g. product or order_id
+	Language   string              // Language code of the query, empty when unknown or the default language
+}
+
+// localIntents holds the trained local classifier, replaced after every change of the examples
+type localIntents struct {
+	mu         sync.RWMutex
+	classifier *document.IntentClassifier
+}
+
+func (l *localIntents) get() *document.IntentClassifier {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.classifier
+}
+
+func (l *localIntents) set(classifier *document.IntentClassifier) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.classifier = classifier
+}
+
+// detectIntent detects the intent of the message with the configured classifier
+func (s *Service) detectIntent(sessionID, message string) (intentDetection, error) {
+	if s.botConfig.IntentClassifier == IntentClassifierLocal {
+		return s.classifyIntent(message)
+	}
+
+	response, err := s.fetchDialogflowResponse(sessionID, message)
+	if err != nil {
+		return intentDetection{}, err
+	}
+	return s.detectionFromQueryResult(response.GetQueryResult()), nil
+}
+
+// classifyIntent matches the message embedding against the example utterances. Messages no intent
+// is similar enough to get the fallback intent.
+func (s *Service) classifyIntent(message string) (intentDetection, error) {
+	classifier := s.intents.get()
+	if classifier == nil || classifier.Len() == 0 {
+		// The examples couldn't be embedded at startup
+		if err := s.trainIntentClassifier(); err != nil {
+			return intentDetection{}, err
+		}
+		if classifier = s.intents.get(); classifier.Len() == 0 {
+			return intentDetection{}, errors.New("no intent examples to classify with")
+		}
+	}
+
+	embedding, err := s.aiClients.OpenAI.EmbedText(message)
+	if err != nil {
+		return intentDetection{}, fmt.Errorf("error embedding message: %w", err)
+	}
+	match, ok := classifier.Classify(embedding)
+	if !ok {
+		fmt.Printf("No intent above the threshold (best %q at %.4f)\n", match.Intent, match.Confidence)
+		return intentDetection{Intent: fallbackIntent, Confidence: match.Confidence}, nil
+	}
+	return intentDetection{Intent: match.Intent, Confidence: match.Confidence}, nil
+}
+
+// newIntentClassifier creates an untrained classifier from the configuration
+func (s *Service) newIntentClassifier() (*document.IntentClassifier, error) {
+	conf := s.botConfig
+	if conf.IntentClassifier != IntentClassifierDialogflow && conf.IntentClassifier != IntentClassifierLocal {
+		return nil, fmt.Errorf("unknown intent classifier %q (expected %s or %s)", conf.IntentClassifier,
+			IntentClassifierDialogflow, IntentClassifierLocal)
+	}
+	return document.NewIntentClassifier(conf.IntentMatch, conf.IntentNeighbors, conf.IntentThreshold)
+}
+
+// initIntentClassifier creates the intent examples table, seeds or imports the examples and, with the
+// local classifier, trains it. A training failure is retried with the first message.
+func (s *Service) initIntentClassifier() error {
+	if _, err := s.newIntentClassifier(); err != nil {
+		return err
+	}
+	if err := s.migrateIntentExamples(); err != nil {
+		return err
+	}
+	if s.botConfig.IntentExamplesFile != "" {
+		if err := s.importIntentExamples(s.botConfig.IntentExamplesFile); err != nil {
+			return err
+		}
+	}
+
+	if s.botConfig.IntentClassifier == IntentClassifierLocal {
+		if err := s.trainIntentClassifier(); err != nil {
+			fmt.Printf("Error training intent classifier: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// migrateIntentExamples creates the intent examples table and seeds it when it's empty and no examples file is set
+func (s *Service) migrateIntentExamples() error {
+	db := s.database.GetDB()
+	if err := db.AutoMigrate(&models.IntentExample{}); err != nil {
+		return fmt.Errorf("error migrating intent examples: %w", err)
+	}
+	if s.botConfig.IntentExamplesFile != "" {
+		return nil
+	}
+
+	var count int64
+	if err := db.Model(&models.IntentExample{}).Count(&count).Error; err != nil {
+		return fmt.Errorf("error counting intent examples: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+	seeded, err := s.insertIntentExamples(defaultIntentExamples)
+	if err != nil {
+		return fmt.Errorf("error seeding intent examples: %w", err)
+	}
+	fmt.Printf("Seeded %d intent examples\n", seeded)
+	return nil
+}
+
+// importIntentExamples adds the examples of a JSON file mapping intents to utterances, keeping the stored ones
+func (s *Service) importIntentExamples(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading intent examples: %w", err)
+	}
+	var examples map[string][]string
+	if err := json.Unmarshal(data, &examples); err != nil {
+		return fmt.Errorf("error parsing intent examples %s: %w", path, err)
+	}
+	added, err := s.insertIntentExamples(examples)
+	if err != nil {
+		return fmt.Errorf("error importing intent examples: %w", err)
+	}
+	fmt.Printf("Imported %d new intent examples from %s\n", added, path)
+	return nil
+}
+
+// insertIntentExamples stores the new utterances of each intent and returns how many were added
+func (s *Service) insertIntentExamples(examples map[string][]string) (int64, error) {
+	var rows []models.IntentExample
+	for intent, utterances := range examples {
+		intent = strings.TrimSpace(intent)
+		for _, utterance := range utterances {
+			if utterance = strings.TrimSpace(utterance); intent != "" && utterance != "" {
+				rows = append(rows, models.IntentExample{Intent: intent, Utterance: utterance})
+			}
+		}
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	result := s.database.GetDB().Clauses(clause.OnConflict{DoNothing: true}).Create(&rows)
+	return result.RowsAffected, result.Error
+}
+
+// trainIntentClassifier embeds the examples stored without embedding and retrains the local classifier
+func (s *Service) trainIntentClassifier() error {
+	classifier, err := s.newIntentClassifier()
+	if err != nil {
+		return err
+	}
+
+	db := s.database.GetDB()
+	var examples []models.IntentExample
+	if err := db.Order("id").Find(&examples).Error; err != nil {
+		return fmt.Errorf("error retrieving intent examples: %w", err)
+	}
+
+	var missing []int
+	for i, example := range examples {
+		if len(example.Embedding) == 0 {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) > 0 {
+		texts := make([]string, len(missing))
+		for i, index := range missing {
+			texts[i] = examples[index].Utterance
+		}
+		embeddings, err := s.aiClients.OpenAI.EmbedTexts(texts, nil)
+		if err != nil {
+			return fmt.Errorf("error embedding intent examples: %w", err)
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			for i, index := range missing {
+				examples[index].Embedding = pq.Float64Array(embeddings[i])
+				if err := tx.Model(&models.IntentExample{}).Where("id = ?", examples[index].ID).
+					Update("embedding", examples[index].Embedding).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("error storing intent example embeddings: %w", err)
+		}
+		fmt.Printf("Embedded %d intent examples\n", len(missing))
+	}
+
+	byIntent := make(map[string][][]float64)
+	for _, example := range examples {
+		byIntent[example.Intent] = append(byIntent[example.Intent], example.Embedding)
+	}
+	classifier.Train(byIntent)
+	s.intents.set(classifier)
+	fmt.Printf("Intent classifier trained with %d examples of %d intents\n", len(examples), classifier.Len())
+	return nil
+}
+
+// retrainIntentClassifier trains the local classifier again after the examples changed
+func (s *Service) retrainIntentClassifier() {
+	if s.botConfig.IntentClassifier != IntentClassifierLocal {
+		return
+	}
+	if err := s.trainIntentClassifier(); err != nil {
+		fmt.Printf("Error training intent classifier: %v\n", err)
+	}
+}
+
+// GetIntentExamples returns the example utterances of an intent, or of all intents when intent is empty
+func (s *Service) GetIntentExamples(intent string) ([]models.IntentExample, error) {
+	query := s.database.GetDB().Order("intent").Order("id")
+	if intent != "" {
+		query = query.Where("intent = ?", intent)
+	}
+	var examples []models.IntentExample
+	if err := query.Find(&examples).Error; err != nil {
+		return nil, fmt.Errorf("error retrieving intent examples: %w", err)
+	}
+	return examples, nil
+}
+
+// AddIntentExamples adds example utterances to an intent, creating the intent for the local classifier.
+// Utterances already stored for the intent are ignored. Returns the examples of the intent.
+func (s *Service) AddIntentExamples(intent string, utterances []string) ([]models.IntentExample, error) {
+	intent = strings.TrimSpace(intent)
+	if intent == "" || !slices.ContainsFunc(utterances, func(u string) bool { return strings.TrimSpace(u) != "" }) {
+		return nil, ErrInvalidIntentExample
+	}
+	added, err := s.insertIntentExamples(map[string][]string{intent: utterances})
+	if err != nil {
+		return nil, fmt.Errorf("error saving examples of intent %s: %w", intent, err)
+	}
+	if added > 0 {
+		s.retrainIntentClassifier()
+	}
+	return s.GetIntentExamples(intent)
+}
+
+// DeleteIntentExample removes an example utterance. gorm.ErrRecordNotFound is returned for unknown IDs.
+func (s *Service) DeleteIntentExample(id uint) error {
+	result := s.database.GetDB().Delete(&models.IntentExample{}, id)
+	if result.Error != nil {
+		return fmt.Errorf("error deleting intent example %d: %w", id, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("intent example %d: %w", id, gorm.ErrRecordNotFound)
+	}
+	s.retrainIntentClassifier()
+	return nil
+}
@@ -1,114 +1,163 @@
 package service
 
 import (
+	"crossplatform_chatbot/ai_clients/chat"
 	"crossplatform_chatbot/bot"
-	document "crossplatform_chatbot/document_proc"
 	"fmt"
 	"log"
 	"strings"
 )
 
-func (s *Service) processUserMessage(chatID, message, botTag string) (string, string, []string, []float64, error) { //TODO add username?
+// StreamHandlers holds the callbacks used to stream the processing of a message to the client
+type StreamHandlers struct {
+	OnChunks func(chunkIDs []string, chunkScores []float64) error // Called once the context chunks are retrieved
+	OnToken  chat.TokenHandler                                    // Called for every token of the generated response
+}
+
+func (s *Service) processUserMessage(chatID, message, botTag string) (*MessageResult, error) { //TODO add username?
+	return s.processUserMessageStream(chatID, message, botTag, nil)
+}
+
+// processUserMessageStream processes the message like processUserMessage, reporting the retrieved chunks
+// and the response tokens through the stream handlers as they become available (if handlers is not nil).
+func (s *Service) processUserMessageStream(chatID, message, botTag string, handlers *StreamHandlers) (*MessageResult, error) {
 	fmt.Printf("Received message: %s from %s \n", message, botTag)
 	fmt.Printf("Chat ID: %s\n", chatID)
 
 	b := s.GetBot(botTag)
 	baseBot := b.Base()
 
-	var response string
-	var intent string
-	var topChunkIDs []string
-	var topChunkScores []float64
+	result := &MessageResult{}
 
 	if strings.HasPrefix(message, "/") {
 		// Handle commands.
-		response = baseBot.HandleCommand(message)
+		result.Response = baseBot.HandleCommand(message)
+		if err := streamWholeResponse(handlers, result.Response); err != nil {
+			return nil, err
+		}
 	} else if s.botConfig.Screaming && len(message) > 0 {
 		// Example of simple transformation.
-		response = strings.ToUpper(message)
-	} else {
-		// Fetch embeddings and process the message.
-		documentEmbeddings, chunkText, err := s.repository.FetchEmbeddings()
-		if err != nil {
-			return "Error retrieving document embeddings.", "", nil, nil, err
+		result.Response = strings.ToUpper(message)
+		if err := streamWholeResponse(handlers, result.Response); err != nil {
+			return nil, err
 		}
-
+	} else {
 		// Fetch conversation history from Redis
-		history, err := s.getConversationHistory(chatID, 5) // Retrieve the last 5 messages TODO
+		history, err := s.getConversationHistory(chatID, 5) // Retrieve the last 5 exchanges TODO
 		if err != nil {
 			log.Printf("Error retrieving conversation history: %v", err)
-			history = "" // Default to no history
+			history = nil // Default to no history
 		}
 
+		// Only the documents in the scope of the session are searched
+		filter := s.sessionFilter(chatID)
+
 		if !s.botConfig.UseDialogflow {
-			// Retrieve top relevant chunks.
-			topChunks, err := document.RetrieveTopNChunks(message, documentEmbeddings, s.aiClients.OpenAI, s.embConfig.NumTopChunks, chunkText, s.embConfig.ScoreThreshold)
+			result.Chunks, err = s.retrieveTopChunks(s.retriever, message, filter)
 			if err != nil {
-				return "Error retrieving related document information.", "", nil, nil, err
-			}
-			prompt := ""
-
-			if len(topChunks) > 0 {
-				// Extract chunk IDs and scores
-				var contextBuilder []string
-				for _, chunk := range topChunks {
-					contextBuilder = append(contextBuilder, chunk.Text)
-					topChunkIDs = append(topChunkIDs, chunk.ChunkID)
-					topChunkScores = append(topChunkScores, chunk.Score)
-				}
-
-				// Use chunks as context for OpenAI.
-				context := strings.Join(contextBuilder, "\n")
-				//prompt := fmt.Sprintf("Context:\n%s\nUser query: %s", context, message)
-				prompt = fmt.Sprintf("Conversation history:\n%s\n\nContext:\n%s\nUser query: %s", history, context, message)
-
-			} else {
-				// Fallback to OpenAI response with history but without context.
-				prompt = fmt.Sprintf("Conversation history:\n%s\nUser query: %s", history, message)
-			}
-			//response, err = baseBot.GetOpenAIResponse(prompt)
-			response, err = s.generateResponse(prompt, baseBot)
-			if err != nil {
-				return fmt.Sprintf("Error: %v", err), "", nil, nil, err
+				return nil, fmt.Errorf("error retrieving related document information: %w", err)
 			}
 		} else {
 			// Fallback to dialogflow or another approach.
-			//response, err = s.HandleMessageDialogflow(sessionID, message)
-			prompt := ""
-			prompt, intent, topChunkIDs, topChunkScores, err = s.handleMessageDialogflow(chatID, message, history)
+			var detection intentDetection
+			result.Chunks, detection, err = s.handleMessageDialogflow(chatID, message, filter)
 			if err != nil {
-				return "Error processing with Dialogflow.", "", nil, nil, err
+				return nil, fmt.Errorf("error processing with Dialogflow: %w", err)
 			}
+			result.Intent, result.Language = detection.Intent, detection.Language
+		}
 
-			//response, err = baseBot.GetOpenAIResponse(prompt)
-			response, err = s.generateResponse(prompt, baseBot)
-			if err != nil {
-				return "", "", nil, nil, fmt.Errorf("error generating response: %v", err)
+		if handlers != nil && handlers.OnChunks != nil {
+			if err := handlers.OnChunks(result.ChunkIDs(), result.ChunkScores()); err != nil {
+				return nil, err
 			}
 		}
 
+		if err := s.answerWithContext(chatID, message, botTag, history, result, handlers, true); err != nil {
+			return nil, err
+		}
 	}
 
-	err := s.saveConversation(chatID, message, response)
+	err := s.saveConversation(chatID, message, result.Response)
 	if err != nil {
-		return "Error saving to Redis.", "", nil, nil, err
+		return nil, fmt.Errorf("error saving to Redis: %w", err)
 	}
 
-	return response, intent, topChunkIDs, topChunkScores, nil
+	return result, nil
 }
 
-func (s *Service) generateResponse(prompt string, b *bot.BaseBot) (string, error) {
-	if s.botConfig.UseOpenAI {
-		return b.GetOpenAIResponse(prompt)
-		//return s.aiClients.OpenAI.GetResponse(prompt)
-	} else if s.botConfig.UseMistral {
-		return b.GetMistralResponse(prompt)
-		//return s.aiClients.Mistral.GetResponse(prompt)
-	} else if s.botConfig.UseMETA {
-		return b.GetTogetherAIResponse(prompt)
-		//return s.aiClients.TogetherAI.GetResponse(prompt)
-	} /*else if s.botConfig.UseHuggingFace {
-		return s.aiClients.HuggingFace.GetResponse(prompt)
-	}*/
-	return "", fmt.Errorf("error: No AI provider is enabled in the configuration")
+// answerWithContext generates the response to the message from the retrieved chunks in the result, applying
+// the no-context policy and, when checkGrounding is set, the grounding check, and maps the citations of the
+// response to their sources
+func (s *Service) answerWithContext(chatID, message, botTag string, history []chat.Message, result *MessageResult, handlers *StreamHandlers, checkGrounding bool) error {
+	baseBot := s.GetBot(botTag).Base()
+
+	noContext := len(result.Chunks) == 0 && result.Intent != welcomeIntent
+	policy := s.botConfig.NoContextPolicy
+
+	if noContext && (policy == NoContextCanned || policy == NoContextHandoff) {
+		// Do not let the model answer without documentation
+		s.replyWithoutContext(chatID, message, botTag, result)
+		return streamWholeResponse(handlers, result.Response)
+	}
+
+	// In rewrite mode the checked answer may replace the generated one, so it is sent whole after the check
+	// instead of streaming tokens the client would have to take back
+	buffered := checkGrounding && s.botConfig.GroundingCheck == GroundingRewrite && len(result.Chunks) > 0
+	streamHandlers := handlers
+	if buffered {
+		streamHandlers = nil
+	}
+
+	// Without context the response falls back to history only.
+	var err error
+	messages := buildMessages(history, buildContext(result.Chunks), message, result.Language)
+	if streamHandlers != nil && streamHandlers.OnToken != nil {
+		result.Response, err = s.generateResponseStream(messages, baseBot, streamHandlers.OnToken)
+	} else {
+		result.Response, err = s.generateResponse(messages, baseBot)
+	}
+	if err != nil {
+		return fmt.Errorf("error generating response: %v", err)
+	}
+
+	if noContext && policy == NoContextDisclaimer {
+		err = appendToResponse(result, streamHandlers, s.botConfig.NoContextDisclaimer)
+	} else if checkGrounding {
+		err = s.verifyGrounding(result, streamHandlers)
+	}
+	if err == nil && buffered {
+		err = streamWholeResponse(handlers, result.Response)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Map the [n] citations in the response back to the retrieved chunks
+	result.Sources = parseCitations(result.Response, result.Chunks)
+	return nil
+}
+
+// streamWholeResponse sends a response that was not generated by a model as a single token
+func streamWholeResponse(handlers *StreamHandlers, response string) error {
+	if handlers == nil || handlers.OnToken == nil {
+		return nil
+	}
+	return handlers.OnToken(response)
+}
+
+// generateResponse sends the messages to the AI provider currently selected in the bot config
+func (s *Service) generateResponse(messages []chat.Message, b *bot.BaseBot) (string, error) {
+	if s.botConfig.AIProvider == "" {
+		return "", fmt.Errorf("error: No AI provider is enabled in the configuration")
+	}
+	return b.GetAIResponse(s.botConfig.AIProvider, messages)
+}
+
+// generateResponseStream streams the response of the AI provider currently selected in the bot config
+func (s *Service) generateResponseStream(messages []chat.Message, b *bot.BaseBot, onToken chat.TokenHandler) (string, error) {
+	if s.botConfig.AIProvider == "" {
+		return "", fmt.Errorf("error: No AI provider is enabled in the configuration")
+	}
+	return b.GetAIResponseStream(s.botConfig.AIProvider, messages, onToken)
 }
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"crossplatform_chatbot/ai_clients/chat"
+	document "crossplatform_chatbot/document_proc"
+	"fmt"
+	"strings"
+)
+
+// Instructions given to the model in the system message
+const systemInstructions = "You are a helpful customer and technical support assistant. " +
+	"Answer the user's question clearly and concisely. " +
+	"When document context is provided, base your answer on it and do not make up details that are not in the context."
+
+// Added to the instructions when context is provided
+const citationInstructions = "The context passages are numbered. " +
+	"Cite the passages your answer relies on with their number in square brackets, e.g. [1] or [2][3]."
+
+// Added to the instructions when the query is in another language than the agent default
+const languageInstructions = "Write your answer in the language with the code %q, whatever the language of the context."
+
+// buildMessages builds the chat message list sent to the AI provider:
+// a system message with the instructions and retrieved context, the prior turns, and the current user query.
+// language is the code of the language of the answer, empty to let the model follow the user.
+func buildMessages(history []chat.Message, context, userMessage, language string) []chat.Message {
+	systemPrompt := systemInstructions
+	if language != "" {
+		systemPrompt += " " + fmt.Sprintf(languageInstructions, language)
+	}
+	if context != "" {
+		systemPrompt = fmt.Sprintf("%s %s\n\nContext:\n%s", systemPrompt, citationInstructions, context)
+	}
+
+	messages := make([]chat.Message, 0, len(history)+2)
+	messages = append(messages, chat.Message{Role: chat.RoleSystem, Content: systemPrompt})
+	messages = append(messages, history...)
+	messages = append(messages, chat.Message{Role: chat.RoleUser, Content: userMessage})
+
+	return messages
+}
+
+// buildContext numbers the retrieved chunks so the model can cite them as [1], [2], ...
+func buildContext(chunks []document.ScoredChunk) string {
+	var context strings.Builder
+	for i, chunk := range chunks {
+		if i > 0 {
+			context.WriteString("\n\n")
+		}
+		fmt.Fprintf(&context, "[%d] (%s)\n%s", i+1, chunk.Filename, chunk.Text)
+	}
+	return context.String()
+}
@@ -2,6 +2,9 @@ package service
 
 import (
 	"context"
+	"crossplatform_chatbot/ai_clients/chat"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
@@ -33,23 +36,83 @@ func initRedis(redisConfig config.RedisConfig) *redis.Client {
 	return client
 }
 
+// saveConversation stores the user message and bot response as two role-tagged entries
 func (s *Service) saveConversation(chatID, userMessage, botResponse string) error {
 	ctx := context.Background()
 	key := "conversation:" + chatID // Use chat/session ID as the key
-	entry := fmt.Sprintf("User: %s\nBot: %s", userMessage, botResponse)
-	return s.redisClient.RPush(ctx, key, entry).Err()
+
+	entries := make([]interface{}, 0, 2)
+	for _, msg := range []chat.Message{
+		{Role: chat.RoleUser, Content: userMessage},
+		{Role: chat.RoleAssistant, Content: botResponse},
+	} {
+		entry, err := json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("error encoding conversation entry: %v", err)
+		}
+		entries = append(entries, string(entry))
+	}
+	return s.redisClient.RPush(ctx, key, entries...).Err()
 }
 
-func (s *Service) getConversationHistory(chatID string, limit int64) (string, error) {
+// getConversationHistory returns the last `limit` exchanges as alternating user/assistant messages
+func (s *Service) getConversationHistory(chatID string, limit int64) ([]chat.Message, error) {
 	ctx := context.Background()
 	key := "conversation:" + chatID
 
-	// Fetch the last `limit` entries
-	history, err := s.redisClient.LRange(ctx, key, -limit, -1).Result()
+	// Fetch the last `limit` exchanges (each exchange holds a user and an assistant entry)
+	entries, err := s.redisClient.LRange(ctx, key, -limit*2, -1).Result()
 	if err != nil {
-		return "", fmt.Errorf("failed to retrieve conversation history from Redis: %v", err)
+		return nil, fmt.Errorf("failed to retrieve conversation history from Redis: %v", err)
+	}
+
+	history := make([]chat.Message, 0, len(entries))
+	for _, entry := range entries {
+		history = append(history, parseConversationEntry(entry)...)
+	}
+
+	// Drop a leading assistant message left over from cutting an exchange in half
+	if len(history) > 0 && history[0].Role == chat.RoleAssistant {
+		history = history[1:]
+	}
+	return history, nil
+}
+
+// parseConversationEntry decodes a stored entry, including the legacy "User: ...\nBot: ..." format
+func parseConversationEntry(entry string) []chat.Message {
+	var msg chat.Message
+	if err := json.Unmarshal([]byte(entry), &msg); err == nil && msg.Role != "" {
+		return []chat.Message{msg}
+	}
+
+	userPart, botPart, found := strings.Cut(entry, "\nBot: ")
+	if !found {
+		return nil
+	}
+	return []chat.Message{
+		{Role: chat.RoleUser, Content: strings.TrimPrefix(userPart, "User: ")},
+		{Role: chat.RoleAssistant, Content: botPart},
+	}
+}
+
+// saveSessionFilter stores the filter expression scoping the document search of the chat, an empty one removes it
+func (s *Service) saveSessionFilter(chatID, expression string) error {
+	ctx := context.Background()
+	key := "filter:" + chatID
+	if expression == "" {
+		return s.redisClient.Del(ctx, key).Err()
 	}
+	return s.redisClient.Set(ctx, key, expression, 0).Err()
+}
 
-	// Combine the entries into a single string
-	return strings.Join(history, "\n"), nil
+// getSessionFilter returns the filter expression of the chat, empty when the chat has none
+func (s *Service) getSessionFilter(chatID string) (string, error) {
+	expression, err := s.redisClient.Get(context.Background(), "filter:"+chatID).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve session filter from Redis: %v", err)
+	}
+	return expression, nil
 }
@@ -2,28 +2,39 @@ package service
 
 import (
 	"crossplatform_chatbot/ai_clients"
-	"crossplatform_chatbot/ai_clients/huggingface"
-	"crossplatform_chatbot/ai_clients/mistral"
-	"crossplatform_chatbot/ai_clients/openai"
-	"crossplatform_chatbot/ai_clients/togetherai"
 	"crossplatform_chatbot/bot"
 	config "crossplatform_chatbot/configs"
 	"crossplatform_chatbot/database"
+	document "crossplatform_chatbot/document_proc"
 	"crossplatform_chatbot/repository"
+	"crossplatform_chatbot/vectorstore"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
 type Service struct {
-	bots        map[string]bot.Bot
-	database    database.Database
-	repository  repository.DAO
-	redisClient *redis.Client
-	botConfig   *config.BotConfig
-	embConfig   config.EmbeddingConfig
-	aiClients   ai_clients.AIClients
+	bots         map[string]bot.Bot
+	database     database.Database
+	repository   repository.DAO
+	redisClient  *redis.Client
+	botConfig    *config.BotConfig
+	embConfig    config.EmbeddingConfig
+	aiClients    ai_clients.AIClients
+	vectorStore  vectorstore.VectorStore
+	lexicalIndex *document.BM25Index
+	retriever    *document.Retriever
+	chunker      document.Chunker
+	crawler      *document.WebCrawler
+	taxonomy     tagTaxonomy // Tags and intent mapping, loaded from the database
+	ingestQueue  chan string // IDs of the document ingestion jobs waiting for a worker
+
+	intents    localIntents       // Local intent classifier trained on the example utterances
+	dialogflow dialogflowSessions // Dialogflow client shared by all sessions
+
+	fulfillmentRetriever *document.Retriever // Retriever without the LLM reranker, for the Dialogflow webhook
 }
 
 func NewService(botConfig *config.BotConfig, embConfig *config.EmbeddingConfig, redisConfig config.RedisConfig, db database.Database) *Service {
@@ -31,13 +42,8 @@ func NewService(botConfig *config.BotConfig, embConfig *config.EmbeddingConfig,
 	dao := repository.NewDAO(db)
 	redisClient := initRedis(redisConfig)
 
-	// Initialize all AI clients and store them in the unified struct
-	aiClients := ai_clients.AIClients{
-		OpenAI:      openai.NewClient(),
-		HuggingFace: huggingface.NewClient(),
-		Mistral:     mistral.NewClient(),
-		TogetherAI:  togetherai.NewClient(),
-	}
+	// Initialize all AI clients and register the chat providers
+	aiClients := ai_clients.NewAIClients()
 
 	// Create a temporary Service instance to access methods like getOrInitializeTagEmbeddings
 	svc := &Service{
@@ -49,12 +55,89 @@ func NewService(botConfig *config.BotConfig, embConfig *config.EmbeddingConfig,
 		embConfig:   *embConfig,
 	}
 
+	svc.initDocumentPipeline(embConfig)
+
+	// Keep the indexes up to date with the documents changed by the ingest command and the other servers
+	if err := svc.listenDocumentChanges(config.GetConfig().ServerConfig.DBString); err != nil {
+		log.Fatalf("Failed to listen to document changes: %v", err)
+	}
+
+	// Intent detection of the Dialogflow mode, by Dialogflow or by the local classifier
+	if err := svc.initIntentClassifier(); err != nil {
+		log.Fatalf("Failed to initialize intent classifier: %v", err)
+	}
+
 	// Now create bots (with the updated embConfig if using emb based tagging)
 	svc.bots = createBots(botConfig, *embConfig, aiClients, db, dao)
 
+	// Start the workers processing uploaded documents in the background (after the bots, which send the completion notices)
+	if err := svc.startIngestWorkers(embConfig.IngestWorkers, embConfig.IngestQueueSize); err != nil {
+		log.Fatalf("Failed to start document ingestion workers: %v", err)
+	}
+
 	return svc
 }
 
+// NewIngestService creates a service for the ingest command. Documents are processed and stored as by the server,
+// without the bots, Redis and the ingestion workers.
+func NewIngestService(botConfig *config.BotConfig, embConfig *config.EmbeddingConfig, db database.Database) *Service {
+	svc := &Service{
+		database:   db,
+		repository: repository.NewDAO(db),
+		aiClients:  ai_clients.NewAIClients(),
+		botConfig:  botConfig,
+		embConfig:  *embConfig,
+	}
+	svc.initDocumentPipeline(embConfig)
+	return svc
+}
+
+// initDocumentPipeline migrates the document tables and sets up extraction, chunking and the search indexes
+func (s *Service) initDocumentPipeline(embConfig *config.EmbeddingConfig) {
+	// Add the document version history before anything reads or writes chunks
+	if err := s.migrateDocumentVersions(); err != nil {
+		log.Fatalf("Failed to migrate document versions: %v", err)
+	}
+	if err := s.migrateContentHashes(); err != nil {
+		log.Fatalf("Failed to migrate chunk content hashes: %v", err)
+	}
+	if err := s.migrateChunkHeadings(); err != nil {
+		log.Fatalf("Failed to migrate chunk heading paths: %v", err)
+	}
+	if err := s.migrateChunkMetadata(); err != nil {
+		log.Fatalf("Failed to migrate chunk metadata: %v", err)
+	}
+
+	// Tags applied by auto-tagging and searched for each Dialogflow intent
+	if err := validTagStrategy(embConfig.TagStrategy); err != nil {
+		log.Fatalf("Invalid tagging configuration: %v", err)
+	}
+	if err := s.initTagTaxonomy(); err != nil {
+		log.Fatalf("Failed to load tag taxonomy: %v", err)
+	}
+
+	// PDF text is extracted in Go, the Python script only runs OCR on scanned pages when enabled
+	document.SetPDFExtractor(document.NewPDFExtractor(embConfig.PDFOCRFallback, embConfig.PDFOCRPython, embConfig.PDFOCRScript))
+
+	// Chunking strategy used for uploaded documents
+	chunker, err := newChunker(*embConfig)
+	if err != nil {
+		log.Fatalf("Failed to create document chunker: %v", err)
+	}
+	s.chunker = chunker
+
+	// Crawler fetching the web pages and sitemaps ingested by URL
+	s.crawler = document.NewWebCrawler(embConfig.WebCrawlUserAgent, time.Duration(embConfig.WebCrawlDelayMs)*time.Millisecond)
+	if embConfig.WebCrawlAllowPrivate {
+		s.crawler.AllowPrivateAddresses()
+	}
+
+	// Initialize the vector store used for chunk retrieval
+	if err := s.initVectorStore(*embConfig); err != nil {
+		log.Fatalf("Failed to initialize vector store: %v", err)
+	}
+}
+
 func (s *Service) RunBots() error {
 
 	for _, bot := range s.bots {
@@ -0,0 +1,384 @@
+package service
+
+import (
+	document "crossplatform_chatbot/document_proc"
+	"crossplatform_chatbot/models"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrUnknownTag is returned when an intent is mapped to a tag that is not in the taxonomy
+	ErrUnknownTag = errors.New("unknown tag")
+	// ErrInvalidTag is returned for empty tag names and names containing commas, the separator of tag lists
+	ErrInvalidTag = errors.New("invalid tag name")
+	// ErrInvalidThreshold is returned for tag thresholds outside the range of cosine similarities
+	ErrInvalidThreshold = errors.New("threshold must be between -1 and 1")
+)
+
+// Taxonomy seeded into an empty database, the tags and intent mapping the bot was first deployed with
+var (
+	defaultTags = []models.Tag{
+		{Name: "Account & Billing", Description: "Accounts, sign-in, subscriptions, invoices, payments and refunds"},
+		{Name: "FAQs", Description: "Frequently asked questions and short general answers"},
+		{Name: "Feedback & Contact Support", Description: "Contacting customer support, opening tickets and sending feedback"},
+		{Name: "Installation & Setup", Description: "Installing, configuring and setting up products for the first time"},
+		{Name: "Order Status & Tracking", Description: "Order confirmation, order status and shipment tracking"},
+		{Name: "Product Information", Description: "Product features, specifications, pricing and compatibility"},
+		{Name: "Security & Privacy", Description: "Account security, passwords, data protection and privacy policies"},
+		{Name: "Shipping & Returns", Description: "Shipping options, delivery times, returns, exchanges and warranties"},
+		{Name: "Software Updates & Maintenance", Description: "Software and firmware updates, release notes and maintenance"},
+		{Name: "Technical Troubleshooting", Description: "Diagnosing errors, malfunctions and other technical problems"},
+		{Name: "User Guide & How-To", Description: "Step by step instructions for using the product"},
+	}
+	defaultIntentTags = []models.IntentTags{
+		{Intent: "FAQ Intent", Tags: pq.StringArray{"FAQs", "Product Information", "User Guide & How-To", "Shipping & Returns"}},
+		{Intent: "Product Inquiry Intent", Tags: pq.StringArray{"Product Information", "Account & Billing", "Order Status & Tracking", "Shipping & Returns"}},
+		{Intent: "Troubleshooting Intent", Tags: pq.StringArray{"Technical Troubleshooting", "Installation & Setup", "Security & Privacy"}},
+		{Intent: "Installation Intent", Tags: pq.StringArray{"Installation & Setup"}},
+	}
+)
+
+// tagTaxonomy is the in-memory copy of the tags and intent mapping stored in Postgres,
+// reloaded after every change made through the admin API
+type tagTaxonomy struct {
+	mu         sync.RWMutex
+	tags       map[string]string    // Descriptions by tag name
+	names      map[string]string    // Tag names by normalized name
+	intents    map[string][]string  // Tags searched for each intent
+	thresholds map[string]float64   // Similarity thresholds of the tags that override DOC_TAG_THRESHOLD
+	embeddings map[string][]float64 // Embeddings of the tag descriptions
+}
+
+func (t *tagTaxonomy) set(tags []models.Tag, intents []models.IntentTags) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tags = make(map[string]string, len(tags))
+	t.names = make(map[string]string, len(tags))
+	t.thresholds = make(map[string]float64)
+	for _, tag := range tags {
+		t.tags[tag.Name] = tag.Description
+		t.names[normalizeTag(tag.Name)] = tag.Name
+		if tag.Threshold != nil {
+			t.thresholds[tag.Name] = *tag.Threshold
+		}
+	}
+	for name := range t.embeddings {
+		if _, ok := t.tags[name]; !ok {
+			delete(t.embeddings, name)
+		}
+	}
+	t.intents = make(map[string][]string, len(intents))
+	for _, intent := range intents {
+		t.intents[intent.Intent] = intent.Tags
+	}
+}
+
+// descriptions returns a copy of the tag descriptions by tag name
+func (t *tagTaxonomy) descriptions() map[string]string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	descriptions := make(map[string]string, len(t.tags))
+	for name, description := range t.tags {
+		descriptions[name] = description
+	}
+	return descriptions
+}
+
+// setEmbeddings replaces the tag embeddings, keeping those of the tags in the taxonomy
+func (t *tagTaxonomy) setEmbeddings(embeddings map[string][]float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.embeddings = make(map[string][]float64, len(embeddings))
+	for name, embedding := range embeddings {
+		if _, ok := t.tags[name]; ok {
+			t.embeddings[name] = embedding
+		}
+	}
+}
+
+// relevantTags returns the tags whose embeddings are similar enough to the chunk embedding, best first
+func (t *tagTaxonomy) relevantTags(chunkEmbedding []float64, defaultThreshold float64, maxTags int) []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return document.GetRelevantTags(chunkEmbedding, t.embeddings, t.thresholds, defaultThreshold, maxTags)
+}
+
+// hasEmbeddings reports whether the tag embeddings are loaded
+func (t *tagTaxonomy) hasEmbeddings() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.embeddings) > 0
+}
+
+// tagsForIntent returns the tags of the documents searched for the intent, nil for unmapped intents
+func (t *tagTaxonomy) tagsForIntent(intent string) []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]string(nil), t.intents[intent]...)
+}
+
+// canonical maps the tags to their names in the taxonomy, ignoring case and spacing.
+// Tags outside the taxonomy are returned separately.
+func (t *tagTaxonomy) canonical(tags []string) (known, unknown []string) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, tag := range tags {
+		if strings.TrimSpace(tag) == "" {
+			continue
+		}
+		if name, ok := t.names[normalizeTag(tag)]; ok {
+			known = append(known, name)
+		} else {
+			unknown = append(unknown, tag)
+		}
+	}
+	return known, unknown
+}
+
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.Join(strings.Fields(tag), " "))
+}
+
+// tagEmbeddingText is the text embedded for a tag, matched against chunk embeddings by embedding based tagging
+func tagEmbeddingText(name, description string) string {
+	if description == "" {
+		return name
+	}
+	return name + ": " + description
+}
+
+// migrateTagTaxonomy creates the taxonomy tables and the tag embeddings table, and seeds an empty taxonomy
+func (s *Service) migrateTagTaxonomy() error {
+	db := s.database.GetDB()
+	if err := db.AutoMigrate(&models.Tag{}, &models.IntentTags{}); err != nil {
+		return fmt.Errorf("error migrating tag taxonomy: %w", err)
+	}
+	if err := db.Exec(`CREATE TABLE IF NOT EXISTS tag_embeddings (tag_name text PRIMARY KEY, embedding float8[])`).Error; err != nil {
+		return fmt.Errorf("error creating tag embeddings table: %w", err)
+	}
+
+	var count int64
+	if err := db.Model(&models.Tag{}).Count(&count).Error; err != nil {
+		return fmt.Errorf("error counting tags: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&defaultTags).Error; err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&defaultIntentTags).Error
+	})
+	if err != nil {
+		return fmt.Errorf("error seeding tag taxonomy: %w", err)
+	}
+	fmt.Printf("Seeded the tag taxonomy with %d tags\n", len(defaultTags))
+	return nil
+}
+
+// loadTagTaxonomy reads the tags and the intent mapping into memory
+func (s *Service) loadTagTaxonomy() error {
+	tags, err := s.GetTags()
+	if err != nil {
+		return err
+	}
+	intents, err := s.GetIntentTags()
+	if err != nil {
+		return err
+	}
+	s.taxonomy.set(tags, intents)
+	return nil
+}
+
+// syncTagEmbeddings removes the embeddings of deleted tags and embeds the tags without one.
+// The named tags are embedded again, after their description changed.
+func (s *Service) syncTagEmbeddings(names ...string) error {
+	db := s.database.GetDB()
+	descriptions := s.taxonomy.descriptions()
+	known := make([]string, 0, len(descriptions))
+	for name := range descriptions {
+		known = append(known, name)
+	}
+	if err := db.Exec(`DELETE FROM tag_embeddings WHERE NOT (tag_name = ANY(?::text[]))`, pq.Array(known)).Error; err != nil {
+		return fmt.Errorf("error removing tag embeddings: %w", err)
+	}
+
+	stored, err := s.repository.RetrieveTagEmbeddings()
+	if err != nil {
+		return err
+	}
+	texts := make(map[string]string)
+	for name, description := range descriptions {
+		if _, ok := stored[name]; !ok {
+			texts[name] = tagEmbeddingText(name, description)
+		}
+	}
+	for _, name := range names {
+		if description, ok := descriptions[name]; ok {
+			texts[name] = tagEmbeddingText(name, description)
+		}
+	}
+	if len(texts) == 0 {
+		s.taxonomy.setEmbeddings(stored)
+		return nil
+	}
+
+	embed := func(texts []string) ([][]float64, error) {
+		return s.aiClients.OpenAI.EmbedTexts(texts, nil)
+	}
+	if err := s.repository.StoreTagEmbeddings(texts, embed); err != nil {
+		s.taxonomy.setEmbeddings(stored) // The tags embedded before are still usable
+		return err
+	}
+	fmt.Printf("Embedded %d tags\n", len(texts))
+
+	if stored, err = s.repository.RetrieveTagEmbeddings(); err != nil {
+		return err
+	}
+	s.taxonomy.setEmbeddings(stored)
+	return nil
+}
+
+// initTagTaxonomy migrates and loads the taxonomy. Tag embeddings are refreshed before the first upload
+// when the tagging strategy uses them, in the background otherwise. A failure is retried on the next start.
+func (s *Service) initTagTaxonomy() error {
+	if err := s.migrateTagTaxonomy(); err != nil {
+		return err
+	}
+	if err := s.loadTagTaxonomy(); err != nil {
+		return err
+	}
+
+	embedTags := func() {
+		if err := s.syncTagEmbeddings(); err != nil {
+			fmt.Printf("Error embedding tags: %v\n", err)
+		}
+	}
+	if usesTagEmbeddings(s.embConfig.TagStrategy) {
+		embedTags()
+	} else {
+		go embedTags()
+	}
+	return nil
+}
+
+// GetTags returns the tags of the taxonomy sorted by name
+func (s *Service) GetTags() ([]models.Tag, error) {
+	var tags []models.Tag
+	if err := s.database.GetDB().Order("name").Find(&tags).Error; err != nil {
+		return nil, fmt.Errorf("error retrieving tags: %w", err)
+	}
+	return tags, nil
+}
+
+// SaveTag adds a tag to the taxonomy or updates its description and similarity threshold (nil for
+// DOC_TAG_THRESHOLD). A name differing from an existing tag only in case or spacing updates that tag.
+func (s *Service) SaveTag(name, description string, threshold *float64) (*models.Tag, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" || strings.Contains(name, ",") {
+		return nil, fmt.Errorf("%q: %w", name, ErrInvalidTag)
+	}
+	if known, _ := s.taxonomy.canonical([]string{name}); len(known) == 1 {
+		name = known[0]
+	}
+
+	if threshold != nil && (*threshold < -1 || *threshold > 1) {
+		return nil, fmt.Errorf("threshold %v: %w", *threshold, ErrInvalidThreshold)
+	}
+
+	tag := &models.Tag{Name: name, Description: strings.TrimSpace(description), Threshold: threshold}
+	err := s.database.GetDB().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"description", "threshold", "updated_at"}),
+	}).Create(tag).Error
+	if err != nil {
+		return nil, fmt.Errorf("error saving tag %s: %w", name, err)
+	}
+
+	if err := s.loadTagTaxonomy(); err != nil {
+		return nil, err
+	}
+	if err := s.syncTagEmbeddings(name); err != nil {
+		fmt.Printf("Error embedding tag %s: %v\n", name, err)
+	}
+	return tag, nil
+}
+
+// DeleteTag removes a tag from the taxonomy and from the intent mapping. Documents keep the tag,
+// but are no longer found through it. gorm.ErrRecordNotFound is returned for unknown tags.
+func (s *Service) DeleteTag(name string) error {
+	if known, _ := s.taxonomy.canonical([]string{name}); len(known) == 1 {
+		name = known[0]
+	}
+	err := s.database.GetDB().Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("name = ?", name).Delete(&models.Tag{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Exec(`UPDATE intent_tags SET tags = array_remove(tags, ?), updated_at = ? WHERE ? = ANY(tags)`,
+			name, time.Now(), name).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`DELETE FROM tag_embeddings WHERE tag_name = ?`, name).Error
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting tag %s: %w", name, err)
+	}
+	return s.loadTagTaxonomy()
+}
+
+// GetIntentTags returns the intent mapping sorted by intent
+func (s *Service) GetIntentTags() ([]models.IntentTags, error) {
+	var intents []models.IntentTags
+	if err := s.database.GetDB().Order("intent").Find(&intents).Error; err != nil {
+		return nil, fmt.Errorf("error retrieving intent tags: %w", err)
+	}
+	return intents, nil
+}
+
+// SaveIntentTags sets the tags searched for a Dialogflow intent. All tags must be in the taxonomy.
+func (s *Service) SaveIntentTags(intent string, tags []string) (*models.IntentTags, error) {
+	intent = strings.TrimSpace(intent)
+	known, unknown := s.taxonomy.canonical(tags)
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("%s: %w", strings.Join(unknown, ", "), ErrUnknownTag)
+	}
+	sort.Strings(known)
+
+	mapping := &models.IntentTags{Intent: intent, Tags: pq.StringArray(slices.Compact(known))}
+	err := s.database.GetDB().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "intent"}},
+		DoUpdates: clause.AssignmentColumns([]string{"tags", "updated_at"}),
+	}).Create(mapping).Error
+	if err != nil {
+		return nil, fmt.Errorf("error saving tags of intent %s: %w", intent, err)
+	}
+	return mapping, s.loadTagTaxonomy()
+}
+
+// DeleteIntentTags removes the mapping of an intent, whose questions are then answered from all documents.
+// gorm.ErrRecordNotFound is returned for unmapped intents.
+func (s *Service) DeleteIntentTags(intent string) error {
+	result := s.database.GetDB().Where("intent = ?", intent).Delete(&models.IntentTags{})
+	if result.Error != nil {
+		return fmt.Errorf("error deleting tags of intent %s: %w", intent, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("intent %s: %w", intent, gorm.ErrRecordNotFound)
+	}
+	return s.loadTagTaxonomy()
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	config "crossplatform_chatbot/configs"
+	document "crossplatform_chatbot/document_proc"
+	"crossplatform_chatbot/models"
+	"crossplatform_chatbot/utils"
+	"crossplatform_chatbot/vectorstore"
+	"fmt"
+	"time"
+)
+
+// initVectorStore creates the vector store selected in the embedding config and the BM25 index used for hybrid retrieval:
+// the pgvector column is migrated, the in-memory indexes are warmed from Postgres.
+func (s *Service) initVectorStore(embConfig config.EmbeddingConfig) error {
+	switch embConfig.VectorStore {
+	case "hnsw", "":
+		s.vectorStore = vectorstore.NewHNSWStore(vectorstore.HNSWConfig{
+			M:              embConfig.HNSWM,
+			EfConstruction: embConfig.HNSWEfConstruction,
+			EfSearch:       embConfig.HNSWEfSearch,
+		})
+	case "pgvector":
+		pgStore := vectorstore.NewPGVectorStore(s.database, embConfig.EmbeddingDimensions)
+		if err := pgStore.Migrate(); err != nil {
+			return err
+		}
+		s.vectorStore = pgStore
+		fmt.Printf("Using pgvector store with %d chunks\n", pgStore.Len())
+	default:
+		return fmt.Errorf("unsupported vector store: %s", embConfig.VectorStore)
+	}
+
+	s.lexicalIndex = document.NewBM25Index(embConfig.LexicalStemming)
+	s.retriever = &document.Retriever{
+		Store:   s.vectorStore,
+		Lexical: s.lexicalIndex,
+		Client:  s.aiClients.OpenAI,
+		Fusion: document.FusionConfig{
+			Mode:           embConfig.FusionMode,
+			SemanticWeight: embConfig.SemanticWeight,
+			LexicalWeight:  embConfig.LexicalWeight,
+			RRFK:           embConfig.RRFK,
+		},
+		Selection: document.SelectionConfig{
+			Mode:          embConfig.SelectionMode,
+			Lambda:        embConfig.MMRLambda,
+			MergeAdjacent: embConfig.MergeAdjacentChunks,
+		},
+	}
+
+	reranker, err := s.newReranker(embConfig)
+	if err != nil {
+		return err
+	}
+	if reranker != nil {
+		s.retriever.Reranker = reranker
+		s.retriever.RerankCandidates = embConfig.RerankCandidates
+	}
+
+	// Fulfillment answers must be returned within the 5 seconds of the Dialogflow webhook, the LLM reranking
+	// call is skipped for them
+	s.fulfillmentRetriever = s.retriever
+	if _, llm := reranker.(*document.LLMReranker); llm {
+		fast := *s.retriever
+		fast.Reranker = nil
+		s.fulfillmentRetriever = &fast
+	}
+
+	return s.warmIndexes()
+}
+
+// newReranker creates the reranker selected in the embedding config, nil if reranking is disabled
+func (s *Service) newReranker(embConfig config.EmbeddingConfig) (document.Reranker, error) {
+	switch embConfig.Reranker {
+	case "none", "":
+		return nil, nil
+	case "llm":
+		providerName := embConfig.RerankProvider
+		if providerName == "" {
+			providerName = s.botConfig.AIProvider
+		}
+		provider, ok := s.aiClients.Providers.Get(providerName)
+		if !ok {
+			return nil, fmt.Errorf("unknown rerank provider: %s", providerName)
+		}
+		fmt.Printf("Reranking retrieved chunks with %s\n", provider.Describe())
+		return document.NewLLMReranker(provider), nil
+	case "http":
+		if embConfig.RerankURL == "" {
+			return nil, fmt.Errorf("RERANK_URL is required for the http reranker")
+		}
+		fmt.Printf("Reranking retrieved chunks with %s\n", embConfig.RerankURL)
+		return document.NewHTTPReranker(embConfig.RerankURL, embConfig.RerankAPIKey, embConfig.RerankModel), nil
+	default:
+		return nil, fmt.Errorf("unsupported reranker: %s", embConfig.Reranker)
+	}
+}
+
+// warmIndexes loads all stored document chunks from Postgres into the in-memory indexes
+func (s *Service) warmIndexes() error {
+	start := time.Now()
+
+	// pgvector keeps the vectors in Postgres, BM25 only needs the texts
+	hnswStore, ok := s.vectorStore.(*vectorstore.HNSWStore)
+	if !ok {
+		documents, err := s.repository.GetAllChunkTexts()
+		if err != nil {
+			return err
+		}
+		records := make([]vectorstore.Record, 0, len(documents))
+		for _, doc := range documents {
+			records = append(records, chunkTextRecord(doc))
+		}
+		s.lexicalIndex.Add(records...)
+		fmt.Printf("BM25 index warmed with %d chunks in %s\n", s.lexicalIndex.Len(), time.Since(start))
+		return nil
+	}
+
+	documents, err := s.repository.GetAllDocuments()
+	if err != nil {
+		return err
+	}
+
+	records := make([]vectorstore.Record, 0, len(documents))
+	for _, doc := range documents {
+		record, err := documentToRecord(doc)
+		if err != nil {
+			fmt.Printf("Error parsing embedding for chunkID %s: %v\n", doc.ChunkID, err)
+			continue // Skip this chunk if there's an error
+		}
+		records = append(records, record)
+	}
+	records = skipMismatchedDimensions(records)
+
+	if err := hnswStore.Upsert(records...); err != nil {
+		return fmt.Errorf("error loading chunks into vector store: %w", err)
+	}
+	fmt.Printf("Vector store warmed with %d chunks in %s\n", hnswStore.Len(), time.Since(start))
+
+	s.lexicalIndex.Add(records...)
+	fmt.Printf("BM25 index warmed with %d chunks in %s\n", s.lexicalIndex.Len(), time.Since(start))
+	return nil
+}
+
+// retrieveTopChunks runs hybrid retrieval for the message over the chunks matching the filter
+func (s *Service) retrieveTopChunks(retriever *document.Retriever, message string, filter vectorstore.Filter) ([]document.ScoredChunk, error) {
+	return retriever.Retrieve(message, s.embConfig.NumTopChunks, s.embConfig.NumCandidateChunks, s.embConfig.ScoreThreshold, filter)
+}
+
+// chunkTextRecord converts a stored document chunk into a record without embedding, for the BM25 index
+func chunkTextRecord(doc models.Document) vectorstore.Record {
+	return vectorstore.Record{
+		ChunkID:  doc.ChunkID,
+		DocID:    doc.DocID,
+		Filename: doc.Filename,
+		Text:     doc.DocText,
+		Tags:     doc.Tags,
+		Metadata: doc.Metadata,
+	}
+}
+
+// skipMismatchedDimensions drops the records whose embedding doesn't have the dimension of most chunks,
+// e.g. chunks embedded with a previous model, as the vector store and the similarity scoring need one dimension
+func skipMismatchedDimensions(records []vectorstore.Record) []vectorstore.Record {
+	counts := make(map[int]int)
+	dim := 0
+	for _, record := range records {
+		counts[len(record.Embedding)]++
+		if n := len(record.Embedding); counts[n] > counts[dim] || (counts[n] == counts[dim] && n > dim) {
+			dim = n
+		}
+	}
+
+	kept := records[:0]
+	for _, record := range records {
+		if len(record.Embedding) != dim {
+			fmt.Printf("Skipping chunkID %s: embedding dimension %d, expected %d\n", record.ChunkID, len(record.Embedding), dim)
+			continue
+		}
+		kept = append(kept, record)
+	}
+	return kept
+}
+
+// documentToRecord converts a stored document chunk into a vector store record
+func documentToRecord(doc models.Document) (vectorstore.Record, error) {
+	embedding, err := utils.PostgresArrayToFloat64Slice(doc.Embedding)
+	if err != nil {
+		return vectorstore.Record{}, err
+	}
+
+	return vectorstore.Record{
+		ChunkID:   doc.ChunkID,
+		DocID:     doc.DocID,
+		Filename:  doc.Filename,
+		Text:      doc.DocText,
+		Embedding: embedding,
+		Tags:      doc.Tags,
+		Metadata:  doc.Metadata,
+	}, nil
+}
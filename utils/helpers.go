@@ -47,7 +47,7 @@ func Float64SliceToPostgresArray(embedding []float64) string {
 		if i > 0 {
 			result.WriteString(",")
 		}
-		result.WriteString(fmt.Sprintf("%f", value))
+		result.WriteString(strconv.FormatFloat(value, 'g', -1, 64)) // Shortest exact representation, %f loses precision
 	}
 	result.WriteString("}")
 	return result.String()
@@ -0,0 +1,412 @@
+package vectorstore
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ErrInvalidFilter is returned for filter expressions that can't be parsed
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Keys of a filter expression that are not chunk metadata
+const (
+	FilterKeyTag      = "tag"      // Matches any tag of the chunk, only with = and !=
+	FilterKeyDocID    = "doc_id"   // ID of the document
+	FilterKeyFilename = "filename" // Name of the uploaded file
+)
+
+// Values made of dot separated numbers (2, 2.1, 10.4.3) are compared number by number,
+// other values as case-insensitive strings
+var versionValue = regexp.MustCompile(`^[0-9]+([.][0-9]+)*$`)
+
+// Filter expressions keys, such as product, version or section
+var filterKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// IsFilterKey reports whether the name can be used as a key in filter expressions
+func IsFilterKey(name string) bool {
+	return filterKey.MatchString(name)
+}
+
+// Expression is a parsed filter expression over the tags and metadata of the chunks, such as
+// `product=X AND version>=2` or `tag="Shipping & Returns" OR NOT (language=fr)`.
+// Comparisons are =, !=, <, <=, > and >=; a comparison on a missing metadata key is false.
+type Expression struct {
+	source string
+	root   exprNode
+}
+
+// ParseFilter parses a filter expression. An empty expression returns nil, which matches everything.
+func ParseFilter(source string) (*Expression, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, nil
+	}
+	tokens, err := lexFilter(source)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+	}
+	p := &filterParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+	}
+	return &Expression{source: strings.TrimSpace(source), root: root}, nil
+}
+
+// Compare returns the expression comparing a key with a value, as parsed from `key op "value"`
+func Compare(key, op, value string) (*Expression, error) {
+	switch op {
+	case "==":
+		op = "="
+	case "<>":
+		op = "!="
+	}
+	if !IsFilterKey(key) {
+		return nil, fmt.Errorf("%w: invalid key %q", ErrInvalidFilter, key)
+	}
+	if !slices.Contains([]string{"=", "!=", "<", "<=", ">", ">="}, op) || (key == FilterKeyTag && op != "=" && op != "!=") {
+		return nil, fmt.Errorf("%w: invalid operator %q for %s", ErrInvalidFilter, op, key)
+	}
+	quote := `"`
+	if strings.Contains(value, quote) {
+		quote = "'"
+	}
+	return &Expression{source: key + op + quote + value + quote, root: compareNode{key: key, op: op, value: value}}, nil
+}
+
+// And returns the expression matching the records matched by both expressions, nil expressions match everything
+func (e *Expression) And(other *Expression) *Expression {
+	if e == nil {
+		return other
+	}
+	if other == nil {
+		return e
+	}
+	return &Expression{source: "(" + e.source + ") AND (" + other.source + ")", root: andNode{left: e.root, right: other.root}}
+}
+
+// Or returns the expression matching the records matched by either expression, nil expressions match everything
+func (e *Expression) Or(other *Expression) *Expression {
+	if e == nil || other == nil {
+		return nil
+	}
+	return &Expression{source: "(" + e.source + ") OR (" + other.source + ")", root: orNode{left: e.root, right: other.root}}
+}
+
+// String returns the expression as written
+func (e *Expression) String() string {
+	if e == nil {
+		return ""
+	}
+	return e.source
+}
+
+// Match reports whether the record satisfies the expression
+func (e *Expression) Match(record Record) bool {
+	return e == nil || e.root.match(record)
+}
+
+// SQL translates the expression into a condition on the documents table (tags text[], metadata jsonb),
+// with ? placeholders for its arguments. Comparisons follow the same rules as Match.
+func (e *Expression) SQL() (string, []interface{}) {
+	if e == nil {
+		return "TRUE", nil
+	}
+	var args []interface{}
+	return e.root.sql(&args), args
+}
+
+type exprNode interface {
+	match(record Record) bool
+	sql(args *[]interface{}) string
+}
+
+type andNode struct{ left, right exprNode }
+
+func (n andNode) match(record Record) bool { return n.left.match(record) && n.right.match(record) }
+
+func (n andNode) sql(args *[]interface{}) string {
+	return "(" + n.left.sql(args) + " AND " + n.right.sql(args) + ")"
+}
+
+type orNode struct{ left, right exprNode }
+
+func (n orNode) match(record Record) bool { return n.left.match(record) || n.right.match(record) }
+
+func (n orNode) sql(args *[]interface{}) string {
+	return "(" + n.left.sql(args) + " OR " + n.right.sql(args) + ")"
+}
+
+type notNode struct{ operand exprNode }
+
+func (n notNode) match(record Record) bool { return !n.operand.match(record) }
+
+func (n notNode) sql(args *[]interface{}) string { return "(NOT " + n.operand.sql(args) + ")" }
+
+// compareNode is a comparison of a key with a value
+type compareNode struct {
+	key, op, value string
+}
+
+func (n compareNode) match(record Record) bool {
+	if n.key == FilterKeyTag {
+		found := false
+		for _, tag := range record.Tags {
+			if strings.EqualFold(tag, n.value) {
+				found = true
+				break
+			}
+		}
+		return found == (n.op == "=")
+	}
+
+	var actual string
+	switch n.key {
+	case FilterKeyDocID:
+		actual = record.DocID
+	case FilterKeyFilename:
+		actual = record.Filename
+	default:
+		value, ok := record.Metadata[n.key]
+		if !ok {
+			return false
+		}
+		actual = value
+	}
+
+	order := compareFilterValues(actual, n.value)
+	switch n.op {
+	case "=":
+		return order == 0
+	case "!=":
+		return order != 0
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	default: // >=
+		return order >= 0
+	}
+}
+
+func (n compareNode) sql(args *[]interface{}) string {
+	if n.key == FilterKeyTag {
+		*args = append(*args, n.value)
+		condition := "EXISTS (SELECT 1 FROM unnest(tags) AS chunk_tag WHERE lower(chunk_tag) = lower(?))"
+		if n.op == "!=" {
+			condition = "NOT " + condition
+		}
+		return condition
+	}
+
+	column := "(metadata->>?::text)"
+	var columnArgs []interface{}
+	switch n.key {
+	case FilterKeyDocID:
+		column = "doc_id"
+	case FilterKeyFilename:
+		column = "filename"
+	default:
+		columnArgs = []interface{}{n.key}
+	}
+
+	// Compare as strings, or number by number when both values are versions
+	stringCompare := fmt.Sprintf(`lower(%s) COLLATE "C" %s lower(?) COLLATE "C"`, column, n.op)
+	stringArgs := append(append([]interface{}{}, columnArgs...), n.value)
+	if !versionValue.MatchString(n.value) {
+		*args = append(*args, stringArgs...)
+		return "COALESCE(" + stringCompare + ", false)"
+	}
+	*args = append(*args, columnArgs...)
+	*args = append(*args, columnArgs...)
+	*args = append(*args, n.value)
+	*args = append(*args, stringArgs...)
+	return fmt.Sprintf(`COALESCE(CASE WHEN %s ~ '^[0-9]+([.][0-9]+)*$' THEN string_to_array(%s, '.')::numeric[] %s string_to_array(?, '.')::numeric[] ELSE %s END, false)`,
+		column, column, n.op, stringCompare)
+}
+
+// compareFilterValues orders two values: versions number by number, other values as case-insensitive strings
+func compareFilterValues(a, b string) int {
+	if !versionValue.MatchString(a) || !versionValue.MatchString(b) {
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	}
+	partsA, partsB := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(partsA) && i < len(partsB); i++ {
+		x, y := strings.TrimLeft(partsA[i], "0"), strings.TrimLeft(partsB[i], "0")
+		if len(x) != len(y) {
+			if len(x) < len(y) {
+				return -1
+			}
+			return 1
+		}
+		if order := strings.Compare(x, y); order != 0 {
+			return order
+		}
+	}
+	// A version is lower than its own extensions (2 < 2.0 < 2.0.1), as Postgres orders arrays
+	switch {
+	case len(partsA) < len(partsB):
+		return -1
+	case len(partsA) > len(partsB):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Token kinds of filter expressions
+const (
+	tokenWord = iota
+	tokenString
+	tokenOperator
+	tokenOpen
+	tokenClose
+)
+
+type filterToken struct {
+	kind int
+	text string
+}
+
+// lexFilter splits the expression into words, quoted strings, operators and parentheses
+func lexFilter(source string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, filterToken{kind: tokenOpen, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, filterToken{kind: tokenClose, text: ")"})
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(source[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			tokens = append(tokens, filterToken{kind: tokenString, text: source[i+1 : i+1+end]})
+			i += end + 2
+		case strings.IndexByte("=!<>", c) >= 0:
+			raw := string(c)
+			if i+1 < len(source) && (source[i+1] == '=' || (c == '<' && source[i+1] == '>')) {
+				raw = source[i : i+2]
+			}
+			op := raw
+			switch raw {
+			case "<>":
+				op = "!="
+			case "==":
+				op = "="
+			case "!":
+				return nil, fmt.Errorf("unexpected ! at %d", i)
+			}
+			tokens = append(tokens, filterToken{kind: tokenOperator, text: op})
+			i += len(raw)
+		default:
+			start := i
+			for i < len(source) && strings.IndexByte(" \t\n\r()\"'=!<>", source[i]) < 0 {
+				i++
+			}
+			tokens = append(tokens, filterToken{kind: tokenWord, text: source[start:i]})
+		}
+	}
+	return tokens, nil
+}
+
+// filterParser is a recursive descent parser: OR binds looser than AND, which binds looser than NOT
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) keyword(word string) bool {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenWord && strings.EqualFold(p.tokens[p.pos].text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (exprNode, error) {
+	if p.keyword("NOT") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand: operand}, nil
+	}
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenOpen {
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != tokenClose {
+			return nil, errors.New("missing )")
+		}
+		p.pos++
+		return node, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (exprNode, error) {
+	if p.pos+3 > len(p.tokens) {
+		return nil, errors.New("incomplete comparison, expected key, operator and value")
+	}
+	key, op, value := p.tokens[p.pos], p.tokens[p.pos+1], p.tokens[p.pos+2]
+	if key.kind != tokenWord || !IsFilterKey(key.text) {
+		return nil, fmt.Errorf("invalid key %q", key.text)
+	}
+	if op.kind != tokenOperator {
+		return nil, fmt.Errorf("expected an operator after %q", key.text)
+	}
+	if value.kind != tokenWord && value.kind != tokenString {
+		return nil, fmt.Errorf("expected a value after %s%s", key.text, op.text)
+	}
+	if key.text == FilterKeyTag && op.text != "=" && op.text != "!=" {
+		return nil, fmt.Errorf("tags can only be compared with = and !=")
+	}
+	p.pos += 3
+	return compareNode{key: key.text, op: op.text, value: value.text}, nil
+}
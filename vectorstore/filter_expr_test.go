@@ -0,0 +1,224 @@
+package vectorstore
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// SQL of a comparison of a metadata key with a value that is not a version
+const metadataCompareSQL = `COALESCE(lower((metadata->>?::text)) COLLATE "C" = lower(?) COLLATE "C", false)`
+
+func TestParseFilterSQL(t *testing.T) {
+	tests := []struct {
+		source   string
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{"product = router", metadataCompareSQL, []interface{}{"product", "router"}},
+		{"product == router", metadataCompareSQL, []interface{}{"product", "router"}},
+		{`product <> "Router X"`, strings.Replace(metadataCompareSQL, " = ", " != ", 1), []interface{}{"product", "Router X"}},
+		{`tag='say "hi"'`, `EXISTS (SELECT 1 FROM unnest(tags) AS chunk_tag WHERE lower(chunk_tag) = lower(?))`, []interface{}{`say "hi"`}},
+		{`tag != "Shipping & Returns"`, `NOT EXISTS (SELECT 1 FROM unnest(tags) AS chunk_tag WHERE lower(chunk_tag) = lower(?))`, []interface{}{"Shipping & Returns"}},
+		{"doc_id = manual_1", `COALESCE(lower(doc_id) COLLATE "C" = lower(?) COLLATE "C", false)`, []interface{}{"manual_1"}},
+		{"filename < m", `COALESCE(lower(filename) COLLATE "C" < lower(?) COLLATE "C", false)`, []interface{}{"m"}},
+		{"version >= 2.1",
+			`COALESCE(CASE WHEN (metadata->>?::text) ~ '^[0-9]+([.][0-9]+)*$' THEN string_to_array((metadata->>?::text), '.')::numeric[] >= string_to_array(?, '.')::numeric[] ` +
+				`ELSE lower((metadata->>?::text)) COLLATE "C" >= lower(?) COLLATE "C" END, false)`,
+			[]interface{}{"version", "version", "2.1", "version", "2.1"}},
+		// NOT binds tighter than AND, which binds tighter than OR
+		{"a=x OR b=y AND NOT c=z", "(" + metadataCompareSQL + " OR (" + metadataCompareSQL + " AND (NOT " + metadataCompareSQL + ")))",
+			[]interface{}{"a", "x", "b", "y", "c", "z"}},
+		{"(a=x or b=y) and c=z", "((" + metadataCompareSQL + " OR " + metadataCompareSQL + ") AND " + metadataCompareSQL + ")",
+			[]interface{}{"a", "x", "b", "y", "c", "z"}},
+		{"a=x AND b=y AND c=z", "((" + metadataCompareSQL + " AND " + metadataCompareSQL + ") AND " + metadataCompareSQL + ")",
+			[]interface{}{"a", "x", "b", "y", "c", "z"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			expr, err := ParseFilter(tt.source)
+			if err != nil {
+				t.Fatalf("ParseFilter: %v", err)
+			}
+			sql, args := expr.SQL()
+			if sql != tt.wantSQL {
+				t.Errorf("SQL = %s\nwant  %s", sql, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %v, want %v", args, tt.wantArgs)
+			}
+			if strings.Count(sql, "?") != len(args) {
+				t.Errorf("%d placeholders for %d args", strings.Count(sql, "?"), len(args))
+			}
+		})
+	}
+}
+
+func TestParseFilterEmpty(t *testing.T) {
+	expr, err := ParseFilter("  ")
+	if err != nil || expr != nil {
+		t.Fatalf("ParseFilter = %v, %v; want nil", expr, err)
+	}
+	if sql, args := expr.SQL(); sql != "TRUE" || args != nil {
+		t.Fatalf("SQL of nil = %s %v, want TRUE", sql, args)
+	}
+	if !expr.Match(Record{}) {
+		t.Fatal("nil expression must match everything")
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	inputs := []string{
+		"product",
+		"product =",
+		"product = router AND",
+		"product = router version = 2",
+		"(product = router",
+		"product = router)",
+		"= router",
+		"1product = router",
+		"product ! router",
+		"product = (router)",
+		`product = "router`,
+		"tag > shipping",
+		"NOT",
+		"()",
+	}
+	for _, input := range inputs {
+		if expr, err := ParseFilter(input); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("ParseFilter(%q) = %v, %v; want ErrInvalidFilter", input, expr, err)
+		}
+	}
+}
+
+func TestExpressionMatch(t *testing.T) {
+	record := Record{
+		DocID:    "manual_1",
+		Filename: "Router.pdf",
+		Tags:     []string{"Installation & Setup", "network"},
+		Metadata: map[string]string{"product": "Router", "version": "10", "release": "2.0", "language": "en"},
+	}
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{"product = router", true}, // Case-insensitive
+		{"product != router", false},
+		{"product = modem OR product = router", true},
+		{"product = router AND language = fr", false},
+		{"product = router AND NOT language = fr", true},
+		{"NOT (product = router OR language = en)", false},
+		{"version >= 2", true}, // Number by number: 10 > 2
+		{"version < 9", false},
+		{"version = 10.0", false}, // 10 < 10.0, as Postgres orders the arrays
+		{"release > 2", true},
+		{"release = 02.00", true}, // Leading zeros are ignored
+		{"release < 2.0.1", true},
+		{"language > de", true}, // Not versions: compared as strings
+		{"missing = x", false},  // Comparisons on missing keys are false
+		{"missing != x", false},
+		{"NOT missing = x", true},
+		{`tag = "installation & setup"`, true},
+		{"tag = network AND tag != billing", true},
+		{"tag = billing", false},
+		{"doc_id = manual_1", true},
+		{"filename = router.pdf", true},
+	}
+	for _, tt := range tests {
+		expr, err := ParseFilter(tt.source)
+		if err != nil {
+			t.Fatalf("ParseFilter(%q): %v", tt.source, err)
+		}
+		if got := expr.Match(record); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestCompareFilterValues(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"2", "10", -1},
+		{"10", "9", 1},
+		{"2.1", "2.01", 0},
+		{"2", "2.0", -1},
+		{"2.0.1", "2.0", 1},
+		{"1.10", "1.9", 1},
+		{"abc", "ABD", -1},
+		{"ABC", "abc", 0},
+		{"2", "2a", -1}, // Not both versions: compared as strings
+	}
+	for _, tt := range tests {
+		if got := compareFilterValues(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareFilterValues(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestExpressionCombine(t *testing.T) {
+	product, err := Compare("product", "==", "Router")
+	if err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+	quoted, err := Compare("section", "<>", `The "best" part`)
+	if err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+	if got := quoted.String(); got != `section!='The "best" part'` {
+		t.Fatalf("String = %s", got)
+	}
+	// The source of a combined expression parses to the same expression
+	combined := product.And(quoted)
+	reparsed, err := ParseFilter(combined.String())
+	if err != nil {
+		t.Fatalf("ParseFilter(%q): %v", combined.String(), err)
+	}
+	sql, args := combined.SQL()
+	reSQL, reArgs := reparsed.SQL()
+	if sql != reSQL || !reflect.DeepEqual(args, reArgs) {
+		t.Fatalf("reparsed %q differs: %s %v", combined.String(), reSQL, reArgs)
+	}
+
+	var none *Expression
+	if none.And(product) != product || product.And(none) != product {
+		t.Error("And with nil must return the other expression")
+	}
+	if none.Or(product) != nil || product.Or(none) != nil {
+		t.Error("Or with nil must match everything")
+	}
+
+	for _, args := range [][3]string{{"1key", "=", "x"}, {"product", "~", "x"}, {"tag", "<", "x"}} {
+		if _, err := Compare(args[0], args[1], args[2]); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("Compare%v = %v, want ErrInvalidFilter", args, err)
+		}
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	where, err := ParseFilter("product = router")
+	if err != nil {
+		t.Fatalf("ParseFilter: %v", err)
+	}
+	record := Record{DocID: "manual", Tags: []string{"Setup"}, Metadata: map[string]string{"product": "router"}}
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty", Filter{}, true},
+		{"doc ID", Filter{DocIDs: []string{"other", "manual"}}, true},
+		{"other doc ID", Filter{DocIDs: []string{"other"}}, false},
+		{"tag", Filter{Tags: []string{"Setup"}}, true},
+		{"other tag", Filter{Tags: []string{"Billing"}}, false},
+		{"expression", Filter{Where: where}, true},
+		{"expression and other doc ID", Filter{DocIDs: []string{"other"}, Where: where}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Match(record); got != tt.want {
+			t.Errorf("%s: Match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,469 @@
+package vectorstore
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// HNSWConfig holds the parameters of the HNSW graph
+type HNSWConfig struct {
+	M              int // Maximum number of neighbours per node on the upper layers (2*M on layer 0)
+	EfConstruction int // Size of the candidate list while inserting
+	EfSearch       int // Minimum size of the candidate list while searching
+}
+
+// hnswNode is a chunk in the graph, deleted nodes stay in the graph for navigation until the next rebuild
+type hnswNode struct {
+	record  Record // Record without the embedding, the normalized vector is kept instead
+	vector  []float32
+	friends [][]int // Neighbour node indexes per layer
+	deleted bool
+}
+
+// HNSWStore is an in-memory VectorStore backed by a Hierarchical Navigable Small World graph
+type HNSWStore struct {
+	mu        sync.RWMutex
+	conf      HNSWConfig
+	levelMult float64
+	rng       *rand.Rand
+	nodes     []*hnswNode
+	ids       map[string]int // ChunkID -> node index
+	entry     int            // Entry point node index, -1 when empty
+	maxLevel  int
+	dim       int
+	deleted   int // Number of deleted nodes still in the graph
+}
+
+// NewHNSWStore creates an empty HNSW store, zero config values fall back to common defaults
+func NewHNSWStore(conf HNSWConfig) *HNSWStore {
+	if conf.M <= 0 {
+		conf.M = 16
+	}
+	if conf.EfConstruction <= 0 {
+		conf.EfConstruction = 100
+	}
+	if conf.EfSearch <= 0 {
+		conf.EfSearch = 64
+	}
+
+	return &HNSWStore{
+		conf:      conf,
+		levelMult: 1 / math.Log(float64(conf.M)),
+		rng:       rand.New(rand.NewSource(42)),
+		ids:       make(map[string]int),
+		entry:     -1,
+	}
+}
+
+// Len returns the number of stored records
+func (s *HNSWStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.ids)
+}
+
+// Upsert inserts the records into the graph, replacing any existing record with the same chunk ID
+func (s *HNSWStore) Upsert(records ...Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Check the whole batch first, so a rejected batch leaves the graph unchanged
+	dim := s.dim
+	for _, record := range records {
+		if len(record.Embedding) == 0 {
+			return fmt.Errorf("error: empty embedding for chunk %s", record.ChunkID)
+		}
+		if dim == 0 {
+			dim = len(record.Embedding)
+		}
+		if len(record.Embedding) != dim {
+			return fmt.Errorf("error: embedding of chunk %s has dimension %d, expected %d", record.ChunkID, len(record.Embedding), dim)
+		}
+	}
+	s.dim = dim
+
+	for _, record := range records {
+		// Replace an existing record by deleting the old node
+		if idx, exists := s.ids[record.ChunkID]; exists {
+			s.markDeleted(idx)
+		}
+
+		vector := normalize(record.Embedding)
+		record.Embedding = nil
+		s.insert(record, vector)
+	}
+
+	s.rebuildIfNeeded()
+	return nil
+}
+
+// Delete removes the records with the given chunk IDs
+func (s *HNSWStore) Delete(chunkIDs ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, chunkID := range chunkIDs {
+		if idx, exists := s.ids[chunkID]; exists {
+			s.markDeleted(idx)
+		}
+	}
+
+	s.rebuildIfNeeded()
+	return nil
+}
+
+// Get returns the stored records with the given chunk IDs, the returned embeddings are normalized
+func (s *HNSWStore) Get(chunkIDs ...string) ([]Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]Record, 0, len(chunkIDs))
+	for _, chunkID := range chunkIDs {
+		if idx, exists := s.ids[chunkID]; exists {
+			records = append(records, s.result(s.nodes[idx], 0).Record)
+		}
+	}
+	return records, nil
+}
+
+// Search returns up to topK records with a cosine similarity of at least threshold, best match first
+func (s *HNSWStore) Search(query []float64, topK int, threshold float64, filter Filter) ([]Result, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.entry < 0 || topK <= 0 {
+		return nil, nil
+	}
+	if len(query) != s.dim {
+		return nil, fmt.Errorf("error: query has dimension %d, expected %d", len(query), s.dim)
+	}
+
+	vector := normalize(query)
+
+	// Widen the candidate list when filtering, since filtered out nodes use up candidate slots
+	ef := s.conf.EfSearch
+	if topK > ef {
+		ef = topK
+	}
+	if !filter.IsEmpty() {
+		ef *= 4
+	}
+
+	// Greedy descent through the upper layers, then a full search on layer 0
+	ep := s.entry
+	for level := s.maxLevel; level > 0; level-- {
+		ep = s.searchLayer(vector, []int{ep}, 1, level)[0].node
+	}
+	candidates := s.searchLayer(vector, []int{ep}, ef, 0)
+
+	results := make([]Result, 0, topK)
+	for _, c := range candidates {
+		node := s.nodes[c.node]
+		score := 1 - c.dist
+		if node.deleted || score < threshold || !filter.Match(node.record) {
+			continue
+		}
+		results = append(results, s.result(node, score))
+		if len(results) == topK {
+			break
+		}
+	}
+
+	// A selective filter can leave too few graph results, so scan the matching records exactly
+	if len(results) < topK && !filter.IsEmpty() {
+		results = s.exactSearch(vector, topK, threshold, filter)
+	}
+
+	return results, nil
+}
+
+// exactSearch scores every live record matching the filter
+func (s *HNSWStore) exactSearch(vector []float32, topK int, threshold float64, filter Filter) []Result {
+	var results []Result
+	for _, node := range s.nodes {
+		if node.deleted || !filter.Match(node.record) {
+			continue
+		}
+		score := float64(dot(vector, node.vector))
+		if score >= threshold {
+			results = append(results, s.result(node, score))
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > topK {
+		results = results[:topK]
+	}
+	return results
+}
+
+// result converts a node into a search result, the returned embedding is the normalized vector
+func (s *HNSWStore) result(node *hnswNode, score float64) Result {
+	record := node.record
+	record.Embedding = make([]float64, len(node.vector))
+	for i, v := range node.vector {
+		record.Embedding[i] = float64(v)
+	}
+	return Result{Record: record, Score: score}
+}
+
+// insert adds a node to the graph (caller holds the write lock)
+func (s *HNSWStore) insert(record Record, vector []float32) {
+	level := int(math.Floor(-math.Log(1-s.rng.Float64()) * s.levelMult))
+	idx := len(s.nodes)
+	node := &hnswNode{
+		record:  record,
+		vector:  vector,
+		friends: make([][]int, level+1),
+	}
+	s.nodes = append(s.nodes, node)
+	s.ids[record.ChunkID] = idx
+
+	if s.entry < 0 {
+		s.entry = idx
+		s.maxLevel = level
+		return
+	}
+
+	// Greedy descent through the layers above the node's level
+	ep := s.entry
+	for l := s.maxLevel; l > level; l-- {
+		ep = s.searchLayer(vector, []int{ep}, 1, l)[0].node
+	}
+
+	// Connect the node on each of its layers
+	entryPoints := []int{ep}
+	for l := min(level, s.maxLevel); l >= 0; l-- {
+		candidates := s.searchLayer(vector, entryPoints, s.conf.EfConstruction, l)
+
+		neighbours := s.selectNeighbours(candidates, s.conf.M)
+		node.friends[l] = neighbours
+
+		for _, n := range neighbours {
+			s.connect(n, idx, l)
+		}
+
+		entryPoints = entryPoints[:0]
+		for _, c := range candidates {
+			entryPoints = append(entryPoints, c.node)
+		}
+	}
+
+	if level > s.maxLevel {
+		s.entry = idx
+		s.maxLevel = level
+	}
+}
+
+// connect adds a link from node to friend on the layer, pruning the links beyond the layer limit
+func (s *HNSWStore) connect(node, friend, level int) {
+	n := s.nodes[node]
+	n.friends[level] = append(n.friends[level], friend)
+
+	maxFriends := s.conf.M
+	if level == 0 {
+		maxFriends = 2 * s.conf.M
+	}
+	if len(n.friends[level]) <= maxFriends {
+		return
+	}
+
+	candidates := make([]candidate, len(n.friends[level]))
+	for i, f := range n.friends[level] {
+		candidates[i] = candidate{node: f, dist: s.distance(n.vector, f)}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].dist < candidates[j].dist
+	})
+	n.friends[level] = s.selectNeighbours(candidates, maxFriends)
+}
+
+// selectNeighbours picks up to m neighbours from the candidates (sorted by distance) using the HNSW heuristic:
+// a candidate is kept only if it is closer to the node than to any neighbour already kept, which spreads
+// the links in different directions. Skipped candidates fill the remaining slots.
+func (s *HNSWStore) selectNeighbours(candidates []candidate, m int) []int {
+	selected := make([]int, 0, m)
+	var skipped []int
+
+	for _, c := range candidates {
+		if len(selected) >= m {
+			break
+		}
+		keep := true
+		for _, sel := range selected {
+			if s.distance(s.nodes[c.node].vector, sel) < c.dist {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			selected = append(selected, c.node)
+		} else {
+			skipped = append(skipped, c.node)
+		}
+	}
+
+	for _, node := range skipped {
+		if len(selected) >= m {
+			break
+		}
+		selected = append(selected, node)
+	}
+	return selected
+}
+
+// searchLayer runs a best-first search on one layer and returns up to ef nodes sorted by distance
+func (s *HNSWStore) searchLayer(vector []float32, entryPoints []int, ef, level int) []candidate {
+	visited := make(map[int]struct{}, ef*4)
+	candidates := &minHeap{}
+	results := &maxHeap{}
+
+	for _, ep := range entryPoints {
+		visited[ep] = struct{}{}
+		c := candidate{node: ep, dist: s.distance(vector, ep)}
+		heap.Push(candidates, c)
+		heap.Push(results, c)
+	}
+	for results.Len() > ef {
+		heap.Pop(results)
+	}
+
+	for candidates.Len() > 0 {
+		current := heap.Pop(candidates).(candidate)
+		if results.Len() >= ef && current.dist > (*results)[0].dist {
+			break // All remaining candidates are farther than the worst result
+		}
+
+		node := s.nodes[current.node]
+		if level >= len(node.friends) {
+			continue
+		}
+		for _, friend := range node.friends[level] {
+			if _, seen := visited[friend]; seen {
+				continue
+			}
+			visited[friend] = struct{}{}
+
+			dist := s.distance(vector, friend)
+			if results.Len() < ef || dist < (*results)[0].dist {
+				heap.Push(candidates, candidate{node: friend, dist: dist})
+				heap.Push(results, candidate{node: friend, dist: dist})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	// Sort the results from closest to farthest
+	sorted := make([]candidate, results.Len())
+	for i := len(sorted) - 1; i >= 0; i-- {
+		sorted[i] = heap.Pop(results).(candidate)
+	}
+	return sorted
+}
+
+// markDeleted removes the record from the index while keeping the node for graph navigation
+func (s *HNSWStore) markDeleted(idx int) {
+	node := s.nodes[idx]
+	if node.deleted {
+		return
+	}
+	node.deleted = true
+	delete(s.ids, node.record.ChunkID)
+	s.deleted++
+}
+
+// rebuildIfNeeded rebuilds the graph from the live records once deleted nodes outnumber them
+func (s *HNSWStore) rebuildIfNeeded() {
+	if s.deleted == 0 || s.deleted < len(s.ids) {
+		return
+	}
+
+	oldNodes := s.nodes
+	s.nodes = nil
+	s.ids = make(map[string]int)
+	s.entry = -1
+	s.maxLevel = 0
+	s.deleted = 0
+
+	for _, node := range oldNodes {
+		if !node.deleted {
+			s.insert(node.record, node.vector)
+		}
+	}
+	if len(s.nodes) == 0 {
+		s.dim = 0
+	}
+}
+
+// distance returns the cosine distance between the vector and a node
+func (s *HNSWStore) distance(vector []float32, node int) float64 {
+	return 1 - float64(dot(vector, s.nodes[node].vector))
+}
+
+// normalize converts the embedding to a unit length float32 vector, so cosine similarity becomes a dot product
+func normalize(embedding []float64) []float32 {
+	var norm float64
+	for _, v := range embedding {
+		norm += v * v
+	}
+	norm = math.Sqrt(norm)
+
+	vector := make([]float32, len(embedding))
+	if norm == 0 {
+		return vector
+	}
+	for i, v := range embedding {
+		vector[i] = float32(v / norm)
+	}
+	return vector
+}
+
+func dot(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// candidate is a node with its distance to the query
+type candidate struct {
+	node int
+	dist float64
+}
+
+// minHeap pops the closest candidate first
+type minHeap []candidate
+
+func (h minHeap) Len() int            { return len(h) }
+func (h minHeap) Less(i, j int) bool  { return h[i].dist < h[j].dist }
+func (h minHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(x interface{}) { *h = append(*h, x.(candidate)) }
+func (h *minHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// maxHeap pops the farthest candidate first
+type maxHeap []candidate
+
+func (h maxHeap) Len() int            { return len(h) }
+func (h maxHeap) Less(i, j int) bool  { return h[i].dist > h[j].dist }
+func (h maxHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *maxHeap) Push(x interface{}) { *h = append(*h, x.(candidate)) }
+func (h *maxHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
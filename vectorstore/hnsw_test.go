@@ -0,0 +1,236 @@
+package vectorstore
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// randomRecords returns n records with random embeddings, in documents of 10 chunks
+func randomRecords(n, dim int, seed int64) []Record {
+	rng := rand.New(rand.NewSource(seed))
+	records := make([]Record, n)
+	for i := range records {
+		embedding := make([]float64, dim)
+		for j := range embedding {
+			embedding[j] = rng.NormFloat64()
+		}
+		records[i] = Record{ChunkID: fmt.Sprintf("chunk_%d", i), DocID: fmt.Sprintf("doc_%d", i/10), Embedding: embedding}
+	}
+	return records
+}
+
+// exactTopK returns the chunk IDs of the k records most similar to the query
+func exactTopK(records []Record, query []float64, k int) []string {
+	type scored struct {
+		chunkID string
+		score   float64
+	}
+	normalized := normalize(query)
+	scores := make([]scored, len(records))
+	for i, record := range records {
+		scores[i] = scored{record.ChunkID, float64(dot(normalized, normalize(record.Embedding)))}
+	}
+	sort.Slice(scores, func(i, j int) bool { return scores[i].score > scores[j].score })
+	ids := make([]string, k)
+	for i := range ids {
+		ids[i] = scores[i].chunkID
+	}
+	return ids
+}
+
+func TestHNSWStoreSearchRecall(t *testing.T) {
+	records := randomRecords(1000, 16, 1)
+	store := NewHNSWStore(HNSWConfig{})
+	if err := store.Upsert(records...); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if store.Len() != len(records) {
+		t.Fatalf("Len = %d, want %d", store.Len(), len(records))
+	}
+
+	queries := randomRecords(50, 16, 2)
+	found, total := 0, 0
+	for _, query := range queries {
+		results, err := store.Search(query.Embedding, 10, -1, Filter{})
+		if err != nil {
+			t.Fatalf("Search: %v", err)
+		}
+		if len(results) != 10 {
+			t.Fatalf("Search returned %d results, want 10", len(results))
+		}
+		for i := 1; i < len(results); i++ {
+			if results[i].Score > results[i-1].Score {
+				t.Fatalf("results not sorted by score: %v > %v", results[i].Score, results[i-1].Score)
+			}
+		}
+		want := make(map[string]bool)
+		for _, chunkID := range exactTopK(records, query.Embedding, 10) {
+			want[chunkID] = true
+		}
+		for _, result := range results {
+			if want[result.ChunkID] {
+				found++
+			}
+		}
+		total += 10
+	}
+	if recall := float64(found) / float64(total); recall < 0.9 {
+		t.Fatalf("recall@10 = %.2f, want at least 0.9", recall)
+	}
+
+	// A stored vector is its own best match
+	results, err := store.Search(records[42].Embedding, 1, 0.5, Filter{})
+	if err != nil || len(results) != 1 || results[0].ChunkID != "chunk_42" || math.Abs(results[0].Score-1) > 1e-5 {
+		t.Fatalf("Search of a stored vector = %+v, %v", results, err)
+	}
+}
+
+func TestHNSWStoreUpsertReplaces(t *testing.T) {
+	store := NewHNSWStore(HNSWConfig{})
+	if err := store.Upsert(Record{ChunkID: "a", Embedding: []float64{1, 0, 0}}, Record{ChunkID: "b", Embedding: []float64{0, 1, 0}}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := store.Upsert(Record{ChunkID: "a", Text: "updated", Embedding: []float64{0, 0, 2}}); err != nil {
+		t.Fatalf("Upsert existing: %v", err)
+	}
+	if store.Len() != 2 {
+		t.Fatalf("Len = %d, want 2", store.Len())
+	}
+	records, _ := store.Get("a")
+	if len(records) != 1 || records[0].Text != "updated" || records[0].Embedding[2] != 1 {
+		t.Fatalf("Get = %+v, want the updated record with a normalized embedding", records)
+	}
+	results, _ := store.Search([]float64{0, 0, 1}, 2, 0.5, Filter{})
+	if len(results) != 1 || results[0].ChunkID != "a" {
+		t.Fatalf("Search = %+v, want only the updated a", results)
+	}
+}
+
+func TestHNSWStoreUpsertRejectsBatch(t *testing.T) {
+	store := NewHNSWStore(HNSWConfig{})
+	if err := store.Upsert(Record{ChunkID: "a", Embedding: []float64{1, 0, 0}}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	batches := [][]Record{
+		{{ChunkID: "b", Embedding: []float64{0, 1, 0}}, {ChunkID: "c", Embedding: []float64{0, 1}}},
+		{{ChunkID: "b", Embedding: []float64{0, 1, 0}}, {ChunkID: "c"}},
+		{{ChunkID: "a", Embedding: []float64{0, 1, 0}}, {ChunkID: "c", Embedding: []float64{0, 1, 0, 0}}},
+	}
+	for i, batch := range batches {
+		if err := store.Upsert(batch...); err == nil {
+			t.Fatalf("batch %d: Upsert succeeded", i)
+		}
+		// Nothing of the rejected batch is stored, not even the valid records before the invalid one
+		records, _ := store.Get("a", "b", "c")
+		if store.Len() != 1 || len(records) != 1 || records[0].Embedding[0] != 1 {
+			t.Fatalf("batch %d: store holds %+v after a rejected batch, want a unchanged", i, records)
+		}
+	}
+
+	// The first batch of an empty store sets the dimension, and must agree on it
+	empty := NewHNSWStore(HNSWConfig{})
+	if err := empty.Upsert(Record{ChunkID: "a", Embedding: []float64{1, 0}}, Record{ChunkID: "b", Embedding: []float64{1, 0, 0}}); err == nil {
+		t.Fatal("Upsert of mixed dimensions succeeded")
+	}
+	if err := empty.Upsert(Record{ChunkID: "a", Embedding: []float64{1, 0, 0, 0}}); err != nil || empty.Len() != 1 {
+		t.Fatalf("Upsert after a rejected first batch = %v, Len %d", err, empty.Len())
+	}
+}
+
+func TestHNSWStoreDeleteAndRebuild(t *testing.T) {
+	records := randomRecords(100, 8, 3)
+	store := NewHNSWStore(HNSWConfig{})
+	if err := store.Upsert(records...); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	if err := store.Delete("chunk_0", "chunk_1", "missing"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if store.Len() != 98 || store.deleted != 2 || len(store.nodes) != 100 {
+		t.Fatalf("after delete: Len %d, deleted %d, nodes %d", store.Len(), store.deleted, len(store.nodes))
+	}
+	results, _ := store.Search(records[0].Embedding, 5, -1, Filter{})
+	for _, result := range results {
+		if result.ChunkID == "chunk_0" || result.ChunkID == "chunk_1" {
+			t.Fatalf("Search returned deleted chunk %s", result.ChunkID)
+		}
+	}
+
+	// The graph is rebuilt once deleted nodes are as many as the live ones
+	var chunkIDs []string
+	for _, record := range records[2:49] {
+		chunkIDs = append(chunkIDs, record.ChunkID)
+	}
+	store.Delete(chunkIDs...)
+	if store.deleted != 49 || len(store.nodes) != 100 {
+		t.Fatalf("rebuilt too early: deleted %d, nodes %d", store.deleted, len(store.nodes))
+	}
+	store.Delete("chunk_49")
+	if store.deleted != 0 || len(store.nodes) != 50 || store.Len() != 50 {
+		t.Fatalf("after rebuild: deleted %d, nodes %d, Len %d", store.deleted, len(store.nodes), store.Len())
+	}
+	results, err := store.Search(records[99].Embedding, 1, 0.5, Filter{})
+	if err != nil || len(results) != 1 || results[0].ChunkID != "chunk_99" {
+		t.Fatalf("Search after rebuild = %+v, %v", results, err)
+	}
+
+	// An emptied store accepts another dimension
+	chunkIDs = chunkIDs[:0]
+	for _, record := range records[50:] {
+		chunkIDs = append(chunkIDs, record.ChunkID)
+	}
+	store.Delete(chunkIDs...)
+	if store.Len() != 0 {
+		t.Fatalf("Len = %d, want 0", store.Len())
+	}
+	if results, err := store.Search(records[0].Embedding, 5, 0, Filter{}); err != nil || results != nil {
+		t.Fatalf("Search of an empty store = %+v, %v", results, err)
+	}
+	if err := store.Upsert(Record{ChunkID: "new", Embedding: []float64{1, 0}}); err != nil {
+		t.Fatalf("Upsert of a new dimension: %v", err)
+	}
+}
+
+func TestHNSWStoreFilteredSearch(t *testing.T) {
+	records := randomRecords(500, 8, 4)
+	// Two chunks of a rare document, far from the query so the graph search misses them
+	query := records[0].Embedding
+	for i, chunkID := range []string{"rare_0", "rare_1"} {
+		embedding := make([]float64, len(query))
+		for j := range embedding {
+			embedding[j] = -query[j]
+		}
+		embedding[i] += 0.5
+		records = append(records, Record{ChunkID: chunkID, DocID: "rare", Tags: []string{"rare"}, Embedding: embedding})
+	}
+	store := NewHNSWStore(HNSWConfig{M: 4, EfConstruction: 20, EfSearch: 4})
+	if err := store.Upsert(records...); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	for _, filter := range []Filter{{DocIDs: []string{"rare"}}, {Tags: []string{"rare"}}} {
+		results, err := store.Search(query, 5, -1, filter)
+		if err != nil {
+			t.Fatalf("Search: %v", err)
+		}
+		if len(results) != 2 {
+			t.Fatalf("Search with %+v = %+v, want the 2 rare chunks", filter, results)
+		}
+		if results[0].Score < results[1].Score {
+			t.Fatalf("results not sorted by score: %+v", results)
+		}
+	}
+
+	// The threshold applies to the exact scan too
+	if results, _ := store.Search(query, 5, 0, Filter{DocIDs: []string{"rare"}}); len(results) != 0 {
+		t.Fatalf("Search with threshold 0 = %+v, want no result", results)
+	}
+	if _, err := store.Search([]float64{1, 0}, 5, 0, Filter{}); err == nil {
+		t.Fatal("Search with a wrong query dimension succeeded")
+	}
+}
@@ -0,0 +1,252 @@
+package vectorstore
+
+import (
+	"crossplatform_chatbot/database"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm/clause"
+)
+
+// PGVectorStore is a VectorStore backed by the documents table, using a pgvector column
+// and cosine distance ordering (<=>) in SQL.
+type PGVectorStore struct {
+	db         database.Database
+	dimensions int
+}
+
+// NewPGVectorStore creates a pgvector store for embeddings of the given dimensions (e.g. 1536 for text-embedding-ada-002)
+func NewPGVectorStore(db database.Database, dimensions int) *PGVectorStore {
+	return &PGVectorStore{
+		db:         db,
+		dimensions: dimensions,
+	}
+}
+
+// Migrate enables the pgvector extension, adds the vector column to the documents table,
+// converts the existing float8[] embeddings and creates the cosine HNSW index.
+// Embeddings of another dimension, e.g. made with a previous model, are not converted and never searched.
+func (s *PGVectorStore) Migrate() error {
+	statements := []string{
+		`CREATE EXTENSION IF NOT EXISTS vector`,
+		fmt.Sprintf(`ALTER TABLE documents ADD COLUMN IF NOT EXISTS embedding_vector vector(%d)`, s.dimensions),
+		fmt.Sprintf(`UPDATE documents SET embedding_vector = embedding::vector
+			WHERE embedding_vector IS NULL AND embedding IS NOT NULL AND array_length(embedding, 1) = %d`, s.dimensions),
+		`CREATE INDEX IF NOT EXISTS documents_embedding_vector_idx ON documents USING hnsw (embedding_vector vector_cosine_ops)`,
+	}
+
+	for _, statement := range statements {
+		if err := s.db.GetDB().Exec(statement).Error; err != nil {
+			return fmt.Errorf("error running pgvector migration %q: %w", statement, err)
+		}
+	}
+
+	var skipped int64
+	err := s.db.GetDB().Table("documents").
+		Where("deleted_at IS NULL AND embedding_vector IS NULL AND embedding IS NOT NULL").
+		Count(&skipped).Error
+	if err != nil {
+		return fmt.Errorf("error counting unconverted embeddings: %w", err)
+	}
+	if skipped > 0 {
+		fmt.Printf("Skipping %d chunks: embedding dimension differs from %d\n", skipped, s.dimensions)
+	}
+	return nil
+}
+
+// Len returns the number of chunks with a stored vector
+func (s *PGVectorStore) Len() int {
+	var count int64
+	err := s.db.GetDB().Table("documents").
+		Where("deleted_at IS NULL AND embedding_vector IS NOT NULL").
+		Count(&count).Error
+	if err != nil {
+		fmt.Printf("Error counting vectors: %v\n", err)
+		return 0
+	}
+	return int(count)
+}
+
+// Upsert stores the vectors of the records, inserting a document row for chunks not in the table yet
+func (s *PGVectorStore) Upsert(records ...Record) error {
+	for _, record := range records {
+		if len(record.Embedding) != s.dimensions {
+			return fmt.Errorf("error: embedding of chunk %s has dimension %d, expected %d", record.ChunkID, len(record.Embedding), s.dimensions)
+		}
+		vector := vectorLiteral(record.Embedding)
+
+		result := s.db.GetDB().Exec(
+			`UPDATE documents SET embedding_vector = ?::vector, updated_at = ? WHERE chunk_id = ? AND deleted_at IS NULL`,
+			vector, time.Now(), record.ChunkID)
+		if result.Error != nil {
+			return fmt.Errorf("error updating vector for chunk %s: %w", record.ChunkID, result.Error)
+		}
+		if result.RowsAffected > 0 {
+			continue
+		}
+
+		err := s.db.GetDB().Exec(
+			`INSERT INTO documents (filename, doc_id, chunk_id, doc_text, embedding, embedding_vector, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?::float8[], ?::vector, ?, ?)`,
+			record.Filename, record.DocID, record.ChunkID, record.Text, strings.NewReplacer("[", "{", "]", "}").Replace(vector), vector, time.Now(), time.Now()).Error
+		if err != nil {
+			return fmt.Errorf("error inserting chunk %s: %w", record.ChunkID, err)
+		}
+	}
+	return nil
+}
+
+// Delete soft deletes the chunks with the given IDs
+func (s *PGVectorStore) Delete(chunkIDs ...string) error {
+	if len(chunkIDs) == 0 {
+		return nil
+	}
+	err := s.db.GetDB().Exec(
+		`UPDATE documents SET deleted_at = ? WHERE chunk_id IN ? AND deleted_at IS NULL`,
+		time.Now(), chunkIDs).Error
+	if err != nil {
+		return fmt.Errorf("error deleting chunks: %w", err)
+	}
+	return nil
+}
+
+// Get returns the stored chunks with the given IDs
+func (s *PGVectorStore) Get(chunkIDs ...string) ([]Record, error) {
+	if len(chunkIDs) == 0 {
+		return nil, nil
+	}
+
+	var rows []pgVectorRow
+	err := s.db.GetDB().Table("documents").
+		Select("chunk_id, doc_id, filename, doc_text, tags, metadata::text AS metadata, embedding_vector::text AS embedding").
+		Where("deleted_at IS NULL AND embedding_vector IS NOT NULL AND chunk_id IN ?", chunkIDs).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving chunks: %w", err)
+	}
+
+	records := make([]Record, 0, len(rows))
+	for _, row := range rows {
+		result, err := row.toResult()
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, result.Record)
+	}
+	return records, nil
+}
+
+// Search orders the chunks by cosine distance in SQL and returns up to topK rows with a similarity of at least threshold
+func (s *PGVectorStore) Search(query []float64, topK int, threshold float64, filter Filter) ([]Result, error) {
+	if topK <= 0 {
+		return nil, nil
+	}
+	if len(query) != s.dimensions {
+		return nil, fmt.Errorf("error: query has dimension %d, expected %d", len(query), s.dimensions)
+	}
+	vector := vectorLiteral(query)
+
+	var rows []pgVectorRow
+
+	db := s.db.GetDB().Table("documents").
+		Select("chunk_id, doc_id, filename, doc_text, tags, metadata::text AS metadata, embedding_vector::text AS embedding, 1 - (embedding_vector <=> ?::vector) AS score", vector).
+		Where("deleted_at IS NULL AND embedding_vector IS NOT NULL").
+		Where("1 - (embedding_vector <=> ?::vector) >= ?", vector, threshold)
+	if len(filter.DocIDs) > 0 {
+		db = db.Where("doc_id IN ?", filter.DocIDs)
+	}
+	if len(filter.Tags) > 0 {
+		db = db.Where("tags && ?::text[]", pq.Array(filter.Tags))
+	}
+	if filter.Where != nil {
+		condition, args := filter.Where.SQL()
+		db = db.Where(condition, args...)
+	}
+
+	err := db.Order(clause.OrderBy{Expression: clause.Expr{SQL: "embedding_vector <=> ?::vector", Vars: []interface{}{vector}}}).
+		Limit(topK).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("error searching vectors: %w", err)
+	}
+
+	results := make([]Result, 0, len(rows))
+	for _, row := range rows {
+		result, err := row.toResult()
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// pgVectorRow is a documents row selected with its vector in text format
+type pgVectorRow struct {
+	ChunkID   string
+	DocID     string
+	Filename  string
+	DocText   string
+	Tags      pq.StringArray
+	Metadata  *string // JSON object, null for chunks stored before chunk metadata
+	Embedding string
+	Score     float64
+}
+
+// toResult converts the row into a search result
+func (row pgVectorRow) toResult() (Result, error) {
+	embedding, err := parseVectorLiteral(row.Embedding)
+	if err != nil {
+		return Result{}, fmt.Errorf("error parsing vector for chunk %s: %w", row.ChunkID, err)
+	}
+	var metadata map[string]string
+	if row.Metadata != nil {
+		if err := json.Unmarshal([]byte(*row.Metadata), &metadata); err != nil {
+			return Result{}, fmt.Errorf("error parsing metadata for chunk %s: %w", row.ChunkID, err)
+		}
+	}
+	return Result{
+		Record: Record{
+			ChunkID:   row.ChunkID,
+			DocID:     row.DocID,
+			Filename:  row.Filename,
+			Text:      row.DocText,
+			Embedding: embedding,
+			Tags:      row.Tags,
+			Metadata:  metadata,
+		},
+		Score: row.Score,
+	}, nil
+}
+
+// vectorLiteral formats the embedding in the pgvector text format ([1,2,3]) without losing precision
+func vectorLiteral(embedding []float64) string {
+	var result strings.Builder
+	result.WriteString("[")
+	for i, value := range embedding {
+		if i > 0 {
+			result.WriteString(",")
+		}
+		result.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	}
+	result.WriteString("]")
+	return result.String()
+}
+
+// parseVectorLiteral parses the pgvector text format back into a float slice
+func parseVectorLiteral(literal string) ([]float64, error) {
+	parts := strings.Split(strings.Trim(literal, "[]"), ",")
+	embedding := make([]float64, len(parts))
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, err
+		}
+		embedding[i] = value
+	}
+	return embedding, nil
+}
@@ -0,0 +1,200 @@
+package vectorstore
+
+import (
+	"crossplatform_chatbot/models"
+	"os"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// testDatabase implements database.Database over an open connection
+type testDatabase struct {
+	db *gorm.DB
+}
+
+func (t *testDatabase) Init() error     { return nil }
+func (t *testDatabase) GetDB() *gorm.DB { return t.db }
+
+// newTestPGVectorStore connects to the Postgres of PGVECTOR_TEST_DATABASE_URL, which needs the pgvector
+// extension available, and creates the documents table in a schema dropped at the end of the test
+func newTestPGVectorStore(t *testing.T, dimensions int) *PGVectorStore {
+	t.Helper()
+	dsn := os.Getenv("PGVECTOR_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("PGVECTOR_TEST_DATABASE_URL not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("error connecting to database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("error getting connection: %v", err)
+	}
+	// A single connection keeps the search path of the test schema
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		db.Exec(`DROP SCHEMA IF EXISTS pgvector_test CASCADE`)
+		sqlDB.Close()
+	})
+
+	for _, statement := range []string{
+		`CREATE EXTENSION IF NOT EXISTS vector`,
+		`DROP SCHEMA IF EXISTS pgvector_test CASCADE`,
+		`CREATE SCHEMA pgvector_test`,
+		`SET search_path TO pgvector_test, public`,
+	} {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatalf("error running %q: %v", statement, err)
+		}
+	}
+	if err := db.AutoMigrate(&models.Document{}); err != nil {
+		t.Fatalf("error migrating documents: %v", err)
+	}
+
+	store := NewPGVectorStore(&testDatabase{db: db}, dimensions)
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return store
+}
+
+func TestPGVectorStoreMigrateConvertsEmbeddings(t *testing.T) {
+	store := newTestPGVectorStore(t, 3)
+	db := store.db.GetDB()
+
+	// Chunks stored before the vector column, with their float8[] embedding only. The second one
+	// was embedded with another model and is left out instead of failing the migration.
+	err := db.Exec(`INSERT INTO documents (filename, doc_id, chunk_id, doc_text, embedding, created_at, updated_at)
+		VALUES ('old.txt', 'old', 'old_0', 'old chunk', '{1,0,0}', now(), now()),
+		       ('older.txt', 'older', 'older_0', 'older chunk', '{1,0}', now(), now())`).Error
+	if err != nil {
+		t.Fatalf("error inserting chunks: %v", err)
+	}
+	if got := store.Len(); got != 0 {
+		t.Fatalf("Len before migration = %d, want 0", got)
+	}
+
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("second Migrate: %v", err)
+	}
+	if got := store.Len(); got != 1 {
+		t.Fatalf("Len after migration = %d, want 1", got)
+	}
+	records, err := store.Get("old_0")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if len(records) != 1 || records[0].Embedding[0] != 1 {
+		t.Fatalf("Get = %+v, want the converted embedding", records)
+	}
+	if skipped, err := store.Get("older_0"); err != nil || len(skipped) != 0 {
+		t.Fatalf("Get of the other dimension = %+v, %v; want no vector", skipped, err)
+	}
+}
+
+func TestPGVectorStoreUpsertDelete(t *testing.T) {
+	store := newTestPGVectorStore(t, 3)
+
+	records := []Record{
+		{ChunkID: "a_0", DocID: "a", Filename: "a.txt", Text: "first", Embedding: []float64{1, 0, 0}},
+		{ChunkID: "a_1", DocID: "a", Filename: "a.txt", Text: "second", Embedding: []float64{0, 1, 0}},
+	}
+	if err := store.Upsert(records...); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if got := store.Len(); got != 2 {
+		t.Fatalf("Len = %d, want 2", got)
+	}
+
+	// Upserting an existing chunk updates its vector instead of inserting a row
+	if err := store.Upsert(Record{ChunkID: "a_0", DocID: "a", Filename: "a.txt", Text: "first", Embedding: []float64{0, 0, 1}}); err != nil {
+		t.Fatalf("Upsert existing: %v", err)
+	}
+	if got := store.Len(); got != 2 {
+		t.Fatalf("Len after update = %d, want 2", got)
+	}
+	updated, err := store.Get("a_0")
+	if err != nil || len(updated) != 1 || updated[0].Embedding[2] != 1 {
+		t.Fatalf("Get updated = %+v, %v", updated, err)
+	}
+
+	if err := store.Upsert(Record{ChunkID: "b_0", Embedding: []float64{1, 0}}); err == nil {
+		t.Fatal("Upsert with a wrong dimension succeeded")
+	}
+
+	if err := store.Delete("a_1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if got := store.Len(); got != 1 {
+		t.Fatalf("Len after delete = %d, want 1", got)
+	}
+	if deleted, err := store.Get("a_1"); err != nil || len(deleted) != 0 {
+		t.Fatalf("Get deleted = %+v, %v", deleted, err)
+	}
+}
+
+func TestPGVectorStoreSearchFilters(t *testing.T) {
+	store := newTestPGVectorStore(t, 3)
+	db := store.db.GetDB()
+
+	chunks := []models.Document{
+		{Filename: "router.pdf", DocID: "router", ChunkID: "router_0", DocText: "router setup", Embedding: "{1,0,0}",
+			Tags: []string{"installation"}, Metadata: map[string]string{"product": "router", "version": "2"}},
+		{Filename: "router.pdf", DocID: "router", ChunkID: "router_1", DocText: "router reset", Embedding: "{0.9,0.1,0}",
+			Tags: []string{"troubleshooting"}, Metadata: map[string]string{"product": "router", "version": "1"}},
+		{Filename: "modem.pdf", DocID: "modem", ChunkID: "modem_0", DocText: "modem setup", Embedding: "{0.8,0.2,0}",
+			Tags: []string{"installation"}, Metadata: map[string]string{"product": "modem"}},
+		{Filename: "far.pdf", DocID: "far", ChunkID: "far_0", DocText: "unrelated", Embedding: "{0,0,1}"},
+	}
+	if err := db.Create(&chunks).Error; err != nil {
+		t.Fatalf("error inserting chunks: %v", err)
+	}
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	where, err := ParseFilter("product = router AND version >= 2")
+	if err != nil {
+		t.Fatalf("ParseFilter: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"no filter", Filter{}, []string{"router_0", "router_1", "modem_0"}},
+		{"doc IDs", Filter{DocIDs: []string{"modem"}}, []string{"modem_0"}},
+		{"tags", Filter{Tags: []string{"installation"}}, []string{"router_0", "modem_0"}},
+		{"expression", Filter{Where: where}, []string{"router_0"}},
+		{"tags and doc IDs", Filter{DocIDs: []string{"router"}, Tags: []string{"troubleshooting"}}, []string{"router_1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := store.Search([]float64{1, 0, 0}, 10, 0.5, tt.filter)
+			if err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+			got := make([]string, len(results))
+			for i, result := range results {
+				got[i] = result.ChunkID
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Search = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Search = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	if _, err := store.Search([]float64{1, 0}, 10, 0, Filter{}); err == nil {
+		t.Fatal("Search with a wrong query dimension succeeded")
+	}
+}
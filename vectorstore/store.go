@@ -0,0 +1,76 @@
+package vectorstore
+
+import "slices"
+
+// Record is a document chunk stored in the vector store
+type Record struct {
+	ChunkID   string
+	DocID     string
+	Filename  string
+	Text      string
+	Embedding []float64
+
+	Tags     []string          // Tags of the chunk
+	Metadata map[string]string // Metadata of the chunk, e.g. product, version, language, source_url, section
+}
+
+// Result is a record returned by a similarity search with its cosine similarity to the query
+type Result struct {
+	Record
+	Score float64
+}
+
+// Filter restricts a search to matching records, an empty filter matches everything
+type Filter struct {
+	DocIDs []string    // Only return chunks belonging to these documents
+	Tags   []string    // Only return chunks having any of these tags
+	Where  *Expression // Only return chunks matching the expression (ParseFilter)
+}
+
+// IsEmpty reports whether the filter has no conditions
+func (f Filter) IsEmpty() bool {
+	return len(f.DocIDs) == 0 && len(f.Tags) == 0 && f.Where == nil
+}
+
+// Match reports whether the record satisfies the filter
+func (f Filter) Match(record Record) bool {
+	if len(f.DocIDs) > 0 {
+		found := false
+		for _, docID := range f.DocIDs {
+			if record.DocID == docID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.Tags) > 0 {
+		found := false
+		for _, tag := range record.Tags {
+			if slices.Contains(f.Tags, tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return f.Where.Match(record)
+}
+
+// VectorStore defines the storage and similarity search of document chunk embeddings
+type VectorStore interface {
+	// Upsert inserts the records, replacing any existing record with the same chunk ID
+	Upsert(records ...Record) error
+	// Delete removes the records with the given chunk IDs, unknown IDs are ignored
+	Delete(chunkIDs ...string) error
+	// Get returns the stored records with the given chunk IDs, unknown IDs are skipped
+	Get(chunkIDs ...string) ([]Record, error)
+	// Search returns up to topK records with a cosine similarity of at least threshold, best match first
+	Search(query []float64, topK int, threshold float64, filter Filter) ([]Result, error)
+	// Len returns the number of stored records
+	Len() int
+}